@@ -0,0 +1,43 @@
+package main
+
+import (
+	"baidusync/internal/config"
+	"baidusync/internal/database"
+	"fmt"
+	"log/slog"
+)
+
+// cmdRestoreDB 用备份恢复状态数据库
+// 不带参数时列出所有可用备份；参数为 "latest" 时使用最新的备份
+func cmdRestoreDB(cfg *config.Config, args []string) error {
+	backups, err := database.ListBackups(cfg.System.BackupDir, cfg.System.DBPath)
+	if err != nil {
+		return fmt.Errorf("读取备份目录失败: %w", err)
+	}
+
+	if len(args) == 0 {
+		if len(backups) == 0 {
+			fmt.Println("没有找到任何备份:", cfg.System.BackupDir)
+			return nil
+		}
+		fmt.Println("可用的数据库备份 (从旧到新):")
+		for _, b := range backups {
+			fmt.Println("  " + b)
+		}
+		return nil
+	}
+
+	target := args[0]
+	if target == "latest" {
+		if len(backups) == 0 {
+			return fmt.Errorf("没有找到任何备份: %s", cfg.System.BackupDir)
+		}
+		target = backups[len(backups)-1]
+	}
+
+	if err := database.RestoreBackup(target, cfg.System.DBPath); err != nil {
+		return err
+	}
+	slog.Info("数据库已恢复", "from", target, "db", cfg.System.DBPath)
+	return nil
+}
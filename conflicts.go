@@ -0,0 +1,114 @@
+package main
+
+import (
+	"baidusync/internal/config"
+	"baidusync/internal/database"
+	"baidusync/pkg/baidusync"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// conflictPath 一个路径的冲突历史 (按时间从早到晚)
+type conflictPath struct {
+	Path    string                   `json:"path"`
+	Count   int                      `json:"count"`
+	History []database.ConflictEntry `json:"history"`
+}
+
+// profileConflicts 单个 Profile 的冲突历史
+type profileConflicts struct {
+	Profile string         `json:"profile"`
+	Paths   []conflictPath `json:"paths"`
+}
+
+// cmdConflicts 列出最近处理过的冲突，用于排查反复冲突 (两侧来回覆盖) 的文件
+// 最近发生冲突的路径排在前面；指定路径时只列出该路径
+func cmdConflicts(cfg *config.Config, args []string) error {
+	fset := flag.NewFlagSet("conflicts", flag.ExitOnError)
+	asJSON := fset.Bool("json", false, "以 JSON 格式输出")
+	only := fset.String("profile", "", "只列出指定 Profile 的冲突")
+	limit := fset.Int("n", 5, "每个路径最多显示最近的几条记录")
+	fset.Parse(args)
+
+	if fset.NArg() > 1 {
+		return fmt.Errorf("用法: baidusync conflicts [--json] [-profile 名称] [-n 条数] [路径]")
+	}
+	var target string
+	if fset.NArg() == 1 {
+		target = strings.TrimPrefix(path.Clean("/"+fset.Arg(0)), "/")
+	}
+
+	app, err := baidusync.NewWithOptions(cfg, baidusync.Options{Profile: *only})
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	var reports []profileConflicts
+	for _, r := range app.Profiles() {
+		stateDB, err := app.DB().Profile(r.Name())
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", r.Name(), err)
+		}
+		report := profileConflicts{Profile: r.Name()}
+		err = stateDB.ForEachConflict(func(relPath string, history []database.ConflictEntry) error {
+			if target != "" && relPath != target {
+				return nil
+			}
+			count := len(history)
+			if *limit > 0 && len(history) > *limit {
+				history = history[len(history)-*limit:]
+			}
+			report.Paths = append(report.Paths, conflictPath{Path: relPath, Count: count, History: history})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("profile %s: 读取冲突历史失败: %w", r.Name(), err)
+		}
+		sort.Slice(report.Paths, func(i, j int) bool {
+			return lastConflict(report.Paths[i]) > lastConflict(report.Paths[j])
+		})
+		reports = append(reports, report)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+
+	for _, report := range reports {
+		fmt.Printf("[%s] %d 个路径有冲突记录\n", report.Profile, len(report.Paths))
+		for _, p := range report.Paths {
+			fmt.Printf("  %s (共 %d 次)\n", p.Path, p.Count)
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "    时间\t策略\t保留\t本地大小\t云端大小\t副本 / 错误")
+			for i := len(p.History) - 1; i >= 0; i-- {
+				c := p.History[i]
+				note := c.Copy
+				if c.Error != "" {
+					note = "失败: " + c.Error
+				}
+				fmt.Fprintf(tw, "    %s\t%s\t%s\t%d\t%d\t%s\n",
+					c.TimeAsTime().Format(time.DateTime), c.Strategy, c.Winner, c.LocalSize, c.RemoteSize, note)
+			}
+			tw.Flush()
+		}
+	}
+	return nil
+}
+
+// lastConflict 路径最近一次冲突的时间 (Unix Nano)
+func lastConflict(p conflictPath) int64 {
+	if len(p.History) == 0 {
+		return 0
+	}
+	return p.History[len(p.History)-1].Time
+}
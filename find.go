@@ -0,0 +1,124 @@
+package main
+
+import (
+	"baidusync/internal/config"
+	"baidusync/internal/database"
+	"baidusync/internal/fs/baidu"
+	"baidusync/pkg/baidusync"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// findResult find 命令的一条结果 (路径为明文相对路径)
+type findResult struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	IsDir   bool      `json:"is_dir"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// profileFind 单个 Profile 的查找结果
+type profileFind struct {
+	Profile string `json:"profile"`
+	// Source 结果来源: remote (网盘的搜索接口) 或 records (本地的同步记录)
+	Source  string       `json:"source"`
+	Results []findResult `json:"results"`
+}
+
+// cmdFind 按文件名查找同步目录中的文件 (文件名包含关键字，不区分大小写)
+// 默认使用百度网盘的搜索接口，结果中的路径会被解密；网盘只能按云端保存的文件名匹配，
+// 因此开启文件名加密 (或云端不是百度网盘) 时改为搜索本地的同步记录，只能找到已经同步过的文件
+func cmdFind(cfg *config.Config, args []string) error {
+	fset := flag.NewFlagSet("find", flag.ExitOnError)
+	asJSON := fset.Bool("json", false, "以 JSON 格式输出")
+	only := fset.String("profile", "", "只在指定的 Profile 中查找")
+	records := fset.Bool("records", false, "搜索本地的同步记录而不是网盘 (开启文件名加密时总是如此)")
+	fset.Parse(args)
+
+	if fset.NArg() != 1 || fset.Arg(0) == "" {
+		return fmt.Errorf("用法: baidusync find [--json] [-profile 名称] [-records] <关键字>")
+	}
+	keyword := fset.Arg(0)
+
+	app, err := baidusync.NewWithOptions(cfg, baidusync.Options{Profile: *only})
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	var reports []profileFind
+	for _, r := range app.Profiles() {
+		report := profileFind{Profile: r.Name()}
+		adapter, ok := r.Remote().(*baidu.Adapter)
+		encryptedNames := r.Config().Crypto.Enable && r.Config().Crypto.EncryptFilenames
+		if ok && !encryptedNames && !*records {
+			report.Source = "remote"
+			entries, err := adapter.Search(keyword)
+			if err != nil {
+				return fmt.Errorf("profile %s: 搜索失败: %w", r.Name(), err)
+			}
+			for _, e := range entries {
+				report.Results = append(report.Results, findResult{Path: e.RelPath, Size: e.Size, IsDir: e.IsDir, ModTime: e.ModTime})
+			}
+		} else {
+			report.Source = "records"
+			stateDB, err := app.DB().Profile(r.Name())
+			if err != nil {
+				return fmt.Errorf("profile %s: %w", r.Name(), err)
+			}
+			if report.Results, err = findRecords(stateDB, keyword); err != nil {
+				return fmt.Errorf("profile %s: 读取同步记录失败: %w", r.Name(), err)
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+
+	for _, report := range reports {
+		source := "网盘"
+		if report.Source == "records" {
+			source = "同步记录"
+		}
+		fmt.Printf("[%s] 在%s中找到 %d 项\n", report.Profile, source, len(report.Results))
+		if len(report.Results) == 0 {
+			continue
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  修改时间\t大小\t路径")
+		for _, f := range report.Results {
+			p := f.Path
+			if f.IsDir {
+				p += "/"
+			}
+			fmt.Fprintf(tw, "  %s\t%d\t%s\n", f.ModTime.Format(time.DateTime), f.Size, p)
+		}
+		tw.Flush()
+	}
+	return nil
+}
+
+// findRecords 在同步记录中查找文件名包含 keyword 的路径 (大小为明文大小)
+func findRecords(stateDB *database.DB, keyword string) ([]findResult, error) {
+	keyword = strings.ToLower(keyword)
+	var results []findResult
+	err := stateDB.ForEach(func(s *database.FileState) error {
+		if strings.Contains(strings.ToLower(path.Base(s.RelPath)), keyword) {
+			results = append(results, findResult{Path: s.RelPath, Size: s.FileSize, IsDir: s.IsDir, ModTime: s.ModTimeAsTime()})
+		}
+		return nil
+	})
+	sort.Slice(results, func(i, j int) bool { return results[i].Path < results[j].Path })
+	return results, err
+}
@@ -3,34 +3,214 @@ package config
 import (
 	"crypto/sha256"
 	"fmt"
+	"log/slog"
 	"os"
+	"path"
+	"strings"
 	"time"
 
+	"github.com/robfig/cron/v3"
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultProfileName 单配置 (旧格式) 对应的 Profile 名称
+const DefaultProfileName = "default"
+
 // Config 对应 config.yaml 的根结构
 type Config struct {
 	Sync   SyncConfig   `yaml:"sync"`
+	Local  LocalConfig  `yaml:"local"`
+	Remote RemoteConfig `yaml:"remote"`
 	Baidu  BaiduConfig  `yaml:"baidu"`
 	Crypto CryptoConfig `yaml:"crypto"`
 	System SystemConfig `yaml:"system"`
+	// 多组同步任务；为空时由 sync + crypto 生成一个名为 "default" 的 Profile
+	Profiles []ProfileConfig `yaml:"profiles"`
+}
+
+// ProfileConfig 一组独立的同步任务 (本地目录 <-> 云端目录)
+// 同步相关字段与 sync 节完全相同，直接平铺在 Profile 下
+type ProfileConfig struct {
+	Name       string `yaml:"name"`
+	SyncConfig `yaml:",inline"`
+	// 为空时沿用全局 crypto 配置
+	Crypto *CryptoConfig `yaml:"crypto"`
 }
 
 // SyncConfig 同步相关配置
 type SyncConfig struct {
-	LocalDir      string `yaml:"local_dir"`
-	RemoteDir     string `yaml:"remote_dir"`
-	Interval      string `yaml:"interval"`
-	MaxConcurrent int    `yaml:"max_concurrent"`
+	LocalDir  string `yaml:"local_dir"`
+	RemoteDir string `yaml:"remote_dir"`
+	Interval  string `yaml:"interval"`
+	// Schedule cron 表达式 (例如 "0 2 * * *" 每天凌晨 2 点、"0 9-18 * * 1-5" 工作日白天每小时)
+	// 设置后代替 interval 决定同步时间
+	Schedule string `yaml:"schedule"`
+	// 每次同步时间额外推迟 0 ~ interval_jitter 的随机时长 (例如 "30s")，
+	// 用于错开多个 Profile 或多个实例的请求，默认不推迟
+	IntervalJitter string `yaml:"interval_jitter"`
+	// 启动时立即同步一轮，默认 true；为 false 时等到第一个 interval 之后再同步 (设置 schedule 时启动时总是不同步)
+	RunOnStart    *bool `yaml:"run_on_start"`
+	MaxConcurrent int   `yaml:"max_concurrent"`
+	// 按操作类型限制并发 (0 表示不单独限制)，都在 max_concurrent 之内生效
+	MaxUploads   int `yaml:"max_uploads"`
+	MaxDownloads int `yaml:"max_downloads"`
+	MaxDeletes   int `yaml:"max_deletes"`
+	// 自适应并发: 以 max_concurrent 为初始值，根据限流与吞吐量在 min ~ max 之间自动调整
+	AdaptiveConcurrency AdaptiveConfig `yaml:"adaptive_concurrency"`
 	// rename_local (默认): 重命名本地文件
 	// rename_remote: 重命名云端文件
 	// keep_latest: 保留时间最新的文件
 	// delete_remote: 删除云端文件 (强制以本地为准)
 	// delete_local: 删除本地文件 (强制以云端为准)
+	// keep_both: 保留两个版本 (本地版本改名为 .conflict-<时间> 后作为新文件上传)
 	ConflictStrategy string `yaml:"conflict_strategy"`
+	// 按路径覆盖冲突策略，按顺序匹配，第一条匹配的规则生效
+	ConflictRules []ConflictRule `yaml:"conflict_rules"`
+	// rename_local / rename_remote 策略的新文件名模板 (默认 "{name}{ext}.{side}")
+	// 占位符: {name} 不含扩展名的文件名、{ext} 扩展名、{side} local 或 remote、{timestamp} 冲突发生的时间
+	// 新文件名已存在时自动追加序号
+	ConflictName string `yaml:"conflict_name"`
+	// 清理孤立记录: 数据库中有记录、但本地和云端都已不存在的路径，
+	// 超过该时长未同步过时从数据库中删除 (为空表示不清理)
+	PruneOrphansAfter string `yaml:"prune_orphans_after"`
+	// 任务失败后的处理方式:
+	// continue (默认): 记录错误并继续执行其他任务
+	// abort: 第一个不可重试的错误 (超时、限流以外的错误) 就中止本轮同步
+	// 认证失败、空间不足在两种方式下都会中止本轮同步
+	OnError string `yaml:"on_error"`
+	// 没有同步记录 (首次同步或数据库丢失)、两侧同名文件大小不一致时以哪一侧为准:
+	// conflict (默认): 按 conflict_strategy 处理; local: 上传覆盖云端; remote: 下载覆盖本地; newer: 保留修改时间较新的一侧
+	FirstRunBias string `yaml:"first_run_bias"`
+	// 同一路径在一侧是文件、另一侧是目录时的处理方式:
+	// skip (默认): 跳过并在日志与 status 中报告; rename_local: 本地一侧改名，原路径采用云端的内容;
+	// rename_remote: 云端一侧改名，原路径采用本地的内容 (改名使用 conflict_name 模板)
+	TypeClash string `yaml:"type_clash"`
+	// 单个文件的传输超时 (为空时按文件大小自动计算: 5 分钟 + 每 64KB 1 秒)
+	FileTimeout string `yaml:"file_timeout"`
+	// 下载中途断开后从断点重新连接的次数 (默认 3)
+	DownloadRetries int `yaml:"download_retries"`
+	// 一轮同步的最长时间，超时后取消剩余任务，下一轮继续 (为空表示不限制)
+	CycleTimeout string `yaml:"cycle_timeout"`
+	// 比对两侧路径时忽略大小写 / 统一 Unicode 规范化形式 (NFC)
+	// 用于 macOS、Windows 等大小写不敏感或会改写文件名编码的本地文件系统
+	NormalizeCase    bool `yaml:"normalize_case"`
+	NormalizeUnicode bool `yaml:"normalize_unicode"`
+	// 删除云端文件后，自动删除因此变空、且本地没有对应目录的云端目录 (默认关闭，只在日志中报告)
+	PruneEmptyDirs bool `yaml:"prune_empty_dirs"`
+	// 传输限速 (每秒字节数，例如 "2MB"，为空或 "0" 表示不限速)，本 Profile 的上传与下载共享
+	BandwidthLimit string `yaml:"bandwidth_limit"`
+	// 按一天中的时间段覆盖 bandwidth_limit，按顺序匹配第一个包含当前时间的时间段
+	BandwidthSchedule []BandwidthWindow `yaml:"bandwidth_schedule"`
+	// 跳过超过该大小的文件 (明文大小，例如 "500MB"、"2GB"，为空表示不限制)
+	MaxFileSize string `yaml:"max_file_size"`
+	// 是否同步隐藏文件 (以 "." 开头的文件与目录，例如 .git)，默认 true
+	// 为 false 时本地与云端扫描都会跳过隐藏文件，隐藏目录连同其中的内容一起跳过
+	IncludeHidden *bool `yaml:"include_hidden"`
+	// 上传时记录本地文件的权限位 (例如可执行位)，下载时恢复，默认关闭
+	// 网盘本身不保存权限，只能恢复本机数据库中记录过的权限；Windows 上不生效
+	PreserveMode bool `yaml:"preserve_mode"`
+	// 本地文件 Hash 算法: md5 (默认) 或 sha256，用于记录与比对本地文件内容
+	// 云端仍使用百度网盘提供的 MD5；切换后旧的本地 Hash 记录失效，文件下次同步前只按大小与修改时间比对
+	HashAlgorithm string `yaml:"hash_algorithm"`
+	// 扫描时有路径无法读取 (扫描不完整) 时仍然执行删除，默认 false: 本轮暂缓所有删除，只上传与下载
+	DeleteOnPartialScan bool `yaml:"delete_on_partial_scan"`
+	// 本地文件大小不变、只有修改时间 (或 inode) 变化时计算 Hash 确认内容是否真的修改，
+	// 内容一致时不上传，只更新记录中的修改时间，默认 true
+	VerifyLocalChanges *bool `yaml:"verify_local_changes"`
+	// 首次同步时云端目录 (remote_dir 及其上级) 不存在则自动创建，默认 true
+	// 为 false 时云端目录不存在直接报错，用于 remote_dir 应当已经存在、写错时不应新建的场景
+	CreateRemoteRoot *bool `yaml:"create_remote_root"`
+	// 下载时无法解密 (密钥不正确或密文损坏) 的云端文件记录为隔离，云端文件变化之前不再尝试下载，默认 false: 每轮重试
+	QuarantineUndecryptable bool `yaml:"quarantine_undecryptable"`
+	// 云端文件比本地的新 (云端修改时间晚于本地) 时不用本地文件覆盖: off (默认)、conflict (按冲突处理) 或 skip (跳过并报告)
+	// 对所有上传生效 (不只是冲突)，防止本地被回滚到旧版本后覆盖云端
+	ProtectNewerRemote string `yaml:"protect_newer_remote"`
+	// 按文件标识 (inode) 识别本地的移动与改名，在云端直接移动文件而不是重新上传，默认关闭
+	DetectMoves bool `yaml:"detect_moves"`
+	// 启动时上传一个探测文件，比较云端记录的时间与本机时间，偏差超过该值时警告 (例如 "2m"，为空表示不检查)
+	ClockSkewThreshold string `yaml:"clock_skew_threshold"`
+	// 时钟偏差超过 clock_skew_threshold 时，keep_latest 不再比较修改时间，只按大小与 Hash 裁决
+	ClockSkewHashOnly bool `yaml:"clock_skew_hash_only"`
+	// 目标一侧的同名文件在该时长内被修改过时不覆盖，推迟到下一轮 (例如 "30s"，为空表示不检查)
+	QuietPeriod string `yaml:"quiet_period"`
+	// 只同步该相对路径 (例如 "photos/2024") 下的内容，两侧的扫描、比对与删除都限定在其中，为空表示整个目录
+	// 范围之外的文件不会被上传、下载或删除；sync 命令的 -subpath 参数可以临时指定
+	Subpath string `yaml:"subpath"`
 	// 也就是解析后的 duration，不导出到 yaml
-	IntervalDuration time.Duration `yaml:"-"`
+	IntervalDuration       time.Duration `yaml:"-"`
+	CronSchedule           cron.Schedule `yaml:"-"`
+	IntervalJitterDuration time.Duration `yaml:"-"`
+	PruneOrphansDuration   time.Duration `yaml:"-"`
+	FileTimeoutDuration    time.Duration `yaml:"-"`
+	CycleTimeoutDuration   time.Duration `yaml:"-"`
+	SkipHidden             bool          `yaml:"-"` // include_hidden 为 false
+	VerifyLocal            bool          `yaml:"-"` // verify_local_changes 未设置或为 true
+	CreateRoot             bool          `yaml:"-"` // create_remote_root 未设置或为 true
+	RunAtStart             bool          `yaml:"-"` // run_on_start 未设置或为 true
+	MaxFileSizeBytes       int64         `yaml:"-"`
+	BandwidthLimitBytes    int64         `yaml:"-"`
+	ClockSkewDuration      time.Duration `yaml:"-"`
+	QuietPeriodDuration    time.Duration `yaml:"-"`
+}
+
+// 支持的云端存储后端 (remote.type)
+const (
+	RemoteTypeBaidu = "baidu" // 百度网盘 (默认)
+	RemoteTypeLocal = "local" // 本地目录 (例如挂载的网络磁盘，或用于测试)
+)
+
+// RemoteConfig 云端存储后端配置
+type RemoteConfig struct {
+	// Type 后端类型: baidu (默认) 或 local
+	// 为 local 时，remote_dir 是作为“云端”的本地目录
+	Type string `yaml:"type"`
+}
+
+// 本地一侧的存储类型 (local.type)
+const (
+	LocalTypeFolder = "folder" // 本机目录 (默认)
+	LocalTypeWebDAV = "webdav" // WebDAV 服务器上的目录，用于在两个网络存储之间同步
+)
+
+// LocalConfig 本地一侧的存储配置
+type LocalConfig struct {
+	// Type 存储类型: folder (默认) 或 webdav
+	// 为 webdav 时，local_dir 是 WebDAV 服务器上的路径 (相对于 webdav.url，以 "/" 开头)
+	Type   string       `yaml:"type"`
+	WebDAV WebDAVConfig `yaml:"webdav"`
+}
+
+// WebDAVConfig WebDAV 服务器的连接配置
+type WebDAVConfig struct {
+	// URL 服务器地址，例如 https://dav.example.com/remote.php/dav/files/me
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// ConflictRule 按路径选择冲突策略
+// pattern 为 glob，支持 "**" 匹配任意层目录；不含 "/" 时只匹配文件名，例如 "*.go"
+type ConflictRule struct {
+	Pattern  string `yaml:"pattern"`
+	Strategy string `yaml:"strategy"`
+}
+
+// BandwidthWindow 按时间段设置的限速
+type BandwidthWindow struct {
+	From  string `yaml:"from"`  // 开始时间 "HH:MM"
+	To    string `yaml:"to"`    // 结束时间 "HH:MM" (早于 from 时表示跨越零点)
+	Limit string `yaml:"limit"` // 该时间段的限速，例如 "512KB"，"0" 表示不限速
+
+	FromOffset time.Duration `yaml:"-"`
+	ToOffset   time.Duration `yaml:"-"`
+	LimitBytes int64         `yaml:"-"`
+}
+
+// AdaptiveConfig 自适应并发配置
+type AdaptiveConfig struct {
+	Enable bool `yaml:"enable"`
+	Min    int  `yaml:"min"` // 并发数下限 (默认 1)
+	Max    int  `yaml:"max"` // 并发数上限 (默认 max_concurrent 的 2 倍)
 }
 
 // BaiduConfig 百度网盘 API 配置
@@ -40,6 +220,17 @@ type BaiduConfig struct {
 	AccessToken  string `yaml:"access_token"`
 	RefreshToken string `yaml:"refresh_token"`
 	UserAgent    string `yaml:"user_agent"`
+	// UserAgents 设置后按请求轮换其中的 User-Agent，此时忽略 UserAgent
+	UserAgents []string `yaml:"user_agents"`
+	// 列表、删除等元数据请求的超时时间 (默认 30s)；下载与上传不受此限制，由 file_timeout 控制
+	MetadataTimeout         string        `yaml:"metadata_timeout"`
+	MetadataTimeoutDuration time.Duration `yaml:"-"`
+	// 大小不小于该值的文件上传时不写入临时文件，边读边上传 (例如 "1GB"，为空表示总是写入临时文件)
+	// 流式上传不会命中秒传
+	StreamUploadThreshold      string `yaml:"stream_upload_threshold"`
+	StreamUploadThresholdBytes int64  `yaml:"-"`
+	// 扫描云端时同时列出的目录数 (默认 4)，目录很多时增大可以缩短扫描时间，过大容易触发限流
+	ListWorkers int `yaml:"list_workers"`
 }
 
 // CryptoConfig 加密配置
@@ -48,6 +239,8 @@ type CryptoConfig struct {
 	Password         string `yaml:"password"`
 	EncryptFilenames bool   `yaml:"encrypt_filenames"`
 	Algorithm        string `yaml:"algorithm"`
+	// 把云端开启加密之前上传的明文文件重新加密上传 (迁移)，默认关闭: 明文文件照常同步，下载时不解密
+	MigratePlain bool `yaml:"migrate_plain"`
 }
 
 // SystemConfig 系统配置
@@ -55,7 +248,26 @@ type SystemConfig struct {
 	DBPath   string `yaml:"db_path"`
 	TempDir  string `yaml:"temp_dir"`
 	LogLevel string `yaml:"log_level"`
-	LogFile  string `yaml:"log_file"`
+	// 日志格式: text (默认) 或 json
+	LogFormat string `yaml:"log_format"`
+	LogFile   string `yaml:"log_file"`
+	// 日志切割: 单文件最大体积 (MB)、保留的历史文件数量、保留天数 (0 表示不限制)
+	LogMaxSizeMB  int `yaml:"log_max_size_mb"`
+	LogMaxBackups int `yaml:"log_max_backups"`
+	LogMaxAgeDays int `yaml:"log_max_age_days"`
+	// 每次同步前备份状态数据库，保留最近 BackupKeep 份 (0 表示不备份)
+	BackupDir  string `yaml:"backup_dir"`
+	BackupKeep int    `yaml:"backup_keep"`
+	// 收到退出信号后等待正在传输的文件完成的最长时间，超时后强制中断 (默认 1m，"0" 表示一直等待)
+	// 作为系统服务运行时应小于服务管理器强制结束进程前的等待时间 (例如 systemd 的 TimeoutStopSec)
+	ShutdownTimeout         string        `yaml:"shutdown_timeout"`
+	ShutdownTimeoutDuration time.Duration `yaml:"-"`
+	// 指标服务监听地址 (例如 "127.0.0.1:9464")，在 /metrics 提供 Prometheus 格式的指标；为空表示不开启
+	MetricsAddr string `yaml:"metrics_addr"`
+	// 写入文件 (下载到本地、上传前写入临时文件) 时每次读取的大小 (例如 "256KB"，为空时为 256KB)
+	// 加密与解密按这个大小分块处理，大文件较多时适当增大可以提高吞吐量
+	CopyBuffer      string `yaml:"copy_buffer"`
+	CopyBufferBytes int    `yaml:"-"`
 }
 
 // LoadConfig 读取并解析配置文件
@@ -70,25 +282,33 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("解析 YAML 格式错误: %w", err)
 	}
 
-	// 校验与转换
-	// ... (IntervalDuration 解析保持不变) ...
-	duration, err := time.ParseDuration(cfg.Sync.Interval)
-	if err != nil {
-		return nil, fmt.Errorf("无效的同步间隔格式 (sync.interval): %v", err)
+	// 展开 ${VAR} 引用，并应用环境变量覆盖 (环境变量优先于配置文件)
+	if err := expandEnv(&cfg); err != nil {
+		return nil, err
 	}
-	cfg.Sync.IntervalDuration = duration
+	applyEnvOverrides(&cfg)
 
-	// 设置默认冲突策略
-	if cfg.Sync.ConflictStrategy == "" {
-		cfg.Sync.ConflictStrategy = "rename_local"
+	// 校验与转换
+	if err := cfg.normalizeProfiles(); err != nil {
+		return nil, err
 	}
-	// 简单校验策略合法性
-	validStrategies := map[string]bool{
-		"rename_local": true, "rename_remote": true,
-		"keep_latest": true, "delete_remote": true, "delete_local": true,
+
+	// 设置默认云端后端
+	switch cfg.Remote.Type {
+	case "":
+		cfg.Remote.Type = RemoteTypeBaidu
+	case RemoteTypeBaidu, RemoteTypeLocal:
+	default:
+		return nil, fmt.Errorf("未知的云端类型 (remote.type): %s", cfg.Remote.Type)
 	}
-	if !validStrategies[cfg.Sync.ConflictStrategy] {
-		return nil, fmt.Errorf("未知的冲突策略: %s", cfg.Sync.ConflictStrategy)
+
+	// 设置默认本地存储类型
+	switch cfg.Local.Type {
+	case "":
+		cfg.Local.Type = LocalTypeFolder
+	case LocalTypeFolder, LocalTypeWebDAV:
+	default:
+		return nil, fmt.Errorf("未知的本地存储类型 (local.type): %s", cfg.Local.Type)
 	}
 
 	// 设置默认临时目录
@@ -96,17 +316,393 @@ func LoadConfig(path string) (*Config, error) {
 		cfg.System.TempDir = "./tmp"
 	}
 
+	// 设置默认日志格式
+	switch cfg.System.LogFormat {
+	case "":
+		cfg.System.LogFormat = "text"
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("未知的日志格式 (system.log_format): %s", cfg.System.LogFormat)
+	}
+
+	// 设置默认备份目录
+	if cfg.System.BackupDir == "" {
+		cfg.System.BackupDir = "./backups"
+	}
+	if cfg.System.BackupKeep < 0 {
+		return nil, fmt.Errorf("无效的备份数量 (system.backup_keep): %d", cfg.System.BackupKeep)
+	}
+
+	if cfg.System.ShutdownTimeout == "" {
+		cfg.System.ShutdownTimeout = "1m"
+	}
+	shutdownTimeout, err := time.ParseDuration(cfg.System.ShutdownTimeout)
+	if err != nil || shutdownTimeout < 0 {
+		return nil, fmt.Errorf("无效的退出等待时间 (system.shutdown_timeout): %s", cfg.System.ShutdownTimeout)
+	}
+	cfg.System.ShutdownTimeoutDuration = shutdownTimeout
+
+	if cfg.System.CopyBuffer != "" {
+		size, err := parseSize(cfg.System.CopyBuffer)
+		if err != nil || size < 4<<10 || size > 64<<20 {
+			return nil, fmt.Errorf("无效的缓冲区大小 (system.copy_buffer，应在 4KB ~ 64MB 之间): %s", cfg.System.CopyBuffer)
+		}
+		cfg.System.CopyBufferBytes = int(size)
+	}
+
+	if cfg.Baidu.MetadataTimeout != "" {
+		metadataTimeout, err := time.ParseDuration(cfg.Baidu.MetadataTimeout)
+		if err != nil || metadataTimeout <= 0 {
+			return nil, fmt.Errorf("无效的请求超时时间 (baidu.metadata_timeout): %s", cfg.Baidu.MetadataTimeout)
+		}
+		cfg.Baidu.MetadataTimeoutDuration = metadataTimeout
+	}
+	if cfg.Baidu.ListWorkers < 0 {
+		return nil, fmt.Errorf("无效的云端扫描并发数 (baidu.list_workers): %d", cfg.Baidu.ListWorkers)
+	}
+	if cfg.Baidu.StreamUploadThreshold != "" {
+		threshold, err := parseSize(cfg.Baidu.StreamUploadThreshold)
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("无效的流式上传阈值 (baidu.stream_upload_threshold): %s", cfg.Baidu.StreamUploadThreshold)
+		}
+		cfg.Baidu.StreamUploadThresholdBytes = threshold
+	}
+
 	// 确保临时目录存在
 	if err := os.MkdirAll(cfg.System.TempDir, 0755); err != nil {
 		return nil, fmt.Errorf("无法创建临时目录: %w", err)
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
 
+// normalizeProfiles 整理 Profile 列表，兼容只写了 sync 节的旧格式
+func (c *Config) normalizeProfiles() error {
+	if len(c.Profiles) == 0 {
+		if err := c.Sync.normalize("sync"); err != nil {
+			return err
+		}
+		crypto := c.Crypto
+		c.Profiles = []ProfileConfig{{
+			Name:       DefaultProfileName,
+			SyncConfig: c.Sync,
+			Crypto:     &crypto,
+		}}
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for i := range c.Profiles {
+		p := &c.Profiles[i]
+		if p.Name == "" {
+			return fmt.Errorf("第 %d 个 profile 缺少 name", i+1)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("profile 名称重复: %s", p.Name)
+		}
+		seen[p.Name] = true
+
+		if err := p.SyncConfig.normalize("profiles." + p.Name); err != nil {
+			return err
+		}
+		if p.Crypto == nil {
+			crypto := c.Crypto
+			p.Crypto = &crypto
+		}
+	}
+	return nil
+}
+
+// normalize 解析同步间隔并填充默认值
+// section 用于错误提示，例如 "sync" 或 "profiles.docs"
+func (s *SyncConfig) normalize(section string) error {
+	// 设置了 schedule 时 interval 可以省略
+	if s.Schedule != "" {
+		schedule, err := cron.ParseStandard(s.Schedule)
+		if err != nil {
+			return fmt.Errorf("无效的 cron 表达式 (%s.schedule): %v", section, err)
+		}
+		s.CronSchedule = schedule
+	}
+	if s.Interval != "" || s.CronSchedule == nil {
+		duration, err := time.ParseDuration(s.Interval)
+		if err != nil {
+			return fmt.Errorf("无效的同步间隔格式 (%s.interval): %v", section, err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("同步间隔必须大于 0 (%s.interval): %s", section, s.Interval)
+		}
+		s.IntervalDuration = duration
+	}
+
+	if s.IntervalJitter != "" {
+		jitter, err := time.ParseDuration(s.IntervalJitter)
+		if err != nil || jitter < 0 {
+			return fmt.Errorf("无效的随机延迟 (%s.interval_jitter): %s", section, s.IntervalJitter)
+		}
+		s.IntervalJitterDuration = jitter
+	}
+
+	if s.PruneOrphansAfter != "" {
+		prune, err := time.ParseDuration(s.PruneOrphansAfter)
+		if err != nil || prune <= 0 {
+			return fmt.Errorf("无效的孤立记录清理时长 (%s.prune_orphans_after): %s", section, s.PruneOrphansAfter)
+		}
+		s.PruneOrphansDuration = prune
+	}
+
+	if s.FileTimeout != "" {
+		timeout, err := time.ParseDuration(s.FileTimeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("无效的文件超时时间 (%s.file_timeout): %s", section, s.FileTimeout)
+		}
+		s.FileTimeoutDuration = timeout
+	}
+	if s.CycleTimeout != "" {
+		timeout, err := time.ParseDuration(s.CycleTimeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("无效的单轮同步超时时间 (%s.cycle_timeout): %s", section, s.CycleTimeout)
+		}
+		s.CycleTimeoutDuration = timeout
+	}
+
+	if s.QuietPeriod != "" {
+		quiet, err := time.ParseDuration(s.QuietPeriod)
+		if err != nil || quiet < 0 {
+			return fmt.Errorf("无效的保护时长 (%s.quiet_period): %s", section, s.QuietPeriod)
+		}
+		s.QuietPeriodDuration = quiet
+	}
+
+	subpath, err := CleanSubpath(s.Subpath)
+	if err != nil {
+		return fmt.Errorf("无效的同步范围 (%s.subpath): %w", section, err)
+	}
+	s.Subpath = subpath
+
+	if s.ClockSkewThreshold != "" {
+		threshold, err := time.ParseDuration(s.ClockSkewThreshold)
+		if err != nil || threshold <= 0 {
+			return fmt.Errorf("无效的时钟偏差阈值 (%s.clock_skew_threshold): %s", section, s.ClockSkewThreshold)
+		}
+		s.ClockSkewDuration = threshold
+	}
+
+	if s.DownloadRetries < 0 {
+		return fmt.Errorf("无效的下载重试次数 (%s.download_retries): %d", section, s.DownloadRetries)
+	}
+	if s.DownloadRetries == 0 {
+		s.DownloadRetries = 3
+	}
+
+	// 未配置并发数时使用默认值 (负数留给 Validate 报错)
+	if s.MaxConcurrent == 0 {
+		s.MaxConcurrent = 3
+	}
+	if s.AdaptiveConcurrency.Enable {
+		if s.AdaptiveConcurrency.Min == 0 {
+			s.AdaptiveConcurrency.Min = 1
+		}
+		if s.AdaptiveConcurrency.Max == 0 {
+			s.AdaptiveConcurrency.Max = s.MaxConcurrent * 2
+		}
+	}
+
+	switch s.OnError {
+	case "":
+		s.OnError = "continue"
+	case "continue", "abort":
+	default:
+		return fmt.Errorf("未知的错误处理方式 (%s.on_error): %s", section, s.OnError)
+	}
+
+	switch s.FirstRunBias {
+	case "":
+		s.FirstRunBias = "conflict"
+	case "conflict", "local", "remote", "newer":
+	default:
+		return fmt.Errorf("未知的首次同步方式 (%s.first_run_bias): %s", section, s.FirstRunBias)
+	}
+
+	switch s.TypeClash {
+	case "":
+		s.TypeClash = "skip"
+	case "skip", "rename_local", "rename_remote":
+	default:
+		return fmt.Errorf("未知的文件/目录冲突处理方式 (%s.type_clash): %s", section, s.TypeClash)
+	}
+
+	switch s.ProtectNewerRemote {
+	case "":
+		s.ProtectNewerRemote = "off"
+	case "off", "conflict", "skip":
+	default:
+		return fmt.Errorf("未知的云端较新文件保护方式 (%s.protect_newer_remote): %s", section, s.ProtectNewerRemote)
+	}
+
+	s.SkipHidden = s.IncludeHidden != nil && !*s.IncludeHidden
+	s.VerifyLocal = s.VerifyLocalChanges == nil || *s.VerifyLocalChanges
+	s.CreateRoot = s.CreateRemoteRoot == nil || *s.CreateRemoteRoot
+	s.RunAtStart = s.RunOnStart == nil || *s.RunOnStart
+
+	if s.BandwidthLimit != "" {
+		limit, err := parseRate(s.BandwidthLimit)
+		if err != nil {
+			return fmt.Errorf("无效的限速 (%s.bandwidth_limit): %s", section, s.BandwidthLimit)
+		}
+		s.BandwidthLimitBytes = limit
+	}
+	for i := range s.BandwidthSchedule {
+		w := &s.BandwidthSchedule[i]
+		from, errFrom := parseClock(w.From)
+		to, errTo := parseClock(w.To)
+		if errFrom != nil || errTo != nil {
+			return fmt.Errorf("无效的时间段 (%s.bandwidth_schedule[%d]): %s ~ %s", section, i, w.From, w.To)
+		}
+		limit, err := parseRate(w.Limit)
+		if err != nil {
+			return fmt.Errorf("无效的限速 (%s.bandwidth_schedule[%d].limit): %s", section, i, w.Limit)
+		}
+		w.FromOffset, w.ToOffset, w.LimitBytes = from, to, limit
+	}
+
+	if s.MaxFileSize != "" {
+		size, err := parseSize(s.MaxFileSize)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("无效的文件大小限制 (%s.max_file_size): %s", section, s.MaxFileSize)
+		}
+		s.MaxFileSizeBytes = size
+	}
+
+	switch s.HashAlgorithm {
+	case "":
+		s.HashAlgorithm = "md5"
+	case "md5", "sha256":
+	default:
+		return fmt.Errorf("不支持的 Hash 算法 (%s.hash_algorithm): %s", section, s.HashAlgorithm)
+	}
+
+	// 设置默认冲突策略
+	if s.ConflictStrategy == "" {
+		s.ConflictStrategy = "rename_local"
+	}
+	// 简单校验策略合法性
+	validStrategies := map[string]bool{
+		"rename_local": true, "rename_remote": true,
+		"keep_latest": true, "delete_remote": true, "delete_local": true,
+		"keep_both": true,
+	}
+	if !validStrategies[s.ConflictStrategy] {
+		return fmt.Errorf("未知的冲突策略 (%s.conflict_strategy): %s", section, s.ConflictStrategy)
+	}
+	if strings.Contains(s.ConflictName, "/") {
+		return fmt.Errorf("冲突文件命名模板不能包含目录 (%s.conflict_name): %s", section, s.ConflictName)
+	}
+	for i, rule := range s.ConflictRules {
+		if !validPattern(rule.Pattern) {
+			return fmt.Errorf("无效的路径规则 (%s.conflict_rules[%d].pattern): %q", section, i, rule.Pattern)
+		}
+		if !validStrategies[rule.Strategy] {
+			return fmt.Errorf("未知的冲突策略 (%s.conflict_rules[%d].strategy): %s", section, i, rule.Strategy)
+		}
+	}
+	return nil
+}
+
+// validPattern 检查 glob 语法 ("**" 作为独立的一级目录出现)
+func validPattern(pattern string) bool {
+	if pattern == "" {
+		return false
+	}
+	for _, seg := range strings.Split(pattern, "/") {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// mask 返回敏感值的脱敏形式，只表明是否已配置
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "***"
+}
+
+// String 实现 fmt.Stringer，输出时隐藏 Token 与密钥
+func (b BaiduConfig) String() string {
+	return fmt.Sprintf("{AppKey:%s SecretKey:%s AccessToken:%s RefreshToken:%s UserAgent:%s UserAgents:%v MetadataTimeout:%s StreamUploadThreshold:%s ListWorkers:%d}",
+		b.AppKey, mask(b.SecretKey), mask(b.AccessToken), mask(b.RefreshToken), b.UserAgent, b.UserAgents, b.MetadataTimeout, b.StreamUploadThreshold, b.ListWorkers)
+}
+
+// LogValue 实现 slog.LogValuer，直接把配置打进日志时也不会泄露敏感信息
+func (b BaiduConfig) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("app_key", b.AppKey),
+		slog.String("secret_key", mask(b.SecretKey)),
+		slog.String("access_token", mask(b.AccessToken)),
+		slog.String("refresh_token", mask(b.RefreshToken)),
+		slog.String("user_agent", b.UserAgent),
+		slog.Any("user_agents", b.UserAgents),
+		slog.String("metadata_timeout", b.MetadataTimeout),
+		slog.String("stream_upload_threshold", b.StreamUploadThreshold),
+		slog.Int("list_workers", b.ListWorkers),
+	)
+}
+
+// String 实现 fmt.Stringer，输出时隐藏密码
+func (w WebDAVConfig) String() string {
+	return fmt.Sprintf("{URL:%s Username:%s Password:%s}", w.URL, w.Username, mask(w.Password))
+}
+
+// LogValue 实现 slog.LogValuer，直接把配置打进日志时也不会泄露密码
+func (w WebDAVConfig) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("url", w.URL),
+		slog.String("username", w.Username),
+		slog.String("password", mask(w.Password)),
+	)
+}
+
+// String 实现 fmt.Stringer，输出时隐藏密码
+func (c CryptoConfig) String() string {
+	return fmt.Sprintf("{Enable:%t Password:%s EncryptFilenames:%t Algorithm:%s}",
+		c.Enable, mask(c.Password), c.EncryptFilenames, c.Algorithm)
+}
+
+// LogValue 实现 slog.LogValuer，直接把配置打进日志时也不会泄露密码
+func (c CryptoConfig) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Bool("enable", c.Enable),
+		slog.String("password", mask(c.Password)),
+		slog.Bool("encrypt_filenames", c.EncryptFilenames),
+		slog.String("algorithm", c.Algorithm),
+	)
+}
+
 // GetAESKey 将用户输入的任意长度密码转换为 32字节 的 AES-256 密钥
 // 使用 SHA-256 哈希算法
 func (c *CryptoConfig) GetAESKey() []byte {
 	hash := sha256.Sum256([]byte(c.Password))
 	return hash[:] // 返回切片 [32]byte -> []byte
 }
+
+// CleanSubpath 规范化同步范围: 统一使用 "/"，去掉首尾的 "/"；"" 与 "." 表示整个目录
+// 不允许包含 ".." (范围必须位于同步目录之内)
+func CleanSubpath(s string) (string, error) {
+	s = strings.ReplaceAll(s, "\\", "/")
+	for _, part := range strings.Split(s, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("不能超出同步目录: %s", s)
+		}
+	}
+	return strings.Trim(path.Clean("/"+s), "/"), nil
+}
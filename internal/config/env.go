@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envPattern 匹配 ${VAR_NAME} 形式的环境变量引用
+// 只支持带花括号的写法，避免误伤密码等字段中出现的普通 "$" 字符
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// envOverrides 可以完全通过环境变量提供的敏感字段
+// 优先级: 环境变量 > 配置文件
+var envOverrides = []struct {
+	name  string
+	field func(c *Config) *string
+}{
+	{"BAIDUSYNC_APP_KEY", func(c *Config) *string { return &c.Baidu.AppKey }},
+	{"BAIDUSYNC_SECRET_KEY", func(c *Config) *string { return &c.Baidu.SecretKey }},
+	{"BAIDUSYNC_ACCESS_TOKEN", func(c *Config) *string { return &c.Baidu.AccessToken }},
+	{"BAIDUSYNC_REFRESH_TOKEN", func(c *Config) *string { return &c.Baidu.RefreshToken }},
+	{"BAIDUSYNC_CRYPTO_PASSWORD", func(c *Config) *string { return &c.Crypto.Password }},
+	{"BAIDUSYNC_WEBDAV_PASSWORD", func(c *Config) *string { return &c.Local.WebDAV.Password }},
+}
+
+// expandEnv 展开配置中所有字符串字段里的 ${VAR} 引用
+// 引用了未定义的环境变量时返回错误 (列出所有缺失的变量)，而不是静默替换为空字符串
+func expandEnv(cfg *Config) error {
+	missing := make(map[string]bool)
+	expandValue(reflect.ValueOf(cfg).Elem(), missing)
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("配置引用了未定义的环境变量: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// expandValue 递归处理结构体、切片中的字符串字段
+func expandValue(v reflect.Value, missing map[string]bool) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(expandString(v.String(), missing))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			expandValue(v.Field(i), missing)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			expandValue(v.Index(i), missing)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			expandValue(v.Elem(), missing)
+		}
+	}
+}
+
+// expandString 替换单个字符串中的 ${VAR}，支持部分展开 (如 "/data/${USER}/docs")
+func expandString(s string, missing map[string]bool) string {
+	return envPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envPattern.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing[name] = true
+			return ref
+		}
+		return value
+	})
+}
+
+// applyEnvOverrides 用 BAIDUSYNC_* 环境变量覆盖配置文件中的敏感字段
+// BAIDUSYNC_CRYPTO_PASSWORD 只覆盖全局 crypto (以及沿用它的 Profile)，
+// 有独立 crypto 节的 Profile 使用 BAIDUSYNC_CRYPTO_PASSWORD_<名称> 覆盖，避免所有 Profile 被改成同一个密码
+func applyEnvOverrides(cfg *Config) {
+	for _, o := range envOverrides {
+		if value, ok := os.LookupEnv(o.name); ok && value != "" {
+			*o.field(cfg) = value
+		}
+	}
+	for i := range cfg.Profiles {
+		p := &cfg.Profiles[i]
+		if p.Crypto == nil {
+			continue
+		}
+		if value, ok := os.LookupEnv(profileEnvName("BAIDUSYNC_CRYPTO_PASSWORD", p.Name)); ok && value != "" {
+			p.Crypto.Password = value
+		}
+	}
+}
+
+// profileEnvName 返回 Profile 专用的环境变量名: prefix + "_" + 名称 (转为大写，字母与数字以外的字符替换为 "_")
+// 例如 ("BAIDUSYNC_CRYPTO_PASSWORD", "photos-2024") -> "BAIDUSYNC_CRYPTO_PASSWORD_PHOTOS_2024"
+func profileEnvName(prefix, profile string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, profile)
+	return prefix + "_" + name
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestExpandString(t *testing.T) {
+	t.Setenv("BS_USER", "alice")
+	t.Setenv("BS_EMPTY", "")
+
+	tests := []struct {
+		in      string
+		want    string
+		missing []string
+	}{
+		{"/data/${BS_USER}/docs", "/data/alice/docs", nil},
+		{"${BS_USER}-${BS_USER}", "alice-alice", nil},
+		{"prefix${BS_EMPTY}suffix", "prefixsuffix", nil},
+		// 不带花括号的 "$" 原样保留 (密码中可能出现)
+		{"pa$$word$BS_USER", "pa$$word$BS_USER", nil},
+		{"${1BAD}", "${1BAD}", nil},
+		{"/data/${BS_MISSING}/${BS_USER}", "/data/${BS_MISSING}/alice", []string{"BS_MISSING"}},
+	}
+	for _, tt := range tests {
+		missing := make(map[string]bool)
+		if got := expandString(tt.in, missing); got != tt.want {
+			t.Errorf("expandString(%q) = %q，应为 %q", tt.in, got, tt.want)
+		}
+		if len(missing) != len(tt.missing) {
+			t.Errorf("expandString(%q) 缺失变量 %v，应为 %v", tt.in, missing, tt.missing)
+		}
+		for _, name := range tt.missing {
+			if !missing[name] {
+				t.Errorf("expandString(%q) 未报告缺失的 %s", tt.in, name)
+			}
+		}
+	}
+}
+
+func TestExpandEnvMissingVariables(t *testing.T) {
+	t.Setenv("BS_ROOT", "/srv")
+
+	cfg := &Config{
+		Sync: SyncConfig{LocalDir: "${BS_ROOT}/${BS_ZETA}"},
+		Profiles: []ProfileConfig{{
+			Name:   "docs",
+			Crypto: &CryptoConfig{Password: "${BS_ALPHA}"},
+		}},
+	}
+	err := expandEnv(cfg)
+	if err == nil {
+		t.Fatal("引用未定义的环境变量时应返回错误")
+	}
+	// 列出全部缺失的变量，按名称排序
+	if want := "配置引用了未定义的环境变量: BS_ALPHA, BS_ZETA"; err.Error() != want {
+		t.Fatalf("错误为 %q，应为 %q", err, want)
+	}
+	if cfg.Sync.LocalDir != "/srv/${BS_ZETA}" {
+		t.Fatalf("LocalDir 为 %q，已定义的变量仍应展开", cfg.Sync.LocalDir)
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	t.Setenv("BAIDUSYNC_ACCESS_TOKEN", "token-from-env")
+	t.Setenv("BAIDUSYNC_REFRESH_TOKEN", "")
+	t.Setenv("BAIDUSYNC_CRYPTO_PASSWORD", "global-secret")
+	t.Setenv("BAIDUSYNC_CRYPTO_PASSWORD_PHOTOS_2024", "photos-secret")
+
+	cfg := &Config{
+		Profiles: []ProfileConfig{
+			{Name: "docs", SyncConfig: SyncConfig{Interval: "1m"}},
+			{Name: "photos-2024", SyncConfig: SyncConfig{Interval: "1m"}, Crypto: &CryptoConfig{Enable: true, Password: "from-file"}},
+			{Name: "music", SyncConfig: SyncConfig{Interval: "1m"}, Crypto: &CryptoConfig{Enable: true, Password: "music-file"}},
+		},
+	}
+	cfg.Baidu.RefreshToken = "refresh-from-file"
+	applyEnvOverrides(cfg)
+	if err := cfg.normalizeProfiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Baidu.AccessToken != "token-from-env" {
+		t.Errorf("AccessToken 为 %q", cfg.Baidu.AccessToken)
+	}
+	// 空值不覆盖配置文件
+	if cfg.Baidu.RefreshToken != "refresh-from-file" {
+		t.Errorf("RefreshToken 为 %q", cfg.Baidu.RefreshToken)
+	}
+
+	want := map[string]string{
+		"docs":        "global-secret", // 沿用全局 crypto
+		"photos-2024": "photos-secret", // 独立 crypto，按名称覆盖
+		"music":       "music-file",    // 独立 crypto，未设置专用变量
+	}
+	for _, p := range cfg.Profiles {
+		if p.Crypto.Password != want[p.Name] {
+			t.Errorf("profile %s 的密码为 %q，应为 %q", p.Name, p.Crypto.Password, want[p.Name])
+		}
+	}
+}
+
+func TestProfileEnvName(t *testing.T) {
+	tests := map[string]string{
+		"docs":        "BAIDUSYNC_CRYPTO_PASSWORD_DOCS",
+		"photos-2024": "BAIDUSYNC_CRYPTO_PASSWORD_PHOTOS_2024",
+		"My.Backup":   "BAIDUSYNC_CRYPTO_PASSWORD_MY_BACKUP",
+		"照片":          "BAIDUSYNC_CRYPTO_PASSWORD___",
+	}
+	for name, want := range tests {
+		if got := profileEnvName("BAIDUSYNC_CRYPTO_PASSWORD", name); got != want {
+			t.Errorf("profileEnvName(%q) = %q，应为 %q", name, got, want)
+		}
+	}
+}
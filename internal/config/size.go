@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sizeUnits 大小单位 (按 1024 进制换算)，按后缀长度从长到短匹配
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize 解析人类可读的大小，例如 "500MB"、"1.5GB"、"4096" (不带单位时为字节)
+// 单位不区分大小写，按 1024 进制换算
+func parseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(str, u.suffix) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, u.suffix))
+			unit = u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的大小: %s", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// parseRate 解析每秒字节数，例如 "2MB"、"512KB/s"，"0" 表示不限速
+func parseRate(s string) (int64, error) {
+	str := strings.TrimSpace(s)
+	if lower := strings.ToLower(str); strings.HasSuffix(lower, "/s") {
+		str = str[:len(str)-2]
+	}
+	return parseSize(str)
+}
+
+// parseClock 解析一天中的时间 "HH:MM"，返回距离零点的时长 ("24:00" 表示一天结束)
+func parseClock(s string) (time.Duration, error) {
+	if strings.TrimSpace(s) == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
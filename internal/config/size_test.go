@@ -0,0 +1,66 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"4096":    4096,
+		"500MB":   500 << 20,
+		"1.5GB":   3 << 29,
+		"2k":      2048,
+		" 10 kb ": 10 << 10,
+		"1T":      1 << 40,
+		"0":       0,
+	}
+	for in, want := range tests {
+		got, err := parseSize(in)
+		if err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v，应为 %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "MB", "-1MB", "10XB"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) 应返回错误", in)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]int64{
+		"2MB":      2 << 20,
+		"512KB/s":  512 << 10,
+		"512kb/S":  512 << 10,
+		"0":        0,
+		"100 B/s ": 100,
+	}
+	for in, want := range tests {
+		got, err := parseRate(in)
+		if err != nil || got != want {
+			t.Errorf("parseRate(%q) = %d, %v，应为 %d", in, got, err, want)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := map[string]time.Duration{
+		"00:00": 0,
+		"06:30": 6*time.Hour + 30*time.Minute,
+		"22:00": 22 * time.Hour,
+		"24:00": 24 * time.Hour,
+		" 9:05": 9*time.Hour + 5*time.Minute,
+	}
+	for in, want := range tests {
+		got, err := parseClock(in)
+		if err != nil || got != want {
+			t.Errorf("parseClock(%q) = %s, %v，应为 %s", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "25:00", "12:60", "noon"} {
+		if _, err := parseClock(in); err == nil {
+			t.Errorf("parseClock(%q) 应返回错误", in)
+		}
+	}
+}
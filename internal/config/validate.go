@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Validate 检查配置是否可用，一次性返回所有问题
+// 在 LoadConfig 的最后调用，避免错误配置在同步过程中才以难以理解的方式暴露出来
+func (c *Config) Validate() error {
+	var problems []error
+	addf := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	// 1. 百度认证信息 (只有使用百度网盘作为后端时才需要)
+	if c.Remote.Type == RemoteTypeBaidu {
+		if c.Baidu.AccessToken == "" {
+			addf("baidu.access_token 不能为空")
+		}
+		if c.Baidu.RefreshToken != "" && (c.Baidu.AppKey == "" || c.Baidu.SecretKey == "") {
+			addf("配置了 baidu.refresh_token 时必须同时配置 app_key 和 secret_key，否则无法刷新 Token")
+		}
+	}
+
+	if c.Local.Type == LocalTypeWebDAV && c.Local.WebDAV.URL == "" {
+		addf("local.type=webdav 时 local.webdav.url 不能为空")
+	}
+
+	// 2. 日志切割参数
+	if c.System.LogMaxSizeMB < 0 || c.System.LogMaxBackups < 0 || c.System.LogMaxAgeDays < 0 {
+		addf("system.log_max_size_mb / log_max_backups / log_max_age_days 不能为负数")
+	}
+
+	// 3. 每个 Profile 的同步设置
+	for i := range c.Profiles {
+		p := &c.Profiles[i]
+		section := "profiles." + p.Name
+		if len(c.Profiles) == 1 && p.Name == DefaultProfileName {
+			section = "sync"
+		}
+
+		if p.LocalDir == "" {
+			addf("%s.local_dir 不能为空", section)
+		} else if c.Local.Type == LocalTypeWebDAV {
+			// WebDAV 服务器上的目录在预检时检查
+			if !strings.HasPrefix(p.LocalDir, "/") {
+				addf("%s.local_dir 必须是以 \"/\" 开头的 WebDAV 路径: %q", section, p.LocalDir)
+			}
+		} else if info, err := os.Stat(p.LocalDir); err != nil {
+			addf("%s.local_dir 无法访问 (%s): %v", section, p.LocalDir, err)
+		} else if !info.IsDir() {
+			addf("%s.local_dir 不是目录: %s", section, p.LocalDir)
+		}
+
+		switch c.Remote.Type {
+		case RemoteTypeBaidu:
+			if !strings.HasPrefix(p.RemoteDir, "/") {
+				addf("%s.remote_dir 必须是以 \"/\" 开头的绝对路径: %q", section, p.RemoteDir)
+			}
+		case RemoteTypeLocal:
+			if p.RemoteDir == "" {
+				addf("%s.remote_dir 不能为空", section)
+			} else if c.Local.Type == LocalTypeFolder && sameDir(p.LocalDir, p.RemoteDir) {
+				addf("%s.remote_dir 不能与 local_dir 相同: %s", section, p.RemoteDir)
+			}
+			if p.Crypto.EncryptFilenames {
+				addf("%s: remote.type=local 不支持 crypto.encrypt_filenames", section)
+			}
+		}
+
+		// 同一个进程内对同一目录重复加锁也会失败，而且两个 Profile 同步同一个目录本身就会互相干扰
+		for _, other := range c.Profiles[:i] {
+			if p.LocalDir != "" && sameDir(p.LocalDir, other.LocalDir) {
+				addf("%s.local_dir 与 profile %s 相同: %s", section, other.Name, p.LocalDir)
+			}
+		}
+
+		if p.MaxConcurrent < 1 {
+			addf("%s.max_concurrent 必须大于等于 1: %d", section, p.MaxConcurrent)
+		}
+		if p.MaxUploads < 0 || p.MaxDownloads < 0 || p.MaxDeletes < 0 {
+			addf("%s.max_uploads / max_downloads / max_deletes 不能为负数: %d / %d / %d",
+				section, p.MaxUploads, p.MaxDownloads, p.MaxDeletes)
+		}
+		if a := p.AdaptiveConcurrency; a.Enable && (a.Min < 1 || a.Min > p.MaxConcurrent || p.MaxConcurrent > a.Max) {
+			addf("%s.adaptive_concurrency 需要满足 1 <= min <= max_concurrent <= max: min=%d max_concurrent=%d max=%d",
+				section, a.Min, p.MaxConcurrent, a.Max)
+		}
+
+		if p.Crypto.Enable && p.Crypto.Password == "" {
+			addf("%s 开启了加密，但没有设置 crypto.password", section)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("配置校验失败，共 %d 个问题:\n%w", len(problems), errors.Join(problems...))
+	}
+	return nil
+}
+
+// sameDir 判断两个本地路径是否指向同一目录
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return absA == absB
+}
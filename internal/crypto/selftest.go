@@ -0,0 +1,201 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// selfTestSizes 自检使用的明文长度: 空文件、不足 / 恰好 / 超过一个 AES 块、跨越多个块的小文件与数 MB 的大文件
+var selfTestSizes = []int{0, 1, 15, 16, 17, 4096 + 3, 3<<20 + 5}
+
+// selfTestNames 自检使用的示例文件名
+var selfTestNames = []string{
+	"report.pdf",
+	".hidden",
+	"中文文件名 (副本).txt",
+	"a b+c=d&e%20f.tar.gz",
+	strings.Repeat("长", 20) + ".bin",
+}
+
+// SelfTestResult 自检中的一项
+type SelfTestResult struct {
+	Name string
+	Err  error // nil 表示通过
+}
+
+// SelfTest 用 key 对随机数据与示例文件名做一遍加密、解密，确认结果与原文一致
+// 除了往返一致之外，还检查密文大小 (明文 + HeaderSize，云端大小的换算依赖它)、每次加密的 IV 不同、
+// 从任意偏移量续传解密、用同一个 IV 重新加密得到相同的密文，以及错误的密钥不能还原内容与文件名
+func SelfTest(key []byte) []SelfTestResult {
+	results := make([]SelfTestResult, 0, len(selfTestSizes)+len(selfTestNames)+1)
+	for _, size := range selfTestSizes {
+		results = append(results, SelfTestResult{
+			Name: fmt.Sprintf("内容 %d 字节", size),
+			Err:  selfTestContent(key, size),
+		})
+	}
+	results = append(results, SelfTestResult{
+		Name: fmt.Sprintf("不足 %d 字节的密文", HeaderSize),
+		Err:  selfTestTruncated(key),
+	})
+	for _, name := range selfTestNames {
+		results = append(results, SelfTestResult{
+			Name: fmt.Sprintf("文件名 %q", name),
+			Err:  selfTestName(key, name),
+		})
+	}
+	return results
+}
+
+// selfTestContent 检查 size 字节的随机内容
+func selfTestContent(key []byte, size int) error {
+	plain := make([]byte, size)
+	if _, err := rand.Read(plain); err != nil {
+		return fmt.Errorf("生成随机数据失败: %w", err)
+	}
+
+	cipherText, err := encryptAll(plain, key)
+	if err != nil {
+		return err
+	}
+	if len(cipherText) != size+HeaderSize {
+		return fmt.Errorf("密文大小为 %d 字节，应为明文大小 + %d = %d 字节", len(cipherText), HeaderSize, size+HeaderSize)
+	}
+
+	got, err := decryptAll(cipherText, key)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, plain) {
+		return fmt.Errorf("解密结果与原文不一致 (%s)", firstDiff(got, plain))
+	}
+
+	// 同样的内容再加密一次，IV 必须不同
+	again, err := encryptAll(plain, key)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(again[:HeaderSize], cipherText[:HeaderSize]) {
+		return errors.New("两次加密使用了相同的 IV")
+	}
+
+	// 用同一个 IV 重新加密必须得到完全相同的密文 (续传下载时据此校验云端 Hash)
+	iv := cipherText[:HeaderSize]
+	r, err := NewEncryptReaderWithIV(bytes.NewReader(plain), key, iv)
+	if err != nil {
+		return err
+	}
+	if same, err := io.ReadAll(r); err != nil {
+		return err
+	} else if !bytes.Equal(same, cipherText) {
+		return fmt.Errorf("指定 IV 重新加密的密文不同 (%s)", firstDiff(same, cipherText))
+	}
+
+	// 从块内与块边界附近的偏移量续传解密
+	for _, offset := range []int{1, 15, 16, 17, size / 2, size - 1} {
+		if offset <= 0 || offset >= size {
+			continue
+		}
+		r, err := NewDecryptReaderAt(bytes.NewReader(cipherText[HeaderSize+offset:]), key, iv, int64(offset))
+		if err != nil {
+			return err
+		}
+		rest, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(rest, plain[offset:]) {
+			return fmt.Errorf("从偏移量 %d 续传解密的结果与原文不一致 (%s)", offset, firstDiff(rest, plain[offset:]))
+		}
+	}
+
+	// 错误的密钥不能还原内容 (太短的内容可能碰巧一致，不检查)
+	if size >= HeaderSize {
+		wrong, err := decryptAll(cipherText, otherKey(key))
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(wrong, plain) {
+			return errors.New("用错误的密钥解密得到了原文")
+		}
+	}
+	return nil
+}
+
+// selfTestTruncated 检查比密文头部还短的内容被识别为 ErrNotEncrypted
+func selfTestTruncated(key []byte) error {
+	_, err := NewDecryptReader(bytes.NewReader(make([]byte, HeaderSize-1)), key)
+	if !errors.Is(err, ErrNotEncrypted) {
+		return fmt.Errorf("应返回 ErrNotEncrypted，实际为 %v", err)
+	}
+	return nil
+}
+
+// selfTestName 检查文件名加密: 能解密回原文、相同的文件名总是得到相同的密文、错误的密钥无法解密
+func selfTestName(key []byte, name string) error {
+	encrypted, err := EncryptName(name, key)
+	if err != nil {
+		return fmt.Errorf("加密失败: %w", err)
+	}
+	if strings.ContainsAny(encrypted, "/\\") {
+		return fmt.Errorf("密文 %q 包含路径分隔符", encrypted)
+	}
+	again, err := EncryptName(name, key)
+	if err != nil {
+		return fmt.Errorf("加密失败: %w", err)
+	}
+	if again != encrypted {
+		return errors.New("同一个文件名两次加密的结果不同")
+	}
+	got, err := DecryptName(encrypted, key)
+	if err != nil {
+		return fmt.Errorf("解密失败: %w", err)
+	}
+	if got != name {
+		return fmt.Errorf("解密结果为 %q", got)
+	}
+	if _, err := DecryptName(encrypted, otherKey(key)); err == nil {
+		return errors.New("用错误的密钥解密成功")
+	}
+	return nil
+}
+
+func encryptAll(plain, key []byte) ([]byte, error) {
+	r, err := NewEncryptReader(bytes.NewReader(plain), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func decryptAll(cipherText, key []byte) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(cipherText), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// otherKey 返回与 key 只差一个比特的密钥
+func otherKey(key []byte) []byte {
+	other := bytes.Clone(key)
+	if len(other) > 0 {
+		other[len(other)-1] ^= 1
+	}
+	return other
+}
+
+// firstDiff 描述两段数据第一处不同的位置
+func firstDiff(got, want []byte) string {
+	n := min(len(got), len(want))
+	for i := 0; i < n; i++ {
+		if got[i] != want[i] {
+			return fmt.Sprintf("第 %d 字节开始不同", i)
+		}
+	}
+	return fmt.Sprintf("长度为 %d 字节，应为 %d 字节", len(got), len(want))
+}
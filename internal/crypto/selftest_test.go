@@ -0,0 +1,49 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	results := SelfTest(key)
+	if want := len(selfTestSizes) + 1 + len(selfTestNames); len(results) != want {
+		t.Fatalf("自检共 %d 项，应为 %d 项", len(results), want)
+	}
+	names := make([]string, 0, len(results))
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.Name, r.Err)
+		}
+		names = append(names, r.Name)
+	}
+
+	// 块边界附近的长度与数 MB 的大文件都必须覆盖
+	for _, size := range []int{0, 1, 15, 16, 17} {
+		if name := fmt.Sprintf("内容 %d 字节", size); !slices.Contains(names, name) {
+			t.Errorf("自检没有覆盖 %s", name)
+		}
+	}
+	if largest := slices.Max(selfTestSizes); largest < 1<<20 {
+		t.Errorf("最大的内容只有 %d 字节，应覆盖数 MB 的文件", largest)
+	}
+}
+
+func TestSelfTestInvalidKey(t *testing.T) {
+	// 长度不是 16 / 24 / 32 字节的密钥无法创建 AES，内容与文件名的检查都应失败
+	for _, r := range SelfTest(make([]byte, 5)) {
+		if r.Name == fmt.Sprintf("不足 %d 字节的密文", HeaderSize) {
+			continue
+		}
+		if r.Err == nil {
+			t.Errorf("%s: 无效的密钥应检查失败", r.Name)
+		}
+	}
+}
@@ -5,10 +5,18 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
 )
 
+// HeaderSize 密文头部 (IV) 的长度，密文大小 = 明文大小 + HeaderSize
+const HeaderSize = aes.BlockSize
+
+// ErrNotEncrypted 内容比密文头部还短，不可能是加密后的文件
+// 通常是开启加密前就已存在于云端的明文文件，或者上传被截断的文件
+var ErrNotEncrypted = errors.New("内容不是有效的密文")
+
 // NewEncryptReader 创建一个加密读取流
 // 输入: 明文流 (src)
 // 输出: 密文流 (包含头部 IV)
@@ -39,6 +47,7 @@ func NewEncryptReader(src io.Reader, key []byte) (io.Reader, error) {
 // NewDecryptReader 创建一个解密读取流
 // 输入: 密文流 (src, 开头必须包含 IV)
 // 输出: 明文流
+// src 不足 HeaderSize 字节时返回 ErrNotEncrypted；恰好 HeaderSize 字节时解密出空文件
 func NewDecryptReader(src io.Reader, key []byte) (io.Reader, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -48,8 +57,11 @@ func NewDecryptReader(src io.Reader, key []byte) (io.Reader, error) {
 	// 1. 读取头部的 IV
 	iv := make([]byte, aes.BlockSize)
 	// 注意：这里会从 src 中预读 16 字节，剩下的才是密文正文
-	if _, err := io.ReadFull(src, iv); err != nil {
-		return nil, fmt.Errorf("读取 IV 失败或文件太短: %w", err)
+	if n, err := io.ReadFull(src, iv); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: 只有 %d 字节，不足 %d 字节的密文头部", ErrNotEncrypted, n, HeaderSize)
+		}
+		return nil, fmt.Errorf("读取 IV 失败: %w", err)
 	}
 
 	// 2. 创建 CTR 解密流 (CTR 模式下加密和解密逻辑是一样的)
@@ -57,3 +69,57 @@ func NewDecryptReader(src io.Reader, key []byte) (io.Reader, error) {
 
 	return &cipher.StreamReader{S: stream, R: src}, nil
 }
+
+// NewEncryptReaderWithIV 使用指定的 IV 加密，输出格式与 NewEncryptReader 相同
+// CTR 模式下相同的 IV 与明文总是得到相同的密文，续传下载时用它重新计算已下载部分对应的密文 (校验云端 Hash)
+func NewEncryptReaderWithIV(src io.Reader, key, iv []byte) (io.Reader, error) {
+	stream, err := newCTRAt(key, iv, 0)
+	if err != nil {
+		return nil, err
+	}
+	return io.MultiReader(
+		bytes.NewReader(iv),
+		&cipher.StreamReader{S: stream, R: src},
+	), nil
+}
+
+// NewDecryptReaderAt 从明文的 offset 处继续解密
+// iv 为密文头部，src 为密文中 HeaderSize+offset 之后的内容 (续传下载时从断点重新请求的部分)
+func NewDecryptReaderAt(src io.Reader, key, iv []byte, offset int64) (io.Reader, error) {
+	stream, err := newCTRAt(key, iv, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &cipher.StreamReader{S: stream, R: src}, nil
+}
+
+// newCTRAt 返回从明文 offset 处开始的 CTR 密钥流
+func newCTRAt(key, iv []byte, offset int64) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("无效的密钥: %w", err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("无效的 IV: 长度为 %d 字节，应为 %d 字节", len(iv), aes.BlockSize)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("无效的偏移量: %d", offset)
+	}
+
+	// 计数器按 128 位大端整数递增 (与 cipher.NewCTR 一致)，先跳过 offset 之前的整块
+	counter := bytes.Clone(iv)
+	blocks := uint64(offset / aes.BlockSize)
+	for i := len(counter) - 1; i >= 0 && blocks > 0; i-- {
+		sum := uint64(counter[i]) + blocks&0xff
+		counter[i] = byte(sum)
+		blocks = blocks>>8 + sum>>8
+	}
+	stream := cipher.NewCTR(block, counter)
+
+	// 再丢弃块内 offset 之前的密钥流
+	if skip := offset % aes.BlockSize; skip > 0 {
+		buf := make([]byte, skip)
+		stream.XORKeyStream(buf, buf)
+	}
+	return stream, nil
+}
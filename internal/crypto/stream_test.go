@@ -0,0 +1,142 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// benchSize 每次加密 / 解密的明文大小
+const benchSize = 8 << 20
+
+// benchBuffers 对比的复制缓冲区大小: io.Copy 默认的 32KB、fs.DefaultCopyBuffer (256KB) 与 1MB
+var benchBuffers = []int{32 << 10, 256 << 10, 1 << 20}
+
+// copyWith 按 size 字节的缓冲区复制 (与 fs.CopyBuffer 相同，隐藏 ReaderFrom / WriterTo 保证按 size 读取)
+func copyWith(dst io.Writer, src io.Reader, buf []byte) error {
+	_, err := io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, buf)
+	return err
+}
+
+func benchKey(b *testing.B) []byte {
+	b.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		b.Fatal(err)
+	}
+	return key
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	key := benchKey(b)
+	plain := make([]byte, benchSize)
+	for _, size := range benchBuffers {
+		b.Run(fmt.Sprintf("buffer=%dKB", size>>10), func(b *testing.B) {
+			buf := make([]byte, size)
+			b.SetBytes(benchSize)
+			b.ReportAllocs()
+			for b.Loop() {
+				r, err := NewEncryptReader(bytes.NewReader(plain), key)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := copyWith(io.Discard, r, buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecrypt(b *testing.B) {
+	key := benchKey(b)
+	r, err := NewEncryptReader(bytes.NewReader(make([]byte, benchSize)), key)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cipherText, err := io.ReadAll(r)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, size := range benchBuffers {
+		b.Run(fmt.Sprintf("buffer=%dKB", size>>10), func(b *testing.B) {
+			buf := make([]byte, size)
+			b.SetBytes(benchSize)
+			b.ReportAllocs()
+			for b.Loop() {
+				r, err := NewDecryptReader(bytes.NewReader(cipherText), key)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := copyWith(io.Discard, r, buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecryptReaderShortInput(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	for _, n := range []int{0, 5, HeaderSize - 1} {
+		_, err := NewDecryptReader(bytes.NewReader(make([]byte, n)), key)
+		if !errors.Is(err, ErrNotEncrypted) {
+			t.Errorf("%d 字节的密文: 错误为 %v，应为 ErrNotEncrypted", n, err)
+		}
+	}
+
+	// 恰好只有头部: 空文件
+	r, err := NewDecryptReader(bytes.NewReader(make([]byte, HeaderSize)), key)
+	if err != nil {
+		t.Fatalf("%d 字节的密文: %v", HeaderSize, err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) != 0 {
+		t.Fatalf("%d 字节的密文解密出 %d 字节，应为空", HeaderSize, len(plain))
+	}
+}
+
+// errReader 读取时总是返回 err
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestDecryptReaderReadError(t *testing.T) {
+	boom := errors.New("连接断开")
+	_, err := NewDecryptReader(errReader{boom}, bytes.Repeat([]byte{1}, 32))
+	if !errors.Is(err, boom) || errors.Is(err, ErrNotEncrypted) {
+		t.Fatalf("错误为 %v，应为读取错误而不是 ErrNotEncrypted", err)
+	}
+}
+
+func TestEmptyRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	r, err := NewEncryptReader(bytes.NewReader(nil), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipherText, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cipherText) != HeaderSize {
+		t.Fatalf("空文件加密后为 %d 字节，应为 %d 字节", len(cipherText), HeaderSize)
+	}
+	r, err = NewDecryptReader(bytes.NewReader(cipherText), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) != 0 {
+		t.Fatalf("解密出 %d 字节，应为空", len(plain))
+	}
+}
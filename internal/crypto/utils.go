@@ -5,6 +5,7 @@ import (
 	"crypto/cipher"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 )
 
@@ -73,6 +74,12 @@ func DecryptName(encryptedName string, key []byte) (string, error) {
 	return string(plaintext), nil
 }
 
+// KeyID 返回密钥的指纹 (SHA-256 的前 8 字节)，用于区分文件是用哪个密钥加密的，不会泄露密钥本身
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
 // CalculateHash 计算流的 MD5/SHA1 (用于校验)
 // 注意：如果用于大文件，这会消耗 IO。通常直接用 os.File 读取。
 // func CalculateHash(...) {}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// backupTimeFormat 备份文件名中的时间格式 (字典序即时间序)
+const backupTimeFormat = "20060102-150405.000"
+
+// backupPrefix 根据数据库文件名生成备份文件前缀
+// "./sync_state.db" -> "sync_state-"
+func backupPrefix(dbPath string) string {
+	base := filepath.Base(dbPath)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// Backup 将当前数据库快照复制到 dir 目录，并只保留最近 keep 份备份
+// 使用只读事务中的 Tx.CopyFile，备份期间不会阻塞其他读操作
+// 返回新备份文件的路径
+func (d *DB) Backup(dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建备份目录失败: %w", err)
+	}
+
+	prefix := backupPrefix(d.conn.Path())
+	name := prefix + time.Now().Format(backupTimeFormat) + ".bak"
+	target := filepath.Join(dir, name)
+
+	err := d.conn.View(func(tx *bbolt.Tx) error {
+		return tx.CopyFile(target, 0600)
+	})
+	if err != nil {
+		return "", fmt.Errorf("备份数据库失败: %w", err)
+	}
+
+	if keep > 0 {
+		if err := pruneBackups(dir, prefix, keep); err != nil {
+			return target, fmt.Errorf("清理旧备份失败: %w", err)
+		}
+	}
+	return target, nil
+}
+
+// ListBackups 列出 dir 中属于 dbPath 的所有备份，按时间从旧到新排序
+func ListBackups(dir, dbPath string) ([]string, error) {
+	return listBackups(dir, backupPrefix(dbPath))
+}
+
+func listBackups(dir, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".bak") {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, name))
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// pruneBackups 删除超出保留数量的旧备份
+func pruneBackups(dir, prefix string, keep int) error {
+	backups, err := listBackups(dir, prefix)
+	if err != nil {
+		return err
+	}
+	for len(backups) > keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// RestoreBackup 用备份文件覆盖数据库文件
+// 调用前必须确保数据库没有被打开 (包括其他进程)。
+// 覆盖前会校验备份文件能被正常打开，并把当前数据库另存为 dbPath+".before-restore"
+func RestoreBackup(backupPath, dbPath string) error {
+	// 1. 校验备份文件的完整性
+	check, err := bbolt.Open(backupPath, 0600, &bbolt.Options{ReadOnly: true, Timeout: 1 * time.Second})
+	if err != nil {
+		return fmt.Errorf("备份文件无法打开: %w", err)
+	}
+	check.Close()
+
+	// 2. 保留当前数据库，防止误操作
+	if _, err := os.Stat(dbPath); err == nil {
+		// 能拿到文件锁才说明没有其他进程正在使用该数据库
+		current, err := bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+		if err != nil {
+			return fmt.Errorf("数据库正在被使用，请先停止同步进程: %w", err)
+		}
+		current.Close()
+
+		if err := copyFile(dbPath, dbPath+".before-restore"); err != nil {
+			return fmt.Errorf("保存当前数据库失败: %w", err)
+		}
+	}
+
+	// 3. 先写入临时文件再重命名，避免中途失败留下损坏的数据库
+	tmp := dbPath + ".restoring"
+	if err := copyFile(backupPath, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("复制备份文件失败: %w", err)
+	}
+	return os.Rename(tmp, dbPath)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
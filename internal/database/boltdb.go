@@ -1,8 +1,10 @@
 package database
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"go.etcd.io/bbolt"
@@ -14,8 +16,10 @@ const (
 )
 
 // DB 封装 BoltDB 实例
+// 多个 Profile 共享同一个数据库文件，各自的快照存放在独立的 Bucket 中
 type DB struct {
-	conn *bbolt.DB
+	conn   *bbolt.DB
+	bucket []byte // 当前实例读写的快照 Bucket
 }
 
 // NewBoltDB 初始化并打开数据库
@@ -38,7 +42,36 @@ func NewBoltDB(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("创建 Bucket 失败: %w", err)
 	}
 
-	return &DB{conn: db}, nil
+	// 检查数据格式版本并执行必要的升级
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &DB{conn: db, bucket: []byte(BucketName)}, nil
+}
+
+// profileBucketName 返回 Profile 对应的快照 Bucket 名称
+// 默认 Profile 沿用旧的 Bucket，保证升级前的数据可以直接使用
+func profileBucketName(profile string) string {
+	if profile == "" || profile == "default" {
+		return BucketName
+	}
+	return BucketName + ":" + profile
+}
+
+// Profile 返回只读写指定 Profile 快照的数据库视图
+// 返回的实例与原实例共享同一个连接，只需关闭原实例一次
+func (d *DB) Profile(name string) (*DB, error) {
+	bucket := []byte(profileBucketName(name))
+	err := d.conn.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建 Profile Bucket 失败 (%s): %w", name, err)
+	}
+	return &DB{conn: d.conn, bucket: bucket}, nil
 }
 
 // Close 关闭数据库连接
@@ -50,7 +83,7 @@ func (d *DB) Close() error {
 func (d *DB) Get(relPath string) (*FileState, error) {
 	var state FileState
 	err := d.conn.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(BucketName))
+		b := tx.Bucket(d.bucket)
 		v := b.Get([]byte(relPath))
 		if v == nil {
 			return fmt.Errorf("not found") // 简单的哨兵错误
@@ -68,8 +101,11 @@ func (d *DB) Get(relPath string) (*FileState, error) {
 }
 
 // Put 保存或更新文件的快照状态
+// LastSyncTime 为 0 时记为当前时间
 func (d *DB) Put(state *FileState) error {
-	state.LastSyncTime = time.Now().UnixNano()
+	if state.LastSyncTime == 0 {
+		state.LastSyncTime = time.Now().UnixNano()
+	}
 
 	data, err := json.Marshal(state)
 	if err != nil {
@@ -77,7 +113,7 @@ func (d *DB) Put(state *FileState) error {
 	}
 
 	return d.conn.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(BucketName))
+		b := tx.Bucket(d.bucket)
 		return b.Put([]byte(state.RelPath), data)
 	})
 }
@@ -85,18 +121,30 @@ func (d *DB) Put(state *FileState) error {
 // Delete 删除文件的快照记录 (当文件被删除时调用)
 func (d *DB) Delete(relPath string) error {
 	return d.conn.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(BucketName))
+		b := tx.Bucket(d.bucket)
 		return b.Delete([]byte(relPath))
 	})
 }
 
-// ListAll 获取所有缓存的文件状态
-// 在同步开始时调用，用于构建 Base 状态树
-func (d *DB) ListAll() (map[string]*FileState, error) {
-	result := make(map[string]*FileState)
-
+// Empty 当前 Profile 是否还没有任何快照记录 (从未同步过，或数据库丢失)
+func (d *DB) Empty() (bool, error) {
+	empty := true
 	err := d.conn.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(BucketName))
+		if k, _ := tx.Bucket(d.bucket).Cursor().First(); k != nil {
+			empty = false
+		}
+		return nil
+	})
+	return empty, err
+}
+
+// ForEach 按 Key 顺序流式遍历所有文件状态
+// 与 ListAll 不同，它不会把全部记录加载进内存，适合记录数巨大的场景。
+// 注意: fn 在只读事务中执行，不能在 fn 内调用 Put/Delete 等写操作 (会死锁)。
+// fn 返回错误时遍历立即终止并返回该错误。
+func (d *DB) ForEach(fn func(state *FileState) error) error {
+	return d.conn.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(d.bucket)
 
 		return b.ForEach(func(k, v []byte) error {
 			var state FileState
@@ -105,6 +153,71 @@ func (d *DB) ListAll() (map[string]*FileState, error) {
 				// 这里为了严谨选择返回错误
 				return fmt.Errorf("解析数据失败 key=%s: %w", string(k), err)
 			}
+			state.RelPath = string(k) // 以 Key 为准
+			return fn(&state)
+		})
+	})
+}
+
+// ListAll 获取所有缓存的文件状态
+func (d *DB) ListAll() (map[string]*FileState, error) {
+	result := make(map[string]*FileState)
+
+	err := d.ForEach(func(state *FileState) error {
+		result[state.RelPath] = state
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// scanPrefix 按目录语义遍历前缀区间内的记录
+// "docs" 匹配 "docs" 本身及 "docs/..." 下的所有记录，但不会匹配 "documents"。
+// 空前缀匹配全部记录。利用 BoltDB 的 Key 有序特性，通过 Cursor.Seek 只遍历相关区间。
+func scanPrefix(b *bbolt.Bucket, prefix string, fn func(k, v []byte) error) error {
+	prefix = strings.TrimSuffix(prefix, "/")
+	c := b.Cursor()
+	if prefix == "" || prefix == "." {
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	exact := []byte(prefix)
+	dirPrefix := []byte(prefix + "/")
+	for k, v := c.Seek(exact); k != nil; k, v = c.Next() {
+		if bytes.Equal(k, exact) || bytes.HasPrefix(k, dirPrefix) {
+			if err := fn(k, v); err != nil {
+				return err
+			}
+			continue
+		}
+		// "docs" 与 "docs/" 之间可能夹着 "docs-old" 这类 Key (因为 '-' < '/')
+		// 只有越过了 "docs/" 区间才能结束遍历
+		if bytes.Compare(k, dirPrefix) > 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// ListByPrefix 获取某个目录 (及其自身) 下的所有文件状态
+func (d *DB) ListByPrefix(prefix string) (map[string]*FileState, error) {
+	result := make(map[string]*FileState)
+
+	err := d.conn.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(d.bucket)
+		return scanPrefix(b, prefix, func(k, v []byte) error {
+			var state FileState
+			if err := json.Unmarshal(v, &state); err != nil {
+				return fmt.Errorf("解析数据失败 key=%s: %w", string(k), err)
+			}
 			result[string(k)] = &state
 			return nil
 		})
@@ -115,3 +228,90 @@ func (d *DB) ListAll() (map[string]*FileState, error) {
 	}
 	return result, nil
 }
+
+// DeleteByPrefix 删除某个目录 (及其自身) 下的所有快照记录
+// 返回实际删除的记录数
+func (d *DB) DeleteByPrefix(prefix string) (int, error) {
+	deleted := 0
+
+	err := d.conn.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(d.bucket)
+		// 先收集再删除，避免在遍历过程中修改 Bucket 导致游标错位
+		var keys [][]byte
+		err := scanPrefix(b, prefix, func(k, _ []byte) error {
+			keys = append(keys, append([]byte(nil), k...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		deleted = len(keys)
+		return nil
+	})
+
+	return deleted, err
+}
+
+// RekeyAll 用 fn 重写所有记录的 Key (例如统一大小写或 Unicode 规范化形式)
+// 多条记录映射到同一个新 Key 时，保留 LastSyncTime 最新的一条。返回被改写或合并的记录数
+func (d *DB) RekeyAll(fn func(key string) string) (int, error) {
+	changed := 0
+
+	err := d.conn.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(d.bucket)
+
+		// 先收集再修改，避免在遍历过程中修改 Bucket 导致游标错位
+		moved := make(map[string]*FileState)
+		var oldKeys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			newKey := fn(string(k))
+			if newKey == string(k) {
+				return nil
+			}
+			var state FileState
+			if err := json.Unmarshal(v, &state); err != nil {
+				return fmt.Errorf("解析数据失败 key=%s: %w", string(k), err)
+			}
+			oldKeys = append(oldKeys, append([]byte(nil), k...))
+			if prev, ok := moved[newKey]; !ok || state.LastSyncTime > prev.LastSyncTime {
+				moved[newKey] = &state
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range oldKeys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		for newKey, state := range moved {
+			// 新 Key 上已有记录时，同样保留较新的一条
+			if v := b.Get([]byte(newKey)); v != nil {
+				var existing FileState
+				if err := json.Unmarshal(v, &existing); err == nil && existing.LastSyncTime >= state.LastSyncTime {
+					continue
+				}
+			}
+			state.RelPath = newKey
+			data, err := json.Marshal(state)
+			if err != nil {
+				return fmt.Errorf("序列化失败: %w", err)
+			}
+			if err := b.Put([]byte(newKey), data); err != nil {
+				return err
+			}
+		}
+		changed = len(oldKeys)
+		return nil
+	})
+
+	return changed, err
+}
@@ -0,0 +1,414 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// openTestDB 在临时目录中创建数据库
+func openTestDB(tb testing.TB) *DB {
+	tb.Helper()
+	db, err := NewBoltDB(filepath.Join(tb.TempDir(), "state.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// putPaths 为每个路径写入一条记录
+func putPaths(tb testing.TB, db *DB, paths ...string) {
+	tb.Helper()
+	for _, p := range paths {
+		if err := db.Put(&FileState{RelPath: p, FileSize: int64(len(p))}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// keys 返回 map 中的 Key (已排序)
+func keys(m map[string]*FileState) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// prefixFixture 包含嵌套目录，以及与目录名有相同前缀的兄弟路径 ('-' 与 '.' 都排在 '/' 之前)
+var prefixFixture = []string{
+	"docs",
+	"docs/a.txt",
+	"docs/sub",
+	"docs/sub/b.txt",
+	"docs/sub/deeper/c.txt",
+	"docs-old/x.txt",
+	"docs.bak",
+	"documents/d.txt",
+	"zeta.txt",
+}
+
+func TestListByPrefix(t *testing.T) {
+	db := openTestDB(t)
+	putPaths(t, db, prefixFixture...)
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"docs", []string{"docs", "docs/a.txt", "docs/sub", "docs/sub/b.txt", "docs/sub/deeper/c.txt"}},
+		{"docs/", []string{"docs", "docs/a.txt", "docs/sub", "docs/sub/b.txt", "docs/sub/deeper/c.txt"}},
+		{"docs/sub", []string{"docs/sub", "docs/sub/b.txt", "docs/sub/deeper/c.txt"}},
+		{"docs/sub/deeper", []string{"docs/sub/deeper/c.txt"}},
+		{"doc", nil},
+		{"documents", []string{"documents/d.txt"}},
+		{"docs/a.txt", []string{"docs/a.txt"}},
+		{"missing", nil},
+		{"", prefixFixture},
+	}
+	for _, tt := range tests {
+		got, err := db.ListByPrefix(tt.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := append([]string(nil), tt.want...)
+		sort.Strings(want)
+		if !slices.Equal(keys(got), want) {
+			t.Errorf("ListByPrefix(%q) = %v，应为 %v", tt.prefix, keys(got), want)
+		}
+	}
+}
+
+func TestDeleteByPrefix(t *testing.T) {
+	db := openTestDB(t)
+	putPaths(t, db, prefixFixture...)
+
+	n, err := db.DeleteByPrefix("docs/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("删除了 %d 条记录，应为 3 条", n)
+	}
+
+	// "docs" 不能连带删除 "docs-old"、"docs.bak" 与 "documents"
+	n, err = db.DeleteByPrefix("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("删除了 %d 条记录，应为 2 条", n)
+	}
+
+	all, err := db.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"docs-old/x.txt", "docs.bak", "documents/d.txt", "zeta.txt"}
+	if !slices.Equal(keys(all), want) {
+		t.Fatalf("剩余的记录为 %v，应为 %v", keys(all), want)
+	}
+}
+
+// writeRawDB 不经过 NewBoltDB (不执行迁移) 直接创建数据库文件，用于模拟其他版本的程序写入的数据库
+func writeRawDB(t *testing.T, path string, fn func(tx *bbolt.Tx) error) {
+	t.Helper()
+	conn, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.Update(fn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rawSchemaVersion 直接读取数据库文件中记录的 Schema 版本 (没有记录时为空)
+func rawSchemaVersion(t *testing.T, path string) string {
+	t.Helper()
+	conn, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var version string
+	err = conn.View(func(tx *bbolt.Tx) error {
+		if meta := tx.Bucket([]byte(MetaBucketName)); meta != nil {
+			version = string(meta.Get([]byte(schemaVersionKey)))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestOpenNewDBWritesSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	db, err := NewBoltDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if got, want := rawSchemaVersion(t, path), fmt.Sprint(CurrentSchemaVersion); got != want {
+		t.Fatalf("Schema 版本为 %q，应为 %q", got, want)
+	}
+}
+
+func TestOpenUpgradesUnversionedDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	// v0: 只有快照 Bucket，没有 Meta Bucket
+	writeRawDB(t, path, func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(BucketName))
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(&FileState{RelPath: "docs/a.txt", FileSize: 42, LocalHash: "abc"})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("docs/a.txt"), data)
+	})
+
+	db, err := NewBoltDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := db.Get("docs/a.txt")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == nil || state.FileSize != 42 || state.LocalHash != "abc" {
+		t.Fatalf("升级后的记录为 %+v", state)
+	}
+	if got, want := rawSchemaVersion(t, path), fmt.Sprint(CurrentSchemaVersion); got != want {
+		t.Fatalf("升级后 Schema 版本为 %q，应为 %q", got, want)
+	}
+}
+
+func TestOpenRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	newer := fmt.Sprint(CurrentSchemaVersion + 1)
+	writeRawDB(t, path, func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucket([]byte(MetaBucketName))
+		if err != nil {
+			return err
+		}
+		return meta.Put([]byte(schemaVersionKey), []byte(newer))
+	})
+
+	db, err := NewBoltDB(path)
+	if err == nil {
+		db.Close()
+		t.Fatal("数据库版本高于程序支持的版本时应拒绝打开")
+	}
+	if !strings.Contains(err.Error(), "高于当前程序支持的版本") {
+		t.Fatalf("错误为 %v，应提示升级程序", err)
+	}
+	// 拒绝打开时不能改写版本号，连接也已经关闭 (可以再次打开)
+	if got := rawSchemaVersion(t, path); got != newer {
+		t.Fatalf("Schema 版本被改写为 %q，应保持 %q", got, newer)
+	}
+}
+
+// completedKeys 返回 BeginCycle 得到的已完成任务 Key (已排序)
+func completedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestCycleResumesInterruptedRun(t *testing.T) {
+	db := openTestDB(t)
+
+	interrupted, completed, err := db.BeginCycle("run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupted != nil || completed != nil {
+		t.Fatalf("首次同步不应有中断的记录: %+v %v", interrupted, completed)
+	}
+	for _, key := range []string{"upload|a.txt", "upload|b.txt"} {
+		if err := db.MarkTaskDone(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// run-1 没有调用 FinishCycle 就退出: 下一轮拿到它的进度与已完成的任务
+	interrupted, completed, err = db.BeginCycle("run-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupted == nil || interrupted.RunID != "run-1" || interrupted.Started == 0 {
+		t.Fatalf("中断的同步为 %+v，应为 run-1", interrupted)
+	}
+	if want := []string{"upload|a.txt", "upload|b.txt"}; !slices.Equal(completedKeys(completed), want) {
+		t.Fatalf("已完成的任务为 %v，应为 %v", completedKeys(completed), want)
+	}
+
+	// run-2 也中断: 记录保留到有一轮正常结束，run-2 完成的任务一并累积
+	if err := db.MarkTaskDone("upload|c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	interrupted, completed, err = db.BeginCycle("run-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupted == nil || interrupted.RunID != "run-2" || len(completed) != 3 {
+		t.Fatalf("中断的同步为 %+v，已完成 %v，应为 run-2 与 3 个任务", interrupted, completedKeys(completed))
+	}
+}
+
+func TestFinishCycle(t *testing.T) {
+	db := openTestDB(t)
+
+	// 有任务失败: 清除进度，但不更新最近一次成功同步
+	if _, _, err := db.BeginCycle("run-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MarkTaskDone("upload|a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FinishCycle(false); err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := db.Cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.InProgress() || cursor.Started != 0 {
+		t.Fatalf("同步结束后仍在进行中: %+v", cursor)
+	}
+	if !cursor.LastSuccessAsTime().IsZero() || cursor.LastSuccessRunID != "" {
+		t.Fatalf("有任务失败时不应更新最近一次成功同步: %+v", cursor)
+	}
+
+	interrupted, completed, err := db.BeginCycle("run-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupted != nil || len(completed) != 0 {
+		t.Fatalf("上一轮已经结束，不应再有进度: %+v %v", interrupted, completedKeys(completed))
+	}
+
+	// 全部成功: 记录本轮的结束时间与 Run ID
+	if err := db.MarkTaskDone("upload|b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	if err := db.FinishCycle(true); err != nil {
+		t.Fatal(err)
+	}
+	cursor, err = db.Cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.InProgress() {
+		t.Fatalf("同步结束后仍在进行中: %+v", cursor)
+	}
+	if cursor.LastSuccessRunID != "run-2" || cursor.LastSuccessAsTime().Before(before) {
+		t.Fatalf("最近一次成功同步为 %s (%s)，应为 run-2", cursor.LastSuccessRunID, cursor.LastSuccessAsTime())
+	}
+	if err := db.conn.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(db.progressBucket()) != nil {
+			return fmt.Errorf("已完成任务的记录没有清除")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 之后失败的同步保留最近一次成功的记录
+	if _, _, err := db.BeginCycle("run-3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FinishCycle(false); err != nil {
+		t.Fatal(err)
+	}
+	if cursor, err = db.Cursor(); err != nil {
+		t.Fatal(err)
+	}
+	if cursor.LastSuccessRunID != "run-2" {
+		t.Fatalf("最近一次成功同步为 %s，应保留 run-2", cursor.LastSuccessRunID)
+	}
+}
+
+// fillDB 在一个事务中写入 n 条记录 (逐条 Put 每次都要提交事务，准备大量数据时太慢)
+func fillDB(b *testing.B, db *DB, n int) {
+	b.Helper()
+	err := db.conn.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(db.bucket)
+		for i := range n {
+			state := &FileState{
+				RelPath:    fmt.Sprintf("dir%03d/file%06d.dat", i/200, i),
+				FileSize:   int64(i),
+				ModTime:    int64(i) * 1e9,
+				LocalHash:  "0123456789abcdef0123456789abcdef",
+				RemoteHash: "fedcba9876543210fedcba9876543210",
+			}
+			data, err := json.Marshal(state)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(state.RelPath), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+const benchRecords = 100_000
+
+// BenchmarkForEach 流式遍历: 同一时刻只有一条记录在内存中
+func BenchmarkForEach(b *testing.B) {
+	db := openTestDB(b)
+	fillDB(b, db, benchRecords)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		var total int64
+		err := db.ForEach(func(state *FileState) error {
+			total += state.FileSize
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkListAll 对照组: 一次性把全部记录加载进 map
+func BenchmarkListAll(b *testing.B) {
+	db := openTestDB(b)
+	fillDB(b, db, benchRecords)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		all, err := db.ListAll()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(all) != benchRecords {
+			b.Fatalf("读取了 %d 条记录", len(all))
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// conflictBucketPrefix 冲突历史的 Bucket 前缀，每个 Profile 一个 (与快照 Bucket 一一对应)
+const conflictBucketPrefix = "ConflictLog"
+
+// ConflictHistoryLimit 每个路径保留的冲突历史条数，超出时丢弃最早的
+const ConflictHistoryLimit = 20
+
+// ConflictEntry 一次冲突处理的记录，用于排查反复冲突 (两侧来回覆盖) 的文件
+type ConflictEntry struct {
+	// Time 处理冲突的时间 (Unix Nano)
+	Time int64 `json:"time"`
+	// Strategy 采用的冲突策略 (配置中的名称)
+	Strategy string `json:"strategy"`
+	// Winner 原路径最终保留的版本: local、remote，或 none (暂不处理)
+	Winner string `json:"winner"`
+	// Copy 另一个版本改名后的路径 (改名类策略与 keep_both，其他策略为空)
+	Copy string `json:"copy,omitempty"`
+	// 冲突时两侧的大小 (云端为后端中的大小，加密时包含加密开销) 与 Hash (扫描时没有计算的为空)
+	LocalSize  int64  `json:"local_size"`
+	RemoteSize int64  `json:"remote_size"`
+	LocalHash  string `json:"local_hash,omitempty"`
+	RemoteHash string `json:"remote_hash,omitempty"`
+	// Error 处理失败时的错误 (成功时为空)
+	Error string `json:"error,omitempty"`
+}
+
+// TimeAsTime 辅助方法：将处理时间转为 Go Time 对象
+func (c *ConflictEntry) TimeAsTime() time.Time {
+	return time.Unix(0, c.Time)
+}
+
+// conflictBucket 当前 Profile 的冲突历史 Bucket
+func (d *DB) conflictBucket() []byte {
+	return []byte(conflictBucketPrefix + strings.TrimPrefix(string(d.bucket), BucketName))
+}
+
+// AddConflict 追加 relPath 的一条冲突记录，只保留最近的 ConflictHistoryLimit 条
+func (d *DB) AddConflict(relPath string, entry *ConflictEntry) error {
+	return d.conn.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(d.conflictBucket())
+		if err != nil {
+			return err
+		}
+		var history []ConflictEntry
+		if v := b.Get([]byte(relPath)); v != nil {
+			if err := json.Unmarshal(v, &history); err != nil {
+				return fmt.Errorf("解析冲突历史失败 (%s): %w", relPath, err)
+			}
+		}
+		history = append(history, *entry)
+		if len(history) > ConflictHistoryLimit {
+			history = history[len(history)-ConflictHistoryLimit:]
+		}
+		data, err := json.Marshal(history)
+		if err != nil {
+			return fmt.Errorf("序列化失败: %w", err)
+		}
+		return b.Put([]byte(relPath), data)
+	})
+}
+
+// ForEachConflict 按路径顺序遍历当前 Profile 的冲突历史 (每个路径的记录按时间从早到晚)
+func (d *DB) ForEachConflict(fn func(relPath string, history []ConflictEntry) error) error {
+	return d.conn.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(d.conflictBucket())
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var history []ConflictEntry
+			if err := json.Unmarshal(v, &history); err != nil {
+				return fmt.Errorf("解析冲突历史失败 (%s): %w", k, err)
+			}
+			return fn(string(k), history)
+		})
+	})
+}
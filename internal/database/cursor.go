@@ -0,0 +1,185 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// progressBucketPrefix 记录进行中的同步已完成哪些任务的 Bucket 前缀，后接快照 Bucket 名称
+const progressBucketPrefix = "Progress:"
+
+// SyncCursor 一个 Profile 的整体同步进度，保存在 Meta Bucket 中
+type SyncCursor struct {
+	// RunID / Started 进行中的同步；同步正常结束后清空
+	// 启动时仍不为空，说明上一轮同步中途退出 (进程崩溃、被强制结束或程序退出时被中断)
+	RunID   string `json:"run_id,omitempty"`
+	Started int64  `json:"started,omitempty"` // Unix Nano
+
+	// LastSuccess 最近一次完整且没有任何失败的同步的结束时间 (Unix Nano)
+	LastSuccess      int64  `json:"last_success,omitempty"`
+	LastSuccessRunID string `json:"last_success_run_id,omitempty"`
+
+	// ClockSkew 最近一次测量的时钟偏差 (云端时间 - 本机时间，纳秒)，ClockSkewAt 为测量时间 (Unix Nano，从未测量时为 0)
+	ClockSkew   int64 `json:"clock_skew,omitempty"`
+	ClockSkewAt int64 `json:"clock_skew_at,omitempty"`
+}
+
+// InProgress 是否有尚未结束的同步
+func (c *SyncCursor) InProgress() bool {
+	return c.RunID != ""
+}
+
+// LastSuccessAsTime 辅助方法：将最近一次成功同步的时间转为 Go Time 对象 (从未成功时为零值)
+func (c *SyncCursor) LastSuccessAsTime() time.Time {
+	if c.LastSuccess == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, c.LastSuccess)
+}
+
+// ClockSkewAsDuration 辅助方法：返回最近一次测量的时钟偏差，从未测量时 ok 为 false
+func (c *SyncCursor) ClockSkewAsDuration() (skew time.Duration, ok bool) {
+	return time.Duration(c.ClockSkew), c.ClockSkewAt != 0
+}
+
+// cursorKey 当前 Profile 的进度在 Meta Bucket 中的 Key
+func (d *DB) cursorKey() []byte {
+	return []byte("cursor:" + string(d.bucket))
+}
+
+// progressBucket 当前 Profile 记录已完成任务的 Bucket 名称
+func (d *DB) progressBucket() []byte {
+	return []byte(progressBucketPrefix + string(d.bucket))
+}
+
+// clearProgress 删除已完成任务的记录
+func (d *DB) clearProgress(tx *bbolt.Tx) error {
+	if tx.Bucket(d.progressBucket()) == nil {
+		return nil
+	}
+	return tx.DeleteBucket(d.progressBucket())
+}
+
+// readCursor 读取进度，没有记录时返回零值
+func (d *DB) readCursor(tx *bbolt.Tx) (*SyncCursor, error) {
+	cursor := &SyncCursor{}
+	meta := tx.Bucket([]byte(MetaBucketName))
+	if meta == nil {
+		return cursor, nil
+	}
+	data := meta.Get(d.cursorKey())
+	if data == nil {
+		return cursor, nil
+	}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, fmt.Errorf("解析同步进度失败: %w", err)
+	}
+	return cursor, nil
+}
+
+// writeCursor 保存进度
+func (d *DB) writeCursor(tx *bbolt.Tx, cursor *SyncCursor) error {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return fmt.Errorf("序列化同步进度失败: %w", err)
+	}
+	meta, err := tx.CreateBucketIfNotExists([]byte(MetaBucketName))
+	if err != nil {
+		return err
+	}
+	return meta.Put(d.cursorKey(), data)
+}
+
+// Cursor 读取当前 Profile 的同步进度
+func (d *DB) Cursor() (*SyncCursor, error) {
+	var cursor *SyncCursor
+	err := d.conn.View(func(tx *bbolt.Tx) error {
+		var err error
+		cursor, err = d.readCursor(tx)
+		return err
+	})
+	return cursor, err
+}
+
+// BeginCycle 记录一轮同步开始
+// 上一轮同步没有正常结束时，返回它的进度以及已经完成的任务 Key，这些记录会保留到本轮正常结束；
+// 否则 interrupted 为 nil
+func (d *DB) BeginCycle(runID string) (interrupted *SyncCursor, completed map[string]bool, err error) {
+	err = d.conn.Update(func(tx *bbolt.Tx) error {
+		cursor, err := d.readCursor(tx)
+		if err != nil {
+			return err
+		}
+
+		if cursor.InProgress() {
+			previous := *cursor
+			interrupted = &previous
+			completed = make(map[string]bool)
+			if b := tx.Bucket(d.progressBucket()); b != nil {
+				err := b.ForEach(func(k, _ []byte) error {
+					completed[string(k)] = true
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+		} else if err := d.clearProgress(tx); err != nil {
+			return err
+		}
+
+		cursor.RunID = runID
+		cursor.Started = time.Now().UnixNano()
+		return d.writeCursor(tx, cursor)
+	})
+	return interrupted, completed, err
+}
+
+// MarkTaskDone 记录本轮同步中已经完成的任务，进程中途退出后重新同步时可以跳过
+func (d *DB) MarkTaskDone(key string) error {
+	return d.conn.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(d.progressBucket())
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), nil)
+	})
+}
+
+// FinishCycle 记录一轮同步正常结束，清除已完成任务的记录
+// success 为 true (所有任务都成功) 时同时更新最近一次成功同步的时间
+func (d *DB) FinishCycle(success bool) error {
+	return d.conn.Update(func(tx *bbolt.Tx) error {
+		cursor, err := d.readCursor(tx)
+		if err != nil {
+			return err
+		}
+		if err := d.clearProgress(tx); err != nil {
+			return err
+		}
+
+		if success {
+			cursor.LastSuccess = time.Now().UnixNano()
+			cursor.LastSuccessRunID = cursor.RunID
+		}
+		cursor.RunID = ""
+		cursor.Started = 0
+		return d.writeCursor(tx, cursor)
+	})
+}
+
+// SaveClockSkew 记录本次测量的时钟偏差 (云端时间 - 本机时间)
+func (d *DB) SaveClockSkew(skew time.Duration) error {
+	return d.conn.Update(func(tx *bbolt.Tx) error {
+		cursor, err := d.readCursor(tx)
+		if err != nil {
+			return err
+		}
+		cursor.ClockSkew = int64(skew)
+		cursor.ClockSkewAt = time.Now().UnixNano()
+		return d.writeCursor(tx, cursor)
+	})
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	// MetaBucketName 存放数据库自身元信息 (Schema 版本等) 的 Bucket
+	MetaBucketName = "Meta"
+
+	// CurrentSchemaVersion 当前程序使用的数据格式版本
+	// 修改 FileState 的字段含义或存储方式时必须递增，并在 migrations 中补充升级步骤
+	CurrentSchemaVersion = 1
+
+	schemaVersionKey = "schema_version"
+)
+
+// migration 将数据从 version 升级到 version+1
+type migration func(tx *bbolt.Tx) error
+
+// migrations 按起始版本索引的升级步骤
+// migrations[0] 表示 0 -> 1，依此类推
+var migrations = map[int]migration{
+	// v0: 没有 Meta Bucket 的旧版数据库，记录格式与 v1 完全一致，只需补写版本号
+	0: func(tx *bbolt.Tx) error { return nil },
+}
+
+// readSchemaVersion 读取磁盘上的 Schema 版本
+// 没有版本记录时: 如果已经存在快照数据，说明是旧版数据库 (v0)；否则是全新数据库
+func readSchemaVersion(tx *bbolt.Tx) (int, error) {
+	if meta := tx.Bucket([]byte(MetaBucketName)); meta != nil {
+		if v := meta.Get([]byte(schemaVersionKey)); v != nil {
+			version, err := strconv.Atoi(string(v))
+			if err != nil {
+				return 0, fmt.Errorf("无法识别的 Schema 版本 %q: %w", string(v), err)
+			}
+			return version, nil
+		}
+	}
+
+	if b := tx.Bucket([]byte(BucketName)); b != nil {
+		if k, _ := b.Cursor().First(); k != nil {
+			return 0, nil
+		}
+	}
+	return CurrentSchemaVersion, nil
+}
+
+// writeSchemaVersion 写入 Schema 版本
+func writeSchemaVersion(tx *bbolt.Tx, version int) error {
+	meta, err := tx.CreateBucketIfNotExists([]byte(MetaBucketName))
+	if err != nil {
+		return err
+	}
+	return meta.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(version)))
+}
+
+// migrate 在打开数据库时执行，将旧格式的数据逐级升级到当前版本
+// 如果磁盘上的版本比程序更新 (用户降级了程序)，拒绝打开以免误读数据
+func migrate(db *bbolt.DB) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		version, err := readSchemaVersion(tx)
+		if err != nil {
+			return err
+		}
+
+		if version > CurrentSchemaVersion {
+			return fmt.Errorf("数据库格式版本 (v%d) 高于当前程序支持的版本 (v%d)，请升级 BaiduSync 后再使用",
+				version, CurrentSchemaVersion)
+		}
+
+		for version < CurrentSchemaVersion {
+			step, ok := migrations[version]
+			if !ok {
+				return fmt.Errorf("缺少从 v%d 升级的迁移步骤", version)
+			}
+			slog.Info("升级数据库格式", "from", version, "to", version+1)
+			if err := step(tx); err != nil {
+				return fmt.Errorf("数据库从 v%d 升级失败: %w", version, err)
+			}
+			version++
+		}
+
+		return writeSchemaVersion(tx, version)
+	})
+}
@@ -24,9 +24,25 @@ type FileState struct {
 	// 对于百度网盘，这里通常存的是云端返回的 MD5
 	RemoteHash string `json:"remote_hash"`
 
+	// 云端内容的分片 MD5 列表 (仅记录 Hash 对大文件不可靠的后端上超过限制的文件，见 fs.BlockHasher)
+	// 百度网盘超过 256MB 的文件列表中的 md5 可能变化，此时按分片 MD5 列表确认内容是否真的改变
+	RemoteBlocks []string `json:"remote_blocks,omitempty"`
+
 	// 是否为文件夹
 	IsDir bool `json:"is_dir"`
 
+	// 上次同步时本地文件的权限位 (仅开启 preserve_mode 时记录，0 表示未记录)
+	// 网盘不保存 POSIX 权限，下载时据此恢复可执行位等权限
+	Mode uint32 `json:"mode,omitempty"`
+
+	// 上次同步时本地文件的底层标识 (设备号 + inode 或 Windows File ID，仅开启 detect_moves 时记录)
+	// 用于识别本地的移动与改名
+	FileID string `json:"file_id,omitempty"`
+
+	// 云端副本是否以明文存储 (未开启加密时上传，或开启加密之前上传的旧文件)
+	// 开启加密后据此跳过解密，见 sync.Engine.remotePlain
+	RemotePlain bool `json:"remote_plain,omitempty"`
+
 	// 最后一次同步的时间 (用于调试或过期策略)
 	LastSyncTime int64 `json:"last_sync_time"`
 }
@@ -35,3 +51,8 @@ type FileState struct {
 func (f *FileState) ModTimeAsTime() time.Time {
 	return time.Unix(0, f.ModTime)
 }
+
+// LastSyncAsTime 辅助方法：将最后同步时间转为 Go Time 对象 (Put 写入时为 Unix Nano)
+func (f *FileState) LastSyncAsTime() time.Time {
+	return time.Unix(0, f.LastSyncTime)
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// quarantineBucketPrefix 隔离记录的 Bucket 前缀，每个 Profile 一个 (与快照 Bucket 一一对应)
+const quarantineBucketPrefix = "Quarantine"
+
+// QuarantineEntry 无法解密、暂停下载的云端文件
+// 云端文件变化 (RemoteHash 或大小不同) 后自动恢复下载
+type QuarantineEntry struct {
+	// 隔离时云端文件的 Hash 与大小
+	RemoteHash string `json:"remote_hash"`
+	RemoteSize int64  `json:"remote_size"`
+	// Reason 隔离原因: wrong_key (密钥不正确) 或 corrupt (密文损坏、不是加密文件)
+	Reason string `json:"reason"`
+	// Error 下载失败时的错误
+	Error string `json:"error"`
+	// Time 隔离的时间 (Unix Nano)
+	Time int64 `json:"time"`
+}
+
+// TimeAsTime 辅助方法：将隔离时间转为 Go Time 对象
+func (q *QuarantineEntry) TimeAsTime() time.Time {
+	return time.Unix(0, q.Time)
+}
+
+// quarantineBucket 当前 Profile 的隔离记录 Bucket
+func (d *DB) quarantineBucket() []byte {
+	return []byte(quarantineBucketPrefix + strings.TrimPrefix(string(d.bucket), BucketName))
+}
+
+// PutQuarantine 隔离 relPath
+func (d *DB) PutQuarantine(relPath string, entry *QuarantineEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化失败: %w", err)
+	}
+	return d.conn.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(d.quarantineBucket())
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(relPath), data)
+	})
+}
+
+// DeleteQuarantine 解除 relPath 的隔离 (没有隔离时什么也不做)
+func (d *DB) DeleteQuarantine(relPath string) error {
+	return d.conn.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(d.quarantineBucket())
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(relPath))
+	})
+}
+
+// Quarantined 读取当前 Profile 的全部隔离记录 (按路径索引)
+func (d *DB) Quarantined() (map[string]*QuarantineEntry, error) {
+	entries := make(map[string]*QuarantineEntry)
+	err := d.conn.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(d.quarantineBucket())
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var entry QuarantineEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("解析隔离记录失败 (%s): %w", k, err)
+			}
+			entries[string(k)] = &entry
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取隔离记录失败: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// rekeyBucketPrefix 更换密钥进度的 Bucket 前缀，每个 Profile 一个 (与快照 Bucket 一一对应)
+const rekeyBucketPrefix = "RekeyProgress"
+
+// RekeyMark 单个云端文件更换密钥的进度
+// 写入新内容之前先记录未完成的进度 (OldHash)，完成后标记 Done，
+// 中断后再次执行时据此判断云端文件是否已经是新密钥加密的内容
+type RekeyMark struct {
+	// KeyID 新密钥的指纹
+	KeyID string `json:"key_id"`
+	// OldHash 改写之前云端文件的 Hash (云端 Hash 已经不同说明新内容已写入)
+	OldHash string `json:"old_hash,omitempty"`
+	// Done 已用新密钥重新加密，并已更新同步记录
+	Done bool `json:"done"`
+	// OldKeyID 已经确认过的旧密钥的指纹，中断后再次执行时没有参照文件也能确认同一个旧密钥
+	OldKeyID string `json:"old_key_id,omitempty"`
+}
+
+// rekeyBucket 当前 Profile 的换密钥进度 Bucket
+func (d *DB) rekeyBucket() []byte {
+	return []byte(rekeyBucketPrefix + strings.TrimPrefix(string(d.bucket), BucketName))
+}
+
+// GetRekeyMark 读取 relPath 的换密钥进度，没有记录时返回 nil
+func (d *DB) GetRekeyMark(relPath string) (*RekeyMark, error) {
+	var mark *RekeyMark
+	err := d.conn.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(d.rekeyBucket())
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(relPath))
+		if v == nil {
+			return nil
+		}
+		mark = &RekeyMark{}
+		return json.Unmarshal(v, mark)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取换密钥进度失败 (%s): %w", relPath, err)
+	}
+	return mark, nil
+}
+
+// PutRekeyMark 保存 relPath 的换密钥进度
+func (d *DB) PutRekeyMark(relPath string, mark *RekeyMark) error {
+	data, err := json.Marshal(mark)
+	if err != nil {
+		return fmt.Errorf("序列化失败: %w", err)
+	}
+	return d.conn.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(d.rekeyBucket())
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(relPath), data)
+	})
+}
+
+// PruneRekeyMarks 删除不属于 keyID 的换密钥进度 (之前更换为其他密钥时留下的)，返回删除的记录数
+func (d *DB) PruneRekeyMarks(keyID string) (int, error) {
+	pruned := 0
+	err := d.conn.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(d.rekeyBucket())
+		if b == nil {
+			return nil
+		}
+		// 先收集再删除，避免在遍历过程中修改 Bucket 导致游标错位
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var mark RekeyMark
+			if err := json.Unmarshal(v, &mark); err != nil || mark.KeyID != keyID {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		pruned = len(keys)
+		return nil
+	})
+	return pruned, err
+}
@@ -1,18 +1,21 @@
 package baidu
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog" // Add slog import
 	"path"     // 仅用于处理 URL 风格路径
 	"strings"
+	"sync"
 	"time"
 
 	"baidusync/internal/crypto" // Add crypto import
 	"baidusync/internal/fs"
 )
 
-// Adapter 实现了 fs.FileSystem 接口
+// Adapter 实现了 fs.RemoteProvider 接口
 type Adapter struct {
 	client *Client
 	root   string // 网盘根目录，例如 "/apps/cloudsync"
@@ -20,6 +23,9 @@ type Adapter struct {
 	// 新增字段用于文件名加密
 	encryptKey       []byte
 	encryptFilenames bool
+
+	// skipHidden ListAll 时跳过以 "." 开头的文件与目录 (按解密后的文件名判断)
+	skipHidden bool
 }
 
 // NewAdapter 创建适配器实例
@@ -37,11 +43,55 @@ func NewAdapter(client *Client, rootDir string, encryptKey []byte, encryptFilena
 	}
 }
 
+// SetSkipHidden 实现 fs.HiddenSkipper
+func (a *Adapter) SetSkipHidden(skip bool) {
+	a.skipHidden = skip
+}
+
 // Root 返回根目录
 func (a *Adapter) Root() string {
 	return a.root
 }
 
+// Close 实现 fs.FileSystem，关闭空闲的 HTTP 连接
+// 客户端由多个 Profile 共享，正在使用的连接不受影响，之后的请求会重新建立连接
+func (a *Adapter) Close() error {
+	// 两个客户端共用同一个 Transport，关闭一次即可
+	a.client.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// Type 实现 fs.RemoteProvider
+func (a *Adapter) Type() string {
+	return "baidu"
+}
+
+// StoredSize 网盘原样保存上传的内容，加密时多出密文头部
+func (a *Adapter) StoredSize(plainSize int64, encrypted bool) int64 {
+	if encrypted {
+		return plainSize + crypto.HeaderSize
+	}
+	return plainSize
+}
+
+// HasContentHash 网盘列表接口返回的 md5 即上传内容的指纹 (大文件见 ContentHashLimit)
+func (a *Adapter) HasContentHash() bool {
+	return true
+}
+
+// ContentHashLimit 实现 fs.BlockHasher
+// 超过 256MB 的文件，列表接口返回的 md5 不一定是整个文件内容的 MD5: 分片上传时 create 返回的值
+// 可能之后被服务端重新计算而改变，也可能是截断或变换过的值。这类文件只按 md5 比对会把没有变化的文件
+// 误判为云端已修改 (并且下载后的校验永远无法通过)，引擎改用分片 MD5 列表比对
+func (a *Adapter) ContentHashLimit() int64 {
+	return LargeFileMD5Threshold
+}
+
+// BlockSize 实现 fs.BlockHasher: 与上传时的分片大小相同
+func (a *Adapter) BlockSize() int64 {
+	return BlockSize
+}
+
 // toAbsPath 将相对路径转换为网盘绝对路径
 // relPath: "docs/file.txt" -> abs: "/apps/cloudsync/docs/file.txt"
 func (a *Adapter) toAbsPath(relPath string) string {
@@ -138,66 +188,130 @@ func (a *Adapter) toDecryptedRelPath(encryptedAbsPath string) (string, error) {
 }
 
 // ListAll 递归列出所有文件
+// 根目录无法列出时整个扫描失败；子目录列出失败 (例如暂时无法访问) 时跳过该目录及其下级并继续扫描，
+// 最后返回已列出的结果与 *fs.ScanError，引擎不会把跳过的路径当作已在云端删除
+// 认证失败不会因为换一个目录而好转，同样让整个扫描失败
 func (a *Adapter) ListAll() (map[string]*fs.FileMeta, error) {
 	result := make(map[string]*fs.FileMeta)
-	var errs []error
-	// 队列中始终使用明文的相对路径
-	queue := []string{""} // 从根目录（相对路径为空）开始
+	var skipped fs.ScanError
+	skip := func(relPath string, err error) {
+		skipped.Skipped = append(skipped.Skipped, relPath)
+		skipped.Errs = append(skipped.Errs, err)
+	}
 
-	for len(queue) > 0 {
-		currentPlainRel := queue[0]
-		queue = queue[1:]
+	// 按层遍历，多个 Worker 同时列出队列中的目录 (请求仍受客户端的限流冷却约束)
+	// 队列、结果与错误都由 mu 保护；队列为空但还有目录正在列出时，空闲的 Worker 等待新的子目录
+	var (
+		mu     sync.Mutex
+		cond   = sync.NewCond(&mu)
+		queue  = []string{""} // 队列中始终使用明文的相对路径，从根目录（相对路径为空）开始
+		active int            // 正在列出的目录数
+		fatal  error          // 根目录无法列出或认证失败时中止整个扫描
+	)
+	worker := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for {
+			for len(queue) == 0 && active > 0 && fatal == nil {
+				cond.Wait()
+			}
+			if len(queue) == 0 || fatal != nil {
+				return
+			}
+			currentPlainRel := queue[0]
+			queue = queue[1:]
+			active++
+			mu.Unlock()
+			files, err := a.listDir(currentPlainRel)
+			mu.Lock()
+			active--
+			switch {
+			case err == nil:
+				queue = a.addListing(result, currentPlainRel, files, skip, queue)
+			case currentPlainRel == "" || errors.Is(err, fs.ErrAuth):
+				fatal = err
+			default:
+				skip(currentPlainRel, err)
+			}
+			cond.Broadcast()
+		}
+	}
 
-		// 将明文相对路径转换为加密后的绝对路径用于 API 调用
-		absEncryptedPath, err := a.toEncryptedAbsPath(currentPlainRel)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("无法创建加密路径，跳过 %s: %w", currentPlainRel, err))
-			continue
+	var wg sync.WaitGroup
+	for i := 0; i < a.client.listWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
+	}
+	wg.Wait()
+
+	if fatal != nil {
+		return nil, fatal
+	}
+	if len(skipped.Skipped) > 0 {
+		return result, &skipped
+	}
+	return result, nil
+}
+
+// listDir 列出明文相对路径 dir 下的内容
+func (a *Adapter) listDir(dir string) ([]FileInfo, error) {
+	// 将明文相对路径转换为加密后的绝对路径用于 API 调用
+	absEncryptedPath, err := a.toEncryptedAbsPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	// 使用加密路径列出目录内容
+	files, err := a.client.ListDir(absEncryptedPath)
+	if err != nil {
+		return nil, fmt.Errorf("列出云端目录 %s 失败: %w", absEncryptedPath, err)
+	}
+	return files, nil
+}
+
+// addListing 把 dir 的列表结果加入 result，返回追加了子目录的队列
+// 文件名无法解密的条目被跳过并通过 skip 报告 (以云端的原始名称)
+func (a *Adapter) addListing(result map[string]*fs.FileMeta, dir string, files []FileInfo, skip func(string, error), queue []string) []string {
+	for _, f := range files {
+		// f.ServerName 是加密后的文件名，需要解密
+		plainName := f.ServerName
+		if a.encryptFilenames {
+			decrypted, err := crypto.DecryptName(f.ServerName, a.encryptKey)
+			if err != nil {
+				skip(path.Join(dir, f.ServerName), fmt.Errorf("解密文件名失败: %w", err))
+				continue
+			}
+			plainName = decrypted
 		}
 
-		// 使用加密路径列出目录内容
-		files, err := a.client.ListDir(absEncryptedPath)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("列出云端目录失败，跳过 %s: %w", absEncryptedPath, err))
+		// 隐藏目录不加入队列，其中的内容也不再列出
+		if a.skipHidden && fs.IsHidden(plainName) {
 			continue
 		}
 
-		for _, f := range files {
-			// f.ServerName 是加密后的文件名，需要解密
-			var plainName string
-			if a.encryptFilenames {
-				decrypted, derr := crypto.DecryptName(f.ServerName, a.encryptKey)
-				if derr != nil {
-					errs = append(errs, fmt.Errorf("解密文件名失败 %s: %w", f.ServerName, derr))
-					plainName = f.ServerName // 解密失败，直接使用
-				} else {
-					plainName = decrypted
-				}
-			} else {
-				plainName = f.ServerName
-			}
-
-			// 拼接明文的相对路径
-			plainRelPath := path.Join(currentPlainRel, plainName)
+		// 拼接明文的相对路径
+		plainRelPath := path.Join(dir, plainName)
 
-			if f.IsDir == 1 {
-				queue = append(queue, plainRelPath)
-			} else {
-				result[plainRelPath] = &fs.FileMeta{
-					RelPath:    plainRelPath,
-					Size:       f.Size,
-					ModTime:    time.Unix(f.ServerMTime, 0),
-					IsDir:      false,
-					RemoteHash: f.MD5,
-				}
+		if f.IsDir == 1 {
+			queue = append(queue, plainRelPath)
+			result[plainRelPath] = &fs.FileMeta{
+				RelPath: plainRelPath,
+				ModTime: time.Unix(f.ServerMTime, 0),
+				IsDir:   true,
+			}
+		} else {
+			result[plainRelPath] = &fs.FileMeta{
+				RelPath:    plainRelPath,
+				Size:       f.Size,
+				ModTime:    time.Unix(f.ServerMTime, 0),
+				IsDir:      false,
+				RemoteHash: f.MD5,
 			}
 		}
 	}
-
-	if len(errs) > 0 {
-		return result, fmt.Errorf("%d errors occurred during remote scan: %v", len(errs), errs)
-	}
-	return result, nil
+	return queue
 }
 
 // OpenStream 打开下载流
@@ -209,14 +323,46 @@ func (a *Adapter) OpenStream(relPath string) (io.ReadCloser, error) {
 	return a.client.Download(absPath)
 }
 
+// OpenStreamAt 实现 fs.RangeOpener: 从 offset 处继续下载 (offset 为密文中的偏移量)
+func (a *Adapter) OpenStreamAt(relPath string, offset int64) (io.ReadCloser, error) {
+	absPath, err := a.toEncryptedAbsPath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	return a.client.DownloadAt(absPath, offset)
+}
+
 // WriteStream 上传流
 func (a *Adapter) WriteStream(relPath string, stream io.Reader, perm time.Time) (string, error) {
+	return a.WriteStreamWithOptions(relPath, stream, perm, &fs.WriteOptions{})
+}
+
+// WriteStreamWithOptions 上传流，支持进度回调与指定同名文件的处理方式
+func (a *Adapter) WriteStreamWithOptions(relPath string, stream io.Reader, perm time.Time, opts *fs.WriteOptions) (string, error) {
 	absPath, err := a.toEncryptedAbsPath(relPath)
 	if err != nil {
 		return "", err
 	}
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	// 网盘不需要设置上传时间，自动为当前时间
-	return a.client.Upload(absPath, stream, 0)
+	return a.client.Upload(ctx, absPath, stream, opts.Size, a.rtype(opts.OnExist), opts.Progress)
+}
+
+// rtype 将写入参数中的覆盖策略转换为接口的 rtype，ExistDefault 时使用客户端的默认值
+func (a *Adapter) rtype(policy fs.ExistPolicy) Rtype {
+	switch policy {
+	case fs.ExistOverwrite:
+		return RtypeOverwrite
+	case fs.ExistFail:
+		return RtypeFail
+	case fs.ExistRename:
+		return RtypeRename
+	default:
+		return a.client.opts.Rtype
+	}
 }
 
 // Delete 删除文件
@@ -228,6 +374,32 @@ func (a *Adapter) Delete(relPath string) error {
 	return a.client.Delete(absPath)
 }
 
+// Mkdir 创建云端目录
+func (a *Adapter) Mkdir(relPath string) error {
+	absPath, err := a.toEncryptedAbsPath(relPath)
+	if err != nil {
+		return err
+	}
+	return a.client.MkDir(absPath)
+}
+
+// Rmdir 删除云端空目录
+// 网盘的删除接口会连同目录内容一起删除，因此先列出目录确认为空
+func (a *Adapter) Rmdir(relPath string) error {
+	absPath, err := a.toEncryptedAbsPath(relPath)
+	if err != nil {
+		return err
+	}
+	list, err := a.client.ListDir(absPath)
+	if err != nil {
+		return err
+	}
+	if len(list) > 0 {
+		return fmt.Errorf("%w: %s", fs.ErrNotEmpty, relPath)
+	}
+	return a.client.Delete(absPath)
+}
+
 // Stat 获取单个文件元数据
 func (a *Adapter) Stat(relPath string) (*fs.FileMeta, error) {
 	// Stat 比较特殊，我们需要获取父目录的内容，然后查找解密后的名字
@@ -268,35 +440,102 @@ func (a *Adapter) Stat(relPath string) (*fs.FileMeta, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("file not found: %s", relPath)
+	return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, relPath)
+}
+
+// Check 实现 fs.Checker: 通过容量查询确认 Token 有效，再确认同步根目录存在
+func (a *Adapter) Check(_ context.Context, createRoot bool) error {
+	quota, err := a.client.Quota()
+	if err != nil {
+		return fmt.Errorf("无法访问百度网盘: %w", err)
+	}
+	slog.Debug("网盘容量", "used", quota.Used, "total", quota.Total)
+
+	_, err = a.client.ListDir(a.root)
+	if errors.Is(err, fs.ErrNotExist) && createRoot {
+		// 上级目录由网盘自动创建；创建后再列一次，确认目录确实可以访问
+		if err := a.client.MkDir(a.root); err != nil {
+			return fmt.Errorf("创建云端目录 %s 失败: %w", a.root, err)
+		}
+		_, err = a.client.ListDir(a.root)
+	}
+	if err != nil {
+		return fmt.Errorf("无法访问云端目录 %s: %w", a.root, err)
+	}
+	return nil
+}
+
+// Share 为相对路径对应的网盘文件创建分享链接 (开启文件名加密时自动换算为加密后的路径)
+// 注意：开启内容加密时，分享出去的是密文，对方需要同样的密码才能解密
+func (a *Adapter) Share(relPath, password string, expiry time.Duration) (*ShareLink, error) {
+	absPath, err := a.toEncryptedAbsPath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	return a.client.CreateShare(absPath, password, int64(expiry/time.Second))
 }
 
-// Rename 重命名文件
+// Rename 重命名文件，新路径在其他目录时移动文件 (自动创建目标目录)
 func (a *Adapter) Rename(oldRelPath, newRelPath string) error {
 	absOldPath, err := a.toEncryptedAbsPath(oldRelPath)
 	if err != nil {
 		return err
 	}
 
-	oldDir := path.Dir(oldRelPath)
-	newDir := path.Dir(newRelPath)
-
-	if oldDir != newDir {
-		return fmt.Errorf("暂不支持跨目录重命名 (oldDir: %s, newDir: %s)", oldDir, newDir)
+	newNameEncrypted, err := a.encryptedName(newRelPath)
+	if err != nil {
+		return err
 	}
 
-	// newName 需要是加密后的
-	var newNameEncrypted string
-	if a.encryptFilenames {
-		baseName := path.Base(newRelPath)
-		encrypted, err := crypto.EncryptName(baseName, a.encryptKey)
+	if path.Dir(oldRelPath) != path.Dir(newRelPath) {
+		absNewDir, err := a.prepareDir(path.Dir(newRelPath))
 		if err != nil {
-			return fmt.Errorf("加密新文件名失败: %w", err)
+			return err
 		}
-		newNameEncrypted = encrypted
-	} else {
-		newNameEncrypted = path.Base(newRelPath)
+		return a.client.Move(absOldPath, absNewDir, newNameEncrypted)
 	}
-
 	return a.client.Rename(absOldPath, newNameEncrypted)
 }
+
+// Copy 实现 fs.Copier: 在云端复制文件 (开启文件名加密时两端都使用加密后的路径)
+// 文件内容原样复制，加密文件的副本使用同一个密钥即可解密
+func (a *Adapter) Copy(srcRelPath, dstRelPath string) error {
+	absSrc, err := a.toEncryptedAbsPath(srcRelPath)
+	if err != nil {
+		return err
+	}
+	name, err := a.encryptedName(dstRelPath)
+	if err != nil {
+		return err
+	}
+	absDstDir, err := a.prepareDir(path.Dir(dstRelPath))
+	if err != nil {
+		return err
+	}
+	return a.client.Copy(absSrc, absDstDir, name)
+}
+
+// encryptedName 返回 relPath 最后一级在云端的名字 (开启文件名加密时为加密后的名字)
+func (a *Adapter) encryptedName(relPath string) (string, error) {
+	baseName := path.Base(relPath)
+	if !a.encryptFilenames {
+		return baseName, nil
+	}
+	encrypted, err := crypto.EncryptName(baseName, a.encryptKey)
+	if err != nil {
+		return "", fmt.Errorf("加密新文件名失败: %w", err)
+	}
+	return encrypted, nil
+}
+
+// prepareDir 确保目标目录存在，返回它在云端的绝对路径
+func (a *Adapter) prepareDir(relDir string) (string, error) {
+	absDir, err := a.toEncryptedAbsPath(relDir)
+	if err != nil {
+		return "", err
+	}
+	if err := a.client.MkDir(absDir); err != nil {
+		return "", fmt.Errorf("创建目标目录失败: %w", err)
+	}
+	return absDir, nil
+}
@@ -0,0 +1,134 @@
+package baidu
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs"
+)
+
+// scanTree 云端 /apps/test 下的测试目录树
+func scanTree(t *testing.T) *fakePan {
+	pan := newFakePan(t)
+	pan.put("/apps/test/a.txt", []byte("a"))
+	pan.put("/apps/test/ok/b.txt", []byte("b"))
+	pan.put("/apps/test/bad/c.txt", []byte("c"))
+	pan.put("/apps/test/bad/sub/d.txt", []byte("d"))
+	return pan
+}
+
+func sortedKeys(m map[string]*fs.FileMeta) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestListAllSkipsFailedDirectory(t *testing.T) {
+	pan := scanTree(t)
+	pan.failNext("list /apps/test/bad", 31066)
+	a := NewAdapter(pan.client(nil), "/apps/test", nil, false)
+
+	result, err := a.ListAll()
+	var scanErr *fs.ScanError
+	if !errors.As(err, &scanErr) {
+		t.Fatalf("错误为 %v，应为 *fs.ScanError", err)
+	}
+	if !slices.Equal(scanErr.Skipped, []string{"bad"}) || len(scanErr.Errs) != 1 {
+		t.Fatalf("跳过了 %v，应只跳过 bad", scanErr.Skipped)
+	}
+	// 无法列出的目录本身 (来自上级目录的列表) 仍在结果中，其下级不在
+	want := []string{"a.txt", "bad", "ok", "ok/b.txt"}
+	if got := sortedKeys(result); !slices.Equal(got, want) {
+		t.Fatalf("扫描结果为 %v，应为 %v", got, want)
+	}
+
+	// 下一轮恢复后完整列出
+	result, err = a.ListAll()
+	if err != nil || len(result) != 7 {
+		t.Fatalf("恢复后扫描到 %d 项，错误为 %v", len(result), err)
+	}
+}
+
+func TestListAllFatalErrors(t *testing.T) {
+	// 根目录无法列出时整个扫描失败
+	pan := scanTree(t)
+	pan.failNext("list /apps/test", 31066)
+	a := NewAdapter(pan.client(nil), "/apps/test", nil, false)
+	if result, err := a.ListAll(); err == nil || result != nil {
+		t.Fatalf("根目录列出失败时返回 %d 项，错误为 %v", len(result), err)
+	}
+
+	// 子目录认证失败: 换一个目录也不会好转，整个扫描失败
+	pan = scanTree(t)
+	pan.failNext("list /apps/test/ok", errnoTokenExpired)
+	a = NewAdapter(pan.client(nil), "/apps/test", nil, false)
+	result, err := a.ListAll()
+	var scanErr *fs.ScanError
+	if !errors.Is(err, fs.ErrAuth) || errors.As(err, &scanErr) || result != nil {
+		t.Fatalf("认证失败时错误为 %v", err)
+	}
+}
+
+func TestListAllSkipHidden(t *testing.T) {
+	pan := newFakePan(t)
+	pan.put("/apps/test/.hidden/visible.txt", []byte("x"))
+	pan.put("/apps/test/docs/.DS_Store", []byte("x"))
+	pan.put("/apps/test/docs/readme.txt", []byte("x"))
+	a := NewAdapter(pan.client(nil), "/apps/test", nil, false)
+	a.SetSkipHidden(true)
+
+	result, err := a.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"docs", "docs/readme.txt"}
+	if got := sortedKeys(result); !slices.Equal(got, want) {
+		t.Fatalf("扫描结果为 %v，应为 %v", got, want)
+	}
+	// 隐藏目录不再列出
+	if n := pan.called("list /apps/test/.hidden"); n != 0 {
+		t.Fatalf("列出了隐藏目录 %d 次", n)
+	}
+}
+
+// BenchmarkListAllWide 列出一个很宽的目录树 (200 个目录，每个 20 个文件)，每次列目录有 2ms 的模拟延迟
+func BenchmarkListAllWide(b *testing.B) {
+	const dirs, files = 200, 20
+	pan := newFakePan(b)
+	for d := range dirs {
+		for f := range files {
+			pan.put(fmt.Sprintf("/apps/test/dir%03d/file%02d.dat", d, f), []byte{byte(f)})
+		}
+	}
+	pan.hook = func(call string, w http.ResponseWriter, r *http.Request) bool {
+		if strings.HasPrefix(call, "list ") {
+			time.Sleep(2 * time.Millisecond)
+		}
+		return false
+	}
+
+	for _, workers := range []int{1, DefaultListWorkers, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			a := NewAdapter(pan.client(&Options{ListWorkers: workers}), "/apps/test", nil, false)
+			b.ReportAllocs()
+			for b.Loop() {
+				result, err := a.ListAll()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(result) != dirs*(files+1) {
+					b.Fatalf("扫描到 %d 项", len(result))
+				}
+			}
+		})
+	}
+}
@@ -2,11 +2,15 @@ package baidu
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"crypto/md5"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/url"
@@ -14,48 +18,126 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"baidusync/internal/fs"
 )
 
 const (
 	// PCSBaseURL 基础 API 地址
 	PCSBaseURL = "https://pan.baidu.com/rest/2.0/xpan/file"
+	// QuotaURL 网盘容量查询地址
+	QuotaURL = "https://pan.baidu.com/api/quota"
 	// PCSUploadURL 上传专用地址 (部分文档指向 d.pcs.baidu.com)
 	PCSUploadURL = "https://d.pcs.baidu.com/rest/2.0/pcs/file"
 	// BlockSize 百度网盘分片大小 (4MB)
 	BlockSize = 4 * 1024 * 1024
+	// LargeFileMD5Threshold 超过该大小的文件，列表中的 md5 不作为可靠的内容指纹 (见 Adapter.ContentHashLimit)
+	LargeFileMD5Threshold = 256 * 1024 * 1024
 
 	// PCSUploadURL 分片上传专用 URL (Superfile2)
 	PCSSuperfileURL = "https://pcs.baidu.com/rest/2.0/pcs/superfile2"
+
+	// DefaultMetadataTimeout 列表、删除等元数据请求默认的超时时间
+	DefaultMetadataTimeout = 30 * time.Second
+	// DefaultListWorkers 扫描云端时默认同时列出的目录数
+	DefaultListWorkers = 4
+)
+
+// Rtype 上传时云端已有同名文件的处理方式 (对应接口的 rtype 参数)
+type Rtype int
+
+const (
+	// RtypeOverwrite 覆盖 (默认，rtype=3)
+	RtypeOverwrite Rtype = iota
+	// RtypeFail 不覆盖，返回 fs.ErrExist (rtype=0)
+	RtypeFail
+	// RtypeRename 不覆盖，由网盘自动改名保存 (rtype=1)
+	RtypeRename
 )
 
+// param 转换为接口的 rtype 参数
+func (r Rtype) param() string {
+	switch r {
+	case RtypeFail:
+		return "0"
+	case RtypeRename:
+		return "1"
+	default:
+		return "3"
+	}
+}
+
 // Options 初始化参数
 type Options struct {
 	AppKey       string
 	SecretKey    string
 	AccessToken  string
 	RefreshToken string
-	UserAgent    string
+	// UserAgent 所有请求使用的 User-Agent (为空时使用 DefaultUserAgent)
+	UserAgent string
+	// UserAgents 设置后按请求依次轮换其中的 User-Agent，此时忽略 UserAgent
+	UserAgents []string
+	// MetadataTimeout 列表、删除、创建等元数据请求的超时时间 (0 表示 DefaultMetadataTimeout)
+	// 下载与分片上传不受此限制，由调用方通过 context 或关闭流中断；只有等待响应头时同样受此限制
+	MetadataTimeout time.Duration
+	// StreamUploadThreshold 大小不小于该值的上传不写入临时文件，每次只在内存中缓存一个分片 (0 表示总是写入临时文件)
+	// 流式上传无法事先计算分片 MD5，不会命中秒传，见 uploadStreaming
+	StreamUploadThreshold int64
+	// ListWorkers 扫描云端 (Adapter.ListAll) 时同时列出的目录数 (0 表示 DefaultListWorkers)
+	ListWorkers int
+	// CopyBuffer 上传前把内容写入临时文件时每次读取的字节数 (0 表示 fs.DefaultCopyBuffer)
+	CopyBuffer int
+	// Rtype 上传时云端已有同名文件的默认处理方式 (零值为覆盖)
+	// 调用方可以在每次上传时指定，见 Adapter.WriteStreamWithOptions
+	Rtype Rtype
 }
 
 // Client 百度网盘 HTTP 客户端
 type Client struct {
-	opts       *Options
+	opts *Options
+	// httpClient 元数据请求使用，整个请求受 MetadataTimeout 限制
 	httpClient *http.Client
+	// transferClient 下载与分片上传使用，不限制总时长 (大文件的下载可能持续很久)
+	transferClient *http.Client
+	agents         *userAgents
+	// cooldown 被限流后暂停所有请求 (见 cooldownTransport)
+	cooldown *cooldown
 }
 
 // NewClient 创建客户端
 func NewClient(opts *Options) *Client {
 	if opts.UserAgent == "" {
-		opts.UserAgent = "pan.baidu.com" // 防止被屏蔽
+		opts.UserAgent = DefaultUserAgent // 防止被屏蔽
+	}
+	if opts.MetadataTimeout <= 0 {
+		opts.MetadataTimeout = DefaultMetadataTimeout
 	}
+	agents := newUserAgents(opts.UserAgent, opts.UserAgents)
+
+	// 两个客户端共用连接池；传输请求只限制等待响应头的时间，避免服务器无响应时永远阻塞
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.ResponseHeaderTimeout = opts.MetadataTimeout
+	// 限流冷却对两个客户端同时生效
+	cd := &cooldown{}
+	transport := &cooldownTransport{base: &userAgentTransport{base: base, agents: agents}, cd: cd}
+
 	return &Client{
-		opts: opts,
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second, // 基础超时，下载/上传时 context 控制
-		},
+		opts:           opts,
+		agents:         agents,
+		cooldown:       cd,
+		httpClient:     &http.Client{Timeout: opts.MetadataTimeout, Transport: transport},
+		transferClient: &http.Client{Transport: transport},
 	}
 }
 
+// listWorkers 扫描云端时同时列出的目录数
+func (c *Client) listWorkers() int {
+	if c.opts.ListWorkers <= 0 {
+		return DefaultListWorkers
+	}
+	return c.opts.ListWorkers
+}
+
 // ListDir 列出目录下的文件
 func (c *Client) ListDir(remoteDir string) ([]FileInfo, error) {
 	params := url.Values{}
@@ -63,7 +145,7 @@ func (c *Client) ListDir(remoteDir string) ([]FileInfo, error) {
 	params.Set("dir", remoteDir)
 	params.Set("limit", "1000") // 简单起见，暂不处理分页
 
-	body, err := c.request("GET", PCSBaseURL, params, nil)
+	body, reqID, err := c.request("GET", PCSBaseURL, params, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -73,14 +155,40 @@ func (c *Client) ListDir(remoteDir string) ([]FileInfo, error) {
 		return nil, err
 	}
 	if !resp.IsSuccess() {
-		return nil, fmt.Errorf("api error: %d %s", resp.ErrNo, resp.Msg)
+		return nil, resp.err("list error", reqID)
 	}
 
 	return resp.List, nil
 }
 
+// Quota 查询网盘容量，也是确认 Token 有效的最轻量的请求
+func (c *Client) Quota() (*QuotaResponse, error) {
+	params := url.Values{}
+	params.Set("checkfree", "1")
+
+	body, reqID, err := c.request("GET", QuotaURL, params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp QuotaResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析容量信息失败: %w", err)
+	}
+	if !resp.IsSuccess() {
+		return nil, resp.err("quota error", reqID)
+	}
+	return &resp, nil
+}
+
 // Download 下载文件流
 func (c *Client) Download(remotePath string) (io.ReadCloser, error) {
+	return c.DownloadAt(remotePath, 0)
+}
+
+// DownloadAt 从 offset 处开始下载文件流 (HTTP Range)
+// 服务器忽略 Range 返回完整内容时，跳过前 offset 个字节
+func (c *Client) DownloadAt(remotePath string, offset int64) (io.ReadCloser, error) {
 	params := url.Values{}
 	params.Set("method", "download")
 	params.Set("path", remotePath)
@@ -92,16 +200,31 @@ func (c *Client) Download(remotePath string) (io.ReadCloser, error) {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", c.opts.UserAgent)
+	req.Header.Set("User-Agent", c.agents.next())
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 
-	resp, err := c.httpClient.Do(req)
+	if err := c.pause(context.Background()); err != nil {
+		return nil, err
+	}
+	resp, err := c.transferClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != 200 {
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+				resp.Body.Close()
+				return nil, fmt.Errorf("跳过已下载的 %d 字节失败: %w", offset, err)
+			}
+		}
+	default:
 		resp.Body.Close()
-		return nil, fmt.Errorf("http status %d", resp.StatusCode)
+		return nil, statusError("download", resp.StatusCode, resp.Header.Get(requestIDHeader))
 	}
 
 	// 调用者负责 Close
@@ -140,7 +263,7 @@ func (c *Client) Delete(remotePath string) error {
 
 	// 3. 发送请求
 	// c.request(method, url, queryParams, bodyData)
-	body, err := c.request("POST", PCSBaseURL, params, strings.NewReader(data.Encode()))
+	body, reqID, err := c.request("POST", PCSBaseURL, params, strings.NewReader(data.Encode()))
 	if err != nil {
 		return err // 错误已在 c.request 中处理
 	}
@@ -153,7 +276,7 @@ func (c *Client) Delete(remotePath string) error {
 
 	// 检查百度网盘接口返回的错误码
 	if !resp.IsSuccess() { // 假设 IsSuccess() 检查 resp.ErrNo == 0
-		return fmt.Errorf("delete operation failed: ErrNo=%d, Msg=%s", resp.ErrNo, resp.Msg)
+		return resp.err("delete operation failed", reqID)
 	}
 
 	// 如果是异步删除 (async=1/2)，resp 中可能包含 task_id 等信息，可以返回或记录。
@@ -163,7 +286,8 @@ func (c *Client) Delete(remotePath string) error {
 }
 
 // request 通用请求封装
-func (c *Client) request(method, urlStr string, params url.Values, body io.Reader) ([]byte, error) {
+// 返回响应体与响应头中的请求 ID (没有时为空)，接口以 errno 返回错误时由调用方用它构造 *APIError
+func (c *Client) request(method, urlStr string, params url.Values, body io.Reader) ([]byte, string, error) {
 	// 自动注入 AccessToken
 	if params == nil {
 		params = url.Values{}
@@ -174,23 +298,40 @@ func (c *Client) request(method, urlStr string, params url.Values, body io.Reade
 
 	req, err := http.NewRequest(method, fullURL, body)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	req.Header.Set("User-Agent", c.opts.UserAgent)
+	req.Header.Set("User-Agent", c.agents.next())
 
+	if err := c.pause(context.Background()); err != nil {
+		return nil, "", err
+	}
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	reqID := resp.Header.Get(requestIDHeader)
+	// 其他错误由各接口按 errno 判断，这里只识别限流与认证失败
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusUnauthorized:
+		return nil, reqID, statusError(method+" "+urlStr, resp.StatusCode, reqID)
+	}
+	data, err := io.ReadAll(resp.Body)
+	return data, reqID, err
 }
 
 // Upload 执行由 Precreate -> Superfile2 -> Create 组成的大文件上传流程
 // content: 输入流 (可能是加密流)
-// _ : 原始大小 (忽略，以加密后落地的临时文件大小为准)
-func (c *Client) Upload(remotePath string, content io.Reader, _ int64) (string, error) {
+// size: content 的总字节数 (0 表示未知)，不小于 StreamUploadThreshold 时使用流式上传
+// rtype: 云端已有同名文件时的处理方式，RtypeFail 时返回包装 fs.ErrExist 的错误
+// progress: 上传进度回调 (可为空)，每个分片上传完成后回调一次总进度
+// ctx 取消或超时后不再上传剩余分片，正在上传的分片请求也会被中断
+func (c *Client) Upload(ctx context.Context, remotePath string, content io.Reader, size int64, rtype Rtype, progress fs.ProgressFunc) (string, error) {
+	if threshold := c.opts.StreamUploadThreshold; threshold > 0 && size >= threshold {
+		return c.uploadStreaming(ctx, remotePath, content, size, rtype, progress)
+	}
+
 	// 1. 【创建临时文件】
 	// 由于 content 可能是不可回退的加密流，而分片上传需要先计算全量 MD5 再分片读取
 	tmpFile, err := os.CreateTemp("", "cloudsync_upload_*")
@@ -203,7 +344,7 @@ func (c *Client) Upload(remotePath string, content io.Reader, _ int64) (string,
 	}()
 
 	// 2. 【写入数据并获取真实大小】
-	size, err := io.Copy(tmpFile, content)
+	size, err = fs.CopyBuffer(tmpFile, content, c.opts.CopyBuffer)
 	if err != nil {
 		return "", fmt.Errorf("写入临时文件失败: %w", err)
 	}
@@ -214,22 +355,31 @@ func (c *Client) Upload(remotePath string, content io.Reader, _ int64) (string,
 	}
 
 	// 3. 【计算指纹】
-	// 获取分片 MD5 列表和 全量 MD5 (localTotalMD5 用于最后校验)
-	blockMD5s, _, err := c.calculateFingerprint(tmpFile, size)
+	// 获取分片 MD5 列表和 全量 MD5 (contentMD5 用于合并结果未知时确认云端文件，见 createIdempotent)
+	blockMD5s, contentMD5, err := c.calculateFingerprint(tmpFile, size)
 	if err != nil {
 		return "", fmt.Errorf("计算文件指纹失败: %w", err)
 	}
 
 	// 4. Step 1: Precreate (预上传)
-	uploadID, err := c.precreate(remotePath, size, blockMD5s)
+	pre, err := c.precreate(remotePath, size, blockMD5s, rtype)
 	if err != nil {
 		return "", fmt.Errorf("precreate failed: %w", err)
 	}
+	uploadID := pre.UploadID
 
 	// 5. Step 2: Upload Slice (分片上传)
-	// 如果 uploadID 为空，说明触发了“秒传”，无需上传物理数据
-	if uploadID != "" {
+	// 命中秒传 (或没有返回 uploadID) 时网盘中已有相同的内容，无需上传物理数据，直接合并
+	// 注意: 加密上传时每次的 IV 都是随机的，只有完全相同的密文已经在网盘中时才会命中
+	rapid := pre.Rapid() || uploadID == ""
+	if rapid {
+		slog.Info("秒传命中", "path", remotePath, "bytes_saved", size)
+	} else {
+		uploaded := newSliceTracker(len(blockMD5s))
 		for i := 0; i < len(blockMD5s); i++ {
+			if err := ctx.Err(); err != nil {
+				return "", fmt.Errorf("上传在分片 %d/%d 处中止: %w", i+1, len(blockMD5s), err)
+			}
 			offset := int64(i) * BlockSize
 			currentBlockSize := int64(BlockSize)
 			if offset+currentBlockSize > size {
@@ -240,29 +390,46 @@ func (c *Client) Upload(remotePath string, content io.Reader, _ int64) (string,
 			sectionReader := io.NewSectionReader(tmpFile, offset, currentBlockSize)
 
 			// 执行分片上传，并获取云端返回的 MD5
-			cloudSliceMD5, err := c.uploadSlice(remotePath, uploadID, i, sectionReader, currentBlockSize)
+			cloudSliceMD5, err := c.uploadSlice(ctx, remotePath, uploadID, i, sectionReader, currentBlockSize, blockMD5s[i])
 			if err != nil {
 				return "", fmt.Errorf("上传分片 %d/%d 失败: %w", i+1, len(blockMD5s), err)
 			}
 
 			// 【关键校验 1】: 校验分片 MD5
 			// blockMD5s[i] 是我们在 calculateFingerprint 中计算的本地分片 MD5
+			// 请求头中的 Content-MD5 已让服务端拒收损坏的分片，这里再对比一次作为兜底
 			if cloudSliceMD5 != blockMD5s[i] {
 				return "", fmt.Errorf("分片 %d 数据校验失败: 本地MD5(%s) != 云端MD5(%s)",
 					i, blockMD5s[i], cloudSliceMD5)
 			}
+			uploaded.confirm(i, cloudSliceMD5)
+
+			if progress != nil {
+				progress(offset+currentBlockSize, size)
+			}
 		}
+		if err := uploaded.verify(blockMD5s); err != nil {
+			return "", fmt.Errorf("上传 %s 失败: %w", remotePath, err)
+		}
+	}
+	if rapid && progress != nil {
+		// 秒传: 无需传输数据，直接报告完成
+		progress(size, size)
 	}
 
 	// 6. Step 3: Create (合并文件)
-	// 假设 c.create 已经根据之前的优化修改为返回 (md5, size, error)
-	cloudMD5, cloudSize, err := c.create(remotePath, size, uploadID, blockMD5s)
+	return c.commit(remotePath, size, uploadID, blockMD5s, contentMD5, rtype)
+}
 
+// commit 合并已上传的分片，并校验云端合并后的大小
+// contentMD5 是整个文件的 MD5，合并请求的响应丢失时用来确认云端文件是否已经生成
+func (c *Client) commit(remotePath string, size int64, uploadID string, blockMD5s []string, contentMD5 string, rtype Rtype) (string, error) {
+	cloudMD5, cloudSize, err := c.createIdempotent(remotePath, size, uploadID, blockMD5s, contentMD5, rtype)
 	if err != nil {
 		return cloudMD5, fmt.Errorf("合并文件失败: %w", err)
 	}
 
-	// 7. 【关键校验 2】: 校验文件大小
+	// 【关键校验 2】: 校验文件大小
 	// 对比本地加密文件大小和云端合并后的大小
 	if cloudSize != size {
 		return "", fmt.Errorf("文件大小校验失败: 本地(%d) != 云端(%d)", size, cloudSize)
@@ -271,10 +438,10 @@ func (c *Client) Upload(remotePath string, content io.Reader, _ int64) (string,
 	return cloudMD5, nil
 }
 
+// calculateFingerprint 计算分片 MD5 列表与整个文件的 MD5
 func (c *Client) calculateFingerprint(f *os.File, size int64) ([]string, string, error) {
 	var blockMD5s []string
-
-	// totalHash := md5.New() // 已移除：不再计算总文件 MD5
+	totalHash := md5.New()
 
 	buf := make([]byte, BlockSize)
 
@@ -295,23 +462,22 @@ func (c *Client) calculateFingerprint(f *os.File, size int64) ([]string, string,
 		// 分片 MD5
 		blockHash := md5.Sum(buf[:n])
 		blockMD5s = append(blockMD5s, hex.EncodeToString(blockHash[:]))
-
-		// 总 MD5 的代码已移除
-		// totalHash.Write(buf[:n])
+		totalHash.Write(buf[:n])
 	}
 
 	// 处理空文件：如果文件大小为 0，添加一个空文件的 MD5 值到分片列表中
+	// precreate 不接受空的 block_list；只有未加密的空文件会走到这里，
+	// 加密后的空文件至少包含 16 字节的 IV，按普通的单分片文件上传
 	if size == 0 {
 		emptyHash := md5.Sum(nil)
 		blockMD5s = append(blockMD5s, hex.EncodeToString(emptyHash[:]))
 	}
 
-	// 返回分片 MD5 列表，第二个参数（总 MD5）返回空字符串 ""
-	return blockMD5s, "", nil
+	return blockMD5s, hex.EncodeToString(totalHash.Sum(nil)), nil
 }
 
 // precreate 预上传
-func (c *Client) precreate(remotePath string, size int64, blockMD5s []string) (string, error) {
+func (c *Client) precreate(remotePath string, size int64, blockMD5s []string, rtype Rtype) (*PrecreateResponse, error) {
 	blockListJSON, _ := json.Marshal(blockMD5s)
 
 	params := url.Values{}
@@ -323,34 +489,30 @@ func (c *Client) precreate(remotePath string, size int64, blockMD5s []string) (s
 	data.Set("size", fmt.Sprintf("%d", size))
 	data.Set("isdir", "0")
 	data.Set("autoinit", "1")
-	data.Set("rtype", "3") // 3=覆盖
+	data.Set("rtype", rtype.param())
 	data.Set("block_list", string(blockListJSON))
 
-	body, err := c.request("POST", PCSBaseURL, params, bytes.NewBufferString(data.Encode()))
+	body, reqID, err := c.request("POST", PCSBaseURL, params, bytes.NewBufferString(data.Encode()))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// 解析响应
-	var resp struct {
-		PCSResponse
-		UploadID   string `json:"uploadid"`
-		ReturnType int    `json:"return_type"` // 1=上传部分, 2=秒传
-	}
+	var resp PrecreateResponse
 	if err := json.Unmarshal(body, &resp); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if !resp.IsSuccess() {
-		return "", fmt.Errorf("precreate error: %d %s", resp.ErrNo, resp.Msg)
+		return nil, resp.err("precreate error", reqID)
 	}
 
-	return resp.UploadID, nil
+	return &resp, nil
 }
 
-// uploadSlice 上传单个分片
+// uploadSlice 上传单个分片，blockMD5 为本地计算的分片 MD5 (十六进制)，随请求以 Content-MD5 发送
 // 返回: (cloudSliceMD5, error)
-func (c *Client) uploadSlice(remotePath string, uploadID string, partSeq int, reader io.Reader, size int64) (string, error) {
+func (c *Client) uploadSlice(ctx context.Context, remotePath string, uploadID string, partSeq int, reader io.Reader, size int64, blockMD5 string) (string, error) {
 	params := url.Values{}
 	params.Set("method", "upload")
 	params.Set("access_token", c.opts.AccessToken)
@@ -361,6 +523,11 @@ func (c *Client) uploadSlice(remotePath string, uploadID string, partSeq int, re
 
 	fullURL := PCSSuperfileURL + "?" + params.Encode()
 
+	contentMD5, err := contentMD5Header(blockMD5)
+	if err != nil {
+		return "", err
+	}
+
 	// 使用 bytes.Buffer 构造 Multipart Body
 	// 必须这样做，因为百度要求 Content-Length，而 io.Pipe 产生的是 Chunked 传输
 	bodyBuf := &bytes.Buffer{}
@@ -379,22 +546,27 @@ func (c *Client) uploadSlice(remotePath string, uploadID string, partSeq int, re
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", fullURL, bodyBuf)
+	req, err := http.NewRequestWithContext(ctx, "POST", fullURL, bodyBuf)
 	if err != nil {
 		return "", err
 	}
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("User-Agent", c.opts.UserAgent) //
+	req.Header.Set("User-Agent", c.agents.next())
+	req.Header.Set("Content-MD5", contentMD5)
 
-	resp, err := c.httpClient.Do(req)
+	if err := c.pause(ctx); err != nil {
+		return "", err
+	}
+	resp, err := c.transferClient.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
+	reqID := resp.Header.Get(requestIDHeader)
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("upload slice http status %d", resp.StatusCode)
+		return "", statusError("upload slice", resp.StatusCode, reqID)
 	}
 
 	// 解析响应，获取 MD5
@@ -404,16 +576,25 @@ func (c *Client) uploadSlice(remotePath string, uploadID string, partSeq int, re
 	}
 
 	if res.ErrNo != 0 {
-		return "", fmt.Errorf("upload slice errno: %d", res.ErrNo)
+		return "", errnoError("upload slice", res.ErrNo, "", cmp.Or(string(res.RequestID), reqID))
 	}
 
 	// 返回云端计算的分片 MD5
 	return res.MD5, nil
 }
 
+// contentMD5Header 将十六进制的分片 MD5 转换为 Content-MD5 请求头的格式 (RFC 1864: 二进制摘要的 Base64)
+func contentMD5Header(hexMD5 string) (string, error) {
+	sum, err := hex.DecodeString(hexMD5)
+	if err != nil || len(sum) != md5.Size {
+		return "", fmt.Errorf("invalid block md5 %q", hexMD5)
+	}
+	return base64.StdEncoding.EncodeToString(sum), nil
+}
+
 // create 合并分片文件
 // 返回: (cloudMD5, cloudSize, error)
-func (c *Client) create(remotePath string, size int64, uploadID string, blockMD5s []string) (string, int64, error) {
+func (c *Client) create(remotePath string, size int64, uploadID string, blockMD5s []string, rtype Rtype) (string, int64, error) {
 	// 1. 序列化分片 MD5 列表
 	blockListJSON, err := json.Marshal(blockMD5s)
 	if err != nil {
@@ -429,12 +610,12 @@ func (c *Client) create(remotePath string, size int64, uploadID string, blockMD5
 	data.Set("size", fmt.Sprintf("%d", size))
 	data.Set("isdir", "0")
 	data.Set("uploadid", uploadID)
-	data.Set("rtype", "3") // 3=覆盖, 0=遇到同名报错
+	data.Set("rtype", rtype.param())
 	data.Set("block_list", string(blockListJSON))
 
 	// 3. 发送请求
 	// 注意：data.Encode() 返回的是 urlencoded 字符串，使用 strings.NewReader 效率略高
-	body, err := c.request("POST", PCSBaseURL, params, strings.NewReader(data.Encode()))
+	body, reqID, err := c.request("POST", PCSBaseURL, params, strings.NewReader(data.Encode()))
 	if err != nil {
 		return "", 0, err
 	}
@@ -447,37 +628,172 @@ func (c *Client) create(remotePath string, size int64, uploadID string, blockMD5
 
 	// 5. 检查错误码
 	if !resp.IsSuccess() {
-		return "", 0, fmt.Errorf("create file error: errno=%d msg=%s", resp.ErrNo, resp.Msg)
+		return "", 0, resp.err("create file error", reqID)
 	}
 
 	// 6. 返回关键元数据 (MD5 和 Size)
 	return resp.MD5, resp.Size, nil
 }
 
-// Rename 重命名或移动文件
+// errnoFileExists 百度网盘返回的“文件或目录已存在”错误码
+const errnoFileExists = -8
+
+// errnoNotExist 百度网盘返回的“文件或目录不存在”错误码
+const errnoNotExist = -9
+
+// 百度网盘返回的限流错误码: 请求过于频繁 / 服务繁忙
+const (
+	errnoThrottled = 31034
+	errnoBusy      = 31023
+)
+
+// isThrottleErrno 错误码是否表示被限流
+func isThrottleErrno(errno int) bool {
+	return errno == errnoThrottled || errno == errnoBusy
+}
+
+// 百度网盘返回的认证失败与空间不足错误码
+const (
+	errnoAuthFailed   = -6  // 身份验证失败
+	errnoTokenExpired = 111 // access token 失效
+	errnoQuotaFull    = -10 // 云端容量已满
+)
+
+// requestIDHeader 百度网盘返回请求 ID 的响应头 (部分接口只在响应体的 request_id 中返回)
+const requestIDHeader = "X-Request-Id"
+
+// APIError 百度网盘接口返回的错误
+// 向百度网盘客服反馈问题时需要提供 RequestID，因此错误信息中总是带上它
+type APIError struct {
+	Op        string
+	Status    int // HTTP 状态码 (接口以 errno 返回错误时为 0)
+	ErrNo     int
+	Msg       string
+	RequestID string
+
+	kind error // 对应的 fs 错误 (fs.ErrThrottled 等)，没有时为 nil
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	if e.Status != 0 {
+		fmt.Fprintf(&b, "%s: http status %d", e.Op, e.Status)
+	} else {
+		fmt.Fprintf(&b, "%s: errno=%d msg=%s", e.Op, e.ErrNo, e.Msg)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " request_id=%s", e.RequestID)
+	}
+	if e.kind != nil {
+		fmt.Fprintf(&b, ": %v", e.kind)
+	}
+	return b.String()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// errnoError 把接口返回的错误码转换为 *APIError
+// 限流、认证失败、空间不足分别包装 fs.ErrThrottled / fs.ErrAuth / fs.ErrQuota，以便引擎区别处理
+func errnoError(op string, errno int, msg, requestID string) error {
+	var kind error
+	switch errno {
+	case errnoThrottled, errnoBusy:
+		kind = fs.ErrThrottled
+	case errnoAuthFailed, errnoTokenExpired:
+		kind = fs.ErrAuth
+	case errnoQuotaFull:
+		kind = fs.ErrQuota
+	case errnoFileExists:
+		kind = fs.ErrExist
+	case errnoNotExist:
+		kind = fs.ErrNotExist
+	}
+	return &APIError{Op: op, ErrNo: errno, Msg: msg, RequestID: requestID, kind: kind}
+}
+
+// statusError 把非 200 的 HTTP 状态码转换为 *APIError
+// 429 包装 fs.ErrThrottled，401 包装 fs.ErrAuth (403 可能只是单个路径无权限，交给 errno 判断)
+func statusError(op string, code int, requestID string) error {
+	var kind error
+	switch code {
+	case http.StatusTooManyRequests:
+		kind = fs.ErrThrottled
+	case http.StatusUnauthorized:
+		kind = fs.ErrAuth
+	}
+	return &APIError{Op: op, Status: code, RequestID: requestID, kind: kind}
+}
+
+// MkDir 创建目录 (父目录不存在时由网盘自动创建)
+// 目录已存在时视为成功
+func (c *Client) MkDir(remotePath string) error {
+	params := url.Values{}
+	params.Set("method", "create")
+
+	data := url.Values{}
+	data.Set("path", remotePath)
+	data.Set("size", "0")
+	data.Set("isdir", "1")
+	data.Set("rtype", "0") // 0=遇到同名报错，避免产生重命名后的副本目录
+
+	body, reqID, err := c.request("POST", PCSBaseURL, params, strings.NewReader(data.Encode()))
+	if err != nil {
+		return err
+	}
+
+	var resp CreateFileResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("unmarshal mkdir response failed: %w", err)
+	}
+	if !resp.IsSuccess() && resp.ErrNo != errnoFileExists {
+		return resp.err("mkdir error", reqID)
+	}
+	return nil
+}
+
+// Rename 重命名文件 (只能在同一个目录内改名，移动到其他目录使用 Move)
 // oldPath: 原文件绝对路径
 // newName: 新文件名 (注意：百度 API 的 rename 参数只需要新名字，不需要完整路径)
 func (c *Client) Rename(oldPath string, newName string) error {
+	// 格式: [{"path":"/old/path","newname":"new_name"}]
+	return c.filemanager("rename", "rename error", []map[string]string{
+		{"path": oldPath, "newname": newName},
+	})
+}
+
+// Move 把文件移动到 destDir 目录下并命名为 newName
+// 目标已存在时失败 (ondup=fail)，不会覆盖云端已有的文件
+func (c *Client) Move(oldPath, destDir, newName string) error {
+	return c.filemanager("move", "move error", []map[string]string{
+		{"path": oldPath, "dest": destDir, "newname": newName, "ondup": "fail"},
+	})
+}
+
+// Copy 在云端把文件复制到 destDir 目录下并命名为 newName，不经过本地传输数据
+// 目标已存在时失败 (ondup=fail)，不会覆盖云端已有的文件
+func (c *Client) Copy(srcPath, destDir, newName string) error {
+	return c.filemanager("copy", "copy error", []map[string]string{
+		{"path": srcPath, "dest": destDir, "newname": newName, "ondup": "fail"},
+	})
+}
+
+// filemanager 调用文件管理接口 (rename / move / copy 等)，op 用于错误信息
+func (c *Client) filemanager(opera, op string, fileList []map[string]string) error {
 	// 1. 准备 URL 参数
 	query := url.Values{}
 	query.Set("method", "filemanager")
 	query.Set("access_token", c.opts.AccessToken)
 
 	// 2. 准备 Body 参数
-	// 格式: [{"path":"/old/path","newname":"new_name"}]
-	fileList := []map[string]string{
-		{
-			"path":    oldPath,
-			"newname": newName,
-		},
-	}
 	fileListBytes, err := json.Marshal(fileList)
 	if err != nil {
 		return fmt.Errorf("marshal filelist failed: %w", err)
 	}
 
 	form := url.Values{}
-	form.Set("opera", "rename")
+	form.Set("opera", opera)
 	form.Set("async", "0")
 	form.Set("filelist", string(fileListBytes))
 
@@ -489,8 +805,11 @@ func (c *Client) Rename(oldPath string, newName string) error {
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("User-Agent", c.opts.UserAgent)
+	req.Header.Set("User-Agent", c.agents.next())
 
+	if err := c.pause(context.Background()); err != nil {
+		return err
+	}
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return err
@@ -508,7 +827,7 @@ func (c *Client) Rename(oldPath string, newName string) error {
 	}
 
 	if !pcsResp.IsSuccess() && pcsResp.ErrNo != 0 {
-		return fmt.Errorf("rename error: %d %s", pcsResp.ErrNo, pcsResp.Msg)
+		return pcsResp.err(op, resp.Header.Get(requestIDHeader))
 	}
 
 	return nil
@@ -0,0 +1,726 @@
+package baidu
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs"
+)
+
+// TestMain 客户端通过默认 Logger 输出限流、秒传等日志，测试时丢弃
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// fakePan 模拟百度网盘开放平台中同步用到的接口 (list / precreate / superfile2 / create / filemanager / download / quota)
+// 与真实接口一样，create 按 block_list 中的分片 MD5 拼接文件内容，因此已经上传过的分片可以命中秒传
+type fakePan struct {
+	t  testing.TB
+	mu sync.Mutex
+
+	files   map[string]*fakeFile // 绝对路径 -> 文件或目录
+	blocks  map[string][]byte    // 分片 MD5 -> 内容 (上传过的分片与已有文件的分片)
+	uploads map[string]string    // uploadid -> precreate 时的路径
+	nextID  int
+
+	calls    []string              // 按顺序记录的接口调用，例如 "precreate"、"upload"、"list /apps/test"
+	errnos   map[string][]int      // 按调用名排队注入的 errno，每次调用取出一个
+	contents []string              // superfile2 请求的 Content-MD5 请求头
+	forms    map[string]url.Values // 每个接口最近一次请求的参数
+
+	// hook 在处理请求之前调用，返回 true 时表示已经写好响应
+	hook func(call string, w http.ResponseWriter, r *http.Request) bool
+	// after 在接口处理完请求、写响应之前调用，可以丢弃响应 (panic(http.ErrAbortHandler))
+	after func(call string)
+}
+
+type fakeFile struct {
+	data  []byte
+	isDir bool
+	mtime int64
+	fsID  uint64
+}
+
+func newFakePan(t testing.TB) *fakePan {
+	return &fakePan{
+		t:       t,
+		files:   map[string]*fakeFile{"/": {isDir: true}},
+		blocks:  make(map[string][]byte),
+		uploads: make(map[string]string),
+		errnos:  make(map[string][]int),
+		forms:   make(map[string]url.Values),
+	}
+}
+
+// client 创建连接到 fakePan 的客户端: 保留 Client 原有的 Transport 链 (限流冷却、User-Agent)，
+// 只把最底层的请求改发到本地的 httptest.Server
+func (p *fakePan) client(opts *Options) *Client {
+	srv := httptest.NewServer(p)
+	p.t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+
+	if opts == nil {
+		opts = &Options{}
+	}
+	opts.AccessToken = "test-token"
+	c := NewClient(opts)
+	ua := c.httpClient.Transport.(*cooldownTransport).base.(*userAgentTransport)
+	ua.base = &rewriteTransport{target: target, base: srv.Client().Transport}
+	return c
+}
+
+// rewriteTransport 把请求改发到 target，路径与参数不变
+type rewriteTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return t.base.RoundTrip(req)
+}
+
+// put 在云端放入文件，父目录自动创建
+func (p *fakePan) put(absPath string, data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mkdirAll(path.Dir(absPath))
+	p.store(absPath, data)
+}
+
+// mkdir 在云端创建目录及其上级
+func (p *fakePan) mkdir(absPath string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mkdirAll(absPath)
+}
+
+// get 返回云端文件的内容
+func (p *fakePan) get(absPath string) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, ok := p.files[absPath]
+	if !ok || f.isDir {
+		return nil, false
+	}
+	return f.data, true
+}
+
+// failNext 让 call 的下一次调用返回 errno
+func (p *fakePan) failNext(call string, errno int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.errnos[call] = append(p.errnos[call], errno)
+}
+
+// called 返回 call 被调用的次数
+func (p *fakePan) called(call string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, c := range p.calls {
+		if c == call {
+			n++
+		}
+	}
+	return n
+}
+
+// form 返回 call 最近一次请求的参数 name
+func (p *fakePan) form(call, name string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.forms[call].Get(name)
+}
+
+func (p *fakePan) mkdirAll(dir string) {
+	for d := dir; d != "/" && d != "."; d = path.Dir(d) {
+		if _, ok := p.files[d]; !ok {
+			p.nextID++
+			p.files[d] = &fakeFile{isDir: true, fsID: uint64(p.nextID)}
+		}
+	}
+}
+
+func (p *fakePan) store(absPath string, data []byte) *fakeFile {
+	for off := 0; off < len(data) || off == 0; off += BlockSize {
+		block := data[off:min(off+BlockSize, len(data))]
+		p.blocks[md5Hex(block)] = block
+	}
+	p.nextID++
+	f := &fakeFile{data: data, mtime: time.Now().Unix(), fsID: uint64(p.nextID)}
+	p.files[absPath] = f
+	return f
+}
+
+func (p *fakePan) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	form, err := parseForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	method := form.Get("method")
+	if r.URL.Path == "/api/quota" {
+		method = "quota"
+	}
+	call := method
+	switch method {
+	case "list":
+		call = "list " + form.Get("dir")
+	case "filemanager":
+		call = form.Get("opera")
+	}
+
+	p.mu.Lock()
+	p.calls = append(p.calls, call)
+	p.forms[call] = form
+	reqID := "req-" + strconv.Itoa(len(p.calls))
+	hook := p.hook
+	var errno int
+	if queue := p.errnos[call]; len(queue) > 0 {
+		errno, p.errnos[call] = queue[0], queue[1:]
+	}
+	p.mu.Unlock()
+
+	if hook != nil && hook(call, w, r) {
+		return
+	}
+	w.Header().Set(requestIDHeader, reqID)
+	if errno != 0 {
+		writeJSON(w, map[string]any{"errno": errno, "errmsg": "injected"})
+		return
+	}
+
+	p.mu.Lock()
+	var resp any
+	switch method {
+	case "list":
+		resp = p.list(form.Get("dir"))
+	case "precreate":
+		resp = p.precreate(form)
+	case "upload":
+		resp = p.uploadSlice(form, r)
+	case "create":
+		resp = p.create(form)
+	case "filemanager":
+		resp = p.filemanager(form)
+	case "quota":
+		resp = map[string]any{"errno": 0, "total": 2 << 40, "used": 1 << 30}
+	case "download":
+		f, ok := p.files[form.Get("path")]
+		p.mu.Unlock()
+		if !ok || f.isDir {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(f.data))
+		return
+	default:
+		resp = map[string]any{"errno": 2, "errmsg": "unknown method " + method}
+	}
+	after := p.after
+	p.mu.Unlock()
+
+	if after != nil {
+		after(call)
+	}
+	writeJSON(w, resp)
+}
+
+// parseForm 合并 URL 参数与请求体中的参数
+// 客户端发送表单时没有设置 Content-Type，不能依赖 Request.ParseForm 解析请求体
+func parseForm(r *http.Request) (url.Values, error) {
+	form := r.URL.Query()
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if err := r.ParseMultipartForm(BlockSize * 2); err != nil {
+			return nil, err
+		}
+		for k, v := range r.MultipartForm.Value {
+			form[k] = append(form[k], v...)
+		}
+		return form, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range values {
+		form[k] = append(form[k], v...)
+	}
+	return form, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (p *fakePan) list(dir string) any {
+	if d, ok := p.files[dir]; !ok || !d.isDir {
+		return map[string]any{"errno": errnoNotExist}
+	}
+	var names []string
+	for name := range p.files {
+		if name != "/" && path.Dir(name) == dir {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	list := make([]FileInfo, 0, len(names))
+	for _, name := range names {
+		f := p.files[name]
+		info := FileInfo{FsID: f.fsID, Path: name, ServerName: path.Base(name), ServerMTime: f.mtime}
+		if f.isDir {
+			info.IsDir = 1
+		} else {
+			info.Size = int64(len(f.data))
+			info.MD5 = md5Hex(f.data)
+		}
+		list = append(list, info)
+	}
+	return ListResponse{List: list}
+}
+
+func (p *fakePan) precreate(form url.Values) any {
+	var blockList []string
+	if err := json.Unmarshal([]byte(form.Get("block_list")), &blockList); err != nil || len(blockList) == 0 {
+		return map[string]any{"errno": 2, "errmsg": "invalid block_list"}
+	}
+	p.nextID++
+	id := "upload-" + strconv.Itoa(p.nextID)
+	p.uploads[id] = form.Get("path")
+
+	// 所有分片都已在网盘中时命中秒传
+	returnType := 2
+	for _, b := range blockList {
+		if _, ok := p.blocks[b]; !ok {
+			returnType = 1
+		}
+	}
+	return map[string]any{"errno": 0, "uploadid": id, "return_type": returnType, "block_list": []int{}}
+}
+
+func (p *fakePan) uploadSlice(form url.Values, r *http.Request) any {
+	if _, ok := p.uploads[form.Get("uploadid")]; !ok {
+		return map[string]any{"errno": 31299, "errmsg": "invalid uploadid"}
+	}
+	p.contents = append(p.contents, r.Header.Get("Content-MD5"))
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return map[string]any{"errno": 31299, "errmsg": err.Error()}
+	}
+	data, _ := io.ReadAll(file)
+	sum := md5Hex(data)
+	p.blocks[sum] = data
+	return map[string]any{"errno": 0, "md5": sum, "request_id": uint64(12345678901234567890)}
+}
+
+func (p *fakePan) create(form url.Values) any {
+	target := form.Get("path")
+	if form.Get("isdir") == "1" {
+		if _, ok := p.files[target]; ok {
+			return map[string]any{"errno": errnoFileExists}
+		}
+		p.mkdirAll(target)
+		return map[string]any{"errno": 0, "path": target, "isdir": 1}
+	}
+
+	id := form.Get("uploadid")
+	if _, ok := p.uploads[id]; !ok {
+		return map[string]any{"errno": 31299, "errmsg": "invalid uploadid"}
+	}
+	var blockList []string
+	json.Unmarshal([]byte(form.Get("block_list")), &blockList)
+	var data []byte
+	for _, b := range blockList {
+		block, ok := p.blocks[b]
+		if !ok {
+			return map[string]any{"errno": 31363, "errmsg": "block miss in superfile2"}
+		}
+		data = append(data, block...)
+	}
+	if size, _ := strconv.ParseInt(form.Get("size"), 10, 64); size != int64(len(data)) {
+		return map[string]any{"errno": 31061, "errmsg": "size mismatch"}
+	}
+
+	if _, exists := p.files[target]; exists {
+		switch form.Get("rtype") {
+		case "0":
+			return map[string]any{"errno": errnoFileExists}
+		case "1":
+			ext := path.Ext(target)
+			target = strings.TrimSuffix(target, ext) + "(1)" + ext
+		}
+	}
+	delete(p.uploads, id)
+	p.mkdirAll(path.Dir(target))
+	f := p.store(target, data)
+	return CreateFileResponse{FsID: f.fsID, MD5: md5Hex(data), Size: int64(len(data)), Path: target}
+}
+
+func (p *fakePan) filemanager(form url.Values) any {
+	var list []map[string]string
+	if err := json.Unmarshal([]byte(form.Get("filelist")), &list); err != nil {
+		// delete 的 filelist 是路径数组
+		var paths []string
+		if err := json.Unmarshal([]byte(form.Get("filelist")), &paths); err != nil {
+			return map[string]any{"errno": 2, "errmsg": "invalid filelist"}
+		}
+		for _, p := range paths {
+			list = append(list, map[string]string{"path": p})
+		}
+	}
+	for _, item := range list {
+		src := item["path"]
+		if _, ok := p.files[src]; !ok {
+			return map[string]any{"errno": errnoNotExist}
+		}
+		var dst string
+		switch form.Get("opera") {
+		case "delete":
+			p.removeAll(src)
+			continue
+		case "rename":
+			dst = path.Join(path.Dir(src), item["newname"])
+		default:
+			dst = path.Join(item["dest"], item["newname"])
+		}
+		if _, exists := p.files[dst]; exists && item["ondup"] == "fail" {
+			return map[string]any{"errno": errnoFileExists}
+		}
+		f := *p.files[src]
+		p.files[dst] = &f
+		if form.Get("opera") != "copy" {
+			p.removeAll(src)
+		}
+	}
+	return map[string]any{"errno": 0}
+}
+
+func (p *fakePan) removeAll(absPath string) {
+	for name := range p.files {
+		if name == absPath || strings.HasPrefix(name, absPath+"/") {
+			delete(p.files, name)
+		}
+	}
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// pattern 生成 n 字节的测试内容，seed 不同时内容不同
+func pattern(n int, seed byte) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i) ^ seed
+	}
+	return data
+}
+
+func TestUploadPrecreateSuperfileCreate(t *testing.T) {
+	pan := newFakePan(t)
+	c := pan.client(nil)
+	data := pattern(2*BlockSize+1000, 1)
+
+	var progress []int64
+	md5sum, err := c.Upload(context.Background(), "/apps/test/big.bin", bytes.NewReader(data), int64(len(data)), RtypeOverwrite,
+		func(done, total int64) { progress = append(progress, done) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md5sum != md5Hex(data) {
+		t.Fatalf("返回的 MD5 为 %s，应为 %s", md5sum, md5Hex(data))
+	}
+	if got, _ := pan.get("/apps/test/big.bin"); !bytes.Equal(got, data) {
+		t.Fatal("云端文件内容与上传的内容不一致")
+	}
+
+	// 三个分片依次上传，之后合并
+	want := []string{"precreate", "upload", "upload", "upload", "create"}
+	if fmt.Sprint(pan.calls) != fmt.Sprint(want) {
+		t.Fatalf("调用顺序为 %v，应为 %v", pan.calls, want)
+	}
+	var blockList []string
+	json.Unmarshal([]byte(pan.form("create", "block_list")), &blockList)
+	wantBlocks := []string{md5Hex(data[:BlockSize]), md5Hex(data[BlockSize : 2*BlockSize]), md5Hex(data[2*BlockSize:])}
+	if fmt.Sprint(blockList) != fmt.Sprint(wantBlocks) {
+		t.Fatalf("create 的 block_list 为 %v，应为 %v", blockList, wantBlocks)
+	}
+	if pan.form("create", "rtype") != "3" || pan.form("precreate", "size") != strconv.Itoa(len(data)) {
+		t.Fatalf("create rtype=%s precreate size=%s", pan.form("create", "rtype"), pan.form("precreate", "size"))
+	}
+	if fmt.Sprint(progress) != fmt.Sprint([]int64{BlockSize, 2 * BlockSize, int64(len(data))}) {
+		t.Fatalf("进度回调为 %v", progress)
+	}
+}
+
+func TestUploadStreaming(t *testing.T) {
+	pan := newFakePan(t)
+	c := pan.client(&Options{StreamUploadThreshold: 1})
+	data := pattern(BlockSize+10, 2)
+
+	if _, err := c.Upload(context.Background(), "/apps/test/s.bin", bytes.NewReader(data), int64(len(data)), RtypeOverwrite, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := pan.get("/apps/test/s.bin"); !bytes.Equal(got, data) {
+		t.Fatal("云端文件内容与上传的内容不一致")
+	}
+
+	// 内容比声明的大小短时不合并
+	_, err := c.Upload(context.Background(), "/apps/test/short.bin", bytes.NewReader(data[:100]), int64(len(data)), RtypeOverwrite, nil)
+	if !errors.Is(err, errStreamSize) {
+		t.Fatalf("错误为 %v，应为 errStreamSize", err)
+	}
+	if _, ok := pan.get("/apps/test/short.bin"); ok {
+		t.Fatal("内容不完整时不应生成云端文件")
+	}
+}
+
+func TestErrnoMapping(t *testing.T) {
+	tests := []struct {
+		errno int
+		want  error
+	}{
+		{errnoThrottled, fs.ErrThrottled},
+		{errnoBusy, fs.ErrThrottled},
+		{errnoAuthFailed, fs.ErrAuth},
+		{errnoTokenExpired, fs.ErrAuth},
+		{errnoQuotaFull, fs.ErrQuota},
+		{errnoFileExists, fs.ErrExist},
+		{errnoNotExist, fs.ErrNotExist},
+		{31066, nil},
+	}
+	for _, tt := range tests {
+		pan := newFakePan(t)
+		pan.mkdir("/apps/test")
+		c := pan.client(nil)
+		pan.failNext("list /apps/test", tt.errno)
+
+		_, err := c.ListDir("/apps/test")
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrNo != tt.errno {
+			t.Fatalf("errno %d: 错误为 %v，应为 *APIError", tt.errno, err)
+		}
+		if apiErr.RequestID == "" || !strings.Contains(err.Error(), "request_id="+apiErr.RequestID) {
+			t.Errorf("errno %d: 错误信息中缺少请求 ID: %v", tt.errno, err)
+		}
+		for _, kind := range []error{fs.ErrThrottled, fs.ErrAuth, fs.ErrQuota, fs.ErrExist, fs.ErrNotExist} {
+			if errors.Is(err, kind) != (kind == tt.want) {
+				t.Errorf("errno %d: errors.Is(err, %v) = %v", tt.errno, kind, !(kind == tt.want))
+			}
+		}
+	}
+}
+
+func TestHTTPStatusMapping(t *testing.T) {
+	for status, want := range map[int]error{
+		http.StatusTooManyRequests: fs.ErrThrottled,
+		http.StatusUnauthorized:    fs.ErrAuth,
+	} {
+		pan := newFakePan(t)
+		pan.hook = func(call string, w http.ResponseWriter, r *http.Request) bool {
+			w.Header().Set(requestIDHeader, "status-req")
+			w.WriteHeader(status)
+			return true
+		}
+		c := pan.client(nil)
+
+		_, err := c.ListDir("/")
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Status != status || apiErr.RequestID != "status-req" || !errors.Is(err, want) {
+			t.Fatalf("状态码 %d: 错误为 %v", status, err)
+		}
+	}
+}
+
+func TestUploadRtypeFailKeepsExistingFile(t *testing.T) {
+	pan := newFakePan(t)
+	pan.put("/apps/test/a.txt", []byte("existing"))
+	c := pan.client(nil)
+	a := NewAdapter(c, "/apps/test", nil, false)
+
+	// rtype=0: 云端已有同名文件时失败，返回 fs.ErrExist
+	_, err := a.WriteStreamWithOptions("a.txt", strings.NewReader("new content"), time.Now(), &fs.WriteOptions{OnExist: fs.ExistFail})
+	if !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("错误为 %v，应为 fs.ErrExist", err)
+	}
+	if pan.form("precreate", "rtype") != "0" || pan.form("create", "rtype") != "0" {
+		t.Fatalf("precreate rtype=%s create rtype=%s，应为 0", pan.form("precreate", "rtype"), pan.form("create", "rtype"))
+	}
+	if got, _ := pan.get("/apps/test/a.txt"); string(got) != "existing" {
+		t.Fatalf("云端文件被改为 %q", got)
+	}
+
+	// rtype=1: 由网盘改名保存
+	if _, err := a.WriteStreamWithOptions("a.txt", strings.NewReader("renamed"), time.Now(), &fs.WriteOptions{OnExist: fs.ExistRename}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := pan.get("/apps/test/a(1).txt"); string(got) != "renamed" {
+		t.Fatalf("改名保存的文件内容为 %q", got)
+	}
+
+	// 默认 (客户端的 Rtype 为零值): 覆盖
+	if _, err := a.WriteStream("a.txt", strings.NewReader("overwritten"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if pan.form("create", "rtype") != "3" {
+		t.Fatalf("create rtype=%s，应为 3", pan.form("create", "rtype"))
+	}
+	if got, _ := pan.get("/apps/test/a.txt"); string(got) != "overwritten" {
+		t.Fatalf("云端文件内容为 %q", got)
+	}
+}
+
+func TestUploadSliceSendsContentMD5(t *testing.T) {
+	pan := newFakePan(t)
+	c := pan.client(nil)
+	data := pattern(BlockSize+3, 3)
+
+	if _, err := c.Upload(context.Background(), "/apps/test/a.bin", bytes.NewReader(data), int64(len(data)), RtypeOverwrite, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Content-MD5 为二进制摘要的 Base64 (RFC 1864)，不是十六进制字符串
+	first, second := md5.Sum(data[:BlockSize]), md5.Sum(data[BlockSize:])
+	want := []string{base64.StdEncoding.EncodeToString(first[:]), base64.StdEncoding.EncodeToString(second[:])}
+	if fmt.Sprint(pan.contents) != fmt.Sprint(want) {
+		t.Fatalf("Content-MD5 为 %v，应为 %v", pan.contents, want)
+	}
+
+	if _, err := contentMD5Header("not-hex"); err == nil {
+		t.Fatal("无效的分片 MD5 应返回错误")
+	}
+}
+
+func TestUploadRapidHitSkipsSlices(t *testing.T) {
+	pan := newFakePan(t)
+	data := pattern(BlockSize+100, 4)
+	pan.put("/apps/test/original.bin", data)
+	c := pan.client(nil)
+
+	var progress []int64
+	md5sum, err := c.Upload(context.Background(), "/apps/test/copy.bin", bytes.NewReader(data), int64(len(data)), RtypeOverwrite,
+		func(done, total int64) { progress = append(progress, done) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// return_type=2: 不上传分片，直接合并
+	if n := pan.called("upload"); n != 0 {
+		t.Fatalf("秒传命中后仍上传了 %d 个分片", n)
+	}
+	if pan.called("create") != 1 || md5sum != md5Hex(data) {
+		t.Fatalf("create 调用 %d 次，MD5 为 %s", pan.called("create"), md5sum)
+	}
+	if got, _ := pan.get("/apps/test/copy.bin"); !bytes.Equal(got, data) {
+		t.Fatal("秒传生成的文件内容不一致")
+	}
+	if fmt.Sprint(progress) != fmt.Sprint([]int64{int64(len(data))}) {
+		t.Fatalf("进度回调为 %v，应直接报告完成", progress)
+	}
+
+	// 内容不同时 return_type=1，照常上传
+	other := pattern(100, 5)
+	if _, err := c.Upload(context.Background(), "/apps/test/other.bin", bytes.NewReader(other), int64(len(other)), RtypeOverwrite, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := pan.called("upload"); n != 1 {
+		t.Fatalf("上传了 %d 个分片，应为 1 个", n)
+	}
+}
+
+func TestCreateFileExistsErrno(t *testing.T) {
+	pan := newFakePan(t)
+	pan.mkdir("/apps/test/dir")
+	c := pan.client(nil)
+
+	// 目录已存在视为成功
+	if err := c.MkDir("/apps/test/dir"); err != nil {
+		t.Fatalf("创建已存在的目录失败: %v", err)
+	}
+
+	// 合并时返回 errno -8: 明确的拒绝，不重新提交也不去列目录确认
+	creates := pan.called("create")
+	pan.failNext("create", errnoFileExists)
+	_, err := c.Upload(context.Background(), "/apps/test/a.txt", strings.NewReader("a"), 1, RtypeFail, nil)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("错误为 %v，应为 fs.ErrExist", err)
+	}
+	if n := pan.called("create") - creates; n != 1 || pan.called("list /apps/test") != 0 {
+		t.Fatalf("create 调用 %d 次、list 调用 %d 次，应为 1 次与 0 次", n, pan.called("list /apps/test"))
+	}
+}
+
+func TestCopyRequest(t *testing.T) {
+	pan := newFakePan(t)
+	pan.put("/apps/test/a.txt", []byte("content"))
+	var query url.Values
+	pan.hook = func(call string, w http.ResponseWriter, r *http.Request) bool {
+		if call == "copy" {
+			query = r.URL.Query()
+		}
+		return false
+	}
+	c := pan.client(nil)
+	a := NewAdapter(c, "/apps/test", nil, false)
+
+	if err := a.Copy("a.txt", "backup/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("method") != "filemanager" || query.Get("access_token") != "test-token" {
+		t.Fatalf("URL 参数为 %v", query)
+	}
+	if pan.form("copy", "async") != "0" {
+		t.Fatalf("async=%s，应为同步执行", pan.form("copy", "async"))
+	}
+	var fileList []map[string]string
+	if err := json.Unmarshal([]byte(pan.form("copy", "filelist")), &fileList); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{{"path": "/apps/test/a.txt", "dest": "/apps/test/backup", "newname": "b.txt", "ondup": "fail"}}
+	if fmt.Sprint(fileList) != fmt.Sprint(want) {
+		t.Fatalf("filelist 为 %v，应为 %v", fileList, want)
+	}
+
+	// 目标目录先创建，内容不经过本地传输
+	if pan.form("create", "path") != "/apps/test/backup" || pan.form("create", "isdir") != "1" {
+		t.Fatalf("没有创建目标目录: %v", pan.forms["create"])
+	}
+	if got, _ := pan.get("/apps/test/backup/b.txt"); string(got) != "content" {
+		t.Fatalf("副本内容为 %q", got)
+	}
+	if pan.called("upload") != 0 || pan.called("download") != 0 {
+		t.Fatal("复制不应上传或下载内容")
+	}
+
+	// 目标已存在时失败，不覆盖
+	if err := a.Copy("a.txt", "backup/b.txt"); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("错误为 %v，应为 fs.ErrExist", err)
+	}
+}
@@ -0,0 +1,136 @@
+package baidu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cooldownBase 第一次被限流时暂停的时长，之后连续被限流时逐次翻倍
+	cooldownBase = 5 * time.Second
+	// cooldownMax 暂停时长的上限
+	cooldownMax = 5 * time.Minute
+	// cooldownPeek 读取响应体判断 errno 的最大长度；限流的响应很短，更长的响应 (例如目录列表) 不检查
+	cooldownPeek = 64 << 10
+)
+
+// cooldown 被百度网盘限流后暂停整个客户端的所有请求
+// 限流针对的是账号与 AppKey，此时立即重试 (包括其他 Worker 的请求) 只会让限流持续得更久，
+// 因此第一次限流后所有请求都等待 cooldownBase，冷却结束后再次被限流则时长翻倍，直到 cooldownMax
+// 冷却结束后保持一段与上次冷却同样长的平稳期，时长才重新从 cooldownBase 开始
+type cooldown struct {
+	mu      sync.Mutex
+	until   time.Time     // 冷却结束的时间
+	last    time.Duration // 最近一次冷却的时长
+	cooling bool          // 进入冷却后还没有请求成功 (用于输出“冷却结束”日志)
+}
+
+// wait 冷却期间阻塞，直到冷却结束或 ctx 取消
+func (c *cooldown) wait(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		d := time.Until(c.until)
+		c.mu.Unlock()
+		if d <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// trip 检测到限流，进入冷却
+// 冷却开始前已经发出的请求可能陆续返回限流，冷却期间再次触发不会延长时长
+func (c *cooldown) trip(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Before(c.until) {
+		return
+	}
+	d := cooldownBase
+	if c.last > 0 && now.Sub(c.until) < c.last {
+		d = min(c.last*2, cooldownMax)
+	}
+	c.last = d
+	c.until = now.Add(d)
+	c.cooling = true
+	slog.Warn("百度网盘限流，暂停所有请求", "reason", reason, "cooldown", d, "resume_at", c.until.Format(time.TimeOnly))
+}
+
+// ok 请求没有被限流
+func (c *cooldown) ok() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cooling && !time.Now().Before(c.until) {
+		c.cooling = false
+		slog.Info("限流冷却结束，已恢复请求", "cooldown", c.last)
+	}
+}
+
+// cooldownTransport 在 RoundTripper 层面识别限流 (HTTP 429 或响应体中的限流 errno)，识别到时进入冷却
+// 请求本身仍然返回原来的错误 (包装 fs.ErrThrottled)，由引擎按可重试错误处理，并让自适应并发降低并发数
+// 冷却期间的等待由 Client 在发出请求之前进行 (见 Client.pause)，不计入 MetadataTimeout
+type cooldownTransport struct {
+	base http.RoundTripper
+	cd   *cooldown
+}
+
+func (t *cooldownTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t.cd.trip("http 429")
+		return resp, nil
+	}
+	if errno, ok := peekErrno(resp); ok && isThrottleErrno(errno) {
+		t.cd.trip("errno " + strconv.Itoa(errno))
+		return resp, nil
+	}
+	t.cd.ok()
+	return resp, nil
+}
+
+// pause 限流冷却期间等待，每个请求发出之前调用
+func (c *Client) pause(ctx context.Context) error {
+	return c.cooldown.wait(ctx)
+}
+
+// peekErrno 读取较短的 JSON 响应中的 errno，读取的内容会放回 resp.Body
+// 下载等二进制内容与较长的响应不检查
+func peekErrno(resp *http.Response) (int, bool) {
+	ct := resp.Header.Get("Content-Type")
+	if resp.Body == nil || resp.ContentLength > cooldownPeek || !strings.Contains(ct, "json") && !strings.HasPrefix(ct, "text/") {
+		return 0, false
+	}
+	head, err := io.ReadAll(io.LimitReader(resp.Body, cooldownPeek+1))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	if err != nil || len(head) > cooldownPeek {
+		return 0, false
+	}
+	var r struct {
+		ErrNo int `json:"errno"`
+	}
+	if json.Unmarshal(head, &r) != nil {
+		return 0, false
+	}
+	return r.ErrNo, true
+}
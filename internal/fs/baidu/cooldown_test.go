@@ -0,0 +1,112 @@
+package baidu
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs"
+)
+
+// remaining 返回冷却还剩下的时长
+func (c *cooldown) remaining() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Until(c.until)
+}
+
+// shorten 把冷却结束时间提前到 d 之后，避免测试等待真实的冷却时长
+func (c *cooldown) shorten(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.until = time.Now().Add(d)
+}
+
+func TestThrottleErrnoStartsCooldown(t *testing.T) {
+	for _, errno := range []int{errnoThrottled, errnoBusy} {
+		pan := newFakePan(t)
+		pan.mkdir("/apps/test")
+		c := pan.client(nil)
+		pan.failNext("list /apps/test", errno)
+
+		if _, err := c.ListDir("/apps/test"); !errors.Is(err, fs.ErrThrottled) {
+			t.Fatalf("errno %d: 错误为 %v，应为 fs.ErrThrottled", errno, err)
+		}
+		if d := c.cooldown.remaining(); d <= cooldownBase-time.Second || d > cooldownBase {
+			t.Fatalf("errno %d: 冷却剩余 %v，应约为 %v", errno, d, cooldownBase)
+		}
+
+		// 冷却期间请求不会发出
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := c.pause(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("errno %d: 冷却期间 pause 返回 %v", errno, err)
+		}
+		calls := pan.called("list /apps/test")
+
+		// 冷却结束后请求照常发出
+		c.cooldown.shorten(50 * time.Millisecond)
+		start := time.Now()
+		if _, err := c.ListDir("/apps/test"); err != nil {
+			t.Fatalf("errno %d: 冷却结束后请求失败: %v", errno, err)
+		}
+		if waited := time.Since(start); waited < 40*time.Millisecond {
+			t.Fatalf("errno %d: 请求只等待了 %v，应等到冷却结束", errno, waited)
+		}
+		if pan.called("list /apps/test") != calls+1 {
+			t.Fatalf("errno %d: 冷却结束后应只发出一次请求", errno)
+		}
+	}
+}
+
+func TestThrottleStatusStartsCooldown(t *testing.T) {
+	pan := newFakePan(t)
+	pan.hook = func(call string, w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return true
+	}
+	c := pan.client(nil)
+
+	if _, err := c.ListDir("/"); !errors.Is(err, fs.ErrThrottled) {
+		t.Fatalf("错误为 %v，应为 fs.ErrThrottled", err)
+	}
+	if c.cooldown.remaining() <= 0 {
+		t.Fatal("HTTP 429 应进入冷却")
+	}
+}
+
+func TestCooldownBackoff(t *testing.T) {
+	var c cooldown
+	c.trip("test")
+	if c.last != cooldownBase {
+		t.Fatalf("第一次冷却 %v，应为 %v", c.last, cooldownBase)
+	}
+
+	// 冷却期间再次触发不延长
+	until := c.until
+	c.trip("test")
+	if c.until != until || c.last != cooldownBase {
+		t.Fatal("冷却期间再次触发不应延长冷却")
+	}
+
+	// 冷却刚结束就再次被限流: 时长翻倍，直到上限
+	want := cooldownBase
+	for range 10 {
+		c.until = time.Now().Add(-time.Millisecond)
+		c.trip("test")
+		want = min(want*2, cooldownMax)
+		if c.last != want {
+			t.Fatalf("冷却时长为 %v，应为 %v", c.last, want)
+		}
+	}
+
+	// 平稳期超过上次的冷却时长后重新从 cooldownBase 开始
+	c.until = time.Now().Add(-c.last - time.Second)
+	c.trip("test")
+	if c.last != cooldownBase {
+		t.Fatalf("平稳期后冷却时长为 %v，应为 %v", c.last, cooldownBase)
+	}
+}
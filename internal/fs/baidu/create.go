@@ -0,0 +1,62 @@
+package baidu
+
+import (
+	"errors"
+	"log/slog"
+	"path"
+	"strings"
+)
+
+// createRetries 合并请求的结果未知时最多重新提交的次数
+const createRetries = 2
+
+// ambiguousCreate 合并请求失败后能否确定它没有生效
+// 网盘以 errno 或状态码明确拒绝的请求 (*APIError) 没有生效；网络中断、响应不完整时请求可能已经生效，只是响应丢失了
+func ambiguousCreate(err error) bool {
+	var apiErr *APIError
+	return !errors.As(err, &apiErr)
+}
+
+// createIdempotent 合并分片，响应丢失时不直接报告失败
+// 重新提交之前先确认云端是否已经有大小与 MD5 都吻合的文件，有则说明上一次请求已经生效，视为成功；
+// 否则重新提交。重新提交被网盘拒绝 (例如 uploadid 已被上一次请求用掉) 时同样先确认一次
+func (c *Client) createIdempotent(remotePath string, size int64, uploadID string, blockMD5s []string, contentMD5 string, rtype Rtype) (string, int64, error) {
+	cloudMD5, cloudSize, err := c.create(remotePath, size, uploadID, blockMD5s, rtype)
+	if err == nil || !ambiguousCreate(err) {
+		return cloudMD5, cloudSize, err
+	}
+	for attempt := 1; ; attempt++ {
+		if f, ok := c.findCreated(remotePath, size, contentMD5); ok {
+			slog.Info("合并请求的响应丢失，但云端文件已经生成，视为成功", "path", remotePath, "attempts", attempt)
+			return f.MD5, f.Size, nil
+		}
+		if !ambiguousCreate(err) || attempt > createRetries {
+			return "", 0, err
+		}
+		slog.Warn("合并请求的结果未知，云端没有对应的文件，重新提交", "path", remotePath, "attempt", attempt, "err", err)
+		cloudMD5, cloudSize, err = c.create(remotePath, size, uploadID, blockMD5s, rtype)
+		if err == nil {
+			return cloudMD5, cloudSize, nil
+		}
+	}
+}
+
+// findCreated 在父目录的列表中查找大小与 MD5 都吻合的文件
+// 只比较大小不够: 覆盖上传时原来的同名文件可能恰好同样大小。列表失败或 MD5 未知时视为不存在
+func (c *Client) findCreated(remotePath string, size int64, contentMD5 string) (*FileInfo, bool) {
+	if contentMD5 == "" {
+		return nil, false
+	}
+	list, err := c.ListDir(path.Dir(remotePath))
+	if err != nil {
+		slog.Debug("确认云端文件失败", "path", remotePath, "err", err)
+		return nil, false
+	}
+	for i := range list {
+		f := &list[i]
+		if f.Path == remotePath && f.IsDir == 0 && f.Size == size && strings.EqualFold(f.MD5, contentMD5) {
+			return f, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,98 @@
+package baidu
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// dropFirst 丢弃 call 第一次调用的响应 (请求已经生效)，客户端只看到连接中断
+func dropFirst(pan *fakePan, call string) {
+	dropped := false
+	pan.after = func(c string) {
+		if c == call && !dropped {
+			dropped = true
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+func TestCreateLostResponseFileExists(t *testing.T) {
+	pan := newFakePan(t)
+	pan.mkdir("/apps/test")
+	dropFirst(pan, "create")
+	c := pan.client(nil)
+
+	md5sum, err := c.Upload(context.Background(), "/apps/test/a.txt", strings.NewReader("hello"), 5, RtypeFail, nil)
+	if err != nil {
+		t.Fatalf("合并请求已生效，不应失败: %v", err)
+	}
+	if md5sum != md5Hex([]byte("hello")) {
+		t.Fatalf("MD5 为 %s", md5sum)
+	}
+	// 列出父目录确认文件已生成，不重新提交
+	if pan.called("create") != 1 || pan.called("list /apps/test") != 1 {
+		t.Fatalf("create 调用 %d 次、list 调用 %d 次", pan.called("create"), pan.called("list /apps/test"))
+	}
+}
+
+func TestCreateLostResponseThenAlreadyExists(t *testing.T) {
+	pan := newFakePan(t)
+	pan.mkdir("/apps/test")
+	dropFirst(pan, "create")
+	// 第一次确认时列表失败，只能重新提交；重新提交因文件已存在 (errno -8) 被拒绝后再确认一次
+	pan.failNext("list /apps/test", 2)
+	c := pan.client(nil)
+
+	if _, err := c.Upload(context.Background(), "/apps/test/a.txt", strings.NewReader("hello"), 5, RtypeFail, nil); err != nil {
+		t.Fatalf("文件已由第一次请求生成，不应失败: %v", err)
+	}
+	if pan.called("create") != 2 || pan.called("list /apps/test") != 2 {
+		t.Fatalf("create 调用 %d 次、list 调用 %d 次，应各为 2 次", pan.called("create"), pan.called("list /apps/test"))
+	}
+	if got, _ := pan.get("/apps/test/a.txt"); string(got) != "hello" {
+		t.Fatalf("云端文件内容为 %q", got)
+	}
+}
+
+func TestCreateAlreadyExistsWithOtherContent(t *testing.T) {
+	pan := newFakePan(t)
+	pan.put("/apps/test/a.txt", []byte("other"))
+	c := pan.client(nil)
+
+	// 响应没有丢失时，errno -8 就是真实的冲突: 云端同样大小但内容不同的文件不能当作上传成功
+	_, err := c.Upload(context.Background(), "/apps/test/a.txt", strings.NewReader("hello"), 5, RtypeFail, nil)
+	if err == nil {
+		t.Fatal("云端已有不同内容的同名文件时应失败")
+	}
+	if got, _ := pan.get("/apps/test/a.txt"); string(got) != "other" {
+		t.Fatalf("云端文件被改为 %q", got)
+	}
+}
+
+func TestCreateLostBeforeApplied(t *testing.T) {
+	pan := newFakePan(t)
+	pan.mkdir("/apps/test")
+	// 请求没有到达网盘 (连接在处理前中断)
+	dropped := false
+	pan.hook = func(call string, w http.ResponseWriter, r *http.Request) bool {
+		if call == "create" && !dropped {
+			dropped = true
+			panic(http.ErrAbortHandler)
+		}
+		return false
+	}
+	c := pan.client(nil)
+
+	if _, err := c.Upload(context.Background(), "/apps/test/a.txt", strings.NewReader("hello"), 5, RtypeOverwrite, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 云端没有对应的文件，重新提交
+	if pan.called("create") != 2 {
+		t.Fatalf("create 调用 %d 次，应为 2 次", pan.called("create"))
+	}
+	if got, _ := pan.get("/apps/test/a.txt"); string(got) != "hello" {
+		t.Fatalf("云端文件内容为 %q", got)
+	}
+}
@@ -0,0 +1,86 @@
+package baidu
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchPageSize 搜索接口每页的条数 (接口上限 1000)
+const searchPageSize = 500
+
+// Search 在 dir 及其下级目录中搜索文件名包含 keyword 的文件与目录 (自动翻页)
+// 网盘按云端保存的文件名匹配，开启文件名加密时用明文关键字搜不到结果
+func (c *Client) Search(keyword, dir string) ([]FileInfo, error) {
+	var files []FileInfo
+	for page := 1; ; page++ {
+		params := url.Values{}
+		params.Set("method", "search")
+		params.Set("key", keyword)
+		params.Set("dir", dir)
+		params.Set("recursion", "1")
+		params.Set("page", strconv.Itoa(page))
+		params.Set("num", strconv.Itoa(searchPageSize))
+
+		body, reqID, err := c.request("GET", PCSBaseURL, params, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var resp SearchResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("解析搜索结果失败: %w", err)
+		}
+		if !resp.IsSuccess() {
+			return nil, resp.err("search error", reqID)
+		}
+
+		files = append(files, resp.List...)
+		if resp.HasMore == 0 || len(resp.List) == 0 {
+			return files, nil
+		}
+	}
+}
+
+// SearchEntry 搜索结果中的一项 (路径已解密为明文相对路径)
+type SearchEntry struct {
+	FsID    uint64    `json:"fs_id"`
+	RelPath string    `json:"path"`
+	Size    int64     `json:"size"` // 云端保存的大小 (加密时包含密文头部)
+	IsDir   bool      `json:"is_dir"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Search 在同步目录下按文件名搜索，结果按路径排序
+// 开启文件名加密时路径会被解密，但网盘只能按密文文件名匹配，明文关键字通常搜不到任何结果，
+// 此时应改为搜索本地的同步记录 (见 find 命令)
+func (a *Adapter) Search(keyword string) ([]SearchEntry, error) {
+	files, err := a.client.Search(keyword, a.root)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []SearchEntry
+	for _, f := range files {
+		if f.Path != a.root && !strings.HasPrefix(f.Path, a.root+"/") {
+			continue
+		}
+		relPath, err := a.toDecryptedRelPath(f.Path)
+		if err != nil {
+			relPath, _ = a.toRelPath(f.Path)
+		}
+		entries = append(entries, SearchEntry{
+			FsID:    f.FsID,
+			RelPath: relPath,
+			Size:    f.Size,
+			IsDir:   f.IsDir == 1,
+			ModTime: time.Unix(f.ServerMTime, 0),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].RelPath < entries[j].RelPath })
+	return entries, nil
+}
@@ -0,0 +1,123 @@
+package baidu
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShareURL 创建分享链接的接口地址
+const ShareURL = "https://pan.baidu.com/share/set"
+
+// errnoShareForbidden 百度网盘返回的“禁止分享”错误码 (文件被限制分享或账号的分享功能已关闭)
+const errnoShareForbidden = 115
+
+// ErrShareDisabled 文件或账号不允许分享
+var ErrShareDisabled = errors.New("该文件或账号不允许分享")
+
+// sharePeriods 百度网盘支持的有效期 (天)，0 表示永久有效
+var sharePeriods = []int{1, 7, 30}
+
+// sharePasswordPattern 提取码必须是 4 位小写字母或数字
+var sharePasswordPattern = regexp.MustCompile(`^[a-z0-9]{4}$`)
+
+// ShareLink 创建好的分享链接
+type ShareLink struct {
+	URL      string `json:"url"`
+	Password string `json:"password"`
+	// PeriodDays 实际的有效期 (天)，0 表示永久有效
+	PeriodDays int `json:"period_days"`
+}
+
+// CreateShare 为网盘中的文件创建带提取码的分享链接
+// password 为空时随机生成；expirySeconds 向上取整到网盘支持的 1 / 7 / 30 天，
+// 超过 30 天或为 0 时创建永久有效的链接
+func (c *Client) CreateShare(remotePath, password string, expirySeconds int64) (*ShareLink, error) {
+	if password == "" {
+		password = randomSharePassword()
+	} else if !sharePasswordPattern.MatchString(password) {
+		return nil, fmt.Errorf("提取码必须是 4 位小写字母或数字: %q", password)
+	}
+
+	// 分享接口只接受 fs_id，先在父目录中找到该文件
+	fsID, err := c.lookupFsID(remotePath)
+	if err != nil {
+		return nil, err
+	}
+
+	period := sharePeriod(expirySeconds)
+	form := url.Values{}
+	form.Set("fid_list", fmt.Sprintf("[%d]", fsID))
+	form.Set("schannel", "4") // 4=带提取码的私密分享
+	form.Set("channel_list", "[]")
+	form.Set("period", strconv.Itoa(period))
+	form.Set("pwd", password)
+
+	body, reqID, err := c.request("POST", ShareURL, nil, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ShareResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析分享响应失败: %w", err)
+	}
+	if resp.ErrNo == errnoShareForbidden {
+		return nil, fmt.Errorf("%s: %w", remotePath, ErrShareDisabled)
+	}
+	if !resp.IsSuccess() {
+		return nil, resp.err("share error", reqID)
+	}
+
+	link := resp.ShortURL
+	if link == "" {
+		link = resp.Link
+	}
+	return &ShareLink{URL: link, Password: password, PeriodDays: period}, nil
+}
+
+// lookupFsID 通过列出父目录找到文件的 fs_id
+func (c *Client) lookupFsID(remotePath string) (uint64, error) {
+	list, err := c.ListDir(path.Dir(remotePath))
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range list {
+		if f.Path == remotePath {
+			return f.FsID, nil
+		}
+	}
+	return 0, fmt.Errorf("网盘中不存在: %s", remotePath)
+}
+
+// sharePeriod 把有效期换算为网盘支持的天数
+func sharePeriod(expirySeconds int64) int {
+	if expirySeconds <= 0 {
+		return 0
+	}
+	days := int((time.Duration(expirySeconds)*time.Second + 24*time.Hour - 1) / (24 * time.Hour))
+	for _, p := range sharePeriods {
+		if days <= p {
+			return p
+		}
+	}
+	return 0
+}
+
+// randomSharePassword 生成 4 位随机提取码
+func randomSharePassword() string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 4)
+	rand.Read(b)
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b)
+}
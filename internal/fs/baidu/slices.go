@@ -0,0 +1,62 @@
+package baidu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sliceTracker 记录每个分片已确认上传的 MD5 (云端返回的分片 MD5 与本地一致后才记录)
+// create 按 block_list 的顺序合并已上传的分片，列表与实际上传的分片不一致时网盘可能合并出损坏的文件，
+// 而且往往只有之后的大小校验才会发现；合并前用 verify 确认每个分片都已按顺序上传
+type sliceTracker struct {
+	confirmed []string
+}
+
+func newSliceTracker(blocks int) *sliceTracker {
+	return &sliceTracker{confirmed: make([]string, blocks)}
+}
+
+// confirm 记录分片 i 已上传
+func (s *sliceTracker) confirm(i int, blockMD5 string) {
+	if i >= 0 && i < len(s.confirmed) {
+		s.confirmed[i] = blockMD5
+	}
+}
+
+// verify 检查 blockMD5s 中的每个分片都已上传，且与上传时的 MD5 一致 (顺序没有错位)
+func (s *sliceTracker) verify(blockMD5s []string) error {
+	if len(blockMD5s) != len(s.confirmed) {
+		return fmt.Errorf("分片数量不一致: 待合并 %d 个，已跟踪 %d 个", len(blockMD5s), len(s.confirmed))
+	}
+	var missing, mismatched []int
+	for i, want := range blockMD5s {
+		switch s.confirmed[i] {
+		case "":
+			missing = append(missing, i)
+		case want:
+		default:
+			mismatched = append(mismatched, i)
+		}
+	}
+	if len(missing) == 0 && len(mismatched) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "分片不完整，拒绝合并 (共 %d 个分片)", len(blockMD5s))
+	if len(missing) > 0 {
+		fmt.Fprintf(&b, "; 未上传: %s", formatIndices(missing))
+	}
+	if len(mismatched) > 0 {
+		fmt.Fprintf(&b, "; MD5 与上传时不一致: %s", formatIndices(mismatched))
+	}
+	return fmt.Errorf("%s", b.String())
+}
+
+// formatIndices 最多列出前 20 个下标
+func formatIndices(idx []int) string {
+	const limit = 20
+	if len(idx) <= limit {
+		return fmt.Sprint(idx)
+	}
+	return fmt.Sprintf("%v 等 %d 个", idx[:limit], len(idx))
+}
@@ -0,0 +1,79 @@
+package baidu
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSliceTrackerVerify(t *testing.T) {
+	blocks := []string{"a", "b", "c", "d"}
+
+	s := newSliceTracker(len(blocks))
+	for i, b := range blocks {
+		s.confirm(i, b)
+	}
+	if err := s.verify(blocks); err != nil {
+		t.Fatalf("所有分片都已上传时校验失败: %v", err)
+	}
+
+	// 缺少第 1 个分片，第 3 个分片与待合并的列表错位
+	s = newSliceTracker(len(blocks))
+	s.confirm(0, "a")
+	s.confirm(2, "c")
+	s.confirm(3, "x")
+	s.confirm(9, "out of range")
+	err := s.verify(blocks)
+	if err == nil || !strings.Contains(err.Error(), "未上传: [1]") || !strings.Contains(err.Error(), "不一致: [3]") {
+		t.Fatalf("错误为 %v", err)
+	}
+
+	if err := newSliceTracker(3).verify(blocks); err == nil || !strings.Contains(err.Error(), "分片数量不一致") {
+		t.Fatalf("分片数量不一致时错误为 %v", err)
+	}
+}
+
+func TestFormatIndices(t *testing.T) {
+	idx := make([]int, 25)
+	for i := range idx {
+		idx[i] = i
+	}
+	if got := formatIndices(idx[:3]); got != "[0 1 2]" {
+		t.Fatalf("formatIndices = %q", got)
+	}
+	if got := formatIndices(idx); !strings.HasSuffix(got, "19] 等 25 个") {
+		t.Fatalf("formatIndices = %q", got)
+	}
+}
+
+func TestUploadMissingSliceNeverCreates(t *testing.T) {
+	pan := newFakePan(t)
+	// 第二个分片的响应中 MD5 与本地不一致，相当于该分片没有正确上传
+	uploads := 0
+	pan.hook = func(call string, w http.ResponseWriter, r *http.Request) bool {
+		if call != "upload" {
+			return false
+		}
+		uploads++
+		if uploads == 2 {
+			writeJSON(w, map[string]any{"errno": 0, "md5": "00000000000000000000000000000000"})
+			return true
+		}
+		return false
+	}
+	c := pan.client(nil)
+	data := pattern(3*BlockSize, 6)
+
+	_, err := c.Upload(context.Background(), "/apps/test/a.bin", bytes.NewReader(data), int64(len(data)), RtypeOverwrite, nil)
+	if err == nil || !strings.Contains(err.Error(), "分片 1 数据校验失败") {
+		t.Fatalf("错误为 %v，应为分片 1 校验失败", err)
+	}
+	if pan.called("create") != 0 {
+		t.Fatal("分片不完整时不应合并")
+	}
+	if _, ok := pan.get("/apps/test/a.bin"); ok {
+		t.Fatal("分片不完整时不应生成云端文件")
+	}
+}
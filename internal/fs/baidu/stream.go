@@ -0,0 +1,85 @@
+package baidu
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"baidusync/internal/fs"
+)
+
+// streamPlaceholderMD5 流式上传时 precreate 的分片 MD5 占位值
+// precreate 只用 block_list 判断秒传与需要上传哪些分片，真实的列表在 create 时提交并由网盘校验
+const streamPlaceholderMD5 = "5910a591dd8fc18c32a8f3df4fdc1761"
+
+// errStreamSize 流式上传读到的内容与事先给出的大小不一致 (例如文件在上传过程中被修改)
+var errStreamSize = errors.New("内容大小与预期不一致")
+
+// uploadStreaming 不落盘的分片上传: 每次从 content 读取一个分片到内存，计算分片 MD5 后立即上传
+// 磁盘占用与文件大小无关，代价是 precreate 时还没有读取内容、只能提交占位的分片 MD5，因此不会命中秒传
+// content 必须恰好有 size 字节，多或少都会在 create 之前失败，云端不会留下不完整的文件
+func (c *Client) uploadStreaming(ctx context.Context, remotePath string, content io.Reader, size int64, rtype Rtype, progress fs.ProgressFunc) (string, error) {
+	blocks := int((size + BlockSize - 1) / BlockSize)
+	placeholders := make([]string, blocks)
+	for i := range placeholders {
+		placeholders[i] = streamPlaceholderMD5
+	}
+
+	pre, err := c.precreate(remotePath, size, placeholders, rtype)
+	if err != nil {
+		return "", fmt.Errorf("precreate failed: %w", err)
+	}
+	if pre.UploadID == "" {
+		return "", fmt.Errorf("precreate failed: 流式上传没有返回 uploadid")
+	}
+
+	buf := make([]byte, BlockSize)
+	blockMD5s := make([]string, 0, blocks)
+	total := md5.New()
+	uploaded := newSliceTracker(blocks)
+	var offset int64
+	for i := 0; i < blocks; i++ {
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("上传在分片 %d/%d 处中止: %w", i+1, blocks, err)
+		}
+		n := min(int64(BlockSize), size-offset)
+		if _, err := io.ReadFull(content, buf[:n]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return "", fmt.Errorf("读取分片 %d/%d 失败: %w (内容少于 %d 字节)", i+1, blocks, errStreamSize, size)
+			}
+			return "", fmt.Errorf("读取分片 %d/%d 失败: %w", i+1, blocks, err)
+		}
+
+		total.Write(buf[:n])
+		sum := md5.Sum(buf[:n])
+		blockMD5 := hex.EncodeToString(sum[:])
+		cloudSliceMD5, err := c.uploadSlice(ctx, remotePath, pre.UploadID, i, bytes.NewReader(buf[:n]), n, blockMD5)
+		if err != nil {
+			return "", fmt.Errorf("上传分片 %d/%d 失败: %w", i+1, blocks, err)
+		}
+		if cloudSliceMD5 != blockMD5 {
+			return "", fmt.Errorf("分片 %d 数据校验失败: 本地MD5(%s) != 云端MD5(%s)", i, blockMD5, cloudSliceMD5)
+		}
+		blockMD5s = append(blockMD5s, blockMD5)
+		uploaded.confirm(i, cloudSliceMD5)
+
+		offset += n
+		if progress != nil {
+			progress(offset, size)
+		}
+	}
+
+	// 内容比 size 长时不能合并: 云端会得到被截断的文件
+	if n, _ := io.ReadFull(content, buf[:1]); n > 0 {
+		return "", fmt.Errorf("上传 %s 失败: %w (内容多于 %d 字节)", remotePath, errStreamSize, size)
+	}
+
+	if err := uploaded.verify(blockMD5s); err != nil {
+		return "", fmt.Errorf("上传 %s 失败: %w", remotePath, err)
+	}
+	return c.commit(remotePath, size, pre.UploadID, blockMD5s, hex.EncodeToString(total.Sum(nil)), rtype)
+}
@@ -1,9 +1,15 @@
 package baidu
 
+import (
+	"cmp"
+	"strings"
+)
+
 // PCSResponse 通用响应外壳
 type PCSResponse struct {
-	ErrNo int    `json:"errno"`
-	Msg   string `json:"errmsg"`
+	ErrNo     int       `json:"errno"`
+	Msg       string    `json:"errmsg"`
+	RequestID RequestID `json:"request_id"`
 }
 
 // IsSuccess 判断请求是否成功
@@ -11,6 +17,24 @@ func (r *PCSResponse) IsSuccess() bool {
 	return r.ErrNo == 0
 }
 
+// err 把响应中的错误码转换为 *APIError，响应体中没有 request_id 时使用响应头中的 headerID
+func (r *PCSResponse) err(op, headerID string) error {
+	return errnoError(op, r.ErrNo, r.Msg, cmp.Or(string(r.RequestID), headerID))
+}
+
+// RequestID 百度网盘为每个请求分配的 ID，向百度网盘客服反馈问题时需要提供
+// 不同接口以数字或字符串返回，统一按字符串保存，避免大整数丢失精度
+type RequestID string
+
+func (id *RequestID) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "null" {
+		s = ""
+	}
+	*id = RequestID(s)
+	return nil
+}
+
 // FileInfo 百度返回的文件信息
 type FileInfo struct {
 	FsID        uint64 `json:"fs_id"`
@@ -36,15 +60,28 @@ type CreateFileResponse struct {
 	IsDir       int    `json:"isdir"`
 }
 
+// PrecreateResponse 对应 precreate 接口的返回 JSON
+type PrecreateResponse struct {
+	PCSResponse
+	UploadID string `json:"uploadid"`
+	// ReturnType 1: 需要上传分片; 2: 秒传命中，网盘中已有相同内容，无需上传
+	ReturnType int `json:"return_type"`
+}
+
+// Rapid 是否命中秒传
+func (r *PrecreateResponse) Rapid() bool {
+	return r.ReturnType == 2
+}
+
 // ListResponse /file?method=list 响应
 type ListResponse struct {
 	PCSResponse
 	List []FileInfo `json:"list"`
 }
 type UploadSliceResponse struct {
-	MD5       string `json:"md5"`        // 云端计算出的该分片 MD5
-	RequestID int64  `json:"request_id"` // 请求 ID，用于调试
-	ErrNo     int    `json:"errno"`      // 错误码，0 为成功
+	MD5       string    `json:"md5"`        // 云端计算出的该分片 MD5
+	RequestID RequestID `json:"request_id"` // 请求 ID，用于调试
+	ErrNo     int       `json:"errno"`      // 错误码，0 为成功
 }
 
 // UploadResponse /file?method=upload 响应
@@ -61,3 +98,39 @@ type AuthResponse struct {
 	RefreshToken string `json:"refresh_token"`
 	ExpiresIn    int    `json:"expires_in"`
 }
+
+// ShareResponse /share/set 响应
+type ShareResponse struct {
+	PCSResponse
+	ShareID  int64  `json:"shareid"`
+	Link     string `json:"link"`
+	ShortURL string `json:"shorturl"`
+}
+
+// RecycleItem 回收站中的一项
+type RecycleItem struct {
+	FileInfo
+	// LeftTime 距离被彻底清除的剩余天数
+	LeftTime int `json:"leftTime"`
+}
+
+// RecycleListResponse /api/recycle/list 响应
+type RecycleListResponse struct {
+	PCSResponse
+	List []RecycleItem `json:"list"`
+}
+
+// SearchResponse 文件搜索 (method=search) 响应
+type SearchResponse struct {
+	PCSResponse
+	List    []FileInfo `json:"list"`
+	HasMore int        `json:"has_more"`
+}
+
+// QuotaResponse /api/quota 响应 (单位: 字节)
+type QuotaResponse struct {
+	PCSResponse
+	Total int64 `json:"total"`
+	Used  int64 `json:"used"`
+	Free  int64 `json:"free"`
+}
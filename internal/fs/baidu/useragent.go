@@ -0,0 +1,55 @@
+package baidu
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// DefaultUserAgent 默认的 User-Agent
+// 百度网盘开放平台要求下载等接口使用 "pan.baidu.com"，使用浏览器的 User-Agent 会被拒绝
+const DefaultUserAgent = "pan.baidu.com"
+
+// userAgents 按请求轮换的 User-Agent 列表，可以安全地并发使用
+type userAgents struct {
+	list []string
+	n    atomic.Uint64
+}
+
+// newUserAgents list 中没有非空的 User-Agent 时固定使用 single
+func newUserAgents(single string, list []string) *userAgents {
+	u := &userAgents{}
+	for _, ua := range list {
+		if ua != "" {
+			u.list = append(u.list, ua)
+		}
+	}
+	if len(u.list) == 0 {
+		u.list = []string{single}
+	}
+	return u
+}
+
+// next 返回下一个请求使用的 User-Agent
+func (u *userAgents) next() string {
+	if len(u.list) == 1 {
+		return u.list[0]
+	}
+	return u.list[(u.n.Add(1)-1)%uint64(len(u.list))]
+}
+
+// userAgentTransport 为没有设置 User-Agent 的请求补上 User-Agent
+// 重定向后的请求会沿用原请求的 User-Agent；刷新 Token 等直接使用 httpClient 的请求由这里补上，
+// 避免请求以 Go 默认的 "Go-http-client" 发出
+type userAgentTransport struct {
+	base   http.RoundTripper
+	agents *userAgents
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		// RoundTripper 不能修改传入的请求
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.agents.next())
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,23 @@
+package fs
+
+import "io"
+
+// DefaultCopyBuffer 写入文件时每次从数据流读取的默认字节数
+// 加密、解密与计算 Hash 都按每次读取的大小处理数据，io.Copy 默认的 32KB 对大文件偏小:
+// 实测 AES-CTR 解密后写入本地文件，256KB 比 32KB 快约 10%，1MB 不再有提升
+const DefaultCopyBuffer = 256 << 10
+
+// CopyBufferSetter 可选接口: 设置写入文件时使用的缓冲区大小 (<= 0 表示 DefaultCopyBuffer)
+type CopyBufferSetter interface {
+	SetCopyBuffer(size int)
+}
+
+// CopyBuffer 使用 size 字节 (<= 0 时为 DefaultCopyBuffer) 的缓冲区把 src 复制到 dst
+// io.CopyBuffer 在 dst 实现了 io.ReaderFrom (例如 *os.File) 或 src 实现了 io.WriterTo 时会忽略传入的缓冲区，
+// 按对方的方式 (通常是 32KB) 读取；这里隐藏这两个接口，保证每次都按 size 读取
+func CopyBuffer(dst io.Writer, src io.Reader, size int) (int64, error) {
+	if size <= 0 {
+		size = DefaultCopyBuffer
+	}
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, make([]byte, size))
+}
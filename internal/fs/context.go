@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"context"
+	"io"
+)
+
+// contextReader 在 ctx 取消后让读取立即失败
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// NewContextReader 包装 Reader，ctx 取消或超时后的读取返回 ctx.Err()
+// 只能在两次读取之间生效；要中断阻塞中的读取 (例如卡住的网络连接)，调用方还需要关闭底层的流
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r
+	}
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (c *contextReader) Read(b []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(b)
+	// 底层的流因为 ctx 取消被关闭时，返回更明确的 ctx.Err()
+	if err != nil && err != io.EOF && c.ctx.Err() != nil {
+		err = c.ctx.Err()
+	}
+	return n, err
+}
+
+// ContextLister 可选接口: 可以取消的 ListAll
+// 扫描很大的目录需要较长时间，ctx 取消后应尽快返回 ctx.Err()，而不是扫描完整个目录
+type ContextLister interface {
+	ListAllContext(ctx context.Context) (map[string]*FileMeta, error)
+}
+
+// ListAll 优先使用 ContextLister，没有实现时退回 ListAll (此时只在开始前检查一次 ctx)
+func ListAll(ctx context.Context, fsys FileSystem) (map[string]*FileMeta, error) {
+	if l, ok := fsys.(ContextLister); ok {
+		return l.ListAllContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fsys.ListAll()
+}
+
+// ContextStater 可选接口: 可以取消的 Stat
+// 本地文件系统的 Stat 需要读取整个文件计算 Hash，ctx 取消后应在读取下一块之前返回 ctx.Err()
+type ContextStater interface {
+	StatContext(ctx context.Context, relPath string) (*FileMeta, error)
+}
+
+// Stat 优先使用 ContextStater，没有实现时退回 Stat (此时只在开始前检查一次 ctx)
+func Stat(ctx context.Context, fsys FileSystem, relPath string) (*FileMeta, error) {
+	if s, ok := fsys.(ContextStater); ok {
+		return s.StatContext(ctx, relPath)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fsys.Stat(relPath)
+}
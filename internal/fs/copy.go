@@ -0,0 +1,7 @@
+package fs
+
+// Copier 可选接口: 在后端内部复制文件，不经过本地传输数据
+// 目标已存在时返回包装 ErrExist 的错误，不覆盖已有的文件；目标的上级目录不存在时自动创建
+type Copier interface {
+	Copy(srcRelPath, dstRelPath string) error
+}
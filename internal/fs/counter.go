@@ -0,0 +1,47 @@
+package fs
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Counter 并发安全的字节计数器，nil 表示不计数
+type Counter struct {
+	n atomic.Int64
+}
+
+// Add 累加字节数
+func (c *Counter) Add(n int64) {
+	if c != nil {
+		c.n.Add(n)
+	}
+}
+
+// Load 返回当前的字节数
+func (c *Counter) Load() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.n.Load()
+}
+
+// countingReader 把读到的字节数累加到计数器
+type countingReader struct {
+	r io.Reader
+	c *Counter
+}
+
+// NewCountingReader 包装 Reader，把实际读到的字节数累加到 c (c 为 nil 时直接返回原 Reader)
+// 放在加密/解密的哪一侧决定了统计的是密文还是明文
+func NewCountingReader(r io.Reader, c *Counter) io.Reader {
+	if c == nil {
+		return r
+	}
+	return &countingReader{r: r, c: c}
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.c.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,60 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNilCounter(t *testing.T) {
+	var c *Counter
+	c.Add(10)
+	if c.Load() != 0 {
+		t.Fatal("nil 计数器应始终为 0")
+	}
+	r := strings.NewReader("data")
+	if NewCountingReader(r, nil) != io.Reader(r) {
+		t.Fatal("计数器为 nil 时应直接返回原 Reader")
+	}
+}
+
+func TestCountingReader(t *testing.T) {
+	var c Counter
+	// 每次只读 1 字节，按实际读到的字节数累加
+	r := NewCountingReader(iotest.OneByteReader(strings.NewReader("hello world")), &c)
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("读取 %q, %v", data, err)
+	}
+	if c.Load() != 11 {
+		t.Fatalf("计数为 %d，应为 11", c.Load())
+	}
+
+	// 出错前已读到的字节同样计入
+	boom := errors.New("连接断开")
+	r = NewCountingReader(io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(boom)), &c)
+	if _, err := io.ReadAll(r); !errors.Is(err, boom) {
+		t.Fatalf("错误为 %v", err)
+	}
+	if c.Load() != 14 {
+		t.Fatalf("计数为 %d，应为 14", c.Load())
+	}
+}
+
+func TestCounterConcurrent(t *testing.T) {
+	const readers, size = 8, 10_000
+	var c Counter
+	var wg sync.WaitGroup
+	for range readers {
+		wg.Go(func() {
+			io.Copy(io.Discard, NewCountingReader(strings.NewReader(strings.Repeat("x", size)), &c))
+		})
+	}
+	wg.Wait()
+	if c.Load() != readers*size {
+		t.Fatalf("计数为 %d，应为 %d", c.Load(), readers*size)
+	}
+}
@@ -0,0 +1,111 @@
+// Package folder 把一个本地目录当作“云端”使用
+// 用于验证 fs.RemoteProvider 抽象、搭建集成测试环境，或同步到挂载的网络磁盘
+package folder
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"baidusync/internal/crypto"
+	"baidusync/internal/fs"
+	"baidusync/internal/fs/local"
+)
+
+// Provider 以本地目录作为云端的存储后端
+// 文件内容原样保存 (加密时为密文)，不支持文件名加密
+type Provider struct {
+	*local.Adapter
+}
+
+// New 创建以 rootDir 为“云端”根目录的 Provider
+func New(rootDir string) *Provider {
+	return &Provider{Adapter: local.NewAdapter(rootDir)}
+}
+
+// Type 实现 fs.RemoteProvider
+func (p *Provider) Type() string {
+	return "local"
+}
+
+// StoredSize 内容原样保存，加密时多出密文头部
+func (p *Provider) StoredSize(plainSize int64, encrypted bool) int64 {
+	if encrypted {
+		return plainSize + crypto.HeaderSize
+	}
+	return plainSize
+}
+
+// HasContentHash ListAll/Stat 会计算文件 MD5 作为 RemoteHash
+func (p *Provider) HasContentHash() bool {
+	return true
+}
+
+// ListAll 在本地扫描的基础上补充 RemoteHash (与 WriteStream 返回的 MD5 同源)
+// 无法读取的文件与目录一样跳过，并在返回的 *fs.ScanError 中列出
+func (p *Provider) ListAll() (map[string]*fs.FileMeta, error) {
+	return p.ListAllContext(context.Background())
+}
+
+// ListAllContext 实现 fs.ContextLister (覆盖 local.Adapter 的同名方法，补充 RemoteHash)
+func (p *Provider) ListAllContext(ctx context.Context) (map[string]*fs.FileMeta, error) {
+	files, err := p.Adapter.ListAllContext(ctx)
+	scanErr := &fs.ScanError{}
+	if err != nil && !errors.As(err, &scanErr) {
+		return nil, err
+	}
+	for rel, meta := range files {
+		if meta.IsDir {
+			continue
+		}
+		hash, err := fileMD5(ctx, filepath.Join(p.Root(), filepath.FromSlash(rel)))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			delete(files, rel)
+			scanErr.Skipped = append(scanErr.Skipped, rel)
+			scanErr.Errs = append(scanErr.Errs, err)
+			continue
+		}
+		meta.RemoteHash = hash
+	}
+	if len(scanErr.Skipped) > 0 {
+		return files, scanErr
+	}
+	return files, nil
+}
+
+// Stat 获取单个文件信息，RemoteHash 与 Hash 相同
+func (p *Provider) Stat(relPath string) (*fs.FileMeta, error) {
+	return p.StatContext(context.Background(), relPath)
+}
+
+// StatContext 实现 fs.ContextStater (覆盖 local.Adapter 的同名方法，补充 RemoteHash)
+func (p *Provider) StatContext(ctx context.Context, relPath string) (*fs.FileMeta, error) {
+	meta, err := p.Adapter.StatContext(ctx, relPath)
+	if err != nil {
+		return nil, err
+	}
+	meta.RemoteHash = meta.Hash
+	return meta, nil
+}
+
+// fileMD5 计算文件内容的 MD5，每读取一块检查一次 ctx
+func fileMD5(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, fs.NewContextReader(ctx, f)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
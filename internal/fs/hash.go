@@ -0,0 +1,47 @@
+package fs
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+)
+
+// 本地文件 Hash 算法 (FileMeta.Hash 与 FileState.LocalHash)
+// 云端的 RemoteHash 由后端决定 (百度网盘为 MD5)，不受此设置影响
+const (
+	HashMD5    = "md5"
+	HashSHA256 = "sha256"
+)
+
+// NewHash 返回指定算法的 hash.Hash，algorithm 为空时使用 MD5
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "", HashMD5:
+		return md5.New(), nil
+	case HashSHA256:
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("不支持的 Hash 算法: %s", algorithm)
+	}
+}
+
+// SameHashAlgorithm 两个十六进制 Hash 是否由同一种算法计算
+// MD5 与 SHA-256 的长度不同，切换算法后旧记录中的 Hash 不能直接与新计算的比较
+func SameHashAlgorithm(a, b string) bool {
+	return len(a) == len(b)
+}
+
+// Hasher 可选接口：文件系统计算 FileMeta.Hash 时使用的算法
+// 没有实现该接口的文件系统视为使用 MD5
+type Hasher interface {
+	HashAlgorithm() string
+}
+
+// HashAlgorithmOf 返回文件系统计算 Hash 使用的算法
+func HashAlgorithmOf(fsys FileSystem) string {
+	if h, ok := fsys.(Hasher); ok && h.HashAlgorithm() != "" {
+		return h.HashAlgorithm()
+	}
+	return HashMD5
+}
@@ -0,0 +1,14 @@
+package fs
+
+import "strings"
+
+// IsHidden 文件名是否为隐藏文件 (以 "." 开头，例如 .git、.DS_Store)
+func IsHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// HiddenSkipper 可选接口: ListAll 时跳过隐藏文件与隐藏目录 (连同其中的所有内容)
+// 本地与云端必须同时跳过，否则只在一侧消失的文件会被当作已删除
+type HiddenSkipper interface {
+	SetSkipHidden(skip bool)
+}
@@ -0,0 +1,8 @@
+package fs
+
+// IdentityTracker 可选接口: ListAll / Stat 时在 FileMeta.FileID 中返回文件的底层标识
+// 同一个文件被移动或改名后标识不变，引擎据此把“旧路径消失 + 新路径出现”识别为移动
+// 系统不提供稳定的标识时 FileID 保持为空，引擎退回按路径比对
+type IdentityTracker interface {
+	SetTrackIdentity(track bool)
+}
@@ -1,18 +1,43 @@
 package fs
 
 import (
+	"errors"
 	"io"
+	iofs "io/fs"
 	"time"
 )
 
+// ErrNotExist 文件不存在
+// 与 os.ErrNotExist 是同一个值，本地适配器返回的 *PathError 也可以用 errors.Is 判断
+var ErrNotExist = iofs.ErrNotExist
+
+// ErrExist 写入时目标已存在 (调用方要求不覆盖时返回)
+// 与 os.ErrExist 是同一个值
+var ErrExist = iofs.ErrExist
+
+// ErrNotEmpty Rmdir 时目录不为空
+var ErrNotEmpty = errors.New("directory not empty")
+
+// ErrThrottled 后端因请求过于频繁而拒绝了请求 (例如 HTTP 429)
+// 同步引擎据此降低并发数，稍后重试即可恢复
+var ErrThrottled = errors.New("request throttled")
+
+// ErrAuth 认证失败 (Token 无效或已过期)，在重新授权之前所有请求都会失败
+var ErrAuth = errors.New("authentication failed")
+
+// ErrQuota 存储空间不足，在清理空间之前所有上传都会失败
+var ErrQuota = errors.New("storage quota exceeded")
+
 // FileMeta 文件元数据
 type FileMeta struct {
-	RelPath    string    // 相对路径 (统一使用 "/" 作为分隔符)
-	Size       int64     // 文件大小
-	ModTime    time.Time // 修改时间
-	IsDir      bool      // 是否为目录
-	Hash       string    //文件hash
-	RemoteHash string    //网盘中的文件hash
+	RelPath    string        // 相对路径 (统一使用 "/" 作为分隔符)
+	Size       int64         // 文件大小
+	ModTime    time.Time     // 修改时间
+	IsDir      bool          // 是否为目录
+	Hash       string        //文件hash
+	RemoteHash string        //网盘中的文件hash
+	Mode       iofs.FileMode // 权限位 (只有本地文件系统提供，其他后端为 0)
+	FileID     string        // 文件的底层标识 (例如设备号 + inode)，只有开启了 IdentityTracker 的本地文件系统提供，为空表示未知
 }
 
 // FileSystem 是对 Local 和 Baidu 的统一抽象
@@ -20,7 +45,7 @@ type FileSystem interface {
 	// Root 返回该文件系统的根路径 (用于日志或调试)
 	Root() string
 
-	// ListAll 递归列出所有文件
+	// ListAll 递归列出所有文件与目录 (目录的 IsDir 为 true)
 	// 返回 map[相对路径]元数据，方便快速查找
 	ListAll() (map[string]*FileMeta, error)
 
@@ -28,14 +53,32 @@ type FileSystem interface {
 	// rangeStart: 支持断点续传/分片读取 (如果不需要传0)
 	OpenStream(relPath string) (io.ReadCloser, error)
 
-	// WriteStream 写入文件流 (用于保存数据)
+	// WriteStream 写入文件流 (用于保存数据)，返回写入内容的 Hash (应在写入时计算，不必写完后再读一遍文件)
 	// 包含创建父目录的逻辑
 	WriteStream(relPath string, stream io.Reader, perm time.Time) (string, error)
 
 	// Delete 删除文件
 	Delete(relPath string) error
 
+	// Mkdir 创建目录 (包含创建父目录的逻辑)，目录已存在时视为成功
+	Mkdir(relPath string) error
+
+	// Rmdir 删除空目录；目录不为空时返回 ErrNotEmpty，不会删除其中的内容
+	Rmdir(relPath string) error
+
 	// Stat 获取单个文件信息
 	Stat(relPath string) (*FileMeta, error)
 	Rename(oldRelPath, newRelPath string) error
+
+	// Close 释放文件系统持有的资源 (连接、缓存、锁等)，在所有同步任务结束后调用
+	// 没有需要释放的资源时直接返回 nil，可以嵌入 Stateless
+	Close() error
+}
+
+// Stateless 为没有需要释放的资源的 FileSystem 实现提供空的 Close
+type Stateless struct{}
+
+// Close 实现 FileSystem
+func (Stateless) Close() error {
+	return nil
 }
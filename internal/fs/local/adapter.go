@@ -1,12 +1,16 @@
 package local
 
 import (
-	"crypto/md5"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"io"
+	iofs "io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"baidusync/internal/fs"
@@ -15,17 +19,68 @@ import (
 
 // Adapter 本地文件系统适配器
 type Adapter struct {
-	rootDir string // 本地绝对路径根目录
+	rootDir  string // 本地绝对路径根目录
+	hashAlgo string // Stat / WriteStream 返回的 Hash 使用的算法 (fs.HashMD5 或 fs.HashSHA256)
+	// skipHidden ListAll 时跳过以 "." 开头的文件与目录
+	skipHidden bool
+	// trackIdentity ListAll / Stat 时返回文件的底层标识 (FileMeta.FileID)
+	trackIdentity bool
+	// copyBuffer WriteStream 每次从数据流读取的字节数 (0 表示 fs.DefaultCopyBuffer)
+	copyBuffer int
+
+	// unlock 释放 Lock 加上的锁，Close 时调用 (未加锁时为 nil)
+	mu     sync.Mutex
+	unlock func() error
 }
 
-// NewAdapter 创建一个新的本地适配器
+// NewAdapter 创建一个新的本地适配器，文件 Hash 使用 MD5
 func NewAdapter(rootDir string) *Adapter {
 	// 确保 rootDir 是绝对路径
 	absDir, err := filepath.Abs(rootDir)
 	if err != nil {
 		absDir = rootDir
 	}
-	return &Adapter{rootDir: absDir}
+	return &Adapter{rootDir: absDir, hashAlgo: fs.HashMD5}
+}
+
+// NewAdapterWithHash 创建一个使用指定 Hash 算法的本地适配器
+func NewAdapterWithHash(rootDir, algorithm string) (*Adapter, error) {
+	if _, err := fs.NewHash(algorithm); err != nil {
+		return nil, err
+	}
+	a := NewAdapter(rootDir)
+	if algorithm != "" {
+		a.hashAlgo = algorithm
+	}
+	return a, nil
+}
+
+// SetSkipHidden 实现 fs.HiddenSkipper
+func (a *Adapter) SetSkipHidden(skip bool) {
+	a.skipHidden = skip
+}
+
+// SetTrackIdentity 实现 fs.IdentityTracker
+func (a *Adapter) SetTrackIdentity(track bool) {
+	a.trackIdentity = track
+}
+
+// SetCopyBuffer 实现 fs.CopyBufferSetter
+func (a *Adapter) SetCopyBuffer(size int) {
+	a.copyBuffer = size
+}
+
+// identity 开启 trackIdentity 时返回文件的底层标识，目录、未开启或系统无法提供时为空
+func (a *Adapter) identity(fullPath string, info os.FileInfo) string {
+	if !a.trackIdentity || info.IsDir() {
+		return ""
+	}
+	return fileID(fullPath, info)
+}
+
+// HashAlgorithm 返回文件 Hash 使用的算法
+func (a *Adapter) HashAlgorithm() string {
+	return a.hashAlgo
 }
 
 // Root 返回根目录
@@ -51,42 +106,87 @@ func (a *Adapter) toRelPath(fullPath string) (string, error) {
 	return filepath.ToSlash(rel), nil
 }
 
-// calculateMD5 计算本地文件的 MD5 值
-func (a *Adapter) calculateMD5(path string) (string, error) {
+// calculateHash 按适配器配置的算法计算本地文件的 Hash
+// 每读取一块检查一次 ctx，大文件计算到一半时也可以及时取消
+func (a *Adapter) calculateHash(ctx context.Context, path string) (string, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
 
-	h := md5.New()
-	if _, err := io.Copy(h, f); err != nil {
+	h, err := fs.NewHash(a.hashAlgo)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, fs.NewContextReader(ctx, f)); err != nil {
 		return "", err
 	}
 
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
+// Check 实现 fs.Checker: 确认根目录存在且可以读取
+func (a *Adapter) Check(_ context.Context, createRoot bool) error {
+	if createRoot {
+		if err := os.MkdirAll(a.rootDir, 0755); err != nil {
+			return fmt.Errorf("创建目录 %s 失败: %w", a.rootDir, err)
+		}
+	}
+	dir, err := os.Open(a.rootDir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	// 只读取一项，确认有列目录的权限
+	if _, err := dir.Readdirnames(1); err != nil && err != io.EOF {
+		return fmt.Errorf("无法读取目录 %s: %w", a.rootDir, err)
+	}
+	return nil
+}
+
 // ListAll 递归扫描本地目录
 func (a *Adapter) ListAll() (map[string]*fs.FileMeta, error) {
+	return a.ListAllContext(context.Background())
+}
+
+// ListAllContext 实现 fs.ContextLister: 每访问一个文件或目录检查一次 ctx，取消后立即停止扫描并返回 ctx.Err()
+func (a *Adapter) ListAllContext(ctx context.Context) (map[string]*fs.FileMeta, error) {
 	files := make(map[string]*fs.FileMeta)
-	var errs []error
+	var skipped fs.ScanError
 
 	err := filepath.Walk(a.rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			errs = append(errs, fmt.Errorf("扫描文件出错 %s: %w", path, err))
-			return nil
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
 		}
-
-		// 跳过根目录本身
+		// 根目录无法读取时整个扫描失败
 		if path == a.rootDir {
-			return nil
+			return err
 		}
 
 		// 计算相对路径
-		relPath, err := a.toRelPath(path)
+		relPath, relErr := a.toRelPath(path)
+		if relErr != nil {
+			return relErr
+		}
+
+		// 无法读取的文件或目录跳过，继续扫描其他路径
+		// 目录读取失败时 Walk 已经回调过一次目录本身，这里把它一并移除，避免目录被当作空目录
 		if err != nil {
-			errs = append(errs, err)
+			delete(files, relPath)
+			skipped.Skipped = append(skipped.Skipped, relPath)
+			skipped.Errs = append(skipped.Errs, fmt.Errorf("扫描文件出错 %s: %w", relPath, err))
+			return nil
+		}
+		// 锁文件与未完成的下载不参与同步
+		if relPath == LockFileName || (!info.IsDir() && strings.HasSuffix(relPath, fs.PartSuffix)) {
+			return nil
+		}
+		// 隐藏目录整个跳过，不再遍历其中的内容 (例如 .git)
+		if a.skipHidden && fs.IsHidden(info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -95,6 +195,8 @@ func (a *Adapter) ListAll() (map[string]*fs.FileMeta, error) {
 			Size:    info.Size(),
 			ModTime: info.ModTime(),
 			IsDir:   info.IsDir(),
+			Mode:    info.Mode().Perm(),
+			FileID:  a.identity(path, info),
 			// Hash is not calculated here for performance reasons
 		}
 		return nil
@@ -103,8 +205,8 @@ func (a *Adapter) ListAll() (map[string]*fs.FileMeta, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(errs) > 0 {
-		return nil, fmt.Errorf("%d errors occurred during file scan: %v", len(errs), errs)
+	if len(skipped.Skipped) > 0 {
+		return files, &skipped
 	}
 	return files, nil
 }
@@ -115,6 +217,19 @@ func (a *Adapter) OpenStream(relPath string) (io.ReadCloser, error) {
 	return os.Open(fullPath)
 }
 
+// OpenStreamAt 实现 fs.RangeOpener: 从 offset 处开始读取本地文件
+func (a *Adapter) OpenStreamAt(relPath string, offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(a.toSysPath(relPath))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
 // WriteStream 将流写入本地文件
 // modTime: 用于恢复文件的修改时间，保持和云端一致
 func (a *Adapter) WriteStream(relPath string, stream io.Reader, modTime time.Time) (string, error) {
@@ -126,6 +241,11 @@ func (a *Adapter) WriteStream(relPath string, stream io.Reader, modTime time.Tim
 		return "", fmt.Errorf("创建目录失败: %w", err)
 	}
 
+	h, err := fs.NewHash(a.hashAlgo)
+	if err != nil {
+		return "", err
+	}
+
 	// 2. 创建文件
 	f, err := os.Create(fullPath)
 	if err != nil {
@@ -133,8 +253,8 @@ func (a *Adapter) WriteStream(relPath string, stream io.Reader, modTime time.Tim
 	}
 	// 注意：此处不能 defer f.Close()，因为后面还要修改时间，或者需要在 close 后修改
 
-	// 3. 写入数据
-	if _, err := io.Copy(f, stream); err != nil {
+	// 3. 写入数据，同时计算 Hash (写完后不必再把整个文件读一遍)
+	if _, err := fs.CopyBuffer(f, io.TeeReader(stream, h), a.copyBuffer); err != nil {
 		f.Close()
 		return "", fmt.Errorf("写入数据失败: %w", err)
 	}
@@ -151,8 +271,69 @@ func (a *Adapter) WriteStream(relPath string, stream io.Reader, modTime time.Tim
 		}
 	}
 
-	// 5. 计算并返回文件的 MD5
-	return a.calculateMD5(fullPath)
+	// 5. 返回写入内容的 Hash
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteStreamAt 实现 fs.PartialWriter
+func (a *Adapter) WriteStreamAt(relPath string, stream io.Reader, offset int64, modTime time.Time) (string, error) {
+	fullPath := a.toSysPath(relPath)
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return "", fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	h, err := fs.NewHash(a.hashAlgo)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(fullPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return "", fmt.Errorf("创建文件失败: %w", err)
+	}
+	// 丢弃 offset 之后的内容 (上次写入到一半的数据)
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return "", fmt.Errorf("截断文件失败: %w", err)
+	}
+	// 已有的部分只读一遍计入 Hash，新写入的部分在写入时计算
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, offset)); err != nil {
+		f.Close()
+		return "", fmt.Errorf("读取已写入的部分失败: %w", err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return "", fmt.Errorf("定位文件失败: %w", err)
+	}
+
+	_, copyErr := fs.CopyBuffer(f, io.TeeReader(stream, h), a.copyBuffer)
+	closeErr := f.Close()
+
+	// 写入失败时同样设置修改时间，下次续传时据此确认文件对应的是同一个云端版本
+	if !modTime.IsZero() {
+		if err := os.Chtimes(fullPath, time.Now(), modTime); err != nil {
+			slog.Warn("无法修改文件时间", "path", relPath, "err", err)
+		}
+	}
+	if copyErr != nil {
+		return "", fmt.Errorf("写入数据失败: %w", copyErr)
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Close 实现 fs.FileSystem，释放仍持有的目录锁
+func (a *Adapter) Close() error {
+	a.mu.Lock()
+	unlock := a.unlock
+	a.unlock = nil
+	a.mu.Unlock()
+	if unlock == nil {
+		return nil
+	}
+	return unlock()
 }
 
 // Delete 删除本地文件
@@ -161,31 +342,74 @@ func (a *Adapter) Delete(relPath string) error {
 	return os.RemoveAll(fullPath) // RemoveAll 也可以删除非空目录
 }
 
+// Mkdir 创建本地目录
+func (a *Adapter) Mkdir(relPath string) error {
+	return os.MkdirAll(a.toSysPath(relPath), 0755)
+}
+
+// Rmdir 删除本地空目录
+// 先检查目录内容，避免把尚有 (被忽略的) 文件的目录删掉
+func (a *Adapter) Rmdir(relPath string) error {
+	fullPath := a.toSysPath(relPath)
+	entries, err := os.ReadDir(fullPath)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%w: %s", fs.ErrNotEmpty, relPath)
+	}
+	return os.Remove(fullPath)
+}
+
 // Stat 获取单个文件状态
 func (a *Adapter) Stat(relPath string) (*fs.FileMeta, error) {
-	fullPath := a.toSysPath(relPath)
-	info, err := os.Stat(fullPath)
+	return a.StatContext(context.Background(), relPath)
+}
+
+// StatContext 实现 fs.ContextStater: 计算 Hash 时每读取一块检查一次 ctx
+func (a *Adapter) StatContext(ctx context.Context, relPath string) (*fs.FileMeta, error) {
+	meta, err := a.StatQuick(relPath)
 	if err != nil {
 		return nil, err
 	}
 
-	var md5Str string
-	if !info.IsDir() {
-		md5Str, err = a.calculateMD5(fullPath)
+	if !meta.IsDir {
+		meta.Hash, err = a.calculateHash(ctx, a.toSysPath(relPath))
 		if err != nil {
 			// Stat 失败通常应该返回错误
-			return nil, fmt.Errorf("stat md5 calc failed: %w", err)
+			return nil, fmt.Errorf("stat hash calc failed: %w", err)
 		}
 	}
+	return meta, nil
+}
+
+// StatQuick 实现 fs.QuickStater: 与 Stat 相同，但不计算 Hash
+func (a *Adapter) StatQuick(relPath string) (*fs.FileMeta, error) {
+	fullPath := a.toSysPath(relPath)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
 
 	return &fs.FileMeta{
 		RelPath: relPath, // 直接返回传入的
 		Size:    info.Size(),
 		ModTime: info.ModTime(),
 		IsDir:   info.IsDir(),
-		Hash:    md5Str, // 添加 MD5
+		Mode:    info.Mode().Perm(),
+		FileID:  a.identity(fullPath, info),
 	}, nil
 }
+
+// Chmod 实现 fs.ModeSetter
+// Windows 没有 POSIX 权限位 (os.Chmod 只能切换只读属性)，直接忽略
+func (a *Adapter) Chmod(relPath string, mode iofs.FileMode) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	return os.Chmod(a.toSysPath(relPath), mode.Perm())
+}
+
 func (a *Adapter) Rename(oldRelPath, newRelPath string) error {
 	oldSysPath := a.toSysPath(oldRelPath)
 	newSysPath := a.toSysPath(newRelPath)
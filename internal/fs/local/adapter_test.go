@@ -0,0 +1,286 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs"
+)
+
+// writeFiles 在 root 下创建文件 (上级目录自动创建)
+func writeFiles(t *testing.T, root string, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		full := filepath.Join(root, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listPaths 返回 ListAll 结果中的路径 (已排序)
+func listPaths(t *testing.T, a *Adapter) []string {
+	t.Helper()
+	files, err := a.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestListAllSkipHidden(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root,
+		".git/config",
+		".hidden/visible.txt",
+		".hidden/sub/deep.txt",
+		"docs/.DS_Store",
+		"docs/readme.txt",
+		"docs/.cache/data.bin",
+		"docs/sub/a.txt",
+	)
+	a := NewAdapter(root)
+
+	// 默认包含隐藏文件
+	if got := listPaths(t, a); len(got) != 13 {
+		t.Fatalf("包含隐藏文件时扫描到 %v", got)
+	}
+
+	// 隐藏目录连同其中可见的文件一起跳过，可见目录中的隐藏文件同样跳过
+	a.SetSkipHidden(true)
+	want := []string{"docs", "docs/readme.txt", "docs/sub", "docs/sub/a.txt"}
+	if got := listPaths(t, a); !slices.Equal(got, want) {
+		t.Fatalf("跳过隐藏文件时扫描到 %v，应为 %v", got, want)
+	}
+}
+
+func TestChmodExecBit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 没有 POSIX 权限位")
+	}
+	root := t.TempDir()
+	writeFiles(t, root, "bin/run.sh")
+	a := NewAdapter(root)
+
+	for _, mode := range []os.FileMode{0755, 0644, 0700} {
+		if err := a.Chmod("bin/run.sh", mode); err != nil {
+			t.Fatal(err)
+		}
+		meta, err := a.StatQuick("bin/run.sh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Mode != mode {
+			t.Fatalf("Chmod(%v) 后权限为 %v", mode, meta.Mode)
+		}
+		files, err := a.ListAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := files["bin/run.sh"].Mode; got != mode {
+			t.Fatalf("Chmod(%v) 后 ListAll 返回的权限为 %v", mode, got)
+		}
+	}
+}
+
+func TestListAllUnreadableDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("需要以非 root 用户在支持 POSIX 权限的系统上运行")
+	}
+	root := t.TempDir()
+	writeFiles(t, root, "a.txt", "locked/secret.txt", "open/b.txt")
+	locked := filepath.Join(root, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+	a := NewAdapter(root)
+
+	// 无法读取的目录被跳过 (连同目录本身，避免被当作空目录)，其余结果仍然有效
+	files, err := a.ListAll()
+	var scanErr *fs.ScanError
+	if !errors.As(err, &scanErr) || !slices.Equal(scanErr.Skipped, []string{"locked"}) {
+		t.Fatalf("错误为 %v，应只跳过 locked", err)
+	}
+	for _, p := range []string{"a.txt", "open", "open/b.txt"} {
+		if files[p] == nil {
+			t.Errorf("扫描结果中缺少 %s", p)
+		}
+	}
+	if files["locked"] != nil || files["locked/secret.txt"] != nil {
+		t.Fatal("无法读取的目录不应出现在扫描结果中")
+	}
+
+	// 根目录无法读取时整个扫描失败
+	if err := os.Chmod(root, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(root, 0755) })
+	if files, err := a.ListAll(); err == nil || errors.As(err, &scanErr) || files != nil {
+		t.Fatalf("根目录无法读取时返回 %d 项，错误为 %v", len(files), err)
+	}
+}
+
+func TestFileIDSurvivesRename(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, "a.txt", "b.txt", "dir/c.txt")
+	a := NewAdapter(root)
+
+	// 未开启时不返回标识
+	if meta, err := a.StatQuick("a.txt"); err != nil || meta.FileID != "" {
+		t.Fatalf("未开启时 FileID 为 %q，错误为 %v", meta.FileID, err)
+	}
+
+	a.SetTrackIdentity(true)
+	before, err := a.StatQuick("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.FileID == "" {
+		t.Skip("当前系统不提供文件标识")
+	}
+	other, _ := a.StatQuick("b.txt")
+	if other.FileID == before.FileID {
+		t.Fatalf("不同文件的 FileID 相同: %s", before.FileID)
+	}
+	if dir, _ := a.StatQuick("dir"); dir.FileID != "" {
+		t.Fatalf("目录的 FileID 应为空，实际为 %q", dir.FileID)
+	}
+
+	// 改名并移动到其他目录后标识不变，ListAll 与 StatQuick 返回的一致
+	if err := a.Rename("a.txt", "dir/moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	after, err := a.StatQuick("dir/moved.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.FileID != before.FileID {
+		t.Fatalf("改名后 FileID 从 %s 变为 %s", before.FileID, after.FileID)
+	}
+	files, err := a.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := files["dir/moved.txt"].FileID; got != before.FileID {
+		t.Fatalf("ListAll 返回的 FileID 为 %s，应为 %s", got, before.FileID)
+	}
+}
+
+func TestWriteStreamHashMatchesStat(t *testing.T) {
+	content := strings.Repeat("streamed content ", 10_000)
+	for _, algorithm := range []string{fs.HashMD5, fs.HashSHA256} {
+		t.Run(algorithm, func(t *testing.T) {
+			a, err := NewAdapterWithHash(t.TempDir(), algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := a.WriteStream("dir/a.bin", strings.NewReader(content), time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 写入时计算的 Hash 与重新读取文件计算的一致
+			stat, err := a.Stat("dir/a.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != stat.Hash {
+				t.Fatalf("WriteStream 返回 %s，Stat 计算的为 %s", got, stat.Hash)
+			}
+
+			// 续传写入返回的是整个文件的 Hash
+			half := int64(len(content) / 2)
+			if _, err := a.WriteStreamAt("b.bin", strings.NewReader(content[:half]+"garbage"), 0, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			resumed, err := a.WriteStreamAt("b.bin", strings.NewReader(content[half:]), half, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resumed != got {
+				t.Fatalf("续传写入返回 %s，应为整个文件的 %s", resumed, got)
+			}
+		})
+	}
+}
+
+// cancelAfter 在第 n 次检查 Err 之后取消，模拟扫描进行到一半时收到中断信号
+type cancelAfter struct {
+	context.Context
+	cancel context.CancelFunc
+	n      int
+	checks int
+}
+
+func newCancelAfter(t *testing.T, n int) *cancelAfter {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &cancelAfter{Context: ctx, cancel: cancel, n: n}
+}
+
+func (c *cancelAfter) Err() error {
+	c.checks++
+	if c.checks > c.n {
+		c.cancel()
+	}
+	return c.Context.Err()
+}
+
+func TestListAllContextCancelledMidScan(t *testing.T) {
+	root := t.TempDir()
+	var paths []string
+	for d := range 20 {
+		for f := range 50 {
+			paths = append(paths, fmt.Sprintf("dir%02d/file%02d.txt", d, f))
+		}
+	}
+	writeFiles(t, root, paths...)
+	a := NewAdapter(root)
+
+	ctx := newCancelAfter(t, 100)
+	files, err := a.ListAllContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("错误为 %v，应为 context.Canceled", err)
+	}
+	if files != nil {
+		t.Fatalf("取消后返回了 %d 个文件", len(files))
+	}
+	// 取消后不再访问剩余的文件
+	if ctx.checks != 101 {
+		t.Fatalf("检查了 %d 次 ctx，应在第 101 次 (取消后) 停止", ctx.checks)
+	}
+}
+
+func TestStatContextCancelledDuringHash(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "big.bin"), make([]byte, 8<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := NewAdapter(root)
+
+	ctx := newCancelAfter(t, 3)
+	if _, err := a.StatContext(ctx, "big.bin"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("错误为 %v，应为 context.Canceled", err)
+	}
+	// 每读取一块检查一次，取消后不再读完整个文件
+	if ctx.checks > 5 {
+		t.Fatalf("检查了 %d 次 ctx，取消后仍在读取", ctx.checks)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package local
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileID 返回文件的设备号与 inode，同一个文件系统内移动或改名后保持不变
+func fileID(_ string, info os.FileInfo) string {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", uint64(st.Dev), uint64(st.Ino))
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package local
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// fileID 返回文件所在卷的序列号与文件索引 (NTFS 的 File ID)，同一个卷内移动或改名后保持不变
+// os.FileInfo 不包含文件索引，需要单独打开文件读取；打开失败时返回空
+// FAT32 等文件系统上的文件索引不稳定，文件被移动后可能变化，此时只是识别不到移动
+func fileID(path string, _ os.FileInfo) string {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return ""
+	}
+	// 只读取属性，不影响其他进程打开文件；目录需要 FILE_FLAG_BACKUP_SEMANTICS 才能打开
+	h, err := windows.CreateFile(p, windows.FILE_READ_ATTRIBUTES,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(h)
+
+	var info windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(h, &info); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x:%x%08x", info.VolumeSerialNumber, info.FileIndexHigh, info.FileIndexLow)
+}
@@ -0,0 +1,62 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LockFileName 同步目录中的锁文件，防止两个实例同时同步同一个目录
+// 锁文件本身不参与同步，释放锁后也不删除 (删除会让等待中的实例锁住一个已被删除的文件)
+const LockFileName = ".baidusync.lock"
+
+// ErrLocked 同步目录已被另一个实例锁定
+var ErrLocked = errors.New("同步目录已被另一个 baidusync 实例占用")
+
+// Lock 对同步目录加排它的建议锁 (不等待)，已被其他实例锁定时返回包装 ErrLocked 的错误
+// 返回的 unlock 释放锁，可以重复调用；Close 时也会释放，进程退出时操作系统也会自动释放
+func (a *Adapter) Lock() (unlock func() error, err error) {
+	lockPath := filepath.Join(a.rootDir, LockFileName)
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("创建锁文件失败: %w", err)
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			if pid := readLockOwner(lockPath); pid != "" {
+				return nil, fmt.Errorf("%w (%s, pid %s)", ErrLocked, a.rootDir, pid)
+			}
+			return nil, fmt.Errorf("%w (%s)", ErrLocked, a.rootDir)
+		}
+		return nil, fmt.Errorf("锁定同步目录失败: %w", err)
+	}
+
+	// 记录持有锁的进程，方便排查 (写入失败不影响加锁)
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	unlock = sync.OnceValue(func() error {
+		defer f.Close()
+		return unlockFile(f)
+	})
+	a.mu.Lock()
+	a.unlock = unlock
+	a.mu.Unlock()
+	return unlock, nil
+}
+
+// readLockOwner 读取锁文件中记录的进程号 (读取失败时返回空字符串)
+func readLockOwner(lockPath string) string {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,376 @@
+// Package memfs 提供一个完全在内存中的 fs.RemoteProvider 实现
+// 用于在不访问真实网盘的情况下测试同步引擎：
+// 文件保存在 map 中，Hash 为内容的 MD5，时间可以通过 SetClock 固定，
+// 并且可以通过 InjectError 让指定操作失败，以覆盖错误处理分支。
+// 同一个实现既可以作为 LocalFS，也可以作为 RemoteFS 使用。
+package memfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"baidusync/internal/crypto"
+	"baidusync/internal/fs"
+)
+
+// Op 可以注入错误的操作
+type Op string
+
+const (
+	OpListAll Op = "ListAll"
+	OpOpen    Op = "OpenStream"
+	OpWrite   Op = "WriteStream"
+	OpDelete  Op = "Delete"
+	OpStat    Op = "Stat"
+	OpRename  Op = "Rename"
+	OpCopy    Op = "Copy"
+	OpMkdir   Op = "Mkdir"
+	OpRmdir   Op = "Rmdir"
+)
+
+// entry 内存中的一个文件或目录
+type entry struct {
+	data    []byte
+	modTime time.Time
+	isDir   bool
+}
+
+// faultKey 注入错误的匹配条件，path 为空表示匹配该操作的所有路径
+type faultKey struct {
+	op   Op
+	path string
+}
+
+// FS 内存文件系统，可以安全地并发使用
+type FS struct {
+	fs.Stateless // 内存中的数据不需要释放
+
+	root string
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	faults  map[faultKey]error
+	now     func() time.Time
+}
+
+// New 创建一个空的内存文件系统，root 只用于日志显示
+func New(root string) *FS {
+	return &FS{
+		root:    root,
+		entries: make(map[string]*entry),
+		faults:  make(map[faultKey]error),
+		now:     time.Now,
+	}
+}
+
+// SetClock 设置生成修改时间所用的时钟，便于写出确定性的测试
+func (m *FS) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// InjectError 让 op 在 relPath 上返回 err；relPath 为空时对所有路径生效
+// err 为 nil 时取消该注入
+func (m *FS) InjectError(op Op, relPath string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := faultKey{op: op, path: relPath}
+	if err == nil {
+		delete(m.faults, key)
+		return
+	}
+	m.faults[key] = err
+}
+
+// ClearErrors 取消所有注入的错误
+func (m *FS) ClearErrors() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = make(map[faultKey]error)
+}
+
+// fault 返回注入的错误 (调用方需持有锁)
+func (m *FS) fault(op Op, relPath string) error {
+	if err, ok := m.faults[faultKey{op: op, path: relPath}]; ok {
+		return err
+	}
+	return m.faults[faultKey{op: op}]
+}
+
+// PutFile 直接写入一个文件 (用于准备测试数据)，父目录会自动创建
+func (m *FS) PutFile(relPath string, data []byte, modTime time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mkdirAll(path.Dir(relPath), modTime)
+	m.entries[relPath] = &entry{data: bytes.Clone(data), modTime: modTime}
+}
+
+// ReadFile 读取文件内容，文件不存在或是目录时 ok 为 false
+func (m *FS) ReadFile(relPath string) (data []byte, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[relPath]
+	if !ok || e.isDir {
+		return nil, false
+	}
+	return bytes.Clone(e.data), true
+}
+
+// Exists 判断文件或目录是否存在
+func (m *FS) Exists(relPath string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.entries[relPath]
+	return ok
+}
+
+// Paths 返回所有文件与目录的路径 (已排序)
+func (m *FS) Paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	paths := make([]string, 0, len(m.entries))
+	for p := range m.entries {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// mkdirAll 创建目录及其所有父目录 (调用方需持有锁)
+func (m *FS) mkdirAll(dir string, modTime time.Time) {
+	for dir != "." && dir != "/" && dir != "" {
+		if _, ok := m.entries[dir]; !ok {
+			m.entries[dir] = &entry{isDir: true, modTime: modTime}
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// meta 生成元数据，Hash 与 RemoteHash 都是内容的 MD5
+func (m *FS) meta(relPath string, e *entry) *fs.FileMeta {
+	meta := &fs.FileMeta{
+		RelPath: relPath,
+		Size:    int64(len(e.data)),
+		ModTime: e.modTime,
+		IsDir:   e.isDir,
+	}
+	if !e.isDir {
+		meta.Hash = md5Hex(e.data)
+		meta.RemoteHash = meta.Hash
+	}
+	return meta
+}
+
+// Root 实现 fs.FileSystem
+func (m *FS) Root() string {
+	return m.root
+}
+
+// ListAll 实现 fs.FileSystem，与本地适配器一致：跳过未完成的下载 (fs.PartSuffix)
+func (m *FS) ListAll() (map[string]*fs.FileMeta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fault(OpListAll, ""); err != nil {
+		return nil, err
+	}
+	result := make(map[string]*fs.FileMeta, len(m.entries))
+	for p, e := range m.entries {
+		if !e.isDir && strings.HasSuffix(p, fs.PartSuffix) {
+			continue
+		}
+		result[p] = m.meta(p, e)
+	}
+	return result, nil
+}
+
+// OpenStream 实现 fs.FileSystem
+func (m *FS) OpenStream(relPath string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fault(OpOpen, relPath); err != nil {
+		return nil, err
+	}
+	e, ok := m.entries[relPath]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, relPath)
+	}
+	if e.isDir {
+		return nil, fmt.Errorf("是目录，无法读取: %s", relPath)
+	}
+	return io.NopCloser(bytes.NewReader(bytes.Clone(e.data))), nil
+}
+
+// WriteStream 实现 fs.FileSystem，返回写入内容的 MD5
+// modTime 为零值时使用当前时钟
+func (m *FS) WriteStream(relPath string, stream io.Reader, modTime time.Time) (string, error) {
+	m.mu.Lock()
+	err := m.fault(OpWrite, relPath)
+	m.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	// 在锁外读取数据流，避免阻塞其他并发操作
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return "", fmt.Errorf("写入数据失败: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if modTime.IsZero() {
+		modTime = m.now()
+	}
+	if e, ok := m.entries[relPath]; ok && e.isDir {
+		return "", fmt.Errorf("同名目录已存在: %s", relPath)
+	}
+	m.mkdirAll(path.Dir(relPath), modTime)
+	m.entries[relPath] = &entry{data: data, modTime: modTime}
+	return md5Hex(data), nil
+}
+
+// Delete 实现 fs.FileSystem，与本地适配器一致：删除目录时连同其内容一起删除
+func (m *FS) Delete(relPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fault(OpDelete, relPath); err != nil {
+		return err
+	}
+	prefix := relPath + "/"
+	for p := range m.entries {
+		if p == relPath || strings.HasPrefix(p, prefix) {
+			delete(m.entries, p)
+		}
+	}
+	return nil
+}
+
+// Mkdir 实现 fs.FileSystem
+func (m *FS) Mkdir(relPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fault(OpMkdir, relPath); err != nil {
+		return err
+	}
+	if e, ok := m.entries[relPath]; ok && !e.isDir {
+		return fmt.Errorf("同名文件已存在: %s", relPath)
+	}
+	m.mkdirAll(relPath, m.now())
+	return nil
+}
+
+// Rmdir 实现 fs.FileSystem
+func (m *FS) Rmdir(relPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fault(OpRmdir, relPath); err != nil {
+		return err
+	}
+	e, ok := m.entries[relPath]
+	if !ok {
+		return fmt.Errorf("%w: %s", fs.ErrNotExist, relPath)
+	}
+	if !e.isDir {
+		return fmt.Errorf("不是目录: %s", relPath)
+	}
+	prefix := relPath + "/"
+	for p := range m.entries {
+		if strings.HasPrefix(p, prefix) {
+			return fmt.Errorf("%w: %s", fs.ErrNotEmpty, relPath)
+		}
+	}
+	delete(m.entries, relPath)
+	return nil
+}
+
+// Stat 实现 fs.FileSystem
+func (m *FS) Stat(relPath string) (*fs.FileMeta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fault(OpStat, relPath); err != nil {
+		return nil, err
+	}
+	e, ok := m.entries[relPath]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, relPath)
+	}
+	return m.meta(relPath, e), nil
+}
+
+// Rename 实现 fs.FileSystem，目录会连同其内容一起移动
+func (m *FS) Rename(oldRelPath, newRelPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fault(OpRename, oldRelPath); err != nil {
+		return err
+	}
+	e, ok := m.entries[oldRelPath]
+	if !ok {
+		return fmt.Errorf("%w: %s", fs.ErrNotExist, oldRelPath)
+	}
+
+	m.mkdirAll(path.Dir(newRelPath), e.modTime)
+	prefix := oldRelPath + "/"
+	for p, child := range m.entries {
+		if strings.HasPrefix(p, prefix) {
+			delete(m.entries, p)
+			m.entries[newRelPath+"/"+strings.TrimPrefix(p, prefix)] = child
+		}
+	}
+	delete(m.entries, oldRelPath)
+	m.entries[newRelPath] = e
+	return nil
+}
+
+// Copy 实现 fs.Copier，目标已存在时返回 fs.ErrExist
+func (m *FS) Copy(srcRelPath, dstRelPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fault(OpCopy, srcRelPath); err != nil {
+		return err
+	}
+	e, ok := m.entries[srcRelPath]
+	if !ok || e.isDir {
+		return fmt.Errorf("%w: %s", fs.ErrNotExist, srcRelPath)
+	}
+	if _, ok := m.entries[dstRelPath]; ok {
+		return fmt.Errorf("%w: %s", fs.ErrExist, dstRelPath)
+	}
+
+	now := m.now()
+	m.mkdirAll(path.Dir(dstRelPath), now)
+	m.entries[dstRelPath] = &entry{data: append([]byte(nil), e.data...), modTime: now}
+	return nil
+}
+
+// Type 实现 fs.RemoteProvider
+func (m *FS) Type() string {
+	return "memory"
+}
+
+// StoredSize 实现 fs.RemoteProvider，内容原样保存，加密时多出密文头部
+func (m *FS) StoredSize(plainSize int64, encrypted bool) int64 {
+	if encrypted {
+		return plainSize + crypto.HeaderSize
+	}
+	return plainSize
+}
+
+// HasContentHash 实现 fs.RemoteProvider
+func (m *FS) HasContentHash() bool {
+	return true
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ProgressInterval 进度回调的最小间隔，避免大量小块读写时刷屏
+const ProgressInterval = 500 * time.Millisecond
+
+// ProgressFunc 传输进度回调
+// bytesTotal 未知时为 -1
+type ProgressFunc func(bytesDone, bytesTotal int64)
+
+// progressReader 在读取的同时统计字节数，并按节流间隔回调进度
+type progressReader struct {
+	r     io.Reader
+	fn    ProgressFunc
+	done  int64
+	total int64
+	last  time.Time
+}
+
+// NewProgressReader 包装 Reader，读取过程中回调进度
+// fn 为 nil 时直接返回原 Reader；读取结束 (EOF 或达到 total) 时一定会回调一次
+func NewProgressReader(r io.Reader, total int64, fn ProgressFunc) io.Reader {
+	if fn == nil {
+		return r
+	}
+	return &progressReader{r: r, fn: fn, total: total}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+
+	finished := err == io.EOF || (p.total >= 0 && p.done >= p.total)
+	if finished || time.Since(p.last) >= ProgressInterval {
+		p.last = time.Now()
+		p.fn(p.done, p.total)
+	}
+	return n, err
+}
+
+// ExistPolicy 写入时目标已存在的处理方式
+type ExistPolicy int
+
+const (
+	// ExistDefault 由后端决定 (百度网盘按客户端配置，默认覆盖)
+	ExistDefault ExistPolicy = iota
+	// ExistOverwrite 覆盖已有的文件
+	ExistOverwrite
+	// ExistFail 不覆盖，返回 ErrExist
+	ExistFail
+	// ExistRename 不覆盖，由后端改名保存 (调用方无法得知新的文件名，同步引擎不使用)
+	ExistRename
+)
+
+// WriteOptions WriteStream 的可选参数
+type WriteOptions struct {
+	// Progress 上传/写入进度回调 (可为空)
+	Progress ProgressFunc
+	// Context 取消或超时后中止尚未完成的写入 (可为空，表示不限制)
+	Context context.Context
+	// OnExist 目标已存在时的处理方式 (不支持的后端总是覆盖)
+	OnExist ExistPolicy
+	// Size stream 的总字节数 (0 表示未知)
+	// 百度网盘据此决定是否不落盘、边读边上传 (需要事先知道大小)，内容与 Size 不符时上传失败
+	Size int64
+}
+
+// OptionsWriter 支持附加写入参数的文件系统 (可选接口)
+type OptionsWriter interface {
+	WriteStreamWithOptions(relPath string, stream io.Reader, modTime time.Time, opts *WriteOptions) (string, error)
+}
+
+// WriteStreamWithOptions 优先使用 OptionsWriter 写入；文件系统不支持时退回普通的 WriteStream
+func WriteStreamWithOptions(fsys FileSystem, relPath string, stream io.Reader, modTime time.Time, opts *WriteOptions) (string, error) {
+	if w, ok := fsys.(OptionsWriter); ok && opts != nil {
+		return w.WriteStreamWithOptions(relPath, stream, modTime, opts)
+	}
+	return fsys.WriteStream(relPath, stream, modTime)
+}
@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"context"
+	"io"
+	iofs "io/fs"
+	"time"
+)
+
+// RemoteProvider 云端存储后端 (百度网盘、本地目录等)
+// 引擎只通过它访问云端，并由它说明后端在大小与 Hash 上的语义，
+// 因此新增后端时不需要修改同步引擎与比对逻辑
+type RemoteProvider interface {
+	FileSystem
+
+	// Type 后端类型，对应配置中的 remote.type
+	Type() string
+
+	// StoredSize 返回明文大小为 plainSize 的文件存入后端后的大小
+	// encrypted 表示内容经过了引擎的流式加密 (会增加加密头部)
+	// 数据库丢失后的模糊匹配与没有 Hash 时的变更判断都依赖它
+	StoredSize(plainSize int64, encrypted bool) int64
+
+	// HasContentHash 报告 ListAll/Stat 返回的 RemoteHash 是否为可靠的内容指纹
+	// 为 false 时引擎只能通过大小判断云端文件是否发生变化
+	HasContentHash() bool
+}
+
+// BlockHasher 可选接口: RemoteHash 对大文件不可靠的后端
+// 超过 ContentHashLimit 的文件，引擎在上传、下载时按 BlockSize 记录云端内容的分片 MD5 列表，
+// 列表中的 Hash 与记录不一致时再读取云端文件、比对分片 MD5 列表，确认内容是否真的变化
+type BlockHasher interface {
+	// ContentHashLimit RemoteHash 只对不超过该大小 (后端中的大小) 的文件是可靠的内容指纹
+	ContentHashLimit() int64
+	// BlockSize 计算分片 MD5 列表时的分片大小
+	BlockSize() int64
+}
+
+// Checker 可选接口: 在首次同步前检查文件系统是否可用 (认证是否有效、根目录是否可以访问)
+type Checker interface {
+	// Check 根目录不存在时，createRoot 为 true 则创建根目录，否则返回包装 ErrNotExist 的错误
+	Check(ctx context.Context, createRoot bool) error
+}
+
+// RangeOpener 可选接口: 从指定偏移量开始读取文件
+// 下载中途断开时引擎据此从断点继续；没有实现时重新打开整个文件并跳过已读取的部分
+type RangeOpener interface {
+	OpenStreamAt(relPath string, offset int64) (io.ReadCloser, error)
+}
+
+// ModeSetter 可选接口: 修改文件的权限位，用于下载后恢复上次同步时记录的权限
+type ModeSetter interface {
+	Chmod(relPath string, mode iofs.FileMode) error
+}
+
+// PartSuffix 未完成的下载文件的后缀
+// 下载先写入 relPath+PartSuffix，写完并校验通过后才改名为目标文件，扫描本地目录时跳过这些文件
+const PartSuffix = ".baidusync.part"
+
+// PartialWriter 可选接口: 从指定偏移量继续写入文件，用于下载的断点续传
+// 没有实现时下载直接写入目标文件，中断后下一轮重新下载
+type PartialWriter interface {
+	// WriteStreamAt 把文件截断为 offset 字节后从 offset 处写入 stream (offset 为 0 时创建新文件)
+	// 无论是否写完都把修改时间设置为 modTime，续传前据此确认文件对应的是同一个云端版本
+	// 成功时返回整个文件的 Hash (与 WriteStream 相同)
+	WriteStreamAt(relPath string, stream io.Reader, offset int64, modTime time.Time) (string, error)
+}
@@ -0,0 +1,18 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ScanError ListAll 时有路径无法读取 (例如没有权限的子目录)，这些路径已被跳过，其余的扫描结果仍然有效
+// ListAll 返回 *ScanError 时同时返回扫描结果；调用方应把 Skipped 中的路径 (连同下级) 视为状态未知，
+// 不能当作已删除
+type ScanError struct {
+	Skipped []string // 跳过的相对路径
+	Errs    []error  // 每个路径对应的错误
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("%d 个路径无法读取，已跳过: %v", len(e.Skipped), errors.Join(e.Errs...))
+}
@@ -0,0 +1,15 @@
+package fs
+
+// QuickStater 可选接口: 只读取大小、修改时间等元数据，不计算 Hash
+// 本地文件系统的 Stat 需要读取整个文件计算 Hash，只关心修改时间时使用它可以避免这部分开销
+type QuickStater interface {
+	StatQuick(relPath string) (*FileMeta, error)
+}
+
+// StatQuick 优先使用 QuickStater，没有实现时退回 Stat (云端的 Stat 本身不需要读取内容)
+func StatQuick(fsys FileSystem, relPath string) (*FileMeta, error) {
+	if q, ok := fsys.(QuickStater); ok {
+		return q.StatQuick(relPath)
+	}
+	return fsys.Stat(relPath)
+}
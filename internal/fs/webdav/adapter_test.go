@@ -0,0 +1,524 @@
+package webdav
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs"
+)
+
+// davFile 模拟服务器上的文件或目录
+type davFile struct {
+	data  []byte
+	isDir bool
+	mtime time.Time
+}
+
+// fakeDAV 最小的内存 WebDAV 服务器，实现同步用到的 PROPFIND / GET / PUT / MKCOL / MOVE / DELETE
+type fakeDAV struct {
+	mu sync.Mutex
+
+	files map[string]*davFile // 未转义的服务器路径 (不带结尾的 "/") -> 文件或目录
+	calls []string            // 按顺序记录的请求，例如 "MKCOL /dav/sync/x"
+
+	user, pass string // 不为空时要求 Basic 认证
+	// absoluteHref PROPFIND 返回完整的 URL 作为 href，否则只返回路径
+	absoluteHref bool
+	// noRange 忽略 Range 请求头，总是返回整个文件
+	noRange bool
+}
+
+func newFakeDAV(t *testing.T) (*fakeDAV, *httptest.Server) {
+	d := &fakeDAV{files: map[string]*davFile{"/dav": {isDir: true}}}
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+	return d, srv
+}
+
+// put 在服务器上创建文件，上级目录自动创建
+func (d *fakeDAV) put(p, data string, mtime time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+		if d.files[dir] == nil {
+			d.files[dir] = &davFile{isDir: true, mtime: mtime}
+		}
+	}
+	d.files[p] = &davFile{data: []byte(data), mtime: mtime}
+}
+
+// mkdir 在服务器上创建目录，上级目录自动创建
+func (d *fakeDAV) mkdir(p string) {
+	d.put(p+"/.keep", "", time.Time{})
+	d.mu.Lock()
+	delete(d.files, p+"/.keep")
+	d.mu.Unlock()
+}
+
+// get 返回服务器上的文件内容
+func (d *fakeDAV) get(p string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f := d.files[p]
+	if f == nil || f.isDir {
+		return "", false
+	}
+	return string(f.data), true
+}
+
+func (d *fakeDAV) exists(p string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.files[p] != nil
+}
+
+// called 返回以 prefix 开头的请求记录
+func (d *fakeDAV) called(prefix string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []string
+	for _, c := range d.calls {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// children 返回 p 的直接下级 (已排序)
+func (d *fakeDAV) children(p string) []string {
+	var out []string
+	for name := range d.files {
+		if path.Dir(name) == p && name != p {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// href 服务器路径在 PROPFIND 响应中的写法 (转义，目录以 "/" 结尾)
+func (d *fakeDAV) href(r *http.Request, p string, isDir bool) string {
+	u := url.URL{Path: p}
+	if isDir {
+		u.Path += "/"
+	}
+	if d.absoluteHref {
+		u.Scheme, u.Host = "http", r.Host
+	}
+	return u.String()
+}
+
+func (d *fakeDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p := strings.TrimSuffix(r.URL.Path, "/")
+	call := r.Method + " " + p
+	if r.Method == "PROPFIND" {
+		call += " depth=" + r.Header.Get("Depth")
+	}
+	d.calls = append(d.calls, call)
+
+	if d.user != "" {
+		if user, pass, ok := r.BasicAuth(); !ok || user != d.user || pass != d.pass {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	f := d.files[p]
+	parent := d.files[path.Dir(p)]
+
+	switch r.Method {
+	case "PROPFIND":
+		if f == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		names := []string{p}
+		if r.Header.Get("Depth") == "1" && f.isDir {
+			names = append(names, d.children(p)...)
+		}
+		var buf bytes.Buffer
+		buf.WriteString(`<?xml version="1.0" encoding="utf-8"?><d:multistatus xmlns:d="DAV:">`)
+		for _, name := range names {
+			e := d.files[name]
+			fmt.Fprintf(&buf, `<d:response><d:href>%s</d:href><d:propstat><d:prop>`, d.href(r, name, e.isDir))
+			if e.isDir {
+				buf.WriteString(`<d:resourcetype><d:collection/></d:resourcetype>`)
+			} else {
+				fmt.Fprintf(&buf, `<d:resourcetype/><d:getcontentlength>%d</d:getcontentlength>`, len(e.data))
+			}
+			fmt.Fprintf(&buf, `<d:getlastmodified>%s</d:getlastmodified></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>`,
+				e.mtime.UTC().Format(http.TimeFormat))
+			// 目录没有 getcontentlength: 与常见的服务器一样放在 404 的 propstat 中
+			if e.isDir {
+				buf.WriteString(`<d:propstat><d:prop><d:getcontentlength>999</d:getcontentlength></d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>`)
+			}
+			buf.WriteString(`</d:response>`)
+		}
+		buf.WriteString(`</d:multistatus>`)
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write(buf.Bytes())
+
+	case http.MethodGet:
+		if f == nil || f.isDir {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if rng := r.Header.Get("Range"); rng != "" && !d.noRange {
+			offset, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			if err != nil || offset > len(f.data) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(f.data)-1, len(f.data)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(f.data[offset:])
+			return
+		}
+		w.Write(f.data)
+
+	case http.MethodPut:
+		if parent == nil || !parent.isDir {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if f != nil && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mtime := time.Now()
+		if sec, err := strconv.ParseInt(r.Header.Get("X-OC-Mtime"), 10, 64); err == nil {
+			mtime = time.Unix(sec, 0)
+		}
+		d.files[p] = &davFile{data: data, mtime: mtime}
+		if f != nil {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+
+	case "MKCOL":
+		switch {
+		case f != nil:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case parent == nil:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			d.files[p] = &davFile{isDir: true}
+			w.WriteHeader(http.StatusCreated)
+		}
+
+	case "MOVE":
+		dst, err := url.Parse(r.Header.Get("Destination"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		to := strings.TrimSuffix(dst.Path, "/")
+		switch {
+		case f == nil:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case d.files[path.Dir(to)] == nil:
+			w.WriteHeader(http.StatusConflict)
+			return
+		case d.files[to] != nil && r.Header.Get("Overwrite") != "T":
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		existed := d.files[to] != nil
+		d.remove(to)
+		for name, e := range d.files {
+			if name == p || strings.HasPrefix(name, p+"/") {
+				delete(d.files, name)
+				d.files[to+strings.TrimPrefix(name, p)] = e
+			}
+		}
+		if existed {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+
+	case http.MethodDelete:
+		if f == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		d.remove(p)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// remove 删除 p 以及其中的所有内容 (调用方持有锁)
+func (d *fakeDAV) remove(p string) {
+	for name := range d.files {
+		if name == p || strings.HasPrefix(name, p+"/") {
+			delete(d.files, name)
+		}
+	}
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// newTestAdapter 创建根目录为服务器上 /dav/sync 的 Adapter
+func newTestAdapter(t *testing.T, srv *httptest.Server, user, pass string) *Adapter {
+	t.Helper()
+	a, err := New("sync", &Options{URL: srv.URL + "/dav", Username: user, Password: pass})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestListAllAndStat(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, absolute := range []bool{false, true} {
+		t.Run(fmt.Sprintf("absoluteHref=%t", absolute), func(t *testing.T) {
+			dav, srv := newFakeDAV(t)
+			dav.absoluteHref = absolute
+			dav.put("/dav/sync/a.txt", "hello", mtime)
+			dav.put("/dav/sync/dir with space/文件 #1.txt", "escaped name", mtime)
+			dav.put("/dav/sync/dir with space/sub/deep.txt", "deep", mtime)
+			dav.mkdir("/dav/sync/empty")
+			dav.put("/dav/sync/a.txt.baidusync.part", "partial", mtime)
+			dav.put("/dav/other.txt", "outside root", mtime)
+			a := newTestAdapter(t, srv, "", "")
+
+			files, err := a.ListAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for p := range files {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+			want := []string{"a.txt", "dir with space", "dir with space/sub", "dir with space/sub/deep.txt", "dir with space/文件 #1.txt", "empty"}
+			if !slices.Equal(paths, want) {
+				t.Fatalf("ListAll 返回 %v，应为 %v", paths, want)
+			}
+			if f := files["dir with space/文件 #1.txt"]; f.IsDir || f.Size != int64(len("escaped name")) || !f.ModTime.Equal(mtime) {
+				t.Fatalf("文件属性为 %+v", f)
+			}
+			// 404 propstat 中的属性不能覆盖目录的大小
+			if d := files["empty"]; !d.IsDir || d.Size != 0 {
+				t.Fatalf("目录属性为 %+v", d)
+			}
+			// 逐层 Depth: 1 列出，每个目录一次
+			if got := len(dav.called("PROPFIND")); got != 4 {
+				t.Fatalf("发送了 %d 次 PROPFIND，应为 4 次 (根目录与 3 个子目录)", got)
+			}
+			if calls := dav.called("PROPFIND /dav/sync depth="); !slices.Equal(calls, []string{"PROPFIND /dav/sync depth=1"}) {
+				t.Fatalf("列出根目录的请求为 %v", calls)
+			}
+
+			// Stat 使用 Depth: 0，并下载文件计算 Hash
+			meta, err := a.Stat("dir with space/文件 #1.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Hash != md5Hex("escaped name") || meta.Size != int64(len("escaped name")) {
+				t.Fatalf("Stat 返回 %+v", meta)
+			}
+			if calls := dav.called("PROPFIND /dav/sync/dir with space/文件 #1.txt"); !slices.Equal(calls, []string{"PROPFIND /dav/sync/dir with space/文件 #1.txt depth=0"}) {
+				t.Fatalf("Stat 的请求为 %v", calls)
+			}
+			if _, err := a.StatQuick("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("错误为 %v，应为 fs.ErrNotExist", err)
+			}
+		})
+	}
+}
+
+func TestOpenStreamAt(t *testing.T) {
+	for _, noRange := range []bool{false, true} {
+		t.Run(fmt.Sprintf("noRange=%t", noRange), func(t *testing.T) {
+			dav, srv := newFakeDAV(t)
+			dav.noRange = noRange
+			dav.put("/dav/sync/a.bin", "0123456789", time.Now())
+			a := newTestAdapter(t, srv, "", "")
+
+			// 支持 Range 时服务器返回 206；忽略 Range 返回 200 时跳过前面的字节
+			rc, err := a.OpenStreamAt("a.bin", 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			data, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "456789" {
+				t.Fatalf("从偏移量 4 读取到 %q", data)
+			}
+			if _, err := a.OpenStreamAt("missing.bin", 0); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("错误为 %v，应为 fs.ErrNotExist", err)
+			}
+		})
+	}
+}
+
+func TestWriteStream(t *testing.T) {
+	dav, srv := newFakeDAV(t)
+	dav.mkdir("/dav/sync")
+	a := newTestAdapter(t, srv, "", "")
+	mtime := time.Unix(1714564800, 0)
+
+	// 父目录不存在: MKCOL 返回 409 后逐级创建上级目录再重试
+	hash, err := a.WriteStream("x/y/z.txt", strings.NewReader("nested"), mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != md5Hex("nested") {
+		t.Fatalf("返回的 Hash 为 %s", hash)
+	}
+	wantMkcol := []string{"MKCOL /dav/sync/x/y", "MKCOL /dav/sync/x", "MKCOL /dav/sync/x/y"}
+	if calls := dav.called("MKCOL"); !slices.Equal(calls, wantMkcol) {
+		t.Fatalf("MKCOL 请求为 %v，应为 %v", calls, wantMkcol)
+	}
+	if got, _ := dav.get("/dav/sync/x/y/z.txt"); got != "nested" {
+		t.Fatalf("服务器上的内容为 %q", got)
+	}
+	meta, err := a.StatQuick("x/y/z.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.ModTime.Equal(mtime) {
+		t.Fatalf("修改时间为 %v，应为 X-OC-Mtime 指定的 %v", meta.ModTime, mtime)
+	}
+
+	// ExistFail 发送 If-None-Match: *，目标已存在时服务器返回 412
+	_, err = fs.WriteStreamWithOptions(a, "x/y/z.txt", strings.NewReader("other"), mtime, &fs.WriteOptions{OnExist: fs.ExistFail})
+	var statusErr *StatusError
+	if !errors.Is(err, fs.ErrExist) || !errors.As(err, &statusErr) || statusErr.Status != http.StatusPreconditionFailed {
+		t.Fatalf("错误为 %v，应为 412 fs.ErrExist", err)
+	}
+	if got, _ := dav.get("/dav/sync/x/y/z.txt"); got != "nested" {
+		t.Fatalf("目标已存在时被覆盖为 %q", got)
+	}
+	// 默认覆盖
+	if _, err := a.WriteStream("x/y/z.txt", strings.NewReader("overwritten"), mtime); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := dav.get("/dav/sync/x/y/z.txt"); got != "overwritten" {
+		t.Fatalf("覆盖后的内容为 %q", got)
+	}
+}
+
+func TestRename(t *testing.T) {
+	dav, srv := newFakeDAV(t)
+	dav.put("/dav/sync/a.txt", "a", time.Now())
+	dav.put("/dav/sync/b.txt", "b", time.Now())
+	a := newTestAdapter(t, srv, "", "")
+
+	// 目标已存在时覆盖 (服务器只在请求带有 Overwrite: T 时覆盖)
+	if err := a.Rename("a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := dav.get("/dav/sync/b.txt"); got != "a" || dav.exists("/dav/sync/a.txt") {
+		t.Fatalf("改名后 b.txt 为 %q，a.txt 存在: %t", got, dav.exists("/dav/sync/a.txt"))
+	}
+
+	// 目标的父目录不存在: 409 后创建父目录再重试
+	if err := a.Rename("b.txt", "new dir/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := dav.get("/dav/sync/new dir/b.txt"); got != "a" {
+		t.Fatalf("移动后的内容为 %q", got)
+	}
+	if calls := dav.called("MOVE"); len(calls) != 3 {
+		t.Fatalf("MOVE 请求为 %v，应为 3 次 (第二次移动重试一次)", calls)
+	}
+	if err := a.Rename("missing.txt", "x.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("错误为 %v，应为 fs.ErrNotExist", err)
+	}
+}
+
+func TestRmdir(t *testing.T) {
+	dav, srv := newFakeDAV(t)
+	dav.put("/dav/sync/full/a.txt", "a", time.Now())
+	dav.mkdir("/dav/sync/empty")
+	a := newTestAdapter(t, srv, "", "")
+
+	// DELETE 会删除目录中的所有内容，非空目录不能发送
+	if err := a.Rmdir("full"); !errors.Is(err, fs.ErrNotEmpty) {
+		t.Fatalf("错误为 %v，应为 fs.ErrNotEmpty", err)
+	}
+	if !dav.exists("/dav/sync/full/a.txt") || len(dav.called("DELETE")) != 0 {
+		t.Fatal("非空目录被删除")
+	}
+	if err := a.Rmdir("empty"); err != nil {
+		t.Fatal(err)
+	}
+	if dav.exists("/dav/sync/empty") {
+		t.Fatal("空目录没有删除")
+	}
+}
+
+func TestAuthError(t *testing.T) {
+	dav, srv := newFakeDAV(t)
+	dav.user, dav.pass = "me", "secret"
+	dav.mkdir("/dav/sync")
+
+	wrong := newTestAdapter(t, srv, "me", "wrong")
+	if _, err := wrong.ListAll(); !errors.Is(err, fs.ErrAuth) {
+		t.Fatalf("ListAll 错误为 %v，应为 fs.ErrAuth", err)
+	}
+	if _, err := wrong.OpenStream("a.txt"); !errors.Is(err, fs.ErrAuth) {
+		t.Fatalf("OpenStream 错误为 %v，应为 fs.ErrAuth", err)
+	}
+	if err := wrong.Check(t.Context(), false); !errors.Is(err, fs.ErrAuth) {
+		t.Fatalf("Check 错误为 %v，应为 fs.ErrAuth", err)
+	}
+
+	right := newTestAdapter(t, srv, "me", "secret")
+	if _, err := right.ListAll(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckCreatesRoot(t *testing.T) {
+	dav, srv := newFakeDAV(t)
+	a, err := New("a/b", &Options{URL: srv.URL + "/dav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Check(t.Context(), false); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("错误为 %v，应为 fs.ErrNotExist", err)
+	}
+	if err := a.Check(t.Context(), true); err != nil {
+		t.Fatal(err)
+	}
+	if !dav.exists("/dav/a/b") {
+		t.Fatal("根目录没有创建")
+	}
+}
@@ -0,0 +1,89 @@
+package webdav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// propfindBody 只请求同步需要的属性，避免服务器返回配额、锁等额外信息
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop>
+<d:resourcetype/><d:getcontentlength/><d:getlastmodified/>
+</d:prop></d:propfind>`
+
+// multistatus PROPFIND 返回的 207 Multi-Status 响应
+type multistatus struct {
+	Responses []response `xml:"DAV: response"`
+}
+
+type response struct {
+	Href      string     `xml:"DAV: href"`
+	Propstats []propstat `xml:"DAV: propstat"`
+}
+
+type propstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   struct {
+		ResourceType struct {
+			Collection *struct{} `xml:"DAV: collection"`
+		} `xml:"DAV: resourcetype"`
+		ContentLength string `xml:"DAV: getcontentlength"`
+		LastModified  string `xml:"DAV: getlastmodified"`
+	} `xml:"DAV: prop"`
+}
+
+// entry PROPFIND 返回的一个文件或目录
+type entry struct {
+	path    string // 服务器上未转义的路径，目录不带结尾的 "/"
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// parseMultistatus 解析 PROPFIND 响应，只取状态为 200 的属性
+func parseMultistatus(r io.Reader) ([]entry, error) {
+	var ms multistatus
+	if err := xml.NewDecoder(r).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("解析 PROPFIND 响应失败: %w", err)
+	}
+	entries := make([]entry, 0, len(ms.Responses))
+	for _, resp := range ms.Responses {
+		// href 可能是完整的 URL，也可能只有路径，两种写法都是转义过的
+		u, err := url.Parse(resp.Href)
+		if err != nil {
+			return nil, fmt.Errorf("无法解析 href %q: %w", resp.Href, err)
+		}
+		e := entry{path: strings.TrimSuffix(u.Path, "/")}
+		for _, ps := range resp.Propstats {
+			if !statusOK(ps.Status) {
+				continue
+			}
+			if ps.Prop.ResourceType.Collection != nil {
+				e.isDir = true
+			}
+			if ps.Prop.ContentLength != "" {
+				e.size, _ = strconv.ParseInt(strings.TrimSpace(ps.Prop.ContentLength), 10, 64)
+			}
+			if ps.Prop.LastModified != "" {
+				e.modTime, _ = http.ParseTime(strings.TrimSpace(ps.Prop.LastModified))
+			}
+		}
+		if e.isDir {
+			e.size = 0
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// statusOK propstat 的状态行 (例如 "HTTP/1.1 200 OK") 是否表示成功
+func statusOK(status string) bool {
+	fields := strings.Fields(status)
+	return len(fields) >= 2 && fields[1] == "200"
+}
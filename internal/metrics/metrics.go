@@ -0,0 +1,162 @@
+// Package metrics 汇总每轮同步的统计结果，并以 Prometheus 文本格式对外提供
+// 只依赖标准库：计数器按 Profile 与操作类型累加，由守护进程在每轮同步结束后调用 Observe
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	syncer "baidusync/internal/sync"
+)
+
+// profileMetrics 单个 Profile 的累计指标
+type profileMetrics struct {
+	synced    map[string]int64 // 按操作类型统计的成功任务数
+	failed    map[string]int64 // 按操作类型统计的失败任务数
+	bytesUp   int64
+	bytesDown int64
+	wireUp    int64 // 实际经过网络的字节数 (含加密开销与失败任务已传输的部分)
+	wireDown  int64
+	conflicts int64
+	runs      map[string]int64 // 按结果 (success / error) 统计的同步轮数
+
+	lastDuration time.Duration
+	lastRun      time.Time
+	concurrency  int
+}
+
+// Registry 所有 Profile 的指标，可以安全地并发使用
+type Registry struct {
+	mu       sync.Mutex
+	profiles map[string]*profileMetrics
+}
+
+// NewRegistry 创建一个空的指标集合
+func NewRegistry() *Registry {
+	return &Registry{profiles: make(map[string]*profileMetrics)}
+}
+
+// Observe 累加一轮同步的结果，err 为 Run 返回的错误
+func (r *Registry) Observe(profile string, result *syncer.RunResult, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.profiles[profile]
+	if !ok {
+		m = &profileMetrics{
+			synced: make(map[string]int64),
+			failed: make(map[string]int64),
+			runs:   make(map[string]int64),
+		}
+		r.profiles[profile] = m
+	}
+
+	if err != nil {
+		m.runs["error"]++
+	} else {
+		m.runs["success"]++
+	}
+	if result == nil {
+		return
+	}
+	for op, n := range result.Succeeded {
+		m.synced[op.String()] += int64(n)
+	}
+	for op, n := range result.Failed {
+		m.failed[op.String()] += int64(n)
+	}
+	m.bytesUp += result.BytesUploaded
+	m.bytesDown += result.BytesDownloaded
+	m.wireUp += result.WireBytesUploaded
+	m.wireDown += result.WireBytesDownloaded
+	m.conflicts += int64(result.Conflicts())
+	m.lastDuration = result.Duration
+	m.lastRun = result.Started
+	if result.Concurrency > 0 {
+		m.concurrency = result.Concurrency
+	}
+}
+
+// ServeHTTP 以 Prometheus 文本格式输出所有指标
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// WriteTo 以 Prometheus 文本格式写出所有指标 (Profile 与标签按字典序排列，输出稳定)
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.profiles))
+	for name := range r.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	// byLabel 按 label 拆分的计数器，例如按操作类型统计的任务数
+	byLabel := func(name, help, label string, get func(*profileMetrics) map[string]int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, profile := range names {
+			values := get(r.profiles[profile])
+			for _, key := range sortedKeys(values) {
+				fmt.Fprintf(&b, "%s{profile=\"%s\",%s=\"%s\"} %d\n", name, escape(profile), label, escape(key), values[key])
+			}
+		}
+	}
+	// single 每个 Profile 一个值的指标
+	single := func(name, typ, help string, get func(*profileMetrics) float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, profile := range names {
+			value := strconv.FormatFloat(get(r.profiles[profile]), 'f', -1, 64)
+			fmt.Fprintf(&b, "%s{profile=\"%s\"} %s\n", name, escape(profile), value)
+		}
+	}
+
+	byLabel("baidusync_files_synced_total", "成功执行的同步任务数", "op",
+		func(m *profileMetrics) map[string]int64 { return m.synced })
+	byLabel("baidusync_errors_total", "执行失败的同步任务数", "op",
+		func(m *profileMetrics) map[string]int64 { return m.failed })
+	byLabel("baidusync_runs_total", "已完成的同步轮数", "result",
+		func(m *profileMetrics) map[string]int64 { return m.runs })
+	single("baidusync_bytes_uploaded_total", "counter", "成功上传的字节数 (明文大小)",
+		func(m *profileMetrics) float64 { return float64(m.bytesUp) })
+	single("baidusync_bytes_downloaded_total", "counter", "成功下载的字节数 (明文大小)",
+		func(m *profileMetrics) float64 { return float64(m.bytesDown) })
+	single("baidusync_wire_bytes_uploaded_total", "counter", "实际上传到云端的字节数 (含加密开销与失败任务已传输的部分)",
+		func(m *profileMetrics) float64 { return float64(m.wireUp) })
+	single("baidusync_wire_bytes_downloaded_total", "counter", "实际从云端下载的字节数 (含加密开销与失败任务已传输的部分)",
+		func(m *profileMetrics) float64 { return float64(m.wireDown) })
+	single("baidusync_conflicts_total", "counter", "处理过的冲突数",
+		func(m *profileMetrics) float64 { return float64(m.conflicts) })
+	single("baidusync_last_run_duration_seconds", "gauge", "最近一轮同步的耗时",
+		func(m *profileMetrics) float64 { return m.lastDuration.Seconds() })
+	single("baidusync_last_run_timestamp_seconds", "gauge", "最近一轮同步的开始时间 (Unix 时间戳)",
+		func(m *profileMetrics) float64 { return float64(m.lastRun.Unix()) })
+	single("baidusync_concurrency", "gauge", "最近一轮文件传输结束时的并发数",
+		func(m *profileMetrics) float64 { return float64(m.concurrency) })
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escape 按 Prometheus 文本格式转义标签值
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,169 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"baidusync/internal/fs"
+)
+
+const (
+	// adaptiveWindow 自适应并发每次评估至少观察的时长
+	adaptiveWindow = 10 * time.Second
+	// adaptiveBackoffCooldown 两次因限流减半之间的最短间隔
+	// 减半前已经发出的请求仍可能陆续被限流，不应让并发数连续减半
+	adaptiveBackoffCooldown = 5 * time.Second
+	// adaptiveDropRatio 吞吐量低于上一个窗口的该比例时，认为增加的并发没有带来收益
+	adaptiveDropRatio = 0.8
+)
+
+// AdaptiveOptions 自适应并发的上下限
+// 以 MaxWorkers 为初始并发数：遇到限流时减半，无错误且吞吐量没有下降时逐个增加
+type AdaptiveOptions struct {
+	Min int
+	Max int
+}
+
+// limiter 控制文件传输阶段同时执行的任务数
+// 未开启自适应时上下限相同，并发数固定为 MaxWorkers
+type limiter struct {
+	log *slog.Logger
+	min int
+	max int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+
+	// 当前观察窗口内的统计
+	windowStart time.Time
+	completed   int
+	failed      int
+	bytes       int64
+	// lastRate 上一个窗口的吞吐量 (字节/秒)，用于判断增加并发是否有收益
+	lastRate float64
+	// lastBackoff 上一次因限流减半的时间
+	lastBackoff time.Time
+}
+
+func newLimiter(log *slog.Logger, base, lo, hi int) *limiter {
+	l := &limiter{
+		log:         log,
+		min:         lo,
+		max:         hi,
+		limit:       min(max(base, lo), hi),
+		windowStart: time.Now(),
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// limiter 为本轮同步创建并发控制器
+// 自适应模式下从上一轮结束时的并发数开始，避免每轮都从头试探
+func (e *Engine) limiter(log *slog.Logger) *limiter {
+	base := e.maxWorkers()
+
+	e.mu.RLock()
+	adaptive := e.opts.Adaptive
+	e.mu.RUnlock()
+	if adaptive == nil {
+		return newLimiter(log, base, base, base)
+	}
+	if last := int(e.concurrency.Load()); last > 0 {
+		base = last
+	}
+	return newLimiter(log, base, adaptive.Min, adaptive.Max)
+}
+
+// acquire 等待空闲的并发名额，ctx 取消时返回 false
+func (l *limiter) acquire(ctx context.Context) bool {
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.cond.Broadcast()
+	})
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= l.limit {
+		if ctx.Err() != nil {
+			return false
+		}
+		l.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	l.active++
+	return true
+}
+
+// release 归还名额，并根据任务结果调整并发数
+// 没有执行任务 (例如队列已空) 时 t 为 nil
+func (l *limiter) release(t *Task, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.cond.Broadcast()
+
+	l.active--
+	if t == nil || l.min == l.max {
+		return
+	}
+
+	if errors.Is(err, fs.ErrThrottled) {
+		// 被限流时立即减半，并重新开始观察
+		if time.Since(l.lastBackoff) >= adaptiveBackoffCooldown {
+			l.lastBackoff = time.Now()
+			l.adjust(max(l.limit/2, l.min), "throttled", 0)
+		}
+		return
+	}
+
+	l.completed++
+	if err != nil {
+		l.failed++
+	} else if t.Op == OpUpload || t.Op == OpDownload || t.Op == OpConflict {
+		l.bytes += t.Size()
+	}
+
+	elapsed := time.Since(l.windowStart)
+	if elapsed < adaptiveWindow || l.completed < l.limit {
+		return
+	}
+
+	rate := float64(l.bytes) / elapsed.Seconds()
+	switch {
+	case l.failed > 0:
+		// 有失败但不是限流，保持不变
+		l.adjust(l.limit, "", rate)
+	case l.lastRate > 0 && rate < l.lastRate*adaptiveDropRatio:
+		l.adjust(max(l.limit-1, l.min), "throughput_dropped", rate)
+	default:
+		l.adjust(min(l.limit+1, l.max), "clean", rate)
+	}
+}
+
+// adjust 修改并发数并开始新的观察窗口 (调用方需持有锁)
+func (l *limiter) adjust(limit int, reason string, rate float64) {
+	if limit != l.limit {
+		l.log.Info("调整并发数", "from", l.limit, "to", limit, "reason", reason, "bytes_per_sec", int64(rate))
+		l.limit = limit
+	}
+	l.lastRate = rate
+	l.windowStart = time.Now()
+	l.completed = 0
+	l.failed = 0
+	l.bytes = 0
+}
+
+// current 返回当前的并发数
+func (l *limiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
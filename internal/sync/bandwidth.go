@@ -0,0 +1,141 @@
+package sync
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// bandwidthChunk 限速时每次读取的最大字节数，越小速率越平滑
+const bandwidthChunk = 32 * 1024
+
+// BandwidthOptions 传输限速 (字节/秒)，上传与下载的所有 Worker 共享同一个额度
+type BandwidthOptions struct {
+	// Limit 不在任何时间段内时的限速 (0 表示不限速)
+	Limit int64
+	// Schedule 按一天中的时间段覆盖 Limit，按顺序匹配第一个包含当前时间的时间段
+	Schedule []BandwidthWindow
+}
+
+// BandwidthWindow 一天中的一个时间段及其限速
+// From / To 为距离零点的时长；From 大于 To 时表示跨越零点 (例如 22:00 ~ 06:00)，两者相同时表示全天
+type BandwidthWindow struct {
+	From  time.Duration
+	To    time.Duration
+	Limit int64 // 0 表示该时间段不限速
+}
+
+// contains 时间段是否包含 t 对应的时刻
+func (w BandwidthWindow) contains(t time.Time) bool {
+	h, m, s := t.Clock()
+	now := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+	switch {
+	case w.From == w.To:
+		return true
+	case w.From < w.To:
+		return now >= w.From && now < w.To
+	default:
+		return now >= w.From || now < w.To
+	}
+}
+
+// limitAt 返回 t 时刻生效的限速
+func (o *BandwidthOptions) limitAt(t time.Time) int64 {
+	for _, w := range o.Schedule {
+		if w.contains(t) {
+			return w.Limit
+		}
+	}
+	return o.Limit
+}
+
+// bandwidthLimiter 令牌桶限速器，每次读取前按当前时间段的限速扣除额度
+// 最多积累 1 秒的额度，额度不足时等待
+type bandwidthLimiter struct {
+	log  *slog.Logger
+	opts *BandwidthOptions
+
+	mu        sync.Mutex
+	tokens    float64
+	last      time.Time
+	lastLimit int64
+}
+
+func newBandwidthLimiter(log *slog.Logger, opts *BandwidthOptions) *bandwidthLimiter {
+	if opts == nil || (opts.Limit <= 0 && len(opts.Schedule) == 0) {
+		return nil
+	}
+	return &bandwidthLimiter{log: log, opts: opts, lastLimit: -1}
+}
+
+// wait 扣除 n 字节的额度，额度不足时等待到可以继续传输，ctx 取消时返回其错误
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	limit := l.opts.limitAt(now)
+	if limit != l.lastLimit {
+		if l.lastLimit >= 0 {
+			l.log.Info("带宽限制已切换", "bytes_per_sec", limit)
+		}
+		l.lastLimit = limit
+	}
+	if limit <= 0 {
+		l.tokens, l.last = 0, now
+		l.mu.Unlock()
+		return nil
+	}
+
+	rate := float64(limit)
+	l.tokens = math.Min(l.tokens+now.Sub(l.last).Seconds()*rate, rate)
+	l.last = now
+	// 额度可以透支，透支的部分按当前速率折算为等待时间
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledReader 按 bandwidthLimiter 的额度读取
+type throttledReader struct {
+	ctx context.Context
+	r   io.Reader
+	lim *bandwidthLimiter
+}
+
+// throttle 为 r 加上限速 (没有配置限速时原样返回)
+func (e *Engine) throttle(ctx context.Context, r io.Reader) io.Reader {
+	if e.bandwidth == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, lim: e.bandwidth}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > bandwidthChunk {
+		p = p[:bandwidthChunk]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.lim.wait(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,90 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimitAt(t *testing.T) {
+	opts := &BandwidthOptions{
+		Limit: 1000,
+		Schedule: []BandwidthWindow{
+			{From: 22 * time.Hour, To: 6 * time.Hour, Limit: 0},                  // 夜间不限速，跨越零点
+			{From: 9 * time.Hour, To: 18 * time.Hour, Limit: 100},                // 工作时间
+			{From: 12 * time.Hour, To: 13 * time.Hour, Limit: 500},               // 被上一条遮住
+			{From: 18*time.Hour + 30*time.Minute, To: 19 * time.Hour, Limit: 50}, // 半点开始
+			{From: 20 * time.Hour, To: 24 * time.Hour, Limit: 200},               // "24:00" 表示一天结束
+		},
+	}
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		at   time.Duration
+		want int64
+	}{
+		{0, 0},
+		{2 * time.Hour, 0},
+		{22 * time.Hour, 0}, // From 包含在内
+		{23*time.Hour + 59*time.Minute + 59*time.Second, 0},
+		{6 * time.Hour, 1000}, // To 不包含在内
+		{6*time.Hour - time.Second, 0},
+		{9 * time.Hour, 100},
+		{12*time.Hour + 30*time.Minute, 100}, // 第一个匹配的时间段生效
+		{18 * time.Hour, 1000},
+		{18*time.Hour + 29*time.Minute, 1000},
+		{18*time.Hour + 30*time.Minute, 50},
+		{19 * time.Hour, 1000},
+		{21*time.Hour + 59*time.Minute, 200},
+	}
+	for _, tt := range tests {
+		at := day.Add(tt.at)
+		if got := opts.limitAt(at); got != tt.want {
+			t.Errorf("%s 的限速为 %d，应为 %d", at.Format("15:04:05"), got, tt.want)
+		}
+	}
+}
+
+func TestBandwidthWindowWholeDay(t *testing.T) {
+	w := BandwidthWindow{From: 8 * time.Hour, To: 8 * time.Hour, Limit: 10}
+	for h := range 24 {
+		if !w.contains(time.Date(2024, 5, 1, h, 0, 0, 0, time.UTC)) {
+			t.Fatalf("From 与 To 相同时应包含全天，%d 点不包含", h)
+		}
+	}
+}
+
+func TestBandwidthLimiterWait(t *testing.T) {
+	log := slog.New(slog.DiscardHandler)
+	if newBandwidthLimiter(log, &BandwidthOptions{}) != nil {
+		t.Fatal("没有配置限速时不应创建限速器")
+	}
+
+	lim := newBandwidthLimiter(log, &BandwidthOptions{Limit: 1000})
+	ctx := context.Background()
+	// 开始时积累了 1 秒的额度，不需要等待
+	start := time.Now()
+	if err := lim.wait(ctx, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("额度充足时等待了 %s", elapsed)
+	}
+
+	// 透支 100 字节约需等待 0.1 秒
+	start = time.Now()
+	if err := lim.wait(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("透支 100 字节只等待了 %s", elapsed)
+	}
+
+	// 等待期间取消时立即返回
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := lim.wait(canceled, 10_000); !errors.Is(err, context.Canceled) {
+		t.Fatalf("错误为 %v，应为 context.Canceled", err)
+	}
+}
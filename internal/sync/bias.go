@@ -0,0 +1,74 @@
+package sync
+
+import (
+	"log/slog"
+
+	"baidusync/internal/fs"
+)
+
+// FirstRunBias 数据库中没有记录 (首次同步或数据库丢失)、两侧都有同名文件且模糊匹配失败时以哪一侧为准
+type FirstRunBias int
+
+const (
+	// BiasConflict (默认)：视为冲突，按冲突策略处理
+	BiasConflict FirstRunBias = iota
+	// BiasLocal：以本地为准，上传覆盖云端
+	BiasLocal
+	// BiasRemote：以云端为准，下载覆盖本地
+	BiasRemote
+	// BiasNewer：保留修改时间较新的一侧 (与 keep_latest 的裁决相同)
+	BiasNewer
+)
+
+// ParseFirstRunBias 解析配置中的 first_run_bias，未知值按 conflict 处理
+func ParseFirstRunBias(s string) FirstRunBias {
+	switch s {
+	case "local":
+		return BiasLocal
+	case "remote":
+		return BiasRemote
+	case "newer":
+		return BiasNewer
+	default:
+		return BiasConflict
+	}
+}
+
+// String 返回配置中使用的名称 (用于日志)
+func (b FirstRunBias) String() string {
+	switch b {
+	case BiasLocal:
+		return "local"
+	case BiasRemote:
+		return "remote"
+	case BiasNewer:
+		return "newer"
+	default:
+		return "conflict"
+	}
+}
+
+// firstRunOp 没有基准、两侧内容不一致时按 FirstRunBias 决定操作
+func (e *Engine) firstRunOp(log *slog.Logger, relPath string, local, remote *fs.FileMeta) OpType {
+	var op OpType
+	switch e.opts.FirstRunBias {
+	case BiasLocal:
+		op = OpUpload
+	case BiasRemote:
+		op = OpDownload
+	case BiasNewer:
+		keepLocal, reason := e.pickNewest(local, remote, e.now())
+		op = OpDownload
+		if keepLocal {
+			op = OpUpload
+		}
+		log.Info("没有同步记录，保留较新的一侧", "path", relPath, "op", op, "reason", reason)
+		return op
+	default:
+		log.Warn("模糊匹配失败，视为冲突", "path", relPath,
+			"localSize", local.Size, "remoteSize", remote.Size)
+		return OpConflict
+	}
+	log.Info("没有同步记录，按 first_run_bias 处理", "path", relPath, "bias", e.opts.FirstRunBias, "op", op)
+	return op
+}
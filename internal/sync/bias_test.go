@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFirstRunBias(t *testing.T) {
+	for _, b := range []FirstRunBias{BiasConflict, BiasLocal, BiasRemote, BiasNewer} {
+		if got := ParseFirstRunBias(b.String()); got != b {
+			t.Errorf("ParseFirstRunBias(%q) = %s", b.String(), got)
+		}
+	}
+	if got := ParseFirstRunBias("unknown"); got != BiasConflict {
+		t.Errorf("未知值解析为 %s，应为 conflict", got)
+	}
+}
+
+func TestFirstRunBias(t *testing.T) {
+	const (
+		localA  = "local a (newer)"
+		remoteA = "remote a"
+		localB  = "local b"
+		remoteB = "remote b (newer)"
+	)
+	tests := []struct {
+		bias          FirstRunBias
+		wantA, wantB  string // 同步后两侧 a.txt、b.txt 的内容
+		wantConflicts int
+	}{
+		{BiasConflict, remoteA, remoteB, 2}, // 默认的 rename_local: 下载云端版本，本地副本改名
+		{BiasLocal, localA, localB, 0},
+		{BiasRemote, remoteA, remoteB, 0},
+		{BiasNewer, localA, remoteB, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.bias.String(), func(t *testing.T) {
+			env := newTestEnv(t)
+			later := t0.Add(time.Minute)
+			env.local.PutFile("a.txt", []byte(localA), later)
+			env.remote.PutFile("a.txt", []byte(remoteA), t0)
+			env.local.PutFile("b.txt", []byte(localB), t0)
+			env.remote.PutFile("b.txt", []byte(remoteB), later)
+			env.local.PutFile("same.txt", []byte("same"), t0)
+			env.remote.PutFile("same.txt", []byte("same"), t0)
+			e := env.engine(func(o *EngineOptions) { o.FirstRunBias = tt.bias })
+
+			result := env.run(e)
+			if result.Conflicts() != tt.wantConflicts {
+				t.Fatalf("处理了 %d 个冲突，应为 %d 个", result.Conflicts(), tt.wantConflicts)
+			}
+			wantFile(t, env.local, "a.txt", tt.wantA)
+			wantFile(t, env.remote, "a.txt", tt.wantA)
+			wantFile(t, env.local, "b.txt", tt.wantB)
+			wantFile(t, env.remote, "b.txt", tt.wantB)
+			if tt.bias == BiasConflict {
+				wantFile(t, env.local, "a.txt.local", localA)
+				wantFile(t, env.local, "b.txt.local", localB)
+			} else {
+				wantMissing(t, env.local, "a.txt.local")
+				wantMissing(t, env.local, "b.txt.local")
+			}
+			// 内容一致的文件不受 first_run_bias 影响，只重建记录
+			if moved := result.Succeeded[OpUpload] + result.Succeeded[OpDownload]; moved > 2 {
+				t.Fatalf("传输了 %d 个文件，same.txt 不应传输", moved)
+			}
+			wantState(t, env.db, "same.txt", true)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package sync
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"hash"
+	"io"
+	"log/slog"
+	"slices"
+
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+)
+
+// blockHashSize 云端大小为 storedSize 的文件需要记录分片 MD5 列表时返回分片大小，否则返回 0
+// 只有实现了 fs.BlockHasher 的后端、且文件超过其 ContentHashLimit 时才需要记录
+func (e *Engine) blockHashSize(storedSize int64) int64 {
+	bh, ok := e.opts.RemoteFS.(fs.BlockHasher)
+	if !ok || bh.ContentHashLimit() <= 0 || storedSize <= bh.ContentHashLimit() {
+		return 0
+	}
+	return bh.BlockSize()
+}
+
+// remoteBlockSize 后端需要为大文件记录分片 MD5 列表时返回分片大小，否则返回 0 (不考虑文件大小)
+func (e *Engine) remoteBlockSize() int64 {
+	bh, ok := e.opts.RemoteFS.(fs.BlockHasher)
+	if !ok || bh.ContentHashLimit() <= 0 {
+		return 0
+	}
+	return bh.BlockSize()
+}
+
+// trustedHash 云端文件列表中的 RemoteHash 是否为可靠的内容指纹
+func (e *Engine) trustedHash(r *fs.FileMeta) bool {
+	return e.opts.RemoteFS.HasContentHash() && e.blockHashSize(r.Size) == 0
+}
+
+// blockHasher 按固定大小分片计算 MD5 列表 (与百度网盘上传时的 block_list 相同)
+type blockHasher struct {
+	size int64
+	fill int64
+	h    hash.Hash
+	sums []string
+}
+
+// newBlockHasher 返回按 size 分片的 blockHasher，size 为 0 时返回 nil (不需要记录)
+// nil 的 blockHasher 可以直接使用: tee 原样返回 r，Sums 返回 nil
+func newBlockHasher(size int64) *blockHasher {
+	if size <= 0 {
+		return nil
+	}
+	return &blockHasher{size: size, h: md5.New()}
+}
+
+func (b *blockHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		chunk := min(int64(len(p)), b.size-b.fill)
+		b.h.Write(p[:chunk])
+		b.fill += chunk
+		p = p[chunk:]
+		if b.fill == b.size {
+			b.flush()
+		}
+	}
+	return n, nil
+}
+
+func (b *blockHasher) flush() {
+	b.sums = append(b.sums, hex.EncodeToString(b.h.Sum(nil)))
+	b.h.Reset()
+	b.fill = 0
+}
+
+// tee 返回读取时同时计算分片 MD5 的 Reader
+func (b *blockHasher) tee(r io.Reader) io.Reader {
+	if b == nil {
+		return r
+	}
+	return io.TeeReader(r, b)
+}
+
+// Sums 返回已写入内容的分片 MD5 列表 (最后一个分片可以不满)
+func (b *blockHasher) Sums() []string {
+	if b == nil {
+		return nil
+	}
+	if b.fill > 0 {
+		b.flush()
+	}
+	return b.sums
+}
+
+// remoteUnchanged 判断云端文件相对基准是否未变化
+// 先按 isRemoteSameAsBase 比对 (列表中的 Hash 或大小)；列表中的 Hash 对该文件不可靠 (见 fs.BlockHasher)、
+// 与记录不一致但大小相同，并且记录了分片 MD5 列表时，读取云端文件计算分片 MD5 列表与记录比对，
+// 一致说明只是后端报告的 Hash 变了，内容没有变化 (本轮结束后记录新的 Hash，见 recordSignatures)
+func (e *Engine) remoteUnchanged(ctx context.Context, log *slog.Logger, r *fs.FileMeta, b *database.FileState) bool {
+	if e.isRemoteSameAsBase(r, b) {
+		return true
+	}
+	size := e.blockHashSize(r.Size)
+	if size == 0 || len(b.RemoteBlocks) == 0 || r.Size != e.opts.RemoteFS.StoredSize(b.FileSize, e.encrypted() && !b.RemotePlain) {
+		return false
+	}
+	sums, err := e.remoteBlocks(ctx, r.RelPath, size)
+	if err != nil {
+		log.Warn("读取云端文件计算分片 MD5 失败，按已修改处理", "path", r.RelPath, "err", err)
+		return false
+	}
+	if !slices.Equal(sums, b.RemoteBlocks) {
+		return false
+	}
+	log.Info("云端大文件的 MD5 变化但分片 MD5 与记录一致，内容未变化", "path", r.RelPath,
+		"old", b.RemoteHash, "new", r.RemoteHash, "blocks", len(sums))
+	return true
+}
+
+// remoteBlocks 读取整个云端文件 (不解密)，计算分片 MD5 列表
+func (e *Engine) remoteBlocks(ctx context.Context, path string, size int64) ([]string, error) {
+	rc, err := e.opts.RemoteFS.OpenStream(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	stop := context.AfterFunc(ctx, func() { rc.Close() })
+	defer stop()
+
+	blocks := newBlockHasher(size)
+	if _, err := io.Copy(blocks, e.throttle(ctx, fs.NewContextReader(ctx, rc))); err != nil {
+		return nil, err
+	}
+	return blocks.Sums(), nil
+}
+
+// remoteHashChanged 两侧一致 (本轮不处理) 的文件，云端报告的 Hash 与记录不同，需要更新记录
+func remoteHashChanged(r *fs.FileMeta, b *database.FileState) bool {
+	return b != nil && r != nil && !r.IsDir && len(b.RemoteBlocks) > 0 && r.RemoteHash != "" && r.RemoteHash != b.RemoteHash
+}
@@ -0,0 +1,149 @@
+package sync
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs"
+	"baidusync/internal/fs/memfs"
+)
+
+// rehashFS 模拟百度网盘超过 256MB 的文件: 实现 fs.BlockHasher，超过 limit 的文件列表中的 Hash
+// 不是内容的 MD5，并且会随 salt 变化 (内容不变时也可能变化)
+type rehashFS struct {
+	*memfs.FS
+	limit, block int64
+	salt         string
+}
+
+func (f *rehashFS) ContentHashLimit() int64 { return f.limit }
+func (f *rehashFS) BlockSize() int64        { return f.block }
+
+func (f *rehashFS) rehash(m *fs.FileMeta) *fs.FileMeta {
+	if !m.IsDir && m.Size > f.limit {
+		sum := md5.Sum([]byte(m.RemoteHash + f.salt))
+		m.RemoteHash = hex.EncodeToString(sum[:])
+	}
+	return m
+}
+
+func (f *rehashFS) ListAll() (map[string]*fs.FileMeta, error) {
+	all, err := f.FS.ListAll()
+	for _, m := range all {
+		f.rehash(m)
+	}
+	return all, err
+}
+
+func (f *rehashFS) Stat(relPath string) (*fs.FileMeta, error) {
+	m, err := f.FS.Stat(relPath)
+	if err != nil {
+		return nil, err
+	}
+	return f.rehash(m), nil
+}
+
+func TestBlockHashSizeThreshold(t *testing.T) {
+	env := newTestEnv(t)
+	remote := &rehashFS{FS: env.remote, limit: 64, block: 16}
+	e := env.engine(func(o *EngineOptions) { o.RemoteFS = remote })
+
+	tests := []struct {
+		size int64
+		want int64
+	}{
+		{0, 0},
+		{64, 0}, // 等于限制时列表中的 Hash 仍然可靠
+		{65, 16},
+		{1000, 16},
+	}
+	for _, tt := range tests {
+		if got := e.blockHashSize(tt.size); got != tt.want {
+			t.Errorf("blockHashSize(%d) = %d，应为 %d", tt.size, got, tt.want)
+		}
+		if got := e.trustedHash(&fs.FileMeta{Size: tt.size}); got != (tt.want == 0) {
+			t.Errorf("trustedHash(size=%d) = %v", tt.size, got)
+		}
+	}
+
+	// 没有实现 fs.BlockHasher 的后端从不记录分片 MD5
+	if got := env.engine().blockHashSize(1 << 40); got != 0 {
+		t.Fatalf("memfs 的 blockHashSize = %d，应为 0", got)
+	}
+}
+
+func TestBlockHasherSums(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 5)) // 50 字节: 3 个满的分片与 1 个 2 字节的分片
+	b := newBlockHasher(16)
+	// 分多次写入，写入的边界与分片边界不一致
+	b.Write(data[:7])
+	b.Write(data[7:40])
+	b.Write(data[40:])
+
+	var want []string
+	for off := 0; off < len(data); off += 16 {
+		sum := md5.Sum(data[off:min(off+16, len(data))])
+		want = append(want, hex.EncodeToString(sum[:]))
+	}
+	if got := b.Sums(); !slices.Equal(got, want) {
+		t.Fatalf("Sums = %v，应为 %v", got, want)
+	}
+
+	var none *blockHasher = newBlockHasher(0)
+	if none != nil || none.Sums() != nil {
+		t.Fatal("分片大小为 0 时不应记录")
+	}
+	if r := strings.NewReader("x"); none.tee(r) != r {
+		t.Fatal("nil 的 blockHasher 应原样返回 Reader")
+	}
+}
+
+func TestLargeFileHashChangeWithoutContentChange(t *testing.T) {
+	env := newTestEnv(t)
+	remote := &rehashFS{FS: env.remote, limit: 64, block: 16, salt: "v1"}
+	e := env.engine(func(o *EngineOptions) { o.RemoteFS = remote })
+
+	large := strings.Repeat("large file ", 10) // 110 字节，超过限制
+	env.local.PutFile("large.bin", []byte(large), t0)
+	env.local.PutFile("small.txt", []byte("small"), t0)
+	env.remote.PutFile("remote-large.bin", []byte(strings.Repeat("from cloud ", 10)), t0)
+	env.run(e)
+
+	// 列表中的 Hash 不是内容的 MD5，下载时不能用它校验
+	wantFile(t, env.local, "remote-large.bin", strings.Repeat("from cloud ", 10))
+	if state := wantState(t, env.db, "large.bin", true); len(state.RemoteBlocks) != 7 {
+		t.Fatalf("记录了 %d 个分片 MD5，应为 7 个", len(state.RemoteBlocks))
+	}
+	if state := wantState(t, env.db, "small.txt", true); len(state.RemoteBlocks) != 0 {
+		t.Fatal("小文件不应记录分片 MD5")
+	}
+	env.wantIdle(e)
+
+	// 云端报告的 Hash 变了，内容没有变化: 不下载，只更新记录
+	remote.salt = "v2"
+	result := env.run(e)
+	if succeeded, failed := result.Total(); succeeded+failed != 0 {
+		t.Fatalf("Hash 变化但内容未变时执行了 %d 个任务", succeeded+failed)
+	}
+	if state := wantState(t, env.db, "large.bin", true); state.RemoteHash != remote.rehash(&fs.FileMeta{Size: 110, RemoteHash: md5Hex(large)}).RemoteHash {
+		t.Fatalf("记录的 Hash 为 %s，应更新为云端新的 Hash", state.RemoteHash)
+	}
+	env.wantIdle(e)
+
+	// 大小不变、内容真的变化时下载
+	env.advance(time.Minute)
+	changed := strings.Repeat("LARGE FILE ", 10)
+	env.remote.PutFile("large.bin", []byte(changed), env.now)
+	env.run(e)
+	wantFile(t, env.local, "large.bin", changed)
+	env.wantIdle(e)
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
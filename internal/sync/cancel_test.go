@@ -0,0 +1,123 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs/memfs"
+)
+
+// blockingFS 每次上传开始时通知 started，然后等待 release 关闭后再写入
+type blockingFS struct {
+	*memfs.FS
+	started chan string
+	release chan struct{}
+}
+
+func (b *blockingFS) WriteStream(relPath string, stream io.Reader, modTime time.Time) (string, error) {
+	b.started <- relPath
+	<-b.release
+	return b.FS.WriteStream(relPath, stream, modTime)
+}
+
+// queuedUploads 准备 n 个待上传的文件，云端每个上传都会阻塞
+func queuedUploads(t *testing.T, n int) (*testEnv, *blockingFS) {
+	t.Helper()
+	env := newTestEnv(t)
+	for i := range n {
+		env.local.PutFile(fmt.Sprintf("f%02d.txt", i), []byte("data"), t0)
+	}
+	return env, &blockingFS{FS: env.remote, started: make(chan string, n), release: make(chan struct{})}
+}
+
+func TestCancelWithQueuedTasks(t *testing.T) {
+	const n, workers = 20, 2
+	env, remote := queuedUploads(t, n)
+	e := env.engine(func(o *EngineOptions) {
+		o.RemoteFS = remote
+		o.MaxWorkers = workers
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var result *RunResult
+	var err error
+	done := make(chan struct{})
+	go func() {
+		result, err = e.Run(ctx)
+		close(done)
+	}()
+	for range workers {
+		<-remote.started
+	}
+	// 两个 Worker 正在上传，其余任务还在队列中
+	cancel()
+	close(remote.release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("取消后 Run 没有返回")
+	}
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("错误为 %v，应为 context.Canceled", err)
+	}
+	succeeded, failed := result.Total()
+	if succeeded+failed+result.Deferred != n {
+		t.Fatalf("成功 %d、失败 %d、推迟 %d 个，总数应为 %d", succeeded, failed, result.Deferred, n)
+	}
+	if result.Deferred < n-workers {
+		t.Fatalf("推迟 %d 个，队列中的 %d 个任务都应推迟", result.Deferred, n-workers)
+	}
+	if len(remote.started) != 0 {
+		t.Fatalf("取消后又开始了 %d 个上传", len(remote.started))
+	}
+
+	// 下一轮补上全部剩余的文件
+	env.run(env.engine())
+	for i := range n {
+		wantFile(t, env.remote, fmt.Sprintf("f%02d.txt", i), "data")
+	}
+}
+
+func TestGracefulStopWithQueuedTasks(t *testing.T) {
+	const n, workers = 20, 2
+	env, remote := queuedUploads(t, n)
+	e := env.engine(func(o *EngineOptions) {
+		o.RemoteFS = remote
+		o.MaxWorkers = workers
+	})
+
+	ctx, stop := WithGracefulStop(context.Background())
+	var result *RunResult
+	var err error
+	done := make(chan struct{})
+	go func() {
+		result, err = e.Run(ctx)
+		close(done)
+	}()
+	for range workers {
+		<-remote.started
+	}
+	stop()
+	close(remote.release)
+	<-done
+
+	// 正在执行的任务正常完成，队列中的任务全部推迟
+	if !errors.Is(err, ErrStopped) {
+		t.Fatalf("错误为 %v，应为 ErrStopped", err)
+	}
+	if result.Succeeded[OpUpload] != workers || result.Deferred != n-workers {
+		t.Fatalf("成功 %d 个、推迟 %d 个，应为 %d 与 %d 个", result.Succeeded[OpUpload], result.Deferred, workers, n-workers)
+	}
+	if len(remote.started) != 0 {
+		t.Fatalf("停止后又开始了 %d 个上传", len(remote.started))
+	}
+	result = env.run(env.engine())
+	if result.Succeeded[OpUpload] != n-workers {
+		t.Fatalf("下一轮上传 %d 个，应为 %d 个", result.Succeeded[OpUpload], n-workers)
+	}
+}
@@ -0,0 +1,73 @@
+package sync
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs/memfs"
+)
+
+// writingFS 模拟上传过程中另一个程序写入文件: 第一次读完 target 时把内容替换为 next
+type writingFS struct {
+	*memfs.FS
+	env    *testEnv
+	target string
+	next   string
+	done   bool
+}
+
+func (f *writingFS) OpenStream(relPath string) (io.ReadCloser, error) {
+	rc, err := f.FS.OpenStream(relPath)
+	if err != nil || relPath != f.target || f.done {
+		return rc, err
+	}
+	f.done = true
+	return struct {
+		io.Reader
+		io.Closer
+	}{&writeOnEOF{r: rc, write: func() {
+		f.env.advance(time.Second)
+		f.FS.PutFile(relPath, []byte(f.next), f.env.now)
+	}}, rc}, nil
+}
+
+type writeOnEOF struct {
+	r     io.Reader
+	write func()
+}
+
+func (w *writeOnEOF) Read(p []byte) (int, error) {
+	n, err := w.r.Read(p)
+	if err == io.EOF && w.write != nil {
+		w.write()
+		w.write = nil
+	}
+	return n, err
+}
+
+func TestUploadFileChangedDuringUpload(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("log.txt", []byte("first line"), t0)
+	e := env.engine(func(o *EngineOptions) {
+		o.LocalFS = &writingFS{FS: env.local, env: env, target: "log.txt", next: "first line\nsecond line"}
+		o.MaxWorkers = 1
+	})
+
+	env.run(e)
+	// 云端是读取时的内容，记录按实际上传的内容保存，修改时间置零
+	wantFile(t, env.remote, "log.txt", "first line")
+	state := wantState(t, env.db, "log.txt", true)
+	if state.ModTime != 0 || state.FileSize != int64(len("first line")) || state.LocalHash != md5Hex("first line") {
+		t.Fatalf("记录为 %+v，应按上传的内容记录并把修改时间置零", state)
+	}
+
+	// 下一轮判定为本地修改并上传最新内容，而不是冲突
+	result := env.run(e)
+	if result.Succeeded[OpUpload] != 1 || result.Conflicts() != 0 {
+		t.Fatalf("上传 %d 个、冲突 %d 个，应只上传 1 个", result.Succeeded[OpUpload], result.Conflicts())
+	}
+	wantFile(t, env.remote, "log.txt", "first line\nsecond line")
+	wantFile(t, env.local, "log.txt", "first line\nsecond line")
+	env.wantIdle(e)
+}
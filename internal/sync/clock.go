@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"baidusync/internal/fs"
+)
+
+// clockProbeName 测量时钟偏差时上传到云端根目录的探测文件，测量后立即删除
+// 程序在测量中途退出时可能残留，因此开启测量时两侧扫描都会排除它
+const clockProbeName = ".baidusync-clock-probe"
+
+// MeasureClockSkew 上传一个探测文件，比较云端记录的修改时间与本机时间，返回偏差 (云端时间 - 本机时间)
+// 本机时间取上传前后的中点；百度网盘的时间精度为秒，因此结果有 1 秒左右的误差
+func (e *Engine) MeasureClockSkew(ctx context.Context) (time.Duration, error) {
+	before := time.Now()
+	// modTime 为零值: 由后端自己记录时间，而不是沿用本机时间
+	_, err := fs.WriteStreamWithOptions(e.opts.RemoteFS, clockProbeName, strings.NewReader("baidusync"), time.Time{}, &fs.WriteOptions{
+		Context: ctx,
+		OnExist: fs.ExistOverwrite,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("上传探测文件失败: %w", err)
+	}
+	after := time.Now()
+	defer func() {
+		if err := e.opts.RemoteFS.Delete(clockProbeName); err != nil {
+			e.opts.Logger.Warn("删除时钟探测文件失败", "path", clockProbeName, "err", err)
+		}
+	}()
+
+	meta, err := e.opts.RemoteFS.Stat(clockProbeName)
+	if err != nil {
+		return 0, fmt.Errorf("读取探测文件信息失败: %w", err)
+	}
+	local := before.Add(after.Sub(before) / 2)
+	return meta.ModTime.Sub(local).Truncate(time.Second), nil
+}
+
+// checkClockSkew 测量时钟偏差并记录到数据库，偏差超过 ClockSkewThreshold 时警告
+// 测量失败只记录日志，不影响同步
+func (e *Engine) checkClockSkew(ctx context.Context) {
+	threshold := e.opts.ClockSkewThreshold
+	if threshold <= 0 {
+		return
+	}
+	skew, err := e.MeasureClockSkew(ctx)
+	if err != nil {
+		e.opts.Logger.Warn("测量时钟偏差失败", "err", err)
+		return
+	}
+	if err := e.opts.StateDB.SaveClockSkew(skew); err != nil {
+		e.opts.Logger.Warn("记录时钟偏差失败", "err", err)
+	}
+
+	skewed := skew.Abs() > threshold
+	e.clockSkewed.Store(skewed && e.opts.ClockSkewHashOnly)
+	if !skewed {
+		e.opts.Logger.Info("时钟偏差正常", "skew", skew, "threshold", threshold)
+		return
+	}
+	e.opts.Logger.Warn("!!! 本机时钟与云端相差过大，keep_latest 等依赖修改时间的判断可能选错同步方向，请校准系统时间 !!!",
+		"skew", skew,
+		"threshold", threshold,
+		"hash_only", e.opts.ClockSkewHashOnly,
+	)
+}
@@ -0,0 +1,50 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs"
+	"baidusync/internal/fs/memfs"
+)
+
+// appearingFS 模拟上传时另一台设备抢先上传了同名文件: 以 fs.ExistFail 写入 relPath 时云端先出现 data，
+// 然后像百度网盘 rtype=0 返回 errno -8 一样以 fs.ErrExist 失败
+type appearingFS struct {
+	*memfs.FS
+	relPath string
+	data    []byte
+}
+
+func (f *appearingFS) WriteStreamWithOptions(relPath string, stream io.Reader, modTime time.Time, opts *fs.WriteOptions) (string, error) {
+	if relPath == f.relPath && opts.OnExist == fs.ExistFail {
+		if !f.Exists(relPath) {
+			f.PutFile(relPath, f.data, modTime)
+		}
+		return "", fmt.Errorf("create file error: errno=-8: %w", fs.ErrExist)
+	}
+	return f.WriteStream(relPath, stream, modTime)
+}
+
+func TestUploadFileExistsResolvedAsConflict(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("mine"), t0)
+	e := env.engine(func(o *EngineOptions) {
+		o.RemoteFS = &appearingFS{FS: env.remote, relPath: "a.txt", data: []byte("theirs")}
+	})
+
+	// 不覆盖云端出现的文件，也不让任务失败，而是立即按冲突策略 (rename_local) 处理
+	result := env.run(e)
+	if result.Failed[OpUpload] != 0 {
+		t.Fatalf("%d 个上传失败", result.Failed[OpUpload])
+	}
+	wantFile(t, env.remote, "a.txt", "theirs")
+	wantFile(t, env.local, "a.txt", "theirs")
+	wantFile(t, env.local, "a.txt.local", "mine")
+
+	env.run(e)
+	wantFile(t, env.remote, "a.txt.local", "mine")
+	env.wantIdle(e)
+}
@@ -0,0 +1,80 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	pathpkg "path"
+	"strconv"
+	"strings"
+	"time"
+
+	"baidusync/internal/fs"
+)
+
+// DefaultConflictName 默认的冲突文件命名模板，与早期版本的 ".local" / ".remote" 后缀一致
+const DefaultConflictName = "{name}{ext}.{side}"
+
+// maxConflictCopies 同一路径最多尝试的序号，超过后放弃处理该冲突
+const maxConflictCopies = 1000
+
+// renderConflictName 按模板生成 rename_local / rename_remote 策略的新文件名，只改写文件名，目录保持不变
+// 占位符: {name} 不含扩展名的文件名、{ext} 扩展名 (含 ".")、{side} local 或 remote、{timestamp} 当前时间
+// "docs/report.pdf" + "{name}.conflict-{side}-{timestamp}{ext}" -> "docs/report.conflict-local-20060102-150405.pdf"
+func renderConflictName(template, relPath, side string, t time.Time) string {
+	if template == "" {
+		template = DefaultConflictName
+	}
+	dir, base := pathpkg.Split(relPath)
+	ext := fileExt(base)
+	name := strings.NewReplacer(
+		"{name}", strings.TrimSuffix(base, ext),
+		"{ext}", ext,
+		"{side}", side,
+		"{timestamp}", t.Format("20060102-150405"),
+	).Replace(template)
+	return dir + name
+}
+
+// fileExt 返回文件名的扩展名，".bashrc" 这类隐藏文件没有扩展名
+func fileExt(base string) string {
+	ext := pathpkg.Ext(base)
+	if ext == base {
+		return ""
+	}
+	return ext
+}
+
+// freeConflictName 返回两侧都不存在的冲突文件名
+// candidate 已被占用 (例如同一文件再次冲突) 时在扩展名前追加序号: "report.conflict.pdf" -> "report.conflict-2.pdf"
+// 冲突副本随后会同步到另一侧，因此两侧都要检查，避免覆盖之前留下的副本
+func (e *Engine) freeConflictName(candidate string) (string, error) {
+	ext := fileExt(pathpkg.Base(candidate))
+	stem := strings.TrimSuffix(candidate, ext)
+
+	name := candidate
+	for n := 2; n <= maxConflictCopies; n++ {
+		taken, err := e.nameTaken(name)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return name, nil
+		}
+		name = stem + "-" + strconv.Itoa(n) + ext
+	}
+	return "", fmt.Errorf("冲突副本过多，无法为 %s 生成新的文件名", candidate)
+}
+
+// nameTaken 路径在本地或云端是否已经存在
+func (e *Engine) nameTaken(relPath string) (bool, error) {
+	for _, side := range []fs.FileSystem{e.opts.LocalFS, e.opts.RemoteFS} {
+		_, err := side.Stat(relPath)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false, fmt.Errorf("检查 %s 是否存在失败: %w", relPath, err)
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRenderConflictName(t *testing.T) {
+	at := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	tests := []struct {
+		template, relPath, side, want string
+	}{
+		{"", "docs/a.txt", "local", "docs/a.txt.local"},
+		{"", "a.txt", "remote", "a.txt.remote"},
+		{"{name}.conflict-{side}-{timestamp}{ext}", "docs/report.pdf", "local", "docs/report.conflict-local-20240501-083000.pdf"},
+		{"{name}.conflict-{side}{ext}", ".bashrc", "remote", ".bashrc.conflict-remote"},
+		{"{name}.conflict-{side}{ext}", "archive.tar.gz", "local", "archive.tar.conflict-local.gz"},
+	}
+	for _, tt := range tests {
+		if got := renderConflictName(tt.template, tt.relPath, tt.side, at); got != tt.want {
+			t.Errorf("renderConflictName(%q, %q, %q) = %q，应为 %q", tt.template, tt.relPath, tt.side, got, tt.want)
+		}
+	}
+}
+
+// conflictAgain 让 relPath 在两侧同时被修改，然后同步两轮 (第二轮上传改名后的副本)
+func conflictAgain(t *testing.T, env *testEnv, e *Engine, relPath string, round int) {
+	t.Helper()
+	env.advance(time.Minute)
+	env.local.PutFile(relPath, []byte(fmt.Sprintf("local %d", round)), env.now)
+	env.remote.PutFile(relPath, []byte(fmt.Sprintf("remote %d", round)), env.now)
+	if result := env.run(e); result.Conflicts() != 1 {
+		t.Fatalf("第 %d 次冲突处理了 %d 个冲突", round, result.Conflicts())
+	}
+	env.run(e)
+}
+
+func TestRepeatedConflictsRenameLocal(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("v1"), t0)
+	e := env.engine()
+	env.run(e)
+
+	for round := 1; round <= 3; round++ {
+		conflictAgain(t, env, e, "a.txt", round)
+	}
+	// 之前的副本不会被覆盖，按序号依次保留
+	for i, name := range []string{"a.txt.local", "a.txt-2.local", "a.txt-3.local"} {
+		want := fmt.Sprintf("local %d", i+1)
+		wantFile(t, env.local, name, want)
+		wantFile(t, env.remote, name, want)
+	}
+	wantFile(t, env.local, "a.txt", "remote 3")
+	env.wantIdle(e)
+}
+
+func TestRepeatedConflictsRenameRemoteTemplate(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("docs/report.pdf", []byte("v1"), t0)
+	e := env.engine(func(o *EngineOptions) {
+		o.ConflictStrategy = StrategyRenameRemote
+		o.ConflictName = "{name}.conflict-{side}{ext}"
+	})
+	env.run(e)
+
+	for round := 1; round <= 3; round++ {
+		conflictAgain(t, env, e, "docs/report.pdf", round)
+	}
+	for i, name := range []string{"docs/report.conflict-remote.pdf", "docs/report.conflict-remote-2.pdf", "docs/report.conflict-remote-3.pdf"} {
+		want := fmt.Sprintf("remote %d", i+1)
+		wantFile(t, env.remote, name, want)
+		wantFile(t, env.local, name, want)
+	}
+	wantFile(t, env.remote, "docs/report.pdf", "local 3")
+	env.wantIdle(e)
+}
@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"errors"
+	"log/slog"
+
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+)
+
+// copySources 本轮两侧一致的文件，按明文大小与本地 Hash 索引: size -> hash -> 路径
+// 新增的本地文件与其中某个文件内容相同 (例如复制了一份) 时，可以在云端直接复制，而不是重新上传
+type copySources map[int64]map[string]string
+
+// add 记录一个两侧一致、可以作为复制来源的文件
+func (s copySources) add(path string, b *database.FileState) {
+	if b.IsDir || b.FileSize == 0 || b.LocalHash == "" {
+		return
+	}
+	byHash := s[b.FileSize]
+	if byHash == nil {
+		byHash = make(map[string]string)
+		s[b.FileSize] = byHash
+	}
+	if _, ok := byHash[b.LocalHash]; !ok {
+		byHash[b.LocalHash] = path
+	}
+}
+
+// markCopies 为云端没有同名文件的上传任务附上大小相同的候选来源
+// 扫描时本地文件还没有计算 Hash，是否真的相同要等执行时计算后才能确定 (见 tryCopy)
+func (e *Engine) markCopies(plan *Plan, sources copySources) {
+	if len(sources) == 0 {
+		return
+	}
+	for i := range plan.Tasks {
+		t := &plan.Tasks[i]
+		if t.Op != OpUpload || t.Remote != nil || t.Local == nil {
+			continue
+		}
+		if byHash := sources[t.Local.Size]; byHash != nil {
+			t.copyFrom = byHash
+		}
+	}
+}
+
+// tryCopy 新文件与云端已有的某个文件内容相同时，在云端复制该文件代替上传
+// copied 为 false 表示没有复制 (内容不同、复制失败等)，调用方继续按普通上传处理
+func (e *Engine) tryCopy(log *slog.Logger, t Task) (copied bool, err error) {
+	copier, ok := e.opts.RemoteFS.(fs.Copier)
+	if !ok || len(t.copyFrom) == 0 {
+		return false, nil
+	}
+	local, err := e.opts.LocalFS.Stat(t.RelPath)
+	if err != nil || local.Hash == "" {
+		return false, nil
+	}
+	src, ok := t.copyFrom[local.Hash]
+	if !ok {
+		return false, nil
+	}
+	base, err := e.opts.StateDB.Get(e.dbKey(src))
+	if err != nil || base == nil || base.LocalHash != local.Hash {
+		return false, nil
+	}
+
+	if err := copier.Copy(src, t.RelPath); err != nil {
+		if !errors.Is(err, fs.ErrExist) {
+			log.Warn("云端复制失败，改为上传", "from", src, "to", t.RelPath, "err", err)
+		}
+		return false, nil
+	}
+	log.Info("内容与云端已有文件相同，已在云端复制", "from", src, "to", t.RelPath, "bytes_saved", local.Size)
+
+	state := &database.FileState{
+		RelPath:      e.dbKey(t.RelPath),
+		FileSize:     local.Size,
+		ModTime:      local.ModTime.UnixNano(),
+		LocalHash:    local.Hash,
+		RemoteHash:   base.RemoteHash, // 复制的是同一份云端内容
+		RemoteBlocks: base.RemoteBlocks,
+		Mode:         e.fileMode(local),
+		FileID:       local.FileID,
+	}
+	return true, e.putState(state)
+}
@@ -0,0 +1,218 @@
+package sync
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"baidusync/internal/crypto"
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+)
+
+var (
+	// ErrWrongKey 云端文件可以解密，但解密结果与同步记录中的内容不符，说明上传时使用的是另一个密钥
+	ErrWrongKey = errors.New("解密失败: 密钥与上传时使用的不同")
+	// ErrCorruptCiphertext 云端文件不是有效的密文 (被截断、损坏，或根本没有加密)
+	ErrCorruptCiphertext = errors.New("解密失败: 云端文件不是有效的密文")
+)
+
+// 隔离原因 (database.QuarantineEntry.Reason)
+const (
+	quarantineWrongKey = "wrong_key"
+	quarantineCorrupt  = "corrupt"
+)
+
+// decryptFailure 返回解密失败的原因，err 不是解密失败时返回空字符串
+func decryptFailure(err error) string {
+	switch {
+	case errors.Is(err, ErrWrongKey):
+		return quarantineWrongKey
+	case errors.Is(err, ErrCorruptCiphertext):
+		return quarantineCorrupt
+	}
+	return ""
+}
+
+// checkPlaintext 改名为目标文件之前确认 .part 的解密结果，密钥不正确时删除 .part 并返回 ErrWrongKey
+// 内容加密 (AES-CTR) 没有校验码，用错密钥也能“解密”出同样长度的乱码，所以只有解密结果可以参照时才能判断:
+// 云端文件与同步记录中的一致 (记录了上次同步时的明文 Hash)，解密出的内容却与记录不同；
+// 云端文件已经变化时没有可以参照的明文，改为用本轮另一个两侧一致的文件确认密钥 (见 checkKey)
+func (e *Engine) checkPlaintext(ctx context.Context, log *slog.Logger, path string, remote *fs.FileMeta, base *database.FileState, blocks []string, localHash string) error {
+	if base == nil || base.IsDir || base.RemotePlain || base.LocalHash == "" || !fs.SameHashAlgorithm(localHash, base.LocalHash) {
+		return e.checkKey(ctx, log, path)
+	}
+	sameRemote := remote.RemoteHash != "" && remote.RemoteHash == base.RemoteHash && e.trustedHash(remote)
+	if !sameRemote && (len(blocks) == 0 || !slices.Equal(blocks, base.RemoteBlocks)) {
+		return e.checkKey(ctx, log, path)
+	}
+	if localHash == base.LocalHash {
+		return nil
+	}
+	e.discardPartial(log, path)
+	return ErrWrongKey
+}
+
+// keyRefMinSize 作为密钥参照的文件的最小明文大小
+// 太短的内容用错误的密钥解密也可能碰巧与原文一致 (空文件总是一致)
+const keyRefMinSize = 16
+
+// keyRef 用于确认密钥的参照文件: 两侧一致、云端是加密文件，并且记录中有明文 Hash 与可靠的云端 MD5
+type keyRef struct {
+	path string
+	base *database.FileState
+}
+
+// keyCheck 一轮同步中用参照文件确认密钥的结果，整轮只检查一次
+type keyCheck struct {
+	ref  *keyRef
+	once sync.Once
+	err  error
+}
+
+// pickKeyRef 扫描时记录可以作为密钥参照的文件，多个时选最小的，检查时下载的数据最少
+func (e *Engine) pickKeyRef(plan *Plan, path string, r *fs.FileMeta, b *database.FileState) {
+	if !e.encrypted() || e.keyVerified.Load() || r == nil || r.IsDir || b == nil || b.IsDir {
+		return
+	}
+	if b.LocalHash == "" || b.FileSize < keyRefMinSize || e.remotePlain(r, b) ||
+		r.RemoteHash == "" || r.RemoteHash != b.RemoteHash || !e.verifiable(r) {
+		return
+	}
+	if plan.keyRef == nil || b.FileSize < plan.keyRef.base.FileSize {
+		plan.keyRef = &keyRef{path: path, base: b}
+	}
+}
+
+// checkKey 下载的文件没有可以参照的明文时，用本轮扫描到的参照文件确认密钥
+// 下载参照文件、解密后与记录中的明文 Hash 比较，不一致说明密钥与上传时使用的不同，删除 .part 并返回 ErrWrongKey；
+// 没有参照文件 (例如首次同步) 或检查本身失败时无法判断，不阻止下载
+// 确认密钥正确之后不再检查 (密钥不能热更新)
+func (e *Engine) checkKey(ctx context.Context, log *slog.Logger, path string) error {
+	if e.keyVerified.Load() {
+		return nil
+	}
+	kc := e.keyCheck.Load()
+	if kc == nil || kc.ref == nil {
+		return nil
+	}
+	kc.once.Do(func() {
+		kc.err = e.probeKey(ctx, e.opts.RemoteFS, kc.ref, e.opts.EncryptKey)
+		switch {
+		case kc.err == nil:
+			e.keyVerified.Store(true)
+			log.Debug("已用参照文件确认密钥", "ref", kc.ref.path)
+		case errors.Is(kc.err, ErrWrongKey):
+			log.Error("参照文件解密后与记录不符，密钥与上传时使用的不同", "ref", kc.ref.path)
+		default:
+			log.Warn("无法用参照文件确认密钥", "ref", kc.ref.path, "err", kc.err)
+			kc.err = nil
+		}
+	})
+	if kc.err != nil {
+		e.discardPartial(log, path)
+	}
+	return kc.err
+}
+
+// probeKey 从 fsys 下载参照文件并用 key 解密，明文 Hash 与记录不一致时返回 ErrWrongKey
+// 下载内容的 MD5 与记录不一致说明参照文件在扫描之后被修改，无法判断
+func (e *Engine) probeKey(ctx context.Context, fsys fs.FileSystem, ref *keyRef, key []byte) error {
+	rc, err := fsys.OpenStream(ref.path)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	stored := md5.New()
+	dec, err := crypto.NewDecryptReader(io.TeeReader(fs.NewContextReader(ctx, rc), stored), key)
+	if err != nil {
+		return err
+	}
+	plain, err := fs.NewHash(fs.HashAlgorithmOf(e.opts.LocalFS))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(plain, dec); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(stored.Sum(nil)); !strings.EqualFold(got, ref.base.RemoteHash) {
+		return fmt.Errorf("参照文件 %s 在扫描之后被修改", ref.path)
+	}
+	got := hex.EncodeToString(plain.Sum(nil))
+	if !fs.SameHashAlgorithm(got, ref.base.LocalHash) {
+		return fmt.Errorf("参照文件 %s 的记录使用的是另一种 Hash 算法", ref.path)
+	}
+	if got != ref.base.LocalHash {
+		return ErrWrongKey
+	}
+	return nil
+}
+
+// quarantine 开启 QuarantineUndecryptable 时记录无法解密的云端文件，云端文件变化之前不再尝试下载
+// err 不是解密失败时什么也不做；返回 err 本身
+func (e *Engine) quarantine(log *slog.Logger, path string, remote *fs.FileMeta, err error) error {
+	reason := decryptFailure(err)
+	if reason == "" || !e.opts.QuarantineUndecryptable {
+		return err
+	}
+	entry := &database.QuarantineEntry{
+		RemoteHash: remote.RemoteHash,
+		RemoteSize: remote.Size,
+		Reason:     reason,
+		Error:      err.Error(),
+		Time:       e.now().UnixNano(),
+	}
+	if perr := e.opts.StateDB.PutQuarantine(e.dbKey(path), entry); perr != nil {
+		log.Warn("记录隔离失败", "path", path, "err", perr)
+		return err
+	}
+	log.Warn("云端文件无法解密，已隔离，云端文件变化之前不再下载", "path", path, "reason", reason)
+	return err
+}
+
+// releaseQuarantine 下载成功后解除隔离 (云端文件已变化，或换回了正确的密钥)
+func (e *Engine) releaseQuarantine(log *slog.Logger, path string) {
+	if !e.opts.QuarantineUndecryptable {
+		return
+	}
+	if err := e.opts.StateDB.DeleteQuarantine(e.dbKey(path)); err != nil {
+		log.Warn("解除隔离失败", "path", path, "err", err)
+	}
+}
+
+// holdQuarantined 跳过已隔离、且云端文件自隔离以来没有变化的下载任务 (冲突任务同样需要下载云端版本，一并跳过)
+func (e *Engine) holdQuarantined(log *slog.Logger, plan *Plan) {
+	if !e.opts.QuarantineUndecryptable {
+		return
+	}
+	entries, err := e.opts.StateDB.Quarantined()
+	if err != nil {
+		log.Warn("读取隔离记录失败，本轮不跳过隔离的文件", "err", err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+	kept := plan.Tasks[:0]
+	for _, t := range plan.Tasks {
+		q := entries[e.dbKey(t.RelPath)]
+		if q != nil && (t.Op == OpDownload || t.Op == OpConflict) && t.Remote != nil &&
+			t.Remote.RemoteHash == q.RemoteHash && t.Remote.Size == q.RemoteSize {
+			plan.Quarantined = append(plan.Quarantined, t)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	plan.Tasks = kept
+	if len(plan.Quarantined) > 0 {
+		log.Warn("跳过已隔离的无法解密的云端文件 (云端文件变化后自动恢复)", "count", len(plan.Quarantined))
+	}
+}
@@ -0,0 +1,201 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"baidusync/internal/crypto"
+	"baidusync/internal/fs"
+	"baidusync/internal/fs/memfs"
+)
+
+var (
+	keyA = bytes.Repeat([]byte{0xA}, 32)
+	keyB = bytes.Repeat([]byte{0xB}, 32)
+)
+
+// encryptFor 用 key 加密 plain，得到存入云端的内容
+func encryptFor(t *testing.T, plain string, key []byte) []byte {
+	t.Helper()
+	r, err := crypto.NewEncryptReader(strings.NewReader(plain), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// withKey 设置加密密钥
+func withKey(key []byte) func(*EngineOptions) {
+	return func(o *EngineOptions) { o.EncryptKey = key }
+}
+
+// withQuarantine 开启隔离无法解密的文件
+func withQuarantine(o *EngineOptions) {
+	o.QuarantineUndecryptable = true
+}
+
+// wantNoPartial 检查本地没有留下未完成的下载
+func wantNoPartial(t *testing.T, env *testEnv, relPath string) {
+	t.Helper()
+	wantMissing(t, env.local, relPath+fs.PartSuffix)
+}
+
+func TestDownloadWithWrongKeyKeepsLocalFile(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("ref.txt", []byte(strings.Repeat("reference ", 8)), t0)
+	env.local.PutFile("a.txt", []byte("version 1"), t0)
+	env.run(env.engine(withKey(keyA)))
+	before := wantState(t, env.db, "a.txt", true)
+
+	// 另一台设备用同一个密钥更新了云端文件，本机却配置了另一个密钥
+	env.advance(time.Minute)
+	env.remote.PutFile("a.txt", encryptFor(t, "version 2", keyA), env.now)
+	wrong := env.engine(withKey(keyB), withQuarantine)
+
+	_, err := env.runErr(wrong)
+	if !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("错误为 %v，应为 ErrWrongKey", err)
+	}
+	wantFile(t, env.local, "a.txt", "version 1")
+	wantNoPartial(t, env, "a.txt")
+	if after := wantState(t, env.db, "a.txt", true); after.RemoteHash != before.RemoteHash {
+		t.Fatal("解密失败后不应更新同步记录")
+	}
+	quarantined, err := env.db.Quarantined()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := quarantined["a.txt"]; q == nil || q.Reason != quarantineWrongKey {
+		t.Fatalf("隔离记录为 %+v，应为 wrong_key", q)
+	}
+
+	// 隔离后云端文件不变时不再尝试下载
+	if _, err := env.runErr(wrong); err != nil {
+		t.Fatalf("隔离后仍然失败: %v", err)
+	}
+
+	// 换回正确的密钥后正常下载
+	env.run(env.engine(withKey(keyA)))
+	wantFile(t, env.local, "a.txt", "version 2")
+}
+
+func TestDownloadWithCorrectKeyPassesKeyCheck(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("ref.txt", []byte(strings.Repeat("reference ", 8)), t0)
+	env.local.PutFile("a.txt", []byte("version 1"), t0)
+	e := env.engine(withKey(keyA))
+	env.run(e)
+
+	env.advance(time.Minute)
+	env.remote.PutFile("a.txt", encryptFor(t, "version 2", keyA), env.now)
+	env.run(e)
+	wantFile(t, env.local, "a.txt", "version 2")
+	wantNoPartial(t, env, "a.txt")
+	if !e.keyVerified.Load() {
+		t.Fatal("应已用参照文件确认密钥")
+	}
+}
+
+func TestDownloadTruncatedCiphertext(t *testing.T) {
+	env := newTestEnv(t)
+	// 比密文头部还短，不可能是加密文件
+	env.remote.PutFile("short.bin", []byte("abcde"), t0)
+	e := env.engine(withKey(keyA), withQuarantine)
+
+	_, err := env.runErr(e)
+	if !errors.Is(err, ErrCorruptCiphertext) {
+		t.Fatalf("错误为 %v，应为 ErrCorruptCiphertext", err)
+	}
+	wantMissing(t, env.local, "short.bin")
+	wantNoPartial(t, env, "short.bin")
+	wantState(t, env.db, "short.bin", false)
+
+	quarantined, err := env.db.Quarantined()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := quarantined["short.bin"]; q == nil || q.Reason != quarantineCorrupt {
+		t.Fatalf("隔离记录为 %+v，应为 corrupt", q)
+	}
+	if _, err := env.runErr(e); err != nil {
+		t.Fatalf("隔离后仍然失败: %v", err)
+	}
+}
+
+// truncatingFS 读取文件时只返回前 limit 字节，模拟总是提前结束的下载
+type truncatingFS struct {
+	*memfs.FS
+	limit int64
+}
+
+func (f *truncatingFS) OpenStream(relPath string) (io.ReadCloser, error) {
+	rc, err := f.FS.OpenStream(relPath)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, f.limit), rc}, nil
+}
+
+func TestDownloadTruncatedStreamLeavesNoOutput(t *testing.T) {
+	shortenRetryDelay(t)
+	env := newTestEnv(t)
+	env.remote.PutFile("a.bin", encryptFor(t, strings.Repeat("x", 100), keyA), t0)
+	e := env.engine(withKey(keyA), func(o *EngineOptions) {
+		o.RemoteFS = &truncatingFS{FS: env.remote, limit: 40}
+		o.DownloadRetries = 1
+	})
+
+	if _, err := env.runErr(e); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("错误为 %v，应为 io.ErrUnexpectedEOF", err)
+	}
+	wantMissing(t, env.local, "a.bin")
+	wantNoPartial(t, env, "a.bin")
+	wantState(t, env.db, "a.bin", false)
+}
+
+// flippingFS 读取文件时翻转第 offset 个字节，模拟传输中损坏的下载
+type flippingFS struct {
+	*memfs.FS
+	offset int
+}
+
+func (f *flippingFS) OpenStream(relPath string) (io.ReadCloser, error) {
+	data, ok := f.ReadFile(relPath)
+	if !ok {
+		return f.FS.OpenStream(relPath)
+	}
+	if f.offset < len(data) {
+		data[f.offset] ^= 0xFF
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestDownloadCorruptedInTransitKeepsLocalFile(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("version 1"), t0)
+	env.run(env.engine(withKey(keyA)))
+
+	env.advance(time.Minute)
+	env.remote.PutFile("a.txt", encryptFor(t, "version 2", keyA), env.now)
+	e := env.engine(withKey(keyA), func(o *EngineOptions) {
+		o.RemoteFS = &flippingFS{FS: env.remote, offset: crypto.HeaderSize + 1}
+	})
+
+	_, err := env.runErr(e)
+	if err == nil || !strings.Contains(err.Error(), "校验失败") {
+		t.Fatalf("错误为 %v，应为 MD5 校验失败", err)
+	}
+	wantFile(t, env.local, "a.txt", "version 1")
+	wantNoPartial(t, env, "a.txt")
+}
@@ -3,79 +3,130 @@ package sync
 import (
 	"baidusync/internal/database"
 	"baidusync/internal/fs"
+	"context"
 	"log/slog"
 	"time"
 )
 
-// 如果你的 crypto 包没有导出 HeaderSize，也可以在这里定义
-// 假设前面的 crypto 实现是 [MD5(32) + IV(16)]，这里就是 48
-// 如果回退到最初只加 IV 的方案，这里就是 16
-// 根据你的描述 "网盘大小 = 本地大小 + 加密头部开销 (假设是 16 字节 IV)"
-const EncryptedOverhead = 16
+const (
+	// ModTimeTolerance 修改时间在该范围内视为相同 (不同文件系统的时间精度不同)
+	ModTimeTolerance = 2 * time.Second
+	// MaxClockSkew 修改时间比当前时间晚超过该值时，认为时钟不可信
+	MaxClockSkew = time.Hour
+)
 
 // compare 决策函数
-func (e *Engine) compare(relPath string, local *fs.FileMeta, remote *fs.FileMeta, base *database.FileState) OpType {
+// Debug 级别下为每个路径输出一条结构化日志，列出三方的输入与决策结果 (见 logDecision)
+func (e *Engine) compare(ctx context.Context, log *slog.Logger, relPath string, local *fs.FileMeta, remote *fs.FileMeta, base *database.FileState) OpType {
+	op, reason := e.decide(ctx, log, relPath, local, remote, base)
+	logDecision(log, relPath, local, remote, base, op, reason)
+	return op
+}
+
+// decide compare 的实现，同时返回决策依据 (用于日志)
+func (e *Engine) decide(ctx context.Context, log *slog.Logger, relPath string, local *fs.FileMeta, remote *fs.FileMeta, base *database.FileState) (OpType, string) {
 	// 1. 处理目录
 	if (local != nil && local.IsDir) || (remote != nil && remote.IsDir) {
-		return OpIgnore
+		return e.compareDir(log, relPath, local, remote, base)
+	}
+	if base != nil && base.IsDir {
+		// 目录已被同名文件替换 (或两侧都已不存在)，旧的目录记录不再作为基准
+		if local == nil && remote == nil {
+			return OpIgnore, "dir_record_gone"
+		}
+		base = nil
 	}
 
 	// 2. 数据库中没有记录 (Base == nil) -> 灾难恢复/首次初始化
 	if base == nil {
 		if local != nil && remote == nil {
-			return OpUpload
+			return OpUpload, "new_local"
 		}
 		if local == nil && remote != nil {
-			return OpDownload
+			return OpDownload, "new_remote"
 		}
 		if local != nil && remote != nil {
-			// 【关键逻辑】DB丢失后的关联策略: 模糊匹配
+			// 【关键逻辑】DB丢失后的关联策略: 模糊匹配 (重新扫描时按内容比对，见 sameContent)
+			if rescanning(ctx) {
+				if e.sameContent(ctx, log, local, remote) {
+					return OpIgnore, "rescan_match"
+				}
+				return e.firstRunOp(log, relPath, local, remote), "rescan_mismatch:" + e.opts.FirstRunBias.String()
+			}
 			if e.isSameFileFuzzy(local, remote) {
-				slog.Info("模糊匹配成功，准备重建索引", "path", relPath)
+				log.Info("模糊匹配成功，准备重建索引", "path", relPath)
 				// 返回 OpIgnore，Engine 层会检测到 base==nil 从而触发 rebuildIndex
-				return OpIgnore
+				return OpIgnore, "fuzzy_match"
 			}
-			slog.Warn("模糊匹配失败，视为冲突", "path", relPath,
-				"localSize", local.Size, "remoteSize", remote.Size)
-			return OpConflict
+			return e.firstRunOp(log, relPath, local, remote), "first_run:" + e.opts.FirstRunBias.String()
 		}
-		return OpIgnore
+		return OpIgnore, "absent"
 	}
 
 	// 3. 本地文件已消失
 	if local == nil {
 		if remote == nil {
-			return OpIgnore
+			return OpIgnore, "both_deleted"
 		}
-		if isRemoteSameAsBase(remote, base, len(e.opts.EncryptKey) > 0) {
-			return OpDeleteRemote
+		if e.remoteUnchanged(ctx, log, remote, base) {
+			return OpDeleteRemote, "local_deleted"
 		}
-		return OpDownload
+		return OpDownload, "local_deleted_remote_changed"
 	}
 
 	// 4. 云端文件已消失
 	if remote == nil {
-		if isLocalSameAsBase(local, base) {
-			return OpDeleteLocal
+		if e.localUnchanged(ctx, log, local, base) {
+			return OpDeleteLocal, "remote_deleted"
 		}
-		return OpUpload
+		return OpUpload, "remote_deleted_local_changed"
 	}
 
 	// 5. 双向存在，检查具体变更
-	localChanged := !isLocalSameAsBase(local, base)
-	remoteChanged := !isRemoteSameAsBase(remote, base, len(e.opts.EncryptKey) > 0)
+	localChanged := !e.localUnchanged(ctx, log, local, base)
+	remoteChanged := !e.remoteUnchanged(ctx, log, remote, base)
 
 	if !localChanged && !remoteChanged {
-		return OpIgnore
+		return OpIgnore, "unchanged"
 	}
 	if localChanged && !remoteChanged {
-		return OpUpload
+		return OpUpload, "local_changed"
 	}
 	if !localChanged && remoteChanged {
-		return OpDownload
+		return OpDownload, "remote_changed"
+	}
+
+	return OpConflict, "both_changed"
+}
+
+// compareDir 目录的决策逻辑，只负责让空目录在两侧之间创建/删除
+// 目录下的文件由各自的任务处理 (上传/下载时会自动创建父目录)
+func (e *Engine) compareDir(log *slog.Logger, relPath string, local *fs.FileMeta, remote *fs.FileMeta, base *database.FileState) (OpType, string) {
+	if isTypeClash(local, remote) {
+		return OpTypeClash, "type_clash:" + e.opts.TypeClash.String()
+	}
+	// 旧记录是文件，说明目录是新出现的，按没有记录处理
+	if base != nil && !base.IsDir {
+		base = nil
 	}
 
-	return OpConflict
+	switch {
+	case local != nil && remote != nil:
+		return OpIgnore, "dir_both_exist"
+	case local != nil:
+		// 没有记录: 本地新建的目录；有记录: 云端已删除该目录
+		if base == nil {
+			return OpMkdirRemote, "new_local_dir"
+		}
+		return OpRmdirLocal, "remote_dir_deleted"
+	case remote != nil:
+		if base == nil {
+			return OpMkdirLocal, "new_remote_dir"
+		}
+		return OpRmdirRemote, "local_dir_deleted"
+	default:
+		return OpIgnore, "absent"
+	}
 }
 
 // isSameFileFuzzy 模糊匹配：本地明文 vs 云端密文
@@ -85,45 +136,153 @@ func (e *Engine) isSameFileFuzzy(l, r *fs.FileMeta) bool {
 	// 后续的同步将依赖于数据库中的强校验 (Hash)。
 	// ModTime 在云端存储中是不可靠的，因此在这里不予比较。
 
-	// 1. 校验大小关系：云端大小 == 本地大小 + 加密头部
-	// 如果未开启加密（key为空），则大小应该相等
-	expectedRemoteSize := l.Size
-	if len(e.opts.EncryptKey) > 0 {
-		expectedRemoteSize += EncryptedOverhead
+	// 1. 校验大小关系：云端大小 == 本地大小存入后端后的大小 (由后端决定加密开销)
+	// 2. 开启加密时云端也可能是之前上传的明文副本，此时 MD5 与本地明文一致
+	return r.Size == e.opts.RemoteFS.StoredSize(l.Size, e.encrypted()) || e.isPlainCopy(l, r)
+}
+
+// pickNewest keep_latest 策略的裁决：返回是否保留本地版本，以及裁决依据 (用于日志)
+// 1. 任一侧的修改时间超出 now + MaxClockSkew，说明该侧时钟不可信，不再比较时间；
+// 预检测得的时钟偏差超过阈值且开启了 ClockSkewHashOnly 时同样不比较
+// 2. 时间相差超过 ModTimeTolerance 时保留较新的一侧
+// 3. 否则依次比较明文大小 (保留较大的) 与 Hash；Hash 的比较没有新旧含义，只保证同样的输入总是得到同样的结果
+func (e *Engine) pickNewest(l, r *fs.FileMeta, now time.Time) (keepLocal bool, reason string) {
+	limit := now.Add(MaxClockSkew)
+	skewed := e.clockSkewed.Load() || l.ModTime.After(limit) || r.ModTime.After(limit)
+
+	if !skewed {
+		diff := l.ModTime.Sub(r.ModTime)
+		switch {
+		case diff > ModTimeTolerance:
+			return true, "local_newer"
+		case diff < -ModTimeTolerance:
+			return false, "remote_newer"
+		}
+	}
+
+	prefix := "mtime_tie"
+	if skewed {
+		prefix = "clock_skew"
 	}
 
-	return r.Size == expectedRemoteSize
+	// 云端大小包含加密开销，换算回明文大小再比较
+	remotePlain := e.plainSize(r)
+	switch {
+	case l.Size > remotePlain:
+		return true, prefix + ":local_larger"
+	case l.Size < remotePlain:
+		return false, prefix + ":remote_larger"
+	}
+
+	// 大小也相同: 按 Hash 字典序决定，只为保证同样的输入总是得到同样的结果
+	// 两个 Hash 并不可比 (本地是按本地算法计算的明文 Hash，云端是密文的 MD5)，结果与哪一侧更新无关
+	if l.Hash > r.RemoteHash {
+		return true, prefix + ":hash"
+	}
+	return false, prefix + ":hash"
 }
 
 // isLocalSameAsBase (保持不变或微调)
 func isLocalSameAsBase(l *fs.FileMeta, b *database.FileState) bool {
+	// 两边都是空文件时内容必然一致，不再比较修改时间
+	if l.Size == 0 && b.FileSize == 0 {
+		return true
+	}
 	// 如果有 Hash 记录且 adapter 支持计算，优先比对 Hash
-	if l.Hash != "" && b.LocalHash != "" {
+	// 切换 hash_algorithm 后旧记录的算法不同，此时退回按大小与修改时间比对
+	if l.Hash != "" && b.LocalHash != "" && fs.SameHashAlgorithm(l.Hash, b.LocalHash) {
 		return l.Hash == b.LocalHash
 	}
+	return sameLocalSignature(l, b)
+}
+
+// sameLocalSignature 按签名 (大小、修改时间与文件标识) 判断本地文件相对基准是否未变化
+func sameLocalSignature(l *fs.FileMeta, b *database.FileState) bool {
 	if l.Size != b.FileSize {
 		return false
 	}
+	// 大小相同的两个文件互换位置后修改时间也可能都对得上，记录了文件标识时以标识区分
+	if l.FileID != "" && b.FileID != "" && l.FileID != b.FileID {
+		return false
+	}
 
 	baseTime := time.Unix(0, b.ModTime)
 	diff := l.ModTime.Sub(baseTime)
 	if diff < 0 {
 		diff = -diff
 	}
-	return diff < 2*time.Second
+	return diff < ModTimeTolerance
 }
 
-func isRemoteSameAsBase(r *fs.FileMeta, b *database.FileState, encrypted bool) bool {
-	// 如果有 RemoteHash 记录，优先比对
-	if r.RemoteHash != "" && b.RemoteHash != "" {
+// isRemoteSameAsBase 判断云端文件相对基准是否未变化
+func (e *Engine) isRemoteSameAsBase(r *fs.FileMeta, b *database.FileState) bool {
+	// 开启加密之前上传、仍是明文的旧文件没有加密开销 (remotePlain 已确认其未变化)
+	if e.remotePlain(r, b) {
+		return true
+	}
+	// 空文件: 云端大小等于空文件存入后端后的大小，说明明文仍然为空，内容必然一致
+	// 不能比对 Hash: 加密时每次上传的 IV 都是随机的，同样是空文件，密文也各不相同
+	if b.FileSize == 0 {
+		return r.Size == e.opts.RemoteFS.StoredSize(0, e.encrypted())
+	}
+	// 后端提供可靠的内容指纹且有 RemoteHash 记录时，优先比对
+	if e.opts.RemoteFS.HasContentHash() && r.RemoteHash != "" && b.RemoteHash != "" {
 		return r.RemoteHash == b.RemoteHash
 	}
-	// 比对大小 (注意：b.FileSize 存的是本地明文大小)
-	expectedSize := b.FileSize
-	// 只有当引擎配置了加密密钥时，才考虑加密开销
-	if encrypted {
-		expectedSize += EncryptedOverhead
+	// 比对大小 (注意：b.FileSize 存的是本地明文大小，换算成后端中的大小)
+	return r.Size == e.opts.RemoteFS.StoredSize(b.FileSize, e.encrypted())
+}
+
+// encrypted 引擎是否对文件内容进行加密
+func (e *Engine) encrypted() bool {
+	return len(e.opts.EncryptKey) > 0
+}
+
+// logDecision 在 Debug 级别输出一条决策日志: 三方是否存在、大小、Hash、修改时间，以及决策结果与依据
+// 只在开启 Debug 时构造日志字段，避免平时为每个路径产生额外开销
+func logDecision(log *slog.Logger, relPath string, l, r *fs.FileMeta, b *database.FileState, op OpType, reason string) {
+	if !log.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	log.Debug("比对决策",
+		"path", relPath,
+		"op", op,
+		"reason", reason,
+		metaGroup("local", l, false),
+		metaGroup("remote", r, true),
+		baseGroup(b),
+	)
+}
+
+// metaGroup 一侧扫描结果的日志字段 (云端取 RemoteHash)
+func metaGroup(name string, m *fs.FileMeta, remote bool) slog.Attr {
+	if m == nil {
+		return slog.Group(name, "exists", false)
+	}
+	hash := m.Hash
+	if remote {
+		hash = m.RemoteHash
 	}
+	return slog.Group(name,
+		"exists", true,
+		"dir", m.IsDir,
+		"size", m.Size,
+		"hash", hash,
+		"mtime", m.ModTime,
+	)
+}
 
-	return r.Size == expectedSize
+// baseGroup 同步记录的日志字段
+func baseGroup(b *database.FileState) slog.Attr {
+	if b == nil {
+		return slog.Group("base", "exists", false)
+	}
+	return slog.Group("base",
+		"exists", true,
+		"dir", b.IsDir,
+		"size", b.FileSize,
+		"local_hash", b.LocalHash,
+		"remote_hash", b.RemoteHash,
+		"mtime", b.ModTimeAsTime(),
+	)
 }
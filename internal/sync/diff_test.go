@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"baidusync/internal/crypto"
+	"baidusync/internal/fs"
+)
+
+func TestEmptyFileRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		key    []byte
+		stored int
+	}{
+		{"plain", nil, 0},
+		{"encrypted", keyA, crypto.HeaderSize},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.local.PutFile("up.txt", nil, t0)
+			env.remote.PutFile("down.txt", encryptedOrPlain(t, "", tt.key), t0)
+			e := env.engine(withKey(tt.key))
+
+			// 上传与下载空文件
+			env.run(e)
+			if data, _ := env.remote.ReadFile("up.txt"); len(data) != tt.stored {
+				t.Fatalf("云端的空文件为 %d 字节，应为 %d 字节", len(data), tt.stored)
+			}
+			wantFile(t, env.local, "down.txt", "")
+			env.wantIdle(e)
+
+			// 另一台设备重新上传了同样的空文件: 加密时 IV 不同、密文 Hash 也不同，但内容没有变化
+			env.advance(time.Hour)
+			env.remote.PutFile("up.txt", encryptedOrPlain(t, "", tt.key), env.now)
+			env.local.PutFile("down.txt", nil, env.now)
+			env.wantIdle(e)
+
+			// 空文件变为非空时照常同步
+			env.remote.PutFile("up.txt", encryptedOrPlain(t, "now filled", tt.key), env.now)
+			env.run(e)
+			wantFile(t, env.local, "up.txt", "now filled")
+			env.wantIdle(e)
+		})
+	}
+}
+
+// encryptedOrPlain key 为空时原样返回 plain，否则返回加密后的内容
+func encryptedOrPlain(t *testing.T, plain string, key []byte) []byte {
+	t.Helper()
+	if len(key) == 0 {
+		return []byte(plain)
+	}
+	return encryptFor(t, plain, key)
+}
+
+func TestPickNewest(t *testing.T) {
+	const (
+		low  = "00000000000000000000000000000000"
+		high = "ffffffffffffffffffffffffffffffff"
+	)
+	h := int64(crypto.HeaderSize)
+	tests := []struct {
+		name                 string
+		localOffset          time.Duration // 本地修改时间相对 t0 的偏移
+		remoteOffset         time.Duration
+		localSize, remoteRaw int64 // remoteRaw 为云端密文大小
+		localHash, remoteMD5 string
+		skewed               bool // 预检测得时钟偏差 (clockSkewed)
+		wantLocal            bool
+		wantReason           string
+	}{
+		{"local_newer", 3 * time.Second, 0, 10, 10 + h, low, high, false, true, "local_newer"},
+		{"remote_newer", 0, 3 * time.Second, 10, 10 + h, high, low, false, false, "remote_newer"},
+		// 相差不超过 ModTimeTolerance 时不比较时间，改为比较大小、Hash
+		{"within_tolerance", time.Second, 0, 10, 12 + h, high, low, false, false, "mtime_tie:remote_larger"},
+		{"within_tolerance_reversed", 0, time.Second, 12, 10 + h, low, high, false, true, "mtime_tie:local_larger"},
+		// 本地时间超出 now + MaxClockSkew: 不再相信时间，哪怕本地看起来更新
+		{"local_future", 2 * time.Hour, 0, 10, 12 + h, high, low, false, false, "clock_skew:remote_larger"},
+		{"remote_future", -time.Minute, 2 * time.Hour, 12, 10 + h, low, high, false, true, "clock_skew:local_larger"},
+		// 预检测得的时钟偏差: 本地新一分钟也不采信
+		{"clock_skewed", time.Minute, 0, 10, 10 + h, low, high, true, false, "clock_skew:hash"},
+		// 开启加密时按明文大小比较: 密文大小相同，明文却是本地更大
+		{"plain_size", 0, 0, 20, 4 + h, low, high, false, true, "mtime_tie:local_larger"},
+		{"plain_size_remote", 0, 0, 10, 12 + h, high, low, false, false, "mtime_tie:remote_larger"},
+		// 大小也相同时按 Hash 字典序，只要求结果确定
+		{"equal_size_high_local", 0, 0, 10, 10 + h, high, low, false, true, "mtime_tie:hash"},
+		{"equal_size_low_local", 0, 0, 10, 10 + h, low, high, false, false, "mtime_tie:hash"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			e := env.engine(withKey(keyA))
+			e.clockSkewed.Store(tt.skewed)
+			l := &fs.FileMeta{RelPath: "a.txt", Size: tt.localSize, ModTime: t0.Add(tt.localOffset), Hash: tt.localHash}
+			r := &fs.FileMeta{RelPath: "a.txt", Size: tt.remoteRaw, ModTime: t0.Add(tt.remoteOffset), RemoteHash: tt.remoteMD5}
+
+			keepLocal, reason := e.pickNewest(l, r, t0)
+			if keepLocal != tt.wantLocal || reason != tt.wantReason {
+				t.Fatalf("pickNewest = (%t, %s)，应为 (%t, %s)", keepLocal, reason, tt.wantLocal, tt.wantReason)
+			}
+			// 同样的输入总是得到同样的结果
+			for range 3 {
+				if again, _ := e.pickNewest(l, r, t0); again != keepLocal {
+					t.Fatal("同样的输入得到了不同的结果")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"baidusync/internal/fs"
+)
+
+// DefaultDownloadRetries 下载中途断开后默认的重试次数
+const DefaultDownloadRetries = 3
+
+// downloadRetryDelay 第一次重试前的等待时间，之后每次递增 (测试中会缩短)
+var downloadRetryDelay = time.Second
+
+// resumingReader 读取云端文件，连接在读完 size 字节之前断开时自动重新打开并从断点继续
+// 网络抖动可能让响应体提前 EOF，如果不检查，写入本地的就是不完整的文件，还会被记录为同步完成
+type resumingReader struct {
+	ctx     context.Context
+	log     *slog.Logger
+	fsys    fs.FileSystem
+	path    string
+	size    int64 // 云端文件大小 (存储后的大小)
+	retries int
+
+	n        int64 // 已读取的字节数
+	attempts int
+
+	mu     sync.Mutex
+	rc     io.ReadCloser
+	closed bool
+}
+
+// openResuming 从 offset 处打开云端文件，返回的 Reader 在读完 size 字节前断开时最多重试 retries 次
+// offset 大于 0 时 RemoteFS 必须实现 fs.RangeOpener
+func (e *Engine) openResuming(ctx context.Context, log *slog.Logger, path string, offset, size int64) (*resumingReader, error) {
+	var rc io.ReadCloser
+	var err error
+	if offset > 0 {
+		rc, err = e.opts.RemoteFS.(fs.RangeOpener).OpenStreamAt(path, offset)
+	} else {
+		rc, err = e.opts.RemoteFS.OpenStream(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	retries := e.opts.DownloadRetries
+	if retries <= 0 {
+		retries = DefaultDownloadRetries
+	}
+	return &resumingReader{
+		ctx:     ctx,
+		log:     log,
+		fsys:    e.opts.RemoteFS,
+		path:    path,
+		size:    size,
+		retries: retries,
+		n:       offset,
+		rc:      rc,
+	}, nil
+}
+
+func (r *resumingReader) Read(p []byte) (int, error) {
+	for {
+		r.mu.Lock()
+		rc := r.rc
+		r.mu.Unlock()
+
+		n, err := rc.Read(p)
+		r.n += int64(n)
+		switch {
+		case err == nil:
+			return n, nil
+		case err == io.EOF && r.n >= r.size:
+			return n, io.EOF
+		case n > 0:
+			// 先交付已经读到的数据，下一次 Read 再处理断开
+			return n, nil
+		}
+		if err := r.resume(err); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// resume 在断开处重新打开文件，超过重试次数或已被取消时返回错误
+func (r *resumingReader) resume(cause error) error {
+	if cause == io.EOF {
+		cause = io.ErrUnexpectedEOF
+	}
+	for {
+		if err := r.ctx.Err(); err != nil {
+			return cause
+		}
+		if r.attempts >= r.retries {
+			return fmt.Errorf("下载在 %d/%d 字节处中断，已重试 %d 次: %w", r.n, r.size, r.attempts, cause)
+		}
+		r.attempts++
+		r.log.Warn("下载中断，重新连接", "path", r.path, "offset", r.n, "size", r.size, "attempt", r.attempts, "err", cause)
+
+		select {
+		case <-time.After(downloadRetryDelay * time.Duration(r.attempts)):
+		case <-r.ctx.Done():
+			return cause
+		}
+
+		rc, err := r.reopen()
+		if err != nil {
+			cause = err
+			continue
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			rc.Close()
+			return cause
+		}
+		r.rc.Close()
+		r.rc = rc
+		r.mu.Unlock()
+		return nil
+	}
+}
+
+// reopen 从已读取的位置重新打开文件；后端不支持按偏移量读取时重新下载并跳过已读取的部分
+func (r *resumingReader) reopen() (io.ReadCloser, error) {
+	if ro, ok := r.fsys.(fs.RangeOpener); ok {
+		return ro.OpenStreamAt(r.path, r.n)
+	}
+	rc, err := r.fsys.OpenStream(r.path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, rc, r.n); err != nil {
+		rc.Close()
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return rc, nil
+}
+
+// Close 关闭当前的连接，可以与 Read 并发调用 (超时取消时用于中断卡住的读取)
+func (r *resumingReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return r.rc.Close()
+}
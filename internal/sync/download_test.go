@@ -0,0 +1,125 @@
+package sync
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs/memfs"
+)
+
+// shortenRetryDelay 缩短下载重试前的等待时间
+func shortenRetryDelay(t *testing.T) {
+	prev := downloadRetryDelay
+	downloadRetryDelay = time.Millisecond
+	t.Cleanup(func() { downloadRetryDelay = prev })
+}
+
+// blippingFS 前 cuts 次打开文件时，读到 limit 字节就提前 EOF，模拟网络抖动
+type blippingFS struct {
+	*memfs.FS
+	limit int64
+
+	mu      sync.Mutex
+	cuts    int
+	opens   int
+	offsets []int64 // 每次按偏移量打开时的偏移量
+}
+
+func (f *blippingFS) OpenStream(relPath string) (io.ReadCloser, error) {
+	return f.open(relPath, 0)
+}
+
+func (f *blippingFS) open(relPath string, offset int64) (io.ReadCloser, error) {
+	data, ok := f.ReadFile(relPath)
+	if !ok {
+		return f.FS.OpenStream(relPath)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.opens++
+	var r io.Reader = strings.NewReader(string(data[offset:]))
+	if f.cuts > 0 {
+		f.cuts--
+		r = io.LimitReader(r, f.limit)
+	}
+	return io.NopCloser(r), nil
+}
+
+// rangeBlippingFS 在 blippingFS 的基础上支持按偏移量打开 (fs.RangeOpener)
+type rangeBlippingFS struct {
+	*blippingFS
+}
+
+func (f rangeBlippingFS) OpenStreamAt(relPath string, offset int64) (io.ReadCloser, error) {
+	f.mu.Lock()
+	f.offsets = append(f.offsets, offset)
+	f.mu.Unlock()
+	return f.open(relPath, offset)
+}
+
+func TestDownloadResumesFromOffsetAfterEarlyEOF(t *testing.T) {
+	shortenRetryDelay(t)
+	env := newTestEnv(t)
+	content := strings.Repeat("0123456789", 10)
+	env.remote.PutFile("a.bin", []byte(content), t0)
+	remote := &blippingFS{FS: env.remote, limit: 30, cuts: 2}
+	e := env.engine(func(o *EngineOptions) { o.RemoteFS = rangeBlippingFS{remote} })
+
+	env.run(e)
+	wantFile(t, env.local, "a.bin", content)
+	wantNoPartial(t, env, "a.bin")
+	if state := wantState(t, env.db, "a.bin", true); state.LocalHash != md5Hex(content) {
+		t.Fatalf("记录的 Hash 为 %s，应为完整文件的 Hash", state.LocalHash)
+	}
+	// 两次断开都从已读取的位置继续
+	if want := []int64{30, 60}; !slices.Equal(remote.offsets, want) {
+		t.Fatalf("重新连接的偏移量为 %v，应为 %v", remote.offsets, want)
+	}
+	env.wantIdle(e)
+}
+
+func TestDownloadRestartsWithoutRangeSupport(t *testing.T) {
+	shortenRetryDelay(t)
+	env := newTestEnv(t)
+	content := strings.Repeat("abcdefghij", 10)
+	env.remote.PutFile("a.bin", []byte(content), t0)
+	remote := &blippingFS{FS: env.remote, limit: 40, cuts: 1}
+	e := env.engine(func(o *EngineOptions) { o.RemoteFS = remote })
+
+	env.run(e)
+	wantFile(t, env.local, "a.bin", content)
+	if remote.opens != 2 {
+		t.Fatalf("打开了 %d 次，应重新下载 1 次", remote.opens)
+	}
+	env.wantIdle(e)
+}
+
+func TestDownloadGivesUpAfterRetries(t *testing.T) {
+	shortenRetryDelay(t)
+	env := newTestEnv(t)
+	env.local.PutFile("a.bin", []byte("old"), t0)
+	e := env.engine()
+	env.run(e)
+
+	env.advance(time.Minute)
+	env.remote.PutFile("a.bin", []byte(strings.Repeat("x", 100)), env.now)
+	remote := &blippingFS{FS: env.remote, limit: 10, cuts: 10}
+	e = env.engine(func(o *EngineOptions) {
+		o.RemoteFS = rangeBlippingFS{remote}
+		o.DownloadRetries = 2
+	})
+
+	if _, err := env.runErr(e); err == nil || !strings.Contains(err.Error(), io.ErrUnexpectedEOF.Error()) {
+		t.Fatalf("错误为 %v，应为 unexpected EOF", err)
+	}
+	if remote.opens != 3 {
+		t.Fatalf("打开了 %d 次，应为首次加 2 次重试", remote.opens)
+	}
+	// 不完整的内容不能替换本地文件
+	wantFile(t, env.local, "a.bin", "old")
+	wantNoPartial(t, env, "a.bin")
+}
@@ -2,16 +2,23 @@ package sync
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	iofs "io/fs"
 	"log/slog"
+	pathpkg "path"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"baidusync/internal/crypto"
 	"baidusync/internal/database"
 	"baidusync/internal/fs"
-	"golang.org/x/sync/errgroup"
 )
 
 type ConflictStrategy int
@@ -27,8 +34,19 @@ const (
 	StrategyForceUpload
 	// StrategyForceDownload (4)：删除本地，强制下载云端 (对应 config: delete_local)
 	StrategyForceDownload
+	// StrategyKeepBoth (5)：本地副本改名为 .conflict-<时间>，下载云端版本，并把副本作为新文件上传
+	StrategyKeepBoth
+	// StrategySkip (6)：暂不处理，两边保持原样 (只用于 ConflictResolver 的返回值)
+	StrategySkip
 )
 
+// DefaultConflictTimeout ConflictResolver 未设置超时时的默认等待时间
+const DefaultConflictTimeout = 2 * time.Minute
+
+// ConflictResolver 交互式冲突处理回调
+// 返回本次冲突要采用的策略；返回错误或超时 (ctx 结束) 时引擎改用配置中的静态策略
+type ConflictResolver func(ctx context.Context, relPath string, local, remote *fs.FileMeta) (ConflictStrategy, error)
+
 // ParseConflictStrategy 将配置文件中的字符串转换为引擎内部的枚举值
 func ParseConflictStrategy(s string) ConflictStrategy {
 	switch s {
@@ -42,250 +60,691 @@ func ParseConflictStrategy(s string) ConflictStrategy {
 	case "delete_local":
 		// 配置叫“删除本地”，实际操作逻辑是“强制下载(覆盖)”
 		return StrategyForceDownload
+	case "keep_both":
+		return StrategyKeepBoth
 	default:
 		// 默认 "rename_local" 或其他未知值
 		return StrategyRenameLocal
 	}
 }
 
+// String 返回配置中使用的名称 (用于日志与冲突历史)
+func (s ConflictStrategy) String() string {
+	switch s {
+	case StrategyRenameRemote:
+		return "rename_remote"
+	case StrategyKeepNewest:
+		return "keep_latest"
+	case StrategyForceUpload:
+		return "delete_remote"
+	case StrategyForceDownload:
+		return "delete_local"
+	case StrategyKeepBoth:
+		return "keep_both"
+	case StrategySkip:
+		return "skip"
+	default:
+		return "rename_local"
+	}
+}
+
 // EngineOptions 初始化选项
 type EngineOptions struct {
-	LocalFS          fs.FileSystem
-	RemoteFS         fs.FileSystem
-	StateDB          *database.DB
-	EncryptKey       []byte // 32字节密钥
-	EncryptFilenames bool   // 是否加密文件名
-	MaxWorkers       int
+	LocalFS    fs.FileSystem
+	RemoteFS   fs.RemoteProvider // 云端存储后端 (文件名加密等细节由后端自行处理)
+	StateDB    *database.DB
+	EncryptKey []byte // 32字节密钥
+	MaxWorkers int
+	// OpLimits 按操作类型 (上传、下载、删除) 分别限制并发，在 MaxWorkers 之内生效
+	OpLimits         OpLimits
 	ConflictStrategy ConflictStrategy
+	// ConflictRules 按路径选择冲突策略，按顺序匹配，都不匹配时使用 ConflictStrategy
+	ConflictRules []ConflictRule
+	// ConflictName rename_local / rename_remote 策略的新文件名模板 (为空时使用 DefaultConflictName)
+	ConflictName string
+	// ConflictResolver 设置后遇到冲突时先询问它 (例如终端提示)，守护进程模式下应保持为空
+	ConflictResolver ConflictResolver
+	// ConflictTimeout 等待 ConflictResolver 的最长时间，超时后使用静态策略 (0 表示 DefaultConflictTimeout)
+	ConflictTimeout time.Duration
+	BackupDir       string // 数据库备份目录
+	BackupKeep      int    // 每次同步前备份数据库并保留的份数 (0 表示不备份)
+	// PruneOrphansAfter 两侧都已不存在、且超过该时长未同步的数据库记录会被清理 (0 表示不清理)
+	PruneOrphansAfter time.Duration
+	// FileTimeout 单个任务的最长执行时间 (0 表示按文件大小自动计算，见 fileTimeout)
+	FileTimeout time.Duration
+	// Bandwidth 传输限速，所有 Worker 共享 (为空表示不限速)
+	Bandwidth *BandwidthOptions
+	// PruneEmptyDirs 删除云端文件后，删除因此变空、且本地没有对应目录的云端目录 (关闭时只在日志中报告)
+	PruneEmptyDirs bool
+	// MaxFileSize 明文大小超过该值的文件不上传、不下载，也不处理冲突 (0 表示不限制)
+	MaxFileSize int64
+	// PreserveMode 上传时记录本地文件的权限位，下载后恢复 (网盘不保存 POSIX 权限)
+	PreserveMode bool
+	// DownloadRetries 下载在读完整个文件之前断开时重新连接的次数 (0 表示 DefaultDownloadRetries)
+	DownloadRetries int
+	// OnError 任务失败后继续执行其他任务还是中止本轮同步 (认证失败、空间不足总是中止)
+	OnError ErrorPolicy
+	// CycleTimeout 一轮同步的最长时间，超时后取消剩余任务并返回 ErrCycleTimeout (0 表示不限制)
+	CycleTimeout time.Duration
+	// Exclude 不参与同步的相对路径 (文件或目录)，两侧的扫描结果与数据库记录都会跳过
+	// 用于排除位于同步目录中的数据库、日志等程序自身的文件
+	Exclude []string
+	// Subpath 只同步该相对路径 (及其下级) 的内容，为空表示整个目录
+	// 范围之外的扫描结果与数据库记录都按 Exclude 同样的方式跳过，不会被上传、下载或删除
+	Subpath string
+	// DetectMoves 根据本地文件的底层标识 (fs.FileMeta.FileID) 把本地的移动与改名同步为云端移动，而不是重新上传再删除
+	// LocalFS 需要实现 fs.IdentityTracker 并已开启，否则没有标识可用，等同于关闭
+	DetectMoves bool
+	// QuietPeriod 目标一侧的同名文件在该时长内被修改过时不覆盖，推迟到下一轮 (0 表示不检查)
+	QuietPeriod time.Duration
+	// MigratePlain 开启加密后，把云端仍以明文存储的旧文件 (两侧一致的) 重新加密上传
+	// 关闭时这些文件照常同步，下载时不解密，直到下次被修改后重新上传
+	MigratePlain bool
+	// TypeClash 同一路径一侧是文件、另一侧是目录时的处理方式 (默认跳过并报告)
+	TypeClash TypeClashPolicy
+	// FirstRunBias 没有同步记录、两侧同名文件内容不一致时以哪一侧为准 (默认视为冲突)
+	FirstRunBias FirstRunBias
+	// DeleteOnPartialScan 扫描不完整 (有路径无法读取) 时仍然执行删除任务 (默认暂缓，见 holdDeletes)
+	DeleteOnPartialScan bool
+	// VerifyLocalChanges 本地文件的大小与记录一致、只有修改时间 (或文件标识) 变化时计算完整的 Hash 确认是否真的修改
+	// 内容一致时不上传，只更新记录中的修改时间 (见 localUnchanged)
+	VerifyLocalChanges bool
+	// QuarantineUndecryptable 下载时无法解密 (密钥不正确或密文损坏) 的云端文件记录为隔离，
+	// 云端文件变化之前不再尝试下载 (默认每轮重试，见 holdQuarantined)
+	QuarantineUndecryptable bool
+	// ProtectNewerRemote 上传会覆盖修改时间更新的云端文件时改为冲突或跳过 (默认不检查，见 guardNewerRemote)
+	ProtectNewerRemote NewerRemoteGuard
+	// NoCreateRemoteRoot 云端根目录不存在时预检直接失败，即使是首次同步也不自动创建
+	// 用于 remote_dir 应当已经存在的场景，写错路径时不会在网盘中新建一个空目录并开始上传
+	NoCreateRemoteRoot bool
+	// ClockSkewThreshold 预检时测量本机与云端的时钟偏差，超过该值时警告 (0 表示不测量)
+	ClockSkewThreshold time.Duration
+	// ClockSkewHashOnly 时钟偏差超过 ClockSkewThreshold 时，keep_latest 不再比较修改时间
+	ClockSkewHashOnly bool
+	// NormalizeCase 比对路径时忽略大小写 (用于 macOS、Windows 等大小写不敏感的本地文件系统)
+	NormalizeCase bool
+	// NormalizeUnicode 比对路径前统一为 Unicode NFC (macOS 上的文件名可能是 NFD)
+	NormalizeUnicode bool
+	Logger           *slog.Logger // 基础 Logger (为空时使用 slog.Default())
+	// Adaptive 设置后根据限流与吞吐量在上下限之间自动调整并发数 (为空表示固定使用 MaxWorkers)
+	Adaptive *AdaptiveOptions
+	// Progress 单个文件的传输进度回调 (可为空)，已按 fs.ProgressInterval 节流
+	// 上传时统计的是实际发往网盘的字节数，下载时统计的是从网盘读取的字节数
+	Progress func(relPath string, op OpType, bytesDone, bytesTotal int64)
+	// Clock 返回当前时间 (为空时使用 time.Now)，测试中可以固定或推进时间
+	// 用于同步记录的时间、冲突文件名、keep_latest 的时钟检查、孤立记录与 QuietPeriod 的判断；
+	// 限速、自适应并发与耗时统计测量的是实际经过的时间，不受影响
+	Clock func() time.Time
 }
 
 type Engine struct {
 	opts *EngineOptions
+
+	// mu 保护可以热更新的选项 (ConflictStrategy、ConflictRules、ConflictResolver、MaxWorkers)
+	mu sync.RWMutex
+
+	// concurrency 最近一轮同步结束时的并发数 (自适应模式下作为下一轮的起点，0 表示尚未同步过)
+	concurrency atomic.Int32
+
+	// bandwidth 传输限速器，在各轮同步之间保持 (未配置限速时为 nil)
+	bandwidth *bandwidthLimiter
+
+	// clockSkewed 预检测得的时钟偏差超过阈值且开启了 ClockSkewHashOnly，keep_latest 不再比较修改时间
+	clockSkewed atomic.Bool
+
+	// keyCheck 本轮用于确认密钥的参照文件 (见 checkKey)，keyVerified 已确认密钥正确
+	keyCheck    atomic.Pointer[keyCheck]
+	keyVerified atomic.Bool
 }
 
 func NewEngine(opts *EngineOptions) *Engine {
 	if opts.MaxWorkers <= 0 {
 		opts.MaxWorkers = 3
 	}
-	return &Engine{opts: opts}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	if opts.ClockSkewThreshold > 0 {
+		opts.Exclude = append(opts.Exclude, clockProbeName)
+	}
+	return &Engine{opts: opts, bandwidth: newBandwidthLimiter(opts.Logger, opts.Bandwidth)}
+}
+
+// Reload 热更新运行期间可以修改的选项
+// 新的并发数从下一轮同步开始生效，新的冲突策略从下一个冲突开始生效
+func (e *Engine) Reload(strategy ConflictStrategy, rules []ConflictRule, maxWorkers int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.opts.ConflictStrategy = strategy
+	e.opts.ConflictRules = rules
+	if maxWorkers > 0 && maxWorkers != e.opts.MaxWorkers {
+		e.opts.MaxWorkers = maxWorkers
+		// 自适应模式从新的初始并发数重新开始
+		e.concurrency.Store(0)
+	}
+}
+
+// SetConflictResolver 设置 (或用 nil 取消) 交互式冲突处理回调
+func (e *Engine) SetConflictResolver(resolver ConflictResolver, timeout time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.opts.ConflictResolver = resolver
+	e.opts.ConflictTimeout = timeout
+}
+
+// maxWorkers 读取当前的并发数
+func (e *Engine) maxWorkers() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.opts.MaxWorkers
 }
 
 // Run 执行一次完整的同步周期
-func (e *Engine) Run(ctx context.Context) error {
-	// 1. 获取三方状态 (并发获取以加速)
-	var (
-		localMap  map[string]*fs.FileMeta
-		remoteMap map[string]*fs.FileMeta
-		baseMap   map[string]*database.FileState
-	)
+// 返回的 RunResult 总是非空，出错时包含出错前已经完成的任务统计
+func (e *Engine) Run(ctx context.Context) (*RunResult, error) {
+	// 为本轮同步生成 (或沿用调用方提供的) Run ID，所有日志都带上它，方便区分交错输出的多轮日志
+	runID := RunIDFromContext(ctx)
+	if runID == "" {
+		runID = NewRunID()
+	}
+	log := e.opts.Logger.With("run_id", runID)
 
-	g, _ := errgroup.WithContext(ctx)
+	result := newRunResult(runID)
+	done := e.beginCycle(log, runID)
+	err := e.run(ctx, log, result, done)
+	result.Duration = time.Since(result.Started)
+	e.finishCycle(ctx, log, err)
+	return result, err
+}
 
-	g.Go(func() error {
-		var err error
-		localMap, err = e.opts.LocalFS.ListAll()
+// run 执行同步周期的各个阶段，并把任务结果累加到 result
+// done 为上一轮中途退出前已经完成的任务，本轮跳过
+func (e *Engine) run(ctx context.Context, log *slog.Logger, result *RunResult, done map[string]bool) error {
+	// 0. 同步前备份数据库，以便回滚错误的同步决策
+	if e.opts.BackupKeep > 0 {
+		backup, err := e.opts.StateDB.Backup(e.opts.BackupDir, e.opts.BackupKeep)
 		if err != nil {
-			return fmt.Errorf("scan local failed: %w", err)
+			// 备份失败不阻止同步，但需要提醒用户
+			log.Warn("同步前备份数据库失败", "err", err)
+		} else {
+			log.Debug("已备份数据库", "file", backup)
 		}
-		return nil
-	})
+	}
+
+	// 整轮同步的截止时间，到期后剩余任务不再执行，正在传输的文件也会被中断
+	parent := ctx
+	if e.opts.CycleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.opts.CycleTimeout)
+		defer cancel()
+	}
+
+	// 按 OnError 策略提前中止时取消 runCtx，剩余任务不再执行
+	runCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
 
-	g.Go(func() error {
-		var err error
-		remoteMap, err = e.opts.RemoteFS.ListAll()
+	// 开启路径规范化后，把数据库中的旧 Key 统一改写为规范形式
+	if e.normalizing() {
+		n, err := e.opts.StateDB.RekeyAll(e.canonical)
 		if err != nil {
-			return fmt.Errorf("scan remote failed: %w", err)
+			return fmt.Errorf("规范化数据库记录失败: %w", err)
 		}
-		return nil
-	})
+		if n > 0 {
+			log.Info("已规范化数据库记录的路径", "count", n)
+		}
+	}
 
-	g.Go(func() error {
-		var err error
-		baseMap, err = e.opts.StateDB.ListAll()
-		if err != nil {
-			return fmt.Errorf("scan db failed: %w", err)
+	// 1. 扫描三方状态并生成执行计划
+	// 扫描与计算 Hash 不修改任何状态，收到停止请求时立即中止，不必等扫描完成
+	scanCtx, stopScan := dispatchContext(ctx)
+	plan, err := e.plan(scanCtx, log)
+	stopScan()
+	if err != nil {
+		if ctx.Err() == nil && StopRequested(ctx) {
+			log.Info("收到停止请求，中止扫描")
+			return nil
+		}
+		return err
+	}
+	e.keyCheck.Store(&keyCheck{ref: plan.keyRef})
+	if rescanning(ctx) {
+		if err := e.resetBase(log); err != nil {
+			return err
 		}
+	}
+
+	// 2. 静默重建索引
+	// 如果 compare 返回 Ignore，说明两边一致。
+	// 但如果数据库中没有记录，说明是 DB 丢失后的首次模糊匹配成功。
+	// 此时需要立即写入一条记录，建立关联，否则下次比对缺乏基准。
+	for _, t := range plan.Rebuilds {
+		e.rebuildIndex(log, t.RelPath, t.Local, t.Remote)
+	}
+	e.recordIdentities(log, plan.Identities)
+	e.recordSignatures(log, plan.Signatures)
+
+	// 清理孤立记录 (需要在遍历数据库的只读事务结束后执行)
+	e.pruneOrphans(log, plan.Orphans)
+
+	tasks := e.skipCompleted(log, plan.Tasks, done)
+	log.Info(
+		"同步检查完成",
+		"发现任务数", len(tasks),
+	)
+	if len(tasks) == 0 {
 		return nil
-	})
+	}
 
-	if err := g.Wait(); err != nil {
-		return err
+	// 3. 分阶段执行任务
+	// 先创建目录 (父目录在前)，再并发传输文件，最后删除空目录 (子目录在前)，
+	// 保证删除目录时其中的文件已经处理完毕
+	var mkdirs, rmdirs, files []Task
+	for _, t := range tasks {
+		switch t.Op {
+		case OpMkdirRemote, OpMkdirLocal:
+			mkdirs = append(mkdirs, t)
+		case OpRmdirRemote, OpRmdirLocal:
+			rmdirs = append(rmdirs, t)
+		default:
+			files = append(files, t)
+		}
 	}
+	sort.Slice(mkdirs, func(i, j int) bool { return mkdirs[i].RelPath < mkdirs[j].RelPath })
+	sort.Slice(rmdirs, func(i, j int) bool { return rmdirs[i].RelPath > rmdirs[j].RelPath })
 
-	// 2. 生成任务队列
-	tasks := make([]Task, 0)
+	// 收到停止请求后 dispatch 结束，不再开始新的任务；已经开始的任务使用 runCtx，继续执行完毕
+	dispatch, stopDispatch := dispatchContext(runCtx)
+	defer stopDispatch()
 
-	// 收集所有出现过的路径 (并集)
-	allPaths := make(map[string]bool)
-	for p := range localMap {
-		allPaths[p] = true
+	errs := e.runSerial(runCtx, dispatch, log, abort, result, mkdirs)
+	errs = append(errs, e.runPool(runCtx, dispatch, log, abort, result, files)...)
+	errs = append(errs, e.runSerial(runCtx, dispatch, log, abort, result, rmdirs)...)
+	if dispatch.Err() == nil {
+		e.pruneEmptyDirs(log, plan.remote, result.removedRemote)
 	}
-	for p := range remoteMap {
-		allPaths[p] = true
+
+	var syncErr error
+	if len(errs) > 0 {
+		syncErr = &SyncError{Errors: errs}
 	}
-	for p := range baseMap {
-		allPaths[p] = true
+
+	if StopRequested(ctx) && ctx.Err() == nil {
+		succeeded, failed := result.Total()
+		if remaining := result.Deferred; remaining > 0 {
+			log.Info("已停止，正在执行的任务已完成并写入数据库",
+				"succeeded", succeeded, "failed", failed, "remaining", remaining)
+			if syncErr != nil {
+				return fmt.Errorf("%w (剩余 %d 个任务): %w", ErrStopped, remaining, syncErr)
+			}
+			return fmt.Errorf("%w (剩余 %d 个任务)", ErrStopped, remaining)
+		}
 	}
 
-	for path := range allPaths {
-		l := localMap[path]
-		r := remoteMap[path]
-		b := baseMap[path]
+	if cause := context.Cause(runCtx); parent.Err() == nil && errors.Is(cause, ErrAborted) {
+		if syncErr != nil {
+			return fmt.Errorf("%w; %w", cause, syncErr)
+		}
+		return cause
+	}
 
-		// 调用 diff.go 中的 compare 逻辑
-		op := e.compare(path, l, r, b)
+	if parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Warn("本轮同步超时，剩余任务已取消，将在下一轮继续", "timeout", e.opts.CycleTimeout, "failed", len(errs), "deferred", result.Deferred)
+		if syncErr != nil {
+			return fmt.Errorf("%w (%s): %w", ErrCycleTimeout, e.opts.CycleTimeout, syncErr)
+		}
+		return fmt.Errorf("%w (%s)", ErrCycleTimeout, e.opts.CycleTimeout)
+	}
+	return syncErr
+}
 
-		if op != OpIgnore {
-			tasks = append(tasks, Task{Op: op, RelPath: path})
+// runSerial 按顺序逐个执行任务 (用于有先后依赖的目录操作)
+// dispatch 结束后不再开始新的任务
+func (e *Engine) runSerial(ctx, dispatch context.Context, log *slog.Logger, abort context.CancelCauseFunc, result *RunResult, tasks []Task) []*PathError {
+	var errs []*PathError
+	for i, task := range tasks {
+		if dispatchStopped(dispatch) {
+			// 剩余的任务没有开始执行，计为推迟
+			result.deferTasks(len(tasks) - i)
+			break
+		}
+		err := e.runTask(ctx, log, &task)
+		result.record(&task, err)
+		if err == nil {
+			e.markDone(log, &task)
 		} else {
-			// 【关键逻辑】静默重建索引
-			// 如果 compare 返回 Ignore，说明两边一致。
-			// 但如果 baseMap 中没有记录 (b==nil)，说明是 DB 丢失后的首次模糊匹配成功。
-			// 此时需要立即写入一条记录，建立关联，否则下次比对缺乏基准。
-			if b == nil && l != nil && r != nil {
-				e.rebuildIndex(path, l, r)
-			}
+			logTaskError(log, task, err)
+			errs = append(errs, &PathError{RelPath: task.RelPath, Op: task.Op, Err: err})
+			e.checkAbort(log, abort, task, err)
 		}
 	}
+	return errs
+}
 
-	slog.Info(
-		"同步检查完成",
-		"发现任务数", len(tasks),
-	)
+// runPool 启动 Worker 池并发执行任务，返回所有失败任务的错误
+// 同时执行的任务数由 limiter 控制，自适应模式下会在运行中调整；上传、下载、删除另外受 OpLimits 限制
+// dispatch 结束后 Worker 不再取新的任务，正在执行的任务使用 ctx 继续完成
+func (e *Engine) runPool(ctx, dispatch context.Context, log *slog.Logger, abort context.CancelCauseFunc, result *RunResult, tasks []Task) []*PathError {
 	if len(tasks) == 0 {
 		return nil
 	}
 
-	// 3. 启动 Worker 池执行任务
-	taskChan := make(chan Task, len(tasks))
-	for _, t := range tasks {
-		taskChan <- t
-	}
-	close(taskChan)
+	lim := e.limiter(log)
+	defer func() {
+		result.Concurrency = lim.current()
+		e.concurrency.Store(int32(result.Concurrency))
+		log.Info("文件传输完成", "concurrency", result.Concurrency)
+	}()
 
 	var wg sync.WaitGroup
-	// 简单的错误收集
-	errChan := make(chan error, len(tasks))
-
-	for i := 0; i < e.opts.MaxWorkers; i++ {
-		wg.Add(1)
-		go func(id int) {
-			defer wg.Done()
-			for task := range taskChan {
-				// 检查上下文是否取消
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
+	// started 已经从队列中取出并开始执行的任务数，其余的任务 (停止或取消时还在队列中、或尚未投递) 计为推迟
+	var started atomic.Int64
+	// 失败的任务通常只占少数，收集到切片中即可，无需为每个任务预留位置
+	var (
+		errMu sync.Mutex
+		errs  []*PathError
+	)
 
-				if err := e.processTask(ctx, task); err != nil {
-					slog.Error("[Worker] 任务失败",
-						"worker", id,
-						"path", task.RelPath,
-						"op", task.Op,
-						"err", err,
-					)
-					errChan <- err
-				}
+	worker := func(id int, taskChan <-chan Task) {
+		defer wg.Done()
+		for {
+			// 等待空闲名额 (停止或取消时退出)
+			if !lim.acquire(dispatch) {
+				return
+			}
+			task, ok := <-taskChan
+			if !ok || dispatchStopped(dispatch) {
+				// 队列中已经缓冲的任务在停止后也不再执行
+				lim.release(nil, nil)
+				return
 			}
-		}(i)
+
+			started.Add(1)
+			err := e.runTask(ctx, log, &task)
+			if errors.Is(err, ErrRecentlyModified) {
+				// 没有传输任何数据，不计入自适应并发的统计
+				lim.release(nil, nil)
+				result.deferTasks(1)
+				log.Info("目标文件刚被修改，推迟到下一轮", "path", task.RelPath, "op", task.Op, "err", err)
+				continue
+			}
+			lim.release(&task, err)
+			result.record(&task, err)
+			if err == nil {
+				e.markDone(log, &task)
+			} else {
+				logTaskError(log, task, err, "worker", id)
+				errMu.Lock()
+				errs = append(errs, &PathError{RelPath: task.RelPath, Op: task.Op, Err: err})
+				errMu.Unlock()
+				e.checkAbort(log, abort, task, err)
+			}
+		}
 	}
 
-	wg.Wait()
-	close(errChan)
+	// 每类操作一个队列，按该类操作的并发上限启动 Worker，实际同时执行的任务总数由 limiter 决定
+	id := 0
+	for _, ln := range e.lanes(tasks, lim.max) {
+		// 任务逐个送入小缓冲的队列，而不是按任务总数预先分配
+		// 停止或取消后 Worker 不再取任务，投递也随之停止
+		taskChan := make(chan Task, 2*ln.workers)
+		go func() {
+			defer close(taskChan)
+			for _, t := range ln.tasks {
+				select {
+				case taskChan <- t:
+				case <-dispatch.Done():
+					return
+				}
+			}
+		}()
+		log.Debug("启动任务队列", "lane", ln.name, "tasks", len(ln.tasks), "workers", ln.workers)
 
-	// 收集所有错误
-	var errs []error
-	for err := range errChan {
-		errs = append(errs, err)
+		for range ln.workers {
+			wg.Add(1)
+			go worker(id, taskChan)
+			id++
+		}
 	}
 
-	if len(errs) > 0 {
-		// 将多个错误合并为一个
-		return fmt.Errorf("%d task(s) failed: %v", len(errs), errs)
+	wg.Wait()
+	if remaining := len(tasks) - int(started.Load()); remaining > 0 {
+		result.deferTasks(remaining)
+		log.Info("停止派发任务，未开始的任务推迟到下一轮", "deferred", remaining)
 	}
 
-	return nil
+	// Worker 完成的顺序不确定，按路径排序保证输出稳定
+	sort.Slice(errs, func(i, j int) bool { return errs[i].RelPath < errs[j].RelPath })
+	return errs
 }
 
 // rebuildIndex 静默重建索引（不传输文件）
-func (e *Engine) rebuildIndex(path string, l, r *fs.FileMeta) {
+func (e *Engine) rebuildIndex(log *slog.Logger, path string, l, r *fs.FileMeta) {
 	// 构造新的状态记录
+	if l.IsDir {
+		// 目录只需要记录存在即可
+		if err := e.recordDir(path, l); err != nil {
+			log.Error("重建索引失败", "path", path, "err", err)
+		}
+		return
+	}
+
 	newState := &database.FileState{
-		RelPath:  path,
+		RelPath:  e.dbKey(path),
 		FileSize: l.Size,               // 以本地明文大小为准
 		ModTime:  l.ModTime.UnixNano(), // 以本地时间为准
 
-		// 关键：重建索引时，我们认为两边内容一致，所以都用本地明文Hash作为基准
-		LocalHash:    l.Hash,
-		RemoteHash:   l.Hash, // <--- 使用本地Hash
-		LastSyncTime: time.Now().Unix(),
+		// 关键：重建索引时，我们认为两边内容一致
+		// RemoteHash 记录云端列表中的 Hash，与之后的扫描结果可以直接比对 (本地 Hash 的算法可能与云端不同)
+		LocalHash:   l.Hash,
+		RemoteHash:  r.RemoteHash,
+		Mode:        e.fileMode(l),
+		FileID:      l.FileID,
+		RemotePlain: !e.encrypted() || e.isPlainCopy(l, r),
 	}
 
-	slog.Info("DB丢失恢复: 重新关联文件", "path", path)
+	log.Info("DB丢失恢复: 重新关联文件", "path", path)
 
 	// 写入数据库
-	if err := e.opts.StateDB.Put(newState); err != nil {
-		slog.Error("重建索引失败", "path", path, "err", err)
+	if err := e.putState(newState); err != nil {
+		log.Error("重建索引失败", "path", path, "err", err)
+	}
+}
+
+// pruneOrphans 删除两侧都已不存在的过期快照记录
+// 这些记录本身不会触发任何操作，但如果之后同名文件重新出现在某一侧，
+// 旧的基准可能让引擎误判为“另一侧已删除”，从而错误地传播删除
+func (e *Engine) pruneOrphans(log *slog.Logger, orphans []*database.FileState) {
+	for _, b := range orphans {
+		if err := e.opts.StateDB.Delete(b.RelPath); err != nil {
+			log.Error("清理孤立记录失败", "path", b.RelPath, "err", err)
+			continue
+		}
+		log.Info("已清理孤立记录", "path", b.RelPath, "last_sync", b.LastSyncAsTime())
 	}
 }
 
 // processTask 处理单个任务
-func (e *Engine) processTask(ctx context.Context, t Task) error {
+func (e *Engine) processTask(ctx context.Context, log *slog.Logger, t Task) error {
 	switch t.Op {
 	case OpUpload:
-		return e.doUpload(t.RelPath)
+		// 扫描时云端没有该文件: 上传前出现的同名文件是意料之外的修改，不覆盖，改为按冲突处理
+		onExist := fs.ExistOverwrite
+		if t.Remote == nil {
+			onExist = fs.ExistFail
+		}
+		if copied, err := e.tryCopy(log, t); copied {
+			return err
+		}
+		err := e.doUpload(ctx, log, t.RelPath, onExist)
+		if onExist == fs.ExistFail && errors.Is(err, fs.ErrExist) {
+			return e.resolveAppeared(ctx, log, t.RelPath)
+		}
+		return err
 	case OpDownload:
-		return e.doDownload(t.RelPath)
+		return e.doDownload(ctx, log, t.RelPath)
 	case OpDeleteRemote:
 		if err := e.opts.RemoteFS.Delete(t.RelPath); err != nil {
 			return err
 		}
-		return e.opts.StateDB.Delete(t.RelPath)
+		return e.forgetPath(log, t.RelPath)
 	case OpDeleteLocal:
 		if err := e.opts.LocalFS.Delete(t.RelPath); err != nil {
 			return err
 		}
-		return e.opts.StateDB.Delete(t.RelPath)
+		return e.forgetPath(log, t.RelPath)
+	case OpMoveRemote:
+		return e.doMoveRemote(ctx, log, t)
+	case OpTypeClash:
+		return e.resolveTypeClash(ctx, log, t)
 	case OpConflict:
 		// 修改：调用专门的冲突处理逻辑
-		return e.resolveConflict(ctx, t.RelPath)
+		return e.resolveConflict(ctx, log, t.RelPath, t.Local, t.Remote)
+	case OpMkdirRemote:
+		log.Info("创建云端目录", "path", t.RelPath)
+		if err := e.opts.RemoteFS.Mkdir(t.RelPath); err != nil {
+			return err
+		}
+		return e.recordDir(t.RelPath, t.Local)
+	case OpMkdirLocal:
+		log.Info("创建本地目录", "path", t.RelPath)
+		if err := e.opts.LocalFS.Mkdir(t.RelPath); err != nil {
+			return err
+		}
+		return e.recordDir(t.RelPath, t.Remote)
+	case OpRmdirRemote:
+		return e.removeDir(log, e.opts.RemoteFS, t.RelPath)
+	case OpRmdirLocal:
+		return e.removeDir(log, e.opts.LocalFS, t.RelPath)
 	}
 	return nil
 }
-func (e *Engine) resolveConflict(ctx context.Context, path string) error {
-	strategy := e.opts.ConflictStrategy
-	slog.Info("开始解决冲突", "path", path, "strategy", strategy)
 
+// recordDir 记录目录已在两侧同步
+func (e *Engine) recordDir(path string, meta *fs.FileMeta) error {
+	state := &database.FileState{RelPath: e.dbKey(path), IsDir: true}
+	if meta != nil {
+		state.ModTime = meta.ModTime.UnixNano()
+	}
+	return e.putState(state)
+}
+
+// removeDir 删除一侧的空目录，并清除目录本身及其下级的全部记录
+// 扫描漏掉的文件 (例如列表分页出错) 在目录删除后不会再被扫描到，按前缀清理才不会留下幽灵记录
+// 目录中仍有文件 (例如被忽略或同步失败的文件) 时保留目录，只清除目录本身的记录 (下级文件的记录留给下一轮)，
+// 下一轮同步会把它当作新目录重新创建到另一侧，不会误删任何内容
+func (e *Engine) removeDir(log *slog.Logger, fsys fs.FileSystem, path string) error {
+	log.Info("删除空目录", "path", path, "root", fsys.Root())
+	if err := fsys.Rmdir(path); err != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotEmpty):
+			log.Warn("目录不为空，保留目录", "path", path, "root", fsys.Root())
+			return e.opts.StateDB.Delete(e.dbKey(path))
+		case errors.Is(err, fs.ErrNotExist):
+		default:
+			return err
+		}
+	}
+	return e.forgetPath(log, path)
+}
+
+// forgetPath 删除路径 (及其下级) 的全部快照记录
+// 删除的可能是一个目录 (Delete 底层为 RemoveAll)，因此按前缀清理，避免残留子记录
+func (e *Engine) forgetPath(log *slog.Logger, path string) error {
+	n, err := e.opts.StateDB.DeleteByPrefix(e.dbKey(path))
+	if err != nil {
+		return err
+	}
+	if n > 1 {
+		log.Debug("已清理目录下的快照记录", "path", path, "count", n)
+	}
+	return nil
+}
+
+// resolveAppeared 上传时云端出现了扫描时还不存在的同名文件 (例如另一台设备同时上传了同一个文件)
+// 按冲突策略立即处理，而不是让任务失败、等下一轮扫描
+func (e *Engine) resolveAppeared(ctx context.Context, log *slog.Logger, path string) error {
+	log.Warn("上传时云端已出现同名文件，按冲突处理", "path", path)
+	local, err := e.opts.LocalFS.Stat(path)
+	if err != nil {
+		return fmt.Errorf("stat local failed: %w", err)
+	}
+	remote, err := e.opts.RemoteFS.Stat(path)
+	if err != nil {
+		return fmt.Errorf("stat remote failed: %w", err)
+	}
+	return e.resolveConflict(ctx, log, path, local, remote)
+}
+
+// resolveConflict 按冲突策略处理两侧都有修改的文件，并把处理结果记入冲突历史
+func (e *Engine) resolveConflict(ctx context.Context, log *slog.Logger, path string, local, remote *fs.FileMeta) error {
+	strategy := e.chooseConflictStrategy(ctx, log, path, local, remote)
+	log.Info("开始解决冲突", "path", path, "strategy", strategy)
+
+	rec := &database.ConflictEntry{
+		Time:       e.now().UnixNano(),
+		Strategy:   strategy.String(),
+		LocalSize:  local.Size,
+		LocalHash:  local.Hash,
+		RemoteSize: remote.Size,
+		RemoteHash: remote.RemoteHash,
+	}
+	err := e.applyConflictStrategy(ctx, log, path, strategy, rec)
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if err := e.opts.StateDB.AddConflict(e.dbKey(path), rec); err != nil {
+		log.Warn("记录冲突历史失败", "path", path, "err", err)
+	}
+	return err
+}
+
+// applyConflictStrategy 执行选定的冲突策略，rec.Winner / rec.Copy 记录原路径保留的版本与另一个版本的去向
+func (e *Engine) applyConflictStrategy(ctx context.Context, log *slog.Logger, path string, strategy ConflictStrategy, rec *database.ConflictEntry) error {
 	switch strategy {
+	case StrategySkip:
+		log.Info("冲突处理: 暂不处理，两边保持原样", "path", path)
+		rec.Winner = "none"
+		return nil
+
 	case StrategyRenameLocal:
-		// 选项一：本地重命名为 .local，然后下载云端文件
-		newName := path + ".local"
-		slog.Info("冲突处理: 重命名本地文件", "old", path, "new", newName)
+		// 选项一：本地按 ConflictName 模板重命名 (默认加 .local 后缀)，然后下载云端文件
+		newName, err := e.freeConflictName(renderConflictName(e.opts.ConflictName, path, "local", e.now()))
+		if err != nil {
+			return err
+		}
+		log.Info("冲突处理: 重命名本地文件", "old", path, "new", newName)
+		rec.Winner, rec.Copy = "remote", newName
 
 		// 1. 重命名本地文件
 		if err := e.opts.LocalFS.Rename(path, newName); err != nil {
 			return fmt.Errorf("rename local failed: %w", err)
 		}
 		// 2. 原路径现在空了，执行下载
-		return e.doDownload(path)
+		return e.doDownload(ctx, log, path)
 
 	case StrategyRenameRemote:
-		// 选项二：云端重命名为 .remote，然后上传本地文件
-		newName := path + ".remote"
-		slog.Info("冲突处理: 重命名云端文件", "old", path, "new", newName)
+		// 选项二：云端按 ConflictName 模板重命名 (默认加 .remote 后缀)，然后上传本地文件
+		newName, err := e.freeConflictName(renderConflictName(e.opts.ConflictName, path, "remote", e.now()))
+		if err != nil {
+			return err
+		}
+		log.Info("冲突处理: 重命名云端文件", "old", path, "new", newName)
+		rec.Winner, rec.Copy = "local", newName
 
 		// 1. 重命名云端文件
 		if err := e.opts.RemoteFS.Rename(path, newName); err != nil {
 			return fmt.Errorf("rename remote failed: %w", err)
 		}
 		// 2. 原路径云端文件已移走，执行上传
-		return e.doUpload(path)
+		return e.doUpload(ctx, log, path, fs.ExistFail)
 
 	case StrategyKeepNewest:
 		// 选项三：比较时间，保留新的
-		localMeta, err := e.opts.LocalFS.Stat(path)
+		localMeta, err := fs.Stat(ctx, e.opts.LocalFS, path)
 		if err != nil {
 			return fmt.Errorf("stat local failed: %w", err)
 		}
@@ -294,47 +753,145 @@ func (e *Engine) resolveConflict(ctx context.Context, path string) error {
 			return fmt.Errorf("stat remote failed: %w", err)
 		}
 
-		slog.Info("冲突处理: 时间比对",
+		keepLocal, reason := e.pickNewest(localMeta, remoteMeta, e.now())
+		keep := "remote"
+		if keepLocal {
+			keep = "local"
+		}
+		rec.Winner = keep
+		log.Info("冲突处理: 时间比对",
 			"localTime", localMeta.ModTime,
-			"remoteTime", remoteMeta.ModTime)
+			"remoteTime", remoteMeta.ModTime,
+			"localSize", localMeta.Size,
+			"remoteSize", remoteMeta.Size,
+			"keep", keep,
+			"reason", reason)
 
-		if localMeta.ModTime.After(remoteMeta.ModTime) {
-			// 本地更新 -> 上传（覆盖云端）
-			slog.Info("本地文件较新，执行上传覆盖")
-			return e.doUpload(path)
-		} else {
-			// 云端更新(或相等) -> 下载（覆盖本地）
-			slog.Info("云端文件较新，执行下载覆盖")
-			return e.doDownload(path)
+		if keepLocal {
+			// 本地胜出 -> 上传（覆盖云端）
+			log.Info("保留本地版本，执行上传覆盖")
+			return e.doUpload(ctx, log, path, fs.ExistOverwrite)
 		}
+		// 云端胜出 -> 下载（覆盖本地）
+		log.Info("保留云端版本，执行下载覆盖")
+		return e.doDownload(ctx, log, path)
 
 	case StrategyForceUpload:
 		// 选项四：删除云端，上传本地
-		slog.Info("冲突处理: 强制删除云端并上传")
+		log.Info("冲突处理: 强制删除云端并上传")
+		rec.Winner = "local"
 		// 先删除云端文件，确保写入时是个新文件（有些网盘覆盖逻辑复杂，删除更稳妥）
 		if err := e.opts.RemoteFS.Delete(path); err != nil {
 			return fmt.Errorf("delete remote failed: %w", err)
 		}
-		return e.doUpload(path)
+		return e.doUpload(ctx, log, path, fs.ExistFail)
 
 	case StrategyForceDownload:
 		// 选项五：删除本地，下载云端
-		slog.Info("冲突处理: 强制删除本地并下载")
+		log.Info("冲突处理: 强制删除本地并下载")
+		rec.Winner = "remote"
 		if err := e.opts.LocalFS.Delete(path); err != nil {
 			return fmt.Errorf("delete local failed: %w", err)
 		}
-		return e.doDownload(path)
+		return e.doDownload(ctx, log, path)
+
+	case StrategyKeepBoth:
+		// 选项六：两个版本都保留
+		newName, err := e.freeConflictName(conflictCopyName(path, e.now()))
+		if err != nil {
+			return err
+		}
+		log.Info("冲突处理: 保留两个版本", "path", path, "copy", newName)
+		rec.Winner, rec.Copy = "remote", newName
+
+		// 1. 本地版本改名为冲突副本
+		if err := e.opts.LocalFS.Rename(path, newName); err != nil {
+			return fmt.Errorf("rename local failed: %w", err)
+		}
+		// 2. 原路径下载云端版本
+		if err := e.doDownload(ctx, log, path); err != nil {
+			return err
+		}
+		// 3. 冲突副本作为新文件上传并写入数据库，下一轮不会被当作删除
+		return e.doUpload(ctx, log, newName, fs.ExistFail)
 
 	default:
 		// 默认行为（防止配置错误）
-		slog.Warn("未知的冲突策略，跳过处理", "strategy", strategy)
+		log.Warn("未知的冲突策略，跳过处理", "strategy", strategy)
+		rec.Winner = "none"
 		return nil
 	}
 }
 
+// chooseConflictStrategy 决定本次冲突采用的策略
+// 配置了 ConflictResolver 时先询问它，出错或超时则回退到按路径匹配的静态策略，
+// 避免交互提示无人应答时卡住整个 Worker 池
+func (e *Engine) chooseConflictStrategy(ctx context.Context, log *slog.Logger, path string, local, remote *fs.FileMeta) ConflictStrategy {
+	fallback := e.conflictStrategyFor(path)
+	e.mu.RLock()
+	resolver, timeout := e.opts.ConflictResolver, e.opts.ConflictTimeout
+	e.mu.RUnlock()
+	if resolver == nil {
+		return fallback
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultConflictTimeout
+	}
+	askCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type answer struct {
+		strategy ConflictStrategy
+		err      error
+	}
+	ch := make(chan answer, 1)
+	go func() {
+		s, err := resolver(askCtx, path, local, remote)
+		ch <- answer{s, err}
+	}()
+
+	select {
+	case a := <-ch:
+		if a.err != nil {
+			log.Warn("交互式冲突处理失败，使用默认策略", "path", path, "strategy", fallback, "err", a.err)
+			return fallback
+		}
+		return a.strategy
+	case <-askCtx.Done():
+		log.Warn("等待冲突处理选择超时，使用默认策略", "path", path, "strategy", fallback, "timeout", timeout)
+		return fallback
+	}
+}
+
+// conflictCopyName 生成冲突副本的文件名，保留扩展名以便仍能用原来的程序打开
+// "docs/report.pdf" -> "docs/report.conflict-20060102-150405.pdf"
+func conflictCopyName(relPath string, t time.Time) string {
+	ext := fileExt(pathpkg.Base(relPath))
+	return strings.TrimSuffix(relPath, ext) + ".conflict-" + t.Format("20060102-150405") + ext
+}
+
+// progressFunc 为单个文件的传输生成进度回调；未配置 Progress 时返回 nil
+func (e *Engine) progressFunc(path string, op OpType) fs.ProgressFunc {
+	if e.opts.Progress == nil {
+		return nil
+	}
+	return func(done, total int64) {
+		e.opts.Progress(path, op, done, total)
+	}
+}
+
 // doUpload 上传流程：读取本地 -> 加密 -> 写入网盘 -> 更新DB
-func (e *Engine) doUpload(path string) error {
-	slog.Info("开始上传", "path", path)
+// onExist 为云端已有同名文件时的处理方式: 确定要替换云端版本时覆盖，预期云端没有该文件时不覆盖
+func (e *Engine) doUpload(ctx context.Context, log *slog.Logger, path string, onExist fs.ExistPolicy) error {
+	log.Info("开始上传", "path", path)
+
+	// 覆盖云端版本前确认它不是刚被修改的 (可能另一台设备正在写入)
+	if onExist == fs.ExistOverwrite {
+		if err := e.checkQuiet(e.opts.RemoteFS, "云端", path); err != nil {
+			return err
+		}
+	}
 
 	// 1. 打开本地流
 	reader, err := e.opts.LocalFS.OpenStream(path)
@@ -343,19 +900,46 @@ func (e *Engine) doUpload(path string) error {
 	}
 	defer reader.Close()
 
+	// 边读边计算明文 Hash (与 LocalFS.Stat 使用同一种算法)，用于确认上传的内容就是文件当前的内容
+	// 超时或取消后读取立即失败，让后端中止上传
+	stats := transferStatsFrom(ctx)
+	local := fs.NewCountingReader(e.throttle(ctx, fs.NewContextReader(ctx, reader)), &stats.upPlain)
+	plain, err := newHashingReader(local, fs.HashAlgorithmOf(e.opts.LocalFS))
+	if err != nil {
+		return err
+	}
+
 	// 2. 包装加密流 (Crypto Stream)
-	var uploadStream io.Reader = reader
+	var uploadStream io.Reader = plain
+	var storedSize int64
+	size, sized := streamSize(reader)
+	if sized {
+		storedSize = e.opts.RemoteFS.StoredSize(size, e.encrypted())
+	}
 	if len(e.opts.EncryptKey) > 0 {
-		encryptedReader, err := crypto.NewEncryptReader(reader, e.opts.EncryptKey)
+		encryptedReader, err := crypto.NewEncryptReader(plain, e.opts.EncryptKey)
 		if err != nil {
 			return fmt.Errorf("crypto init failed: %w", err)
 		}
 		uploadStream = encryptedReader
 	}
 
-	// 3. 传输到网盘 (返回云端密文 MD5)
+	// 3. 传输到网盘 (返回云端密文 MD5)，按交给后端的字节数 (密文) 统计上传量
 	// RemoteFS.WriteStream 必须返回 (cloudMD5, error)
-	cloudMD5, err := e.opts.RemoteFS.WriteStream(path, uploadStream, time.Now())
+	// 云端的 MD5 对大文件不可靠时，同时记录交给后端的内容的分片 MD5 列表 (见 remoteUnchanged)
+	// 事先不知道大小时 (本地流不是普通文件，例如 WebDAV) 按后端的分片大小计算，上传后再按实际大小决定是否记录
+	blockSize := e.blockHashSize(storedSize)
+	if !sized {
+		blockSize = e.remoteBlockSize()
+	}
+	blocks := newBlockHasher(blockSize)
+	uploadStream = blocks.tee(fs.NewCountingReader(uploadStream, &stats.upWire))
+	cloudMD5, err := fs.WriteStreamWithOptions(e.opts.RemoteFS, path, uploadStream, e.now(), &fs.WriteOptions{
+		Progress: e.progressFunc(path, OpUpload),
+		Context:  ctx,
+		OnExist:  onExist,
+		Size:     storedSize,
+	})
 	if err != nil {
 		return err
 	}
@@ -367,77 +951,232 @@ func (e *Engine) doUpload(path string) error {
 		return fmt.Errorf("stat local failed after upload: %w", err)
 	}
 
+	remoteBlocks := blocks.Sums()
+	if e.blockHashSize(e.opts.RemoteFS.StoredSize(plain.n, e.encrypted())) == 0 {
+		remoteBlocks = nil
+	}
+
 	newState := &database.FileState{
-		RelPath:      path,
+		RelPath:      e.dbKey(path),
 		FileSize:     stat.Size,               // 本地文件大小
 		ModTime:      stat.ModTime.UnixNano(), // 本地修改时间
 		LocalHash:    stat.Hash,               // 【重要】本地明文 Hash (由 LocalFS.Stat 计算)
 		RemoteHash:   cloudMD5,                // 【重要】云端密文 Hash (由 WriteStream 返回)
-		LastSyncTime: time.Now().Unix(),
+		RemoteBlocks: remoteBlocks,
+		Mode:         e.fileMode(stat),
+		FileID:       stat.FileID,
+		RemotePlain:  !e.encrypted(),
+	}
+
+	// 5. 上传期间文件被修改: 云端保存的是不完整的中间状态
+	// 此时按“实际上传的内容”记录基准，并把修改时间置零，保证下一轮一定判定为本地已修改并重新上传；
+	// 如果按当前文件记录，半截的云端副本会被当成已同步，或者下一轮被误判为冲突
+	if uploaded := plain.Sum(); stat.Hash != uploaded || stat.Size != plain.n {
+		log.Warn("文件在上传过程中被修改，将在下一轮重新上传",
+			"path", path,
+			"uploadedSize", plain.n,
+			"currentSize", stat.Size)
+		newState.FileSize = plain.n
+		newState.ModTime = 0
+		newState.LocalHash = uploaded
 	}
 
-	slog.Debug("更新数据库状态(Upload)",
+	log.Debug("更新数据库状态(Upload)",
 		"path", path,
 		"localHash", newState.LocalHash,
 		"remoteHash", newState.RemoteHash)
 
-	return e.opts.StateDB.Put(newState)
+	return e.putState(newState)
+}
+
+// streamSize 返回本地文件流的大小 (本地文件系统返回的是 *os.File)，无法得知时 ok 为 false
+func streamSize(r io.Reader) (size int64, ok bool) {
+	f, ok := r.(interface{ Stat() (iofs.FileInfo, error) })
+	if !ok {
+		return 0, false
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// hashingReader 在读取的同时计算 Hash 并统计字节数
+type hashingReader struct {
+	r io.Reader
+	h hash.Hash
+	n int64
+}
+
+func newHashingReader(r io.Reader, algorithm string) (*hashingReader, error) {
+	h, err := fs.NewHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &hashingReader{r: r, h: h}, nil
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.h.Write(p[:n])
+	h.n += int64(n)
+	return n, err
+}
+
+// Sum 返回已读取内容的 Hash (十六进制)
+func (h *hashingReader) Sum() string {
+	return hex.EncodeToString(h.h.Sum(nil))
 }
 
 // doDownload 下载流程：读取网盘 -> 解密 -> 写入本地 -> 更新DB
-func (e *Engine) doDownload(path string) error {
-	slog.Info("开始下载任务", "path", path)
+func (e *Engine) doDownload(ctx context.Context, log *slog.Logger, path string) error {
+	log.Info("开始下载任务", "path", path)
+
+	// 覆盖本地文件前确认它不是刚被修改的 (可能正在编辑)
+	if err := e.checkQuiet(e.opts.LocalFS, "本地", path); err != nil {
+		return err
+	}
+
+	// 1. 获取云端元数据 (为了恢复 MTime、获取 RemoteHash 以及计算下载进度)
+	remoteMeta, err := e.opts.RemoteFS.Stat(path)
+	if err != nil {
+		return err
+	}
 
-	// 1. 打开网盘流
-	reader, err := e.opts.RemoteFS.OpenStream(path)
+	// 开启加密之前上传的明文文件不解密，原样写入本地
+	base, err := e.opts.StateDB.Get(e.dbKey(path))
+	if err != nil {
+		return fmt.Errorf("读取同步记录失败: %w", err)
+	}
+	plain := e.remotePlain(remoteMeta, base)
+	encrypted := e.encrypted() && !plain
+	if plain {
+		log.Info("云端文件是开启加密之前上传的明文文件，不解密", "path", path)
+	}
+
+	// 先写入 .part 文件，写完并校验通过后再改名，校验失败时目标文件保持原样
+	// 本地文件系统支持 PartialWriter 时中断后下一轮从断点继续，否则每次从头下载
+	pw, partial := e.opts.LocalFS.(fs.PartialWriter)
+	resume := e.freshPoint(remoteMeta)
+	if partial {
+		resume = e.resumePartial(log, path, remoteMeta, encrypted)
+	}
+
+	// 2. 打开网盘流 (按网络上传输的密文字节统计进度)
+	// 读完云端记录的大小之前连接断开时，自动从断点重新连接
+	start := resume.storedOffset()
+	reader, err := e.openResuming(ctx, log, path, start, remoteMeta.Size)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
+	// 超时或取消时关闭网络流，中断卡住的读取
+	stop := context.AfterFunc(ctx, func() { reader.Close() })
+	defer stop()
+	stats := transferStatsFrom(ctx)
+	wire := fs.NewCountingReader(e.throttle(ctx, fs.NewContextReader(ctx, reader)), &stats.downWire)
+	// 云端的 MD5 对大文件不可靠时，同时记录云端内容的分片 MD5 列表 (续传时读不到前面的内容，不记录)
+	var blocks *blockHasher
+	if start == 0 {
+		blocks = newBlockHasher(e.blockHashSize(remoteMeta.Size))
+	}
+	wire = blocks.tee(wire)
+	var downStream io.Reader = fs.NewProgressReader(wire, remoteMeta.Size-start, e.progressFunc(path, OpDownload))
+	if resume.hash != nil {
+		downStream = io.TeeReader(downStream, resume.hash)
+	}
 
-	// 2. 包装解密流
-	var downStream io.Reader = reader
-	if len(e.opts.EncryptKey) > 0 {
-		decryptedReader, err := crypto.NewDecryptReader(reader, e.opts.EncryptKey)
+	// 3. 包装解密流
+	if encrypted && resume.offset > 0 {
+		decryptedReader, err := crypto.NewDecryptReaderAt(downStream, e.opts.EncryptKey, resume.iv, resume.offset)
+		if err != nil {
+			return fmt.Errorf("crypto init failed: %w", err)
+		}
+		downStream = decryptedReader
+	} else if encrypted {
+		decryptedReader, err := crypto.NewDecryptReader(downStream, e.opts.EncryptKey)
+		if errors.Is(err, crypto.ErrNotEncrypted) {
+			// 云端混有未加密的文件: 不写入本地，保留云端文件，由用户决定如何处理
+			log.Warn("云端文件不是加密文件，跳过下载", "path", path, "size", remoteMeta.Size)
+			return e.quarantine(log, path, remoteMeta, fmt.Errorf("%w (%s): %w", ErrCorruptCiphertext, path, err))
+		}
 		if err != nil {
 			return fmt.Errorf("crypto init failed: %w", err)
 		}
 		downStream = decryptedReader
 	}
 
-	// 3. 获取云端元数据 (为了恢复 MTime 和获取 RemoteHash)
-	remoteMeta, err := e.opts.RemoteFS.Stat(path)
+	// 4. 写入本地 (返回本地计算的明文 Hash)
+	// LocalFS.WriteStream 必须返回 (localHash, error)
+	downStream = fs.NewCountingReader(downStream, &stats.downPlain)
+	var localHash string
+	if partial {
+		// 写入失败时保留 .part，下一轮从已写入的位置继续
+		localHash, err = pw.WriteStreamAt(path+fs.PartSuffix, downStream, resume.offset, remoteMeta.ModTime)
+	} else {
+		// 不能续传，写入失败时删除 .part
+		localHash, err = e.opts.LocalFS.WriteStream(path+fs.PartSuffix, downStream, remoteMeta.ModTime)
+		if err != nil {
+			e.discardPartial(log, path)
+		}
+	}
 	if err != nil {
 		return err
 	}
-
-	// 4. 写入本地 (返回本地计算的明文 MD5)
-	// LocalFS.WriteStream 必须返回 (localMD5, error)
-	localMD5, err := e.opts.LocalFS.WriteStream(path, downStream, remoteMeta.ModTime)
-	if err != nil {
+	if err := e.checkPartial(log, path, remoteMeta, resume); err != nil {
 		return err
 	}
+	if encrypted {
+		if err := e.checkPlaintext(ctx, log, path, remoteMeta, base, blocks.Sums(), localHash); err != nil {
+			return e.quarantine(log, path, remoteMeta, fmt.Errorf("%w (%s)", err, path))
+		}
+	}
+	if err := e.opts.LocalFS.Rename(path+fs.PartSuffix, path); err != nil {
+		return fmt.Errorf("重命名下载完成的文件失败: %w", err)
+	}
+
+	// 恢复上次同步时记录的权限位 (开启 PreserveMode 时)
+	e.restoreMode(log, path)
 
 	// 5. 更新数据库
-	// 重新获取本地状态确保一致
-	localStat, err := e.opts.LocalFS.Stat(path)
+	// 重新获取本地状态确保一致 (Hash 已在写入时计算，这里不再读取文件内容)
+	localStat, err := fs.StatQuick(e.opts.LocalFS, path)
 	if err != nil {
 		return fmt.Errorf("stat local after download failed: %w", err)
 	}
 
 	newState := &database.FileState{
-		RelPath:      path,
+		RelPath:      e.dbKey(path),
 		FileSize:     localStat.Size,
 		ModTime:      localStat.ModTime.UnixNano(),
-		LocalHash:    localMD5,              // 【重要】本地明文 Hash
+		LocalHash:    localHash,             // 【重要】本地明文 Hash
 		RemoteHash:   remoteMeta.RemoteHash, // 【重要】云端密文 Hash
-		LastSyncTime: time.Now().Unix(),
+		RemoteBlocks: blocks.Sums(),
+		Mode:         e.fileMode(localStat),
+		FileID:       localStat.FileID,
+		RemotePlain:  !encrypted,
 	}
 
-	slog.Debug("更新数据库(Download)",
+	log.Debug("更新数据库(Download)",
 		"path", path,
 		"localHash", newState.LocalHash,
 		"remoteHash", newState.RemoteHash)
 
-	return e.opts.StateDB.Put(newState)
+	if err := e.putState(newState); err != nil {
+		return err
+	}
+	e.releaseQuarantine(log, path)
+	return nil
+}
+
+// now 返回引擎时钟的当前时间 (见 EngineOptions.Clock)
+func (e *Engine) now() time.Time {
+	return e.opts.Clock()
+}
+
+// putState 保存同步记录，LastSyncTime 取引擎时钟的当前时间
+func (e *Engine) putState(state *database.FileState) error {
+	state.LastSyncTime = e.now().UnixNano()
+	return e.opts.StateDB.Put(state)
 }
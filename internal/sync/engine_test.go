@@ -0,0 +1,255 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"baidusync/internal/database"
+	"baidusync/internal/fs/memfs"
+)
+
+// t0 测试中的固定时间，引擎与两侧的内存文件系统都使用它作为时钟
+var t0 = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// testEnv 用两个内存文件系统 (本地与云端) 和临时目录中的数据库组装同步引擎
+type testEnv struct {
+	t      *testing.T
+	local  *memfs.FS
+	remote *memfs.FS
+	db     *database.DB
+	now    time.Time
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	db, err := database.NewBoltDB(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	env := &testEnv{t: t, local: memfs.New("local"), remote: memfs.New("remote"), db: db, now: t0}
+	env.local.SetClock(env.clock)
+	env.remote.SetClock(env.clock)
+	return env
+}
+
+func (env *testEnv) clock() time.Time {
+	return env.now
+}
+
+// engine 创建引擎，mods 可以在创建前修改选项
+func (env *testEnv) engine(mods ...func(*EngineOptions)) *Engine {
+	opts := &EngineOptions{
+		LocalFS:    env.local,
+		RemoteFS:   env.remote,
+		StateDB:    env.db,
+		MaxWorkers: 2,
+		Clock:      env.clock,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	for _, mod := range mods {
+		mod(opts)
+	}
+	return NewEngine(opts)
+}
+
+// run 执行一轮同步，出错时测试失败
+func (env *testEnv) run(e *Engine) *RunResult {
+	env.t.Helper()
+	result, err := e.Run(context.Background())
+	if err != nil {
+		env.t.Fatalf("同步失败: %v", err)
+	}
+	return result
+}
+
+// runErr 执行一轮同步并返回错误
+func (env *testEnv) runErr(e *Engine) (*RunResult, error) {
+	env.t.Helper()
+	return e.Run(context.Background())
+}
+
+// advance 推进时钟
+func (env *testEnv) advance(d time.Duration) {
+	env.now = env.now.Add(d)
+}
+
+// wantFile 检查文件系统中 relPath 的内容
+func wantFile(t *testing.T, fsys *memfs.FS, relPath, want string) {
+	t.Helper()
+	got, ok := fsys.ReadFile(relPath)
+	if !ok {
+		t.Fatalf("%s: %s 不存在", fsys.Root(), relPath)
+	}
+	if string(got) != want {
+		t.Fatalf("%s: %s 的内容为 %q，应为 %q", fsys.Root(), relPath, got, want)
+	}
+}
+
+// wantMissing 检查文件系统中不存在 relPath
+func wantMissing(t *testing.T, fsys *memfs.FS, relPath string) {
+	t.Helper()
+	if fsys.Exists(relPath) {
+		t.Fatalf("%s: %s 不应存在", fsys.Root(), relPath)
+	}
+}
+
+// wantState 检查数据库中是否有 relPath 的记录
+func wantState(t *testing.T, db *database.DB, relPath string, exists bool) *database.FileState {
+	t.Helper()
+	state, err := db.Get(relPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists && state == nil {
+		t.Fatalf("数据库中没有 %s 的记录", relPath)
+	}
+	if !exists && state != nil {
+		t.Fatalf("数据库中不应有 %s 的记录", relPath)
+	}
+	return state
+}
+
+// wantIdle 再同步一轮，不应再有任何任务
+func (env *testEnv) wantIdle(e *Engine) {
+	env.t.Helper()
+	plan, err := e.Plan(context.Background())
+	if err != nil {
+		env.t.Fatal(err)
+	}
+	if len(plan.Tasks) > 0 {
+		env.t.Fatalf("同步后仍有 %d 个任务，第一个为 %s %s", len(plan.Tasks), plan.Tasks[0].Op, plan.Tasks[0].RelPath)
+	}
+}
+
+func TestRunUploadsAndDownloadsNewFiles(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("docs/a.txt", []byte("local a"), t0)
+	env.remote.PutFile("photos/b.jpg", []byte("remote b"), t0)
+	e := env.engine()
+
+	result := env.run(e)
+	if result.Succeeded[OpUpload] != 1 || result.Succeeded[OpDownload] != 1 {
+		t.Fatalf("上传 %d 个、下载 %d 个，应各为 1 个", result.Succeeded[OpUpload], result.Succeeded[OpDownload])
+	}
+	wantFile(t, env.remote, "docs/a.txt", "local a")
+	wantFile(t, env.local, "photos/b.jpg", "remote b")
+	wantState(t, env.db, "docs/a.txt", true)
+	wantState(t, env.db, "photos/b.jpg", true)
+	env.wantIdle(e)
+}
+
+func TestRunPropagatesDeletes(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("a"), t0)
+	env.local.PutFile("b.txt", []byte("b"), t0)
+	e := env.engine()
+	env.run(e)
+
+	env.local.Delete("a.txt")
+	env.remote.Delete("b.txt")
+	result := env.run(e)
+	if result.Succeeded[OpDeleteRemote] != 1 || result.Succeeded[OpDeleteLocal] != 1 {
+		t.Fatalf("删除云端 %d 个、删除本地 %d 个，应各为 1 个", result.Succeeded[OpDeleteRemote], result.Succeeded[OpDeleteLocal])
+	}
+	wantMissing(t, env.remote, "a.txt")
+	wantMissing(t, env.local, "b.txt")
+	wantState(t, env.db, "a.txt", false)
+	wantState(t, env.db, "b.txt", false)
+}
+
+func TestRunPropagatesModifications(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("v1"), t0)
+	e := env.engine()
+	env.run(e)
+
+	env.advance(time.Minute)
+	env.local.PutFile("a.txt", []byte("v2 local"), env.now)
+	env.run(e)
+	wantFile(t, env.remote, "a.txt", "v2 local")
+
+	env.advance(time.Minute)
+	env.remote.PutFile("a.txt", []byte("v3 remote"), env.now)
+	env.run(e)
+	wantFile(t, env.local, "a.txt", "v3 remote")
+	env.wantIdle(e)
+}
+
+func TestRunConflictRenameLocal(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("v1"), t0)
+	e := env.engine()
+	env.run(e)
+
+	env.advance(time.Minute)
+	env.local.PutFile("a.txt", []byte("local edit"), env.now)
+	env.remote.PutFile("a.txt", []byte("remote edit"), env.now)
+	result := env.run(e)
+	if result.Conflicts() != 1 {
+		t.Fatalf("处理了 %d 个冲突，应为 1 个", result.Conflicts())
+	}
+	wantFile(t, env.local, "a.txt", "remote edit")
+	wantFile(t, env.local, "a.txt.local", "local edit")
+
+	// 改名后的本地副本在下一轮作为新文件上传
+	env.run(e)
+	wantFile(t, env.remote, "a.txt.local", "local edit")
+	env.wantIdle(e)
+}
+
+func TestRunRebuildsLostDatabase(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("same"), t0)
+	env.local.PutFile("dir/b.txt", []byte("same too"), t0)
+	e := env.engine()
+	env.run(e)
+
+	// 换一个空数据库: 两侧一致的文件只重建记录，不传输
+	db, err := database.NewBoltDB(filepath.Join(t.TempDir(), "new.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	env.db = db
+	e = env.engine()
+	result := env.run(e)
+	if succeeded, failed := result.Total(); succeeded+failed != 0 {
+		t.Fatalf("重建记录时执行了 %d 个任务", succeeded+failed)
+	}
+	wantState(t, db, "a.txt", true)
+	wantState(t, db, "dir/b.txt", true)
+	env.wantIdle(e)
+}
+
+func TestRunReportsInjectedErrors(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("ok.txt", []byte("ok"), t0)
+	env.local.PutFile("bad.txt", []byte("bad"), t0)
+	boom := errors.New("写入失败")
+	env.remote.InjectError(memfs.OpWrite, "bad.txt", boom)
+	e := env.engine()
+
+	result, err := env.runErr(e)
+	var syncErr *SyncError
+	if !errors.As(err, &syncErr) || len(syncErr.Errors) != 1 || syncErr.Errors[0].RelPath != "bad.txt" || !errors.Is(err, boom) {
+		t.Fatalf("错误为 %v，应为 bad.txt 上传失败", err)
+	}
+	if result.Succeeded[OpUpload] != 1 || result.Failed[OpUpload] != 1 {
+		t.Fatalf("成功 %d 个、失败 %d 个上传，应各为 1 个", result.Succeeded[OpUpload], result.Failed[OpUpload])
+	}
+	wantFile(t, env.remote, "ok.txt", "ok")
+	wantState(t, env.db, "bad.txt", false)
+
+	// 错误消失后下一轮补上
+	env.remote.ClearErrors()
+	env.run(e)
+	wantFile(t, env.remote, "bad.txt", "bad")
+	env.wantIdle(e)
+}
@@ -0,0 +1,57 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxErrorSummary SyncError.Error 中最多列出的失败路径数
+const maxErrorSummary = 5
+
+// PathError 单个同步任务的失败
+type PathError struct {
+	RelPath string
+	Op      OpType
+	Err     error
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.RelPath, e.Err)
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// SyncError 一轮同步中失败的全部任务，由 Engine.Run 返回
+// 可以通过 errors.As 取出逐个路径的失败原因，errors.Is 会检查其中的每一个错误 (例如 ErrTaskTimeout)
+type SyncError struct {
+	Errors []*PathError
+}
+
+// Error 返回可读的摘要，只列出前 maxErrorSummary 个失败的路径
+func (e *SyncError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d 个任务失败", len(e.Errors))
+	for i, pe := range e.Errors {
+		if i == maxErrorSummary {
+			fmt.Fprintf(&b, "; 另有 %d 个", len(e.Errors)-maxErrorSummary)
+			break
+		}
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		b.WriteString(pe.Error())
+	}
+	return b.String()
+}
+
+func (e *SyncError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, pe := range e.Errors {
+		errs[i] = pe
+	}
+	return errs
+}
@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	"baidusync/internal/fs"
+)
+
+// excluded 路径是否被 Exclude 排除 (与某一项相同，或位于该目录之下)，或者位于 Subpath 之外
+func (e *Engine) excluded(path string) bool {
+	return !e.inScope(path) || underAny(path, e.opts.Exclude)
+}
+
+// inScope 路径是否位于 Subpath 之内 (Subpath 的上级目录不在范围内)
+// 按规范形式比较，扫描结果中的实际路径与数据库中的 Key 得到同样的结果
+func (e *Engine) inScope(path string) bool {
+	return e.opts.Subpath == "" || underAny(e.canonical(path), []string{e.canonical(e.opts.Subpath)})
+}
+
+// scopeUnreadable 只保留与 Subpath 有关的无法读取的路径: 范围之内的路径，以及范围的上级目录
+// (上级目录无法读取时范围本身也无法读取)。范围之外的路径无法读取不影响本轮同步
+func (e *Engine) scopeUnreadable(paths []string) []string {
+	if e.opts.Subpath == "" {
+		return paths
+	}
+	kept := paths[:0]
+	for _, p := range paths {
+		if e.inScope(p) || underAny(e.canonical(e.opts.Subpath), []string{e.canonical(p)}) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// underAny 路径是否与 dirs 中的某一项相同，或位于其下
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// dropUnder 从扫描结果中移除 dirs 中的路径及其下级
+func dropUnder(files map[string]*fs.FileMeta, dirs []string) {
+	if len(dirs) == 0 {
+		return
+	}
+	for path := range files {
+		if underAny(path, dirs) {
+			delete(files, path)
+		}
+	}
+}
+
+// tolerateScan 把 ListAll 返回的 *fs.ScanError 记录为警告并返回跳过的路径，其他错误原样返回
+func tolerateScan(log *slog.Logger, side string, err error) ([]string, error) {
+	var scanErr *fs.ScanError
+	if !errors.As(err, &scanErr) {
+		return nil, err
+	}
+	for i, path := range scanErr.Skipped {
+		var cause error
+		if i < len(scanErr.Errs) {
+			cause = scanErr.Errs[i]
+		}
+		log.Warn("路径无法读取，本轮跳过", "side", side, "path", path, "err", cause)
+	}
+	return scanErr.Skipped, nil
+}
+
+// dropExcluded 从扫描结果中移除被排除的路径
+// 两侧都要过滤：只过滤本地时，之前被上传过的副本会被当作云端新增的文件下载回来，覆盖正在使用的文件
+func (e *Engine) dropExcluded(files map[string]*fs.FileMeta) {
+	if len(e.opts.Exclude) == 0 && e.opts.Subpath == "" {
+		return
+	}
+	for path := range files {
+		if e.excluded(path) {
+			delete(files, path)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package sync
+
+import (
+	"log/slog"
+)
+
+// NewerRemoteGuard 云端文件比本地的新时，是否阻止用本地文件覆盖云端
+// 与 keep_latest 不同，它作用于所有上传任务 (不只是冲突)，用于防止本地被回滚 (例如从旧备份恢复) 后把旧内容覆盖到云端
+type NewerRemoteGuard int
+
+const (
+	// NewerRemoteOff (默认)：不检查，上传任务照常执行
+	NewerRemoteOff NewerRemoteGuard = iota
+	// NewerRemoteConflict：改为冲突，按 ConflictStrategy 处理
+	NewerRemoteConflict
+	// NewerRemoteSkip：本轮跳过，在日志与 status 中报告
+	NewerRemoteSkip
+)
+
+// ParseNewerRemoteGuard 解析配置中的 protect_newer_remote，未知值按 off 处理
+func ParseNewerRemoteGuard(s string) NewerRemoteGuard {
+	switch s {
+	case "conflict":
+		return NewerRemoteConflict
+	case "skip":
+		return NewerRemoteSkip
+	default:
+		return NewerRemoteOff
+	}
+}
+
+// String 返回配置中使用的名称 (用于日志)
+func (g NewerRemoteGuard) String() string {
+	switch g {
+	case NewerRemoteConflict:
+		return "conflict"
+	case NewerRemoteSkip:
+		return "skip"
+	default:
+		return "off"
+	}
+}
+
+// guardNewerRemote 按 ProtectNewerRemote 处理会覆盖较新云端文件的上传任务
+// 云端的修改时间 (上传时间) 比本地文件的修改时间晚超过 ModTimeTolerance，说明云端的内容是在本地这一版之后写入的
+func (e *Engine) guardNewerRemote(log *slog.Logger, plan *Plan) {
+	if e.opts.ProtectNewerRemote == NewerRemoteOff {
+		return
+	}
+	kept := plan.Tasks[:0]
+	guarded := 0
+	for _, t := range plan.Tasks {
+		if t.Op != OpUpload || t.Local == nil || t.Remote == nil || t.Local.IsDir || t.Remote.IsDir ||
+			t.Remote.ModTime.Sub(t.Local.ModTime) <= ModTimeTolerance {
+			kept = append(kept, t)
+			continue
+		}
+		guarded++
+		log.Warn("云端文件比本地的新，不用本地文件覆盖", "path", t.RelPath, "reason", t.Reason,
+			"local_mtime", t.Local.ModTime, "remote_mtime", t.Remote.ModTime, "guard", e.opts.ProtectNewerRemote)
+		if e.opts.ProtectNewerRemote == NewerRemoteSkip {
+			plan.GuardedUploads = append(plan.GuardedUploads, t)
+			continue
+		}
+		t.Op, t.Reason = OpConflict, "remote_newer"
+		kept = append(kept, t)
+	}
+	plan.Tasks = kept
+	if guarded > 0 {
+		log.Warn("!!! 有上传任务会用较旧的本地文件覆盖云端，已按 protect_newer_remote 处理 !!!",
+			"count", guarded, "guard", e.opts.ProtectNewerRemote)
+	}
+}
@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseNewerRemoteGuard(t *testing.T) {
+	for _, g := range []NewerRemoteGuard{NewerRemoteOff, NewerRemoteConflict, NewerRemoteSkip} {
+		if got := ParseNewerRemoteGuard(g.String()); got != g {
+			t.Errorf("ParseNewerRemoteGuard(%q) = %s", g.String(), got)
+		}
+	}
+}
+
+// rolledBack 同步后把本地 old.txt 换成一天前的备份 (修改时间比云端的上传时间早)，
+// 同时正常修改 new.txt (修改时间比云端晚)
+func rolledBack(t *testing.T, guard NewerRemoteGuard) (*testEnv, *Engine) {
+	t.Helper()
+	env := newTestEnv(t)
+	env.local.PutFile("old.txt", []byte("current"), t0)
+	env.local.PutFile("new.txt", []byte("v1"), t0)
+	e := env.engine(func(o *EngineOptions) { o.ProtectNewerRemote = guard })
+	env.run(e)
+
+	env.advance(time.Minute)
+	env.local.PutFile("old.txt", []byte("from backup"), t0.Add(-24*time.Hour))
+	env.local.PutFile("new.txt", []byte("v2"), env.now)
+	return env, e
+}
+
+func TestNewerRemoteGuardOff(t *testing.T) {
+	env, e := rolledBack(t, NewerRemoteOff)
+	env.run(e)
+	wantFile(t, env.remote, "old.txt", "from backup")
+	wantFile(t, env.remote, "new.txt", "v2")
+}
+
+func TestNewerRemoteGuardSkip(t *testing.T) {
+	env, e := rolledBack(t, NewerRemoteSkip)
+
+	plan, err := e.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.GuardedUploads) != 1 || plan.GuardedUploads[0].RelPath != "old.txt" {
+		t.Fatalf("跳过的上传为 %+v，应只有 old.txt", plan.GuardedUploads)
+	}
+	result := env.run(e)
+	if result.Succeeded[OpUpload] != 1 {
+		t.Fatalf("上传 %d 个，应只上传 new.txt", result.Succeeded[OpUpload])
+	}
+	// 较旧的本地文件不覆盖云端，两侧都保持原样，下一轮仍然跳过
+	wantFile(t, env.remote, "old.txt", "current")
+	wantFile(t, env.local, "old.txt", "from backup")
+	wantFile(t, env.remote, "new.txt", "v2")
+	if result := env.run(e); result.Succeeded[OpUpload] != 0 {
+		t.Fatalf("下一轮上传了 %d 个", result.Succeeded[OpUpload])
+	}
+}
+
+func TestNewerRemoteGuardConflict(t *testing.T) {
+	env, e := rolledBack(t, NewerRemoteConflict)
+
+	result := env.run(e)
+	if result.Conflicts() != 1 || result.Succeeded[OpUpload] != 1 {
+		t.Fatalf("冲突 %d 个、上传 %d 个，应各为 1 个", result.Conflicts(), result.Succeeded[OpUpload])
+	}
+	// 默认的 rename_local: 云端版本保留在原路径，本地的旧版本改名保存
+	wantFile(t, env.local, "old.txt", "current")
+	wantFile(t, env.local, "old.txt.local", "from backup")
+	wantFile(t, env.remote, "old.txt", "current")
+	wantFile(t, env.remote, "new.txt", "v2")
+}
@@ -0,0 +1,79 @@
+package sync
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"baidusync/internal/fs"
+	"baidusync/internal/fs/local"
+)
+
+func TestHashingReader(t *testing.T) {
+	content := strings.Repeat("hash me ", 5000)
+	md5Sum := md5.Sum([]byte(content))
+	sha256Sum := sha256.Sum256([]byte(content))
+	want := map[string]string{
+		fs.HashMD5:    hex.EncodeToString(md5Sum[:]),
+		fs.HashSHA256: hex.EncodeToString(sha256Sum[:]),
+	}
+	for algorithm, sum := range want {
+		// 分成很多次小块读取，结果与一次性计算相同
+		h, err := newHashingReader(iotest.HalfReader(strings.NewReader(content)), algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(h)
+		if err != nil || string(data) != content {
+			t.Fatalf("%s: 读取的内容不一致 (%v)", algorithm, err)
+		}
+		if h.Sum() != sum || h.n != int64(len(content)) {
+			t.Fatalf("%s: Hash 为 %s (%d 字节)，应为 %s (%d 字节)", algorithm, h.Sum(), h.n, sum, len(content))
+		}
+	}
+	if _, err := newHashingReader(strings.NewReader(""), "crc32"); err == nil {
+		t.Fatal("不支持的算法应返回错误")
+	}
+}
+
+func TestDownloadRecordsStreamedHash(t *testing.T) {
+	content := strings.Repeat("downloaded ", 3000)
+	for _, algorithm := range []string{fs.HashMD5, fs.HashSHA256} {
+		for _, encrypted := range []bool{false, true} {
+			name := algorithm
+			if encrypted {
+				name += "/encrypted"
+			}
+			t.Run(name, func(t *testing.T) {
+				env := newTestEnv(t)
+				adapter, err := local.NewAdapterWithHash(t.TempDir(), algorithm)
+				if err != nil {
+					t.Fatal(err)
+				}
+				mods := []func(*EngineOptions){func(o *EngineOptions) { o.LocalFS = adapter }}
+				if encrypted {
+					env.remote.PutFile("a.bin", encryptFor(t, content, keyA), t0)
+					mods = append(mods, withKey(keyA))
+				} else {
+					env.remote.PutFile("a.bin", []byte(content), t0)
+				}
+				e := env.engine(mods...)
+				env.run(e)
+
+				// 下载时边写入边计算的 Hash 与重新读取文件计算的一致
+				stat, err := adapter.Stat("a.bin")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if state := wantState(t, env.db, "a.bin", true); state.LocalHash != stat.Hash {
+					t.Fatalf("记录的 Hash 为 %s，重新计算的为 %s", state.LocalHash, stat.Hash)
+				}
+				env.wantIdle(e)
+			})
+		}
+	}
+}
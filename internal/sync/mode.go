@@ -0,0 +1,35 @@
+package sync
+
+import (
+	iofs "io/fs"
+	"log/slog"
+
+	"baidusync/internal/fs"
+)
+
+// fileMode 返回需要记录到数据库的权限位 (未开启 PreserveMode 时为 0，不记录)
+func (e *Engine) fileMode(m *fs.FileMeta) uint32 {
+	if !e.opts.PreserveMode {
+		return 0
+	}
+	return uint32(m.Mode.Perm())
+}
+
+// restoreMode 下载后恢复上次同步时记录的权限位
+// 网盘不保存权限，新下载的文件按默认权限创建，可执行位等权限会丢失
+func (e *Engine) restoreMode(log *slog.Logger, path string) {
+	if !e.opts.PreserveMode {
+		return
+	}
+	setter, ok := e.opts.LocalFS.(fs.ModeSetter)
+	if !ok {
+		return
+	}
+	base, err := e.opts.StateDB.Get(e.dbKey(path))
+	if err != nil || base == nil || base.Mode == 0 {
+		return
+	}
+	if err := setter.Chmod(path, iofs.FileMode(base.Mode)); err != nil {
+		log.Warn("恢复文件权限失败", "path", path, "mode", iofs.FileMode(base.Mode), "err", err)
+	}
+}
@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs/local"
+)
+
+func TestPreserveModeRoundTrip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 没有 POSIX 权限位")
+	}
+	env := newTestEnv(t)
+	root := t.TempDir()
+	script := filepath.Join(root, "run.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho v1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(script, 0755); err != nil { // 不受 umask 影响
+		t.Fatal(err)
+	}
+	preserve := func(o *EngineOptions) {
+		o.LocalFS = local.NewAdapter(root)
+		o.PreserveMode = true
+	}
+	e := env.engine(preserve)
+	env.run(e)
+	if state := wantState(t, env.db, "run.sh", true); os.FileMode(state.Mode) != 0755 {
+		t.Fatalf("记录的权限为 %v，应为 0755", os.FileMode(state.Mode))
+	}
+
+	// 另一台设备修改了脚本: 下载的新文件恢复可执行位
+	env.advance(time.Hour)
+	env.remote.PutFile("run.sh", []byte("#!/bin/sh\necho v2\n"), env.now)
+	env.run(e)
+	info, err := os.Stat(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(script); string(data) != "#!/bin/sh\necho v2\n" {
+		t.Fatalf("本地内容为 %q", data)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Fatalf("下载后权限为 %v，应为 0755", info.Mode().Perm())
+	}
+
+	// 未开启时不记录
+	env2 := newTestEnv(t)
+	root2 := t.TempDir()
+	os.WriteFile(filepath.Join(root2, "run.sh"), []byte("x"), 0755)
+	env2.run(env2.engine(func(o *EngineOptions) { o.LocalFS = local.NewAdapter(root2) }))
+	if state := wantState(t, env2.db, "run.sh", true); state.Mode != 0 {
+		t.Fatalf("未开启 PreserveMode 时记录了权限 %v", os.FileMode(state.Mode))
+	}
+}
@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+)
+
+// detectMoves 把“本地旧路径消失 (OpDeleteRemote) + 本地新路径出现 (OpUpload)”识别为本地的移动或改名，
+// 合并为一个 OpMoveRemote 任务，在云端直接移动文件而不是重新上传再删除
+// vanished 为 OpDeleteRemote 任务的路径对应的数据库记录 (只收集记录了 FileID 的)
+// 两者必须是同一个底层文件 (FileID 相同)，大小与修改时间也与记录一致 (移动不会改变它们，可以排除 inode 被新文件复用)；
+// 同一个 FileID 对应多个路径 (硬链接) 时无法确定谁是谁，保持原来的任务
+func (e *Engine) detectMoves(log *slog.Logger, plan *Plan, vanished map[string]*database.FileState) {
+	if len(vanished) == 0 {
+		return
+	}
+
+	// FileID -> 新出现的本地文件在 plan.Tasks 中的下标 (-1 表示有多个)
+	appeared := make(map[string]int)
+	for i, t := range plan.Tasks {
+		if t.Op != OpUpload || t.Remote != nil || t.Local == nil || t.Local.FileID == "" {
+			continue
+		}
+		if _, dup := appeared[t.Local.FileID]; dup {
+			appeared[t.Local.FileID] = -1
+			continue
+		}
+		appeared[t.Local.FileID] = i
+	}
+	sources := make(map[string]int) // FileID -> 旧路径的数量
+	for _, b := range vanished {
+		sources[b.FileID]++
+	}
+
+	merged := make(map[int]bool)
+	var moves []Task
+	for i, t := range plan.Tasks {
+		if t.Op != OpDeleteRemote {
+			continue
+		}
+		b := vanished[t.RelPath]
+		if b == nil || sources[b.FileID] != 1 {
+			continue
+		}
+		j, ok := appeared[b.FileID]
+		if !ok || j < 0 {
+			continue
+		}
+		l := plan.Tasks[j].Local
+		if l.Size != b.FileSize || l.ModTime.Sub(b.ModTimeAsTime()).Abs() >= ModTimeTolerance {
+			continue
+		}
+		log.Info("检测到本地移动，将在云端移动文件", "from", t.RelPath, "to", plan.Tasks[j].RelPath)
+		moves = append(moves, Task{Op: OpMoveRemote, RelPath: plan.Tasks[j].RelPath, From: t.RelPath, Local: l, Remote: t.Remote})
+		merged[i], merged[j] = true, true
+	}
+	if len(moves) == 0 {
+		return
+	}
+
+	tasks := plan.Tasks[:0]
+	for i, t := range plan.Tasks {
+		if !merged[i] {
+			tasks = append(tasks, t)
+		}
+	}
+	plan.Tasks = append(tasks, moves...)
+}
+
+// doMoveRemote 在云端把 t.From 移动到 t.RelPath，并把记录转移到新路径
+// 移动前重新读取本地文件，确认内容仍与原路径的记录一致；不一致或移动失败时退回为上传新路径 + 删除云端的旧路径
+func (e *Engine) doMoveRemote(ctx context.Context, log *slog.Logger, t Task) error {
+	base, err := e.opts.StateDB.Get(e.dbKey(t.From))
+	if err != nil {
+		return err
+	}
+	local, err := e.opts.LocalFS.Stat(t.RelPath)
+	if err != nil {
+		return fmt.Errorf("stat local failed: %w", err)
+	}
+
+	if base == nil || !isLocalSameAsBase(local, base) {
+		log.Info("本地文件内容已变化，改为上传", "from", t.From, "to", t.RelPath)
+		return e.uploadMoved(ctx, log, t)
+	}
+	if err := e.opts.RemoteFS.Rename(t.From, t.RelPath); err != nil {
+		log.Warn("云端移动失败，改为上传", "from", t.From, "to", t.RelPath, "err", err)
+		return e.uploadMoved(ctx, log, t)
+	}
+	log.Info("云端移动完成", "from", t.From, "to", t.RelPath)
+
+	state := *base
+	state.RelPath = e.dbKey(t.RelPath)
+	state.FileSize = local.Size
+	state.ModTime = local.ModTime.UnixNano()
+	state.LocalHash = local.Hash
+	state.FileID = local.FileID
+	state.Mode = e.fileMode(local)
+	if err := e.putState(&state); err != nil {
+		return err
+	}
+	return e.opts.StateDB.Delete(e.dbKey(t.From))
+}
+
+// uploadMoved 无法在云端移动时按原来的两个任务处理: 上传新路径，删除云端的旧路径
+func (e *Engine) uploadMoved(ctx context.Context, log *slog.Logger, t Task) error {
+	if err := e.doUpload(ctx, log, t.RelPath, fs.ExistFail); err != nil {
+		return err
+	}
+	if err := e.opts.RemoteFS.Delete(t.From); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return e.forgetPath(log, t.From)
+}
+
+// recordIdentities 为已同步的文件补记文件标识
+// 开启 DetectMoves 之前同步的文件没有记录标识，补记之后它们的移动才能被识别
+func (e *Engine) recordIdentities(log *slog.Logger, tasks []Task) {
+	for _, t := range tasks {
+		key := e.dbKey(t.RelPath)
+		state, err := e.opts.StateDB.Get(key)
+		if err != nil || state == nil {
+			continue
+		}
+		state.FileID = t.Local.FileID
+		if err := e.putState(state); err != nil {
+			log.Error("记录文件标识失败", "path", t.RelPath, "err", err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"baidusync/internal/fs/local"
+)
+
+// localEnv 使用临时目录作为本地文件系统 (开启文件标识) 的测试环境
+func localEnv(t *testing.T) (*testEnv, string, func(*EngineOptions)) {
+	t.Helper()
+	env := newTestEnv(t)
+	root := t.TempDir()
+	adapter := local.NewAdapter(root)
+	adapter.SetTrackIdentity(true)
+	return env, root, func(o *EngineOptions) {
+		o.LocalFS = adapter
+		o.DetectMoves = true
+	}
+}
+
+func writeLocal(t *testing.T, root, relPath, data string) {
+	t.Helper()
+	full := filepath.Join(root, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func moveLocal(t *testing.T, root, from, to string) {
+	t.Helper()
+	dst := filepath.Join(root, filepath.FromSlash(to))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(root, filepath.FromSlash(from)), dst); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetectLocalMove(t *testing.T) {
+	env, root, opts := localEnv(t)
+	writeLocal(t, root, "docs/report.pdf", "report")
+	writeLocal(t, root, "docs/notes.txt", "notes")
+	e := env.engine(opts)
+	env.run(e)
+	if wantState(t, env.db, "docs/report.pdf", true).FileID == "" {
+		t.Skip("当前系统不提供文件标识")
+	}
+
+	moveLocal(t, root, "docs/report.pdf", "archive/report-2024.pdf")
+	result := env.run(e)
+	if result.Succeeded[OpMoveRemote] != 1 || result.Succeeded[OpUpload] != 0 || result.Succeeded[OpDeleteRemote] != 0 {
+		t.Fatalf("移动 %d 个、上传 %d 个、删除 %d 个，应只在云端移动 1 个",
+			result.Succeeded[OpMoveRemote], result.Succeeded[OpUpload], result.Succeeded[OpDeleteRemote])
+	}
+	wantFile(t, env.remote, "archive/report-2024.pdf", "report")
+	wantMissing(t, env.remote, "docs/report.pdf")
+	wantState(t, env.db, "docs/report.pdf", false)
+	wantState(t, env.db, "archive/report-2024.pdf", true)
+	env.wantIdle(e)
+}
+
+func TestMovedAndModifiedIsUploaded(t *testing.T) {
+	env, root, opts := localEnv(t)
+	writeLocal(t, root, "a.txt", "original")
+	e := env.engine(opts)
+	env.run(e)
+	if wantState(t, env.db, "a.txt", true).FileID == "" {
+		t.Skip("当前系统不提供文件标识")
+	}
+
+	// 同一个文件改名后又修改了大小: 不能当作移动
+	moveLocal(t, root, "a.txt", "b.txt")
+	writeLocal(t, root, "b.txt", "modified content")
+	result := env.run(e)
+	if result.Succeeded[OpMoveRemote] != 0 || result.Succeeded[OpUpload] != 1 || result.Succeeded[OpDeleteRemote] != 1 {
+		t.Fatalf("移动 %d 个、上传 %d 个、删除 %d 个，应为上传 1 个并删除 1 个",
+			result.Succeeded[OpMoveRemote], result.Succeeded[OpUpload], result.Succeeded[OpDeleteRemote])
+	}
+	wantFile(t, env.remote, "b.txt", "modified content")
+	wantMissing(t, env.remote, "a.txt")
+}
+
+func TestMoveWithoutDetectMoves(t *testing.T) {
+	env, root, opts := localEnv(t)
+	off := func(o *EngineOptions) {
+		opts(o)
+		o.DetectMoves = false
+	}
+	writeLocal(t, root, "a.txt", "content")
+	e := env.engine(off)
+	env.run(e)
+
+	moveLocal(t, root, "a.txt", "b.txt")
+	result := env.run(e)
+	if result.Succeeded[OpMoveRemote] != 0 || result.Succeeded[OpUpload] != 1 || result.Succeeded[OpDeleteRemote] != 1 {
+		t.Fatalf("未开启时移动 %d 个、上传 %d 个、删除 %d 个", result.Succeeded[OpMoveRemote], result.Succeeded[OpUpload], result.Succeeded[OpDeleteRemote])
+	}
+	wantFile(t, env.remote, "b.txt", "content")
+}
@@ -0,0 +1,93 @@
+package sync
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+
+	"baidusync/internal/fs"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Collision 规范化后指向同一个 Key 的多个实际路径
+// 例如大小写不敏感时的 "Foo.txt" 与 "foo.txt"，或 NFC/NFD 两种写法的 "café"。
+// 引擎无法判断它们是否为同一个文件，因此跳过该 Key 并报告给用户。
+type Collision struct {
+	Key   string   `json:"key"`   // 规范化后的路径
+	Paths []string `json:"paths"` // 实际路径，带 "local:" / "remote:" 前缀
+}
+
+// normalizing 是否开启了路径规范化
+func (e *Engine) normalizing() bool {
+	return e.opts.NormalizeCase || e.opts.NormalizeUnicode
+}
+
+// canonical 返回路径的规范形式，用作本地/云端/数据库三方比对的 Key
+// Unicode 统一为 NFC；大小写不敏感时统一转为小写
+func (e *Engine) canonical(relPath string) string {
+	if e.opts.NormalizeUnicode {
+		relPath = norm.NFC.String(relPath)
+	}
+	if e.opts.NormalizeCase {
+		relPath = strings.ToLower(relPath)
+	}
+	return relPath
+}
+
+// dbKey 返回写入数据库时使用的 Key (未开启规范化时即原路径)
+func (e *Engine) dbKey(relPath string) string {
+	if !e.normalizing() {
+		return relPath
+	}
+	return e.canonical(relPath)
+}
+
+// canonicalMap 按规范化后的路径重新组织扫描结果
+// 同一侧有多个路径映射到同一个 Key 时，记录到 collisions 中
+func (e *Engine) canonicalMap(files map[string]*fs.FileMeta, side string, collisions map[string][]string) map[string]*fs.FileMeta {
+	result := make(map[string]*fs.FileMeta, len(files))
+	for path, meta := range files {
+		key := e.canonical(path)
+		if prev, ok := result[key]; ok {
+			if len(collisions[key]) == 0 {
+				collisions[key] = append(collisions[key], side+":"+prev.RelPath)
+			}
+			collisions[key] = append(collisions[key], side+":"+path)
+			continue
+		}
+		result[key] = meta
+	}
+	return result
+}
+
+// normalizeMaps 规范化两侧的扫描结果，并移除发生碰撞的 Key
+func (e *Engine) normalizeMaps(log *slog.Logger, localMap, remoteMap map[string]*fs.FileMeta) (map[string]*fs.FileMeta, map[string]*fs.FileMeta, []Collision) {
+	found := make(map[string][]string)
+	localMap = e.canonicalMap(localMap, "local", found)
+	remoteMap = e.canonicalMap(remoteMap, "remote", found)
+
+	collisions := make([]Collision, 0, len(found))
+	for key, paths := range found {
+		sort.Strings(paths)
+		delete(localMap, key)
+		delete(remoteMap, key)
+		collisions = append(collisions, Collision{Key: key, Paths: paths})
+		log.Warn("路径规范化后发生碰撞，跳过同步，请手动重命名", "key", key, "paths", paths)
+	}
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i].Key < collisions[j].Key })
+	return localMap, remoteMap, collisions
+}
+
+// actualPath 为规范化后的 Key 选择执行操作时使用的实际路径
+// 优先使用云端的写法 (云端按原样保存，必须精确匹配)，其次是本地、数据库中的写法；
+// 本地文件系统大小写/规范化不敏感，用云端的写法同样可以访问到本地文件
+func actualPath(key string, l, r *fs.FileMeta) string {
+	switch {
+	case r != nil:
+		return r.RelPath
+	case l != nil:
+		return l.RelPath
+	default:
+		return key
+	}
+}
@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+const (
+	cafeNFC = "café.txt"  // 单个字符 é
+	cafeNFD = "café.txt" // e + 组合重音符 (macOS 保存的写法)
+)
+
+func withNormalize(o *EngineOptions) {
+	o.NormalizeCase = true
+	o.NormalizeUnicode = true
+}
+
+func TestNormalizeMatchesBothSides(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("docs/readme.txt", []byte("readme"), t0)
+	env.remote.PutFile("Docs/README.txt", []byte("readme"), t0)
+	env.local.PutFile(cafeNFD, []byte("menu"), t0)
+	env.remote.PutFile(cafeNFC, []byte("menu"), t0)
+	e := env.engine(withNormalize)
+
+	// 两侧是同一个文件的不同写法: 只建立记录，不产生重复的副本
+	result := env.run(e)
+	if succeeded, failed := result.Total(); succeeded+failed != 0 {
+		t.Fatalf("执行了 %d 个任务，不同写法的同一文件不应传输", succeeded+failed)
+	}
+	wantMissing(t, env.remote, "docs/readme.txt")
+	wantMissing(t, env.remote, cafeNFD)
+	wantMissing(t, env.local, cafeNFC)
+	wantState(t, env.db, "docs/readme.txt", true)
+	wantState(t, env.db, cafeNFC, true)
+	env.wantIdle(e)
+}
+
+func TestNormalizeOffKeepsSpellingsApart(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("readme.txt", []byte("readme"), t0)
+	env.remote.PutFile("README.txt", []byte("readme"), t0)
+	env.run(env.engine())
+
+	// 未开启时是两个不同的文件，各自同步到另一侧
+	wantFile(t, env.remote, "readme.txt", "readme")
+	wantFile(t, env.local, "README.txt", "readme")
+}
+
+func TestNormalizeReportsCollisions(t *testing.T) {
+	env := newTestEnv(t)
+	env.remote.PutFile("Foo.txt", []byte("upper"), t0)
+	env.remote.PutFile("foo.txt", []byte("lower"), t0)
+	env.local.PutFile(cafeNFC, []byte("nfc"), t0)
+	env.local.PutFile(cafeNFD, []byte("nfd"), t0)
+	env.local.PutFile("ok.txt", []byte("ok"), t0)
+	e := env.engine(withNormalize)
+
+	plan, err := e.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Collision{
+		{Key: cafeNFC, Paths: []string{"local:" + cafeNFD, "local:" + cafeNFC}},
+		{Key: "foo.txt", Paths: []string{"remote:Foo.txt", "remote:foo.txt"}},
+	}
+	if !slices.EqualFunc(plan.Collisions, want, func(a, b Collision) bool {
+		return a.Key == b.Key && slices.Equal(a.Paths, b.Paths)
+	}) {
+		t.Fatalf("碰撞为 %+v，应为 %+v", plan.Collisions, want)
+	}
+
+	// 碰撞的路径不合并也不传输，其余文件照常同步
+	result := env.run(e)
+	if result.Succeeded[OpUpload] != 1 || result.Succeeded[OpDownload] != 0 {
+		t.Fatalf("上传 %d 个、下载 %d 个，应只上传 ok.txt", result.Succeeded[OpUpload], result.Succeeded[OpDownload])
+	}
+	wantFile(t, env.remote, "ok.txt", "ok")
+	wantMissing(t, env.local, "foo.txt")
+	wantMissing(t, env.local, "Foo.txt")
+	wantMissing(t, env.remote, cafeNFC)
+	wantState(t, env.db, "foo.txt", false)
+	wantState(t, env.db, cafeNFC, false)
+}
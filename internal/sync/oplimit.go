@@ -0,0 +1,55 @@
+package sync
+
+// OpLimits 按操作类型限制同时执行的任务数，0 表示不单独限制 (只受 MaxWorkers 限制)
+// 所有任务仍然共用 MaxWorkers (或自适应并发) 的总名额，这里的限制只是在总名额之内再为每类操作设上限，
+// 避免大量小文件的删除占满名额、让大文件的上传一直排队，反之亦然
+type OpLimits struct {
+	Uploads   int // 上传
+	Downloads int // 下载
+	Deletes   int // 删除文件 (本地与云端)
+}
+
+// lane 一类操作的任务队列
+type lane struct {
+	name    string
+	workers int
+	tasks   []Task
+}
+
+// lanes 把任务按操作类型分到各自的队列，每个队列的 Worker 数为该类操作的上限与 max 中较小的一个
+// 冲突、云端移动等其他任务放在同一个队列，只受 max 限制；保持任务原来的相对顺序
+func (e *Engine) lanes(tasks []Task, max int) []*lane {
+	limits := e.opts.OpLimits
+	upload := &lane{name: "upload", workers: laneWorkers(limits.Uploads, max)}
+	download := &lane{name: "download", workers: laneWorkers(limits.Downloads, max)}
+	del := &lane{name: "delete", workers: laneWorkers(limits.Deletes, max)}
+	other := &lane{name: "other", workers: max}
+
+	for _, t := range tasks {
+		switch t.Op {
+		case OpUpload:
+			upload.tasks = append(upload.tasks, t)
+		case OpDownload:
+			download.tasks = append(download.tasks, t)
+		case OpDeleteLocal, OpDeleteRemote:
+			del.tasks = append(del.tasks, t)
+		default:
+			other.tasks = append(other.tasks, t)
+		}
+	}
+
+	var lanes []*lane
+	for _, l := range []*lane{upload, download, del, other} {
+		if len(l.tasks) > 0 {
+			lanes = append(lanes, l)
+		}
+	}
+	return lanes
+}
+
+func laneWorkers(limit, max int) int {
+	if limit <= 0 || limit > max {
+		return max
+	}
+	return limit
+}
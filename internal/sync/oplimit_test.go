@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs/memfs"
+)
+
+func TestLaneWorkers(t *testing.T) {
+	tests := []struct{ limit, max, want int }{
+		{0, 8, 8},
+		{-1, 8, 8},
+		{2, 8, 2},
+		{8, 8, 8},
+		{16, 8, 8}, // 不超过总名额
+	}
+	for _, tt := range tests {
+		if got := laneWorkers(tt.limit, tt.max); got != tt.want {
+			t.Errorf("laneWorkers(%d, %d) = %d，应为 %d", tt.limit, tt.max, got, tt.want)
+		}
+	}
+}
+
+// gaugeFS 统计云端每类操作同时进行的最大数量，每个操作持续 hold
+type gaugeFS struct {
+	*memfs.FS
+	hold time.Duration
+
+	mu      sync.Mutex
+	running map[OpType]int
+	peak    map[OpType]int
+	total   int
+	peakAll int
+}
+
+func newGaugeFS(fsys *memfs.FS) *gaugeFS {
+	return &gaugeFS{FS: fsys, hold: 5 * time.Millisecond, running: make(map[OpType]int), peak: make(map[OpType]int)}
+}
+
+// enter 记录一个操作开始，返回结束时调用的函数
+func (g *gaugeFS) enter(op OpType) func() {
+	g.mu.Lock()
+	g.running[op]++
+	g.total++
+	g.peak[op] = max(g.peak[op], g.running[op])
+	g.peakAll = max(g.peakAll, g.total)
+	g.mu.Unlock()
+	time.Sleep(g.hold)
+	return func() {
+		g.mu.Lock()
+		g.running[op]--
+		g.total--
+		g.mu.Unlock()
+	}
+}
+
+func (g *gaugeFS) WriteStream(relPath string, stream io.Reader, modTime time.Time) (string, error) {
+	defer g.enter(OpUpload)()
+	return g.FS.WriteStream(relPath, stream, modTime)
+}
+
+func (g *gaugeFS) Delete(relPath string) error {
+	defer g.enter(OpDeleteRemote)()
+	return g.FS.Delete(relPath)
+}
+
+// OpenStream 下载从打开开始，到关闭数据流结束
+func (g *gaugeFS) OpenStream(relPath string) (io.ReadCloser, error) {
+	done := g.enter(OpDownload)
+	rc, err := g.FS.OpenStream(relPath)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	return &gaugedStream{ReadCloser: rc, done: done}, nil
+}
+
+type gaugedStream struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (s *gaugedStream) Close() error {
+	s.once.Do(s.done)
+	return s.ReadCloser.Close()
+}
+
+func TestOpLimitsRespected(t *testing.T) {
+	const n, workers = 12, 6
+	env := newTestEnv(t)
+	for i := range n {
+		env.local.PutFile(fmt.Sprintf("old/%02d.txt", i), []byte("old"), t0)
+	}
+	env.run(env.engine())
+
+	env.local.Delete("old")
+	for i := range n {
+		env.local.PutFile(fmt.Sprintf("up/%02d.txt", i), []byte("up"), t0)
+		env.remote.PutFile(fmt.Sprintf("down/%02d.txt", i), []byte("down"), t0)
+	}
+	gauge := newGaugeFS(env.remote)
+	limits := map[OpType]int{OpUpload: 2, OpDownload: 3, OpDeleteRemote: 1}
+	e := env.engine(func(o *EngineOptions) {
+		o.RemoteFS = gauge
+		o.MaxWorkers = workers
+		o.OpLimits = OpLimits{Uploads: limits[OpUpload], Downloads: limits[OpDownload], Deletes: limits[OpDeleteRemote]}
+	})
+
+	result := env.run(e)
+	for op, limit := range limits {
+		if result.Succeeded[op] != n {
+			t.Fatalf("%s 成功 %d 个，应为 %d 个", op, result.Succeeded[op], n)
+		}
+		if gauge.peak[op] > limit {
+			t.Errorf("%s 最多同时执行 %d 个，超过限制 %d", op, gauge.peak[op], limit)
+		}
+	}
+	// 各类操作同时进行，总数仍不超过 MaxWorkers
+	if gauge.peakAll > workers {
+		t.Errorf("最多同时执行 %d 个任务，超过 MaxWorkers %d", gauge.peakAll, workers)
+	}
+	if gauge.peakAll <= limits[OpDownload] {
+		t.Errorf("最多同时执行 %d 个任务，不同类型的操作应能并行", gauge.peakAll)
+	}
+}
@@ -0,0 +1,138 @@
+package sync
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"strings"
+
+	"baidusync/internal/crypto"
+	"baidusync/internal/fs"
+)
+
+// resumePoint 续传 .part 文件的起点
+type resumePoint struct {
+	offset int64     // .part 中已写入的明文字节数
+	iv     []byte    // 云端密文的 IV (续传加密文件时才有)
+	hash   hash.Hash // 校验云端 Hash 用的 MD5，已写入 offset 之前的云端内容 (云端没有可靠的 MD5 时为 nil)
+}
+
+// storedOffset 续传时云端文件的起始偏移量 (加密文件要跳过密文头部)
+func (p *resumePoint) storedOffset() int64 {
+	if p.offset > 0 && p.iv != nil {
+		return p.offset + crypto.HeaderSize
+	}
+	return p.offset
+}
+
+// resumePartial 检查上次中断留下的 .part 文件，返回本次下载的起点
+// .part 的修改时间与云端不一致 (云端文件已被修改)、大小不小于云端文件、后端不支持按偏移量读取，
+// 或者读取已下载的部分失败时，丢弃 .part 从头下载
+// encrypted 为云端文件是否加密 (开启加密时云端也可能是之前上传的明文文件)
+func (e *Engine) resumePartial(log *slog.Logger, path string, remote *fs.FileMeta, encrypted bool) *resumePoint {
+	fresh := e.freshPoint(remote)
+
+	part, err := e.opts.LocalFS.Stat(path + fs.PartSuffix)
+	if err != nil || part.IsDir || part.Size == 0 {
+		return fresh
+	}
+	size := remote.Size
+	if encrypted {
+		size = e.plainSize(remote)
+	}
+	_, ranged := e.opts.RemoteFS.(fs.RangeOpener)
+	if !ranged || part.Size >= size || part.ModTime.Unix() != remote.ModTime.Unix() {
+		log.Info("丢弃过期的未完成下载，重新下载", "path", path, "part_size", part.Size)
+		return fresh
+	}
+
+	p := &resumePoint{offset: part.Size}
+	if encrypted {
+		if p.iv, err = e.readIV(path); err != nil {
+			log.Warn("读取云端文件的密文头部失败，重新下载", "path", path, "err", err)
+			return fresh
+		}
+	}
+	if fresh.hash != nil {
+		if p.hash, err = e.hashPartial(path, p); err != nil {
+			log.Warn("读取未完成的下载失败，重新下载", "path", path, "err", err)
+			return fresh
+		}
+	}
+	log.Info("从上次中断处继续下载", "path", path, "offset", p.offset, "size", size)
+	return p
+}
+
+// freshPoint 从头下载的起点，云端的 MD5 可靠时边下载边计算，写完后据此校验 (见 checkPartial)
+func (e *Engine) freshPoint(remote *fs.FileMeta) *resumePoint {
+	p := &resumePoint{}
+	if e.verifiable(remote) {
+		p.hash = md5.New()
+	}
+	return p
+}
+
+// verifiable 下载完成后能否用云端的 MD5 校验内容 (列表中的 MD5 对大文件不可靠时不校验，见 fs.BlockHasher)
+func (e *Engine) verifiable(remote *fs.FileMeta) bool {
+	return e.trustedHash(remote) && len(remote.RemoteHash) == md5.Size*2
+}
+
+// readIV 读取云端加密文件的密文头部
+func (e *Engine) readIV(path string) ([]byte, error) {
+	rc, err := e.opts.RemoteFS.OpenStream(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	iv := make([]byte, crypto.HeaderSize)
+	if _, err := io.ReadFull(rc, iv); err != nil {
+		return nil, err
+	}
+	return iv, nil
+}
+
+// hashPartial 计算 .part 中已下载部分对应的云端内容的 MD5
+// 加密文件用同一个 IV 重新加密得到云端的密文 (CTR 模式的结果是确定的)
+func (e *Engine) hashPartial(path string, p *resumePoint) (hash.Hash, error) {
+	rc, err := e.opts.LocalFS.OpenStream(path + fs.PartSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var stored io.Reader = io.LimitReader(rc, p.offset)
+	if p.iv != nil {
+		if stored, err = crypto.NewEncryptReaderWithIV(stored, e.opts.EncryptKey, p.iv); err != nil {
+			return nil, err
+		}
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, stored); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// checkPartial 用云端的 MD5 校验写完的 .part 文件，不一致时删除 .part
+func (e *Engine) checkPartial(log *slog.Logger, path string, remote *fs.FileMeta, p *resumePoint) error {
+	if p.hash == nil {
+		return nil
+	}
+	got := hex.EncodeToString(p.hash.Sum(nil))
+	if strings.EqualFold(got, remote.RemoteHash) {
+		return nil
+	}
+	e.discardPartial(log, path)
+	return fmt.Errorf("下载的文件 %s 校验失败: 云端 MD5 %s，下载内容的 MD5 %s", path, remote.RemoteHash, got)
+}
+
+// discardPartial 删除校验失败或无法续传的 .part 文件
+func (e *Engine) discardPartial(log *slog.Logger, path string) {
+	if err := e.opts.LocalFS.Delete(path + fs.PartSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warn("删除未完成的下载失败", "path", path, "err", err)
+	}
+}
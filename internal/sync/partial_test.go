@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs"
+	"baidusync/internal/fs/local"
+)
+
+// partialEnv 本地使用临时目录 (支持续传写入)，云端支持按偏移量读取
+func partialEnv(t *testing.T, content string) (*testEnv, string, *blippingFS, *Engine) {
+	t.Helper()
+	shortenRetryDelay(t)
+	env := newTestEnv(t)
+	root := t.TempDir()
+	env.remote.PutFile("a.bin", []byte(content), t0)
+	remote := &blippingFS{FS: env.remote}
+	e := env.engine(func(o *EngineOptions) {
+		o.LocalFS = local.NewAdapter(root)
+		o.RemoteFS = rangeBlippingFS{remote}
+		o.DownloadRetries = 1
+	})
+	return env, root, remote, e
+}
+
+// writePart 写入未完成的下载，修改时间为 modTime
+func writePart(t *testing.T, root, relPath, data string, modTime time.Time) {
+	t.Helper()
+	writeLocal(t, root, relPath+fs.PartSuffix, data)
+	if err := os.Chtimes(filepath.Join(root, relPath+fs.PartSuffix), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wantLocalFile 检查本地目录中的文件内容，并确认没有残留 .part
+func wantLocalFile(t *testing.T, root, relPath, want string) {
+	t.Helper()
+	got, err := os.ReadFile(filepath.Join(root, relPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("%s 的内容为 %q，应为 %q", relPath, got, want)
+	}
+	if _, err := os.Stat(filepath.Join(root, relPath+fs.PartSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("%s 仍有未完成的下载", relPath)
+	}
+}
+
+func TestDownloadResumesInterruptedPart(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	env, root, remote, e := partialEnv(t, content)
+
+	// 第一轮: 首次连接与唯一一次重试都在 30 字节后断开，已下载的 60 字节保留在 .part 中
+	remote.limit, remote.cuts = 30, 2
+	if _, err := env.runErr(e); err == nil {
+		t.Fatal("下载中断时应返回错误")
+	}
+	part, err := os.ReadFile(filepath.Join(root, "a.bin"+fs.PartSuffix))
+	if err != nil || string(part) != content[:60] {
+		t.Fatalf(".part 的内容为 %q (%v)，应为前 60 字节", part, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.bin")); !os.IsNotExist(err) {
+		t.Fatal("下载完成前不应出现目标文件")
+	}
+	wantState(t, env.db, "a.bin", false)
+
+	// 第二轮从 .part 的末尾继续，.part 本身不会被当作新文件上传
+	remote.offsets = nil
+	env.run(e)
+	if want := []int64{60}; !slices.Equal(remote.offsets, want) {
+		t.Fatalf("续传的偏移量为 %v，应为 %v", remote.offsets, want)
+	}
+	wantLocalFile(t, root, "a.bin", content)
+	wantMissing(t, env.remote, "a.bin"+fs.PartSuffix)
+	if state := wantState(t, env.db, "a.bin", true); state.LocalHash != md5Hex(content) {
+		t.Fatalf("记录的 Hash 为 %s，应为完整文件的 Hash", state.LocalHash)
+	}
+	env.wantIdle(e)
+}
+
+func TestDownloadDiscardsStalePart(t *testing.T) {
+	content := strings.Repeat("abcdefghij", 10)
+	tests := []struct {
+		name    string
+		data    string
+		modTime time.Time
+	}{
+		// 云端在上次下载之后被修改过
+		{"modified", content[:40], t0.Add(-time.Hour)},
+		// 不小于云端文件，不可能是未完成的下载
+		{"oversized", content + "extra", t0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, root, remote, e := partialEnv(t, content)
+			writePart(t, root, "a.bin", tt.data, tt.modTime)
+
+			env.run(e)
+			if len(remote.offsets) != 0 {
+				t.Fatalf("按偏移量 %v 续传，应从头下载", remote.offsets)
+			}
+			wantLocalFile(t, root, "a.bin", content)
+		})
+	}
+}
+
+func TestDownloadRejectsMismatchedPart(t *testing.T) {
+	content := strings.Repeat("abcdefghij", 10)
+	env, root, _, e := partialEnv(t, content)
+	// 修改时间与云端一致，但已下载的内容与云端不同 (例如磁盘损坏)
+	writePart(t, root, "a.bin", strings.Repeat("X", 40), t0)
+
+	_, err := env.runErr(e)
+	if err == nil || !strings.Contains(err.Error(), "校验失败") {
+		t.Fatalf("错误为 %v，应为校验失败", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.bin")); !os.IsNotExist(err) {
+		t.Fatal("校验失败时不应生成目标文件")
+	}
+
+	// 校验失败后 .part 已被删除，下一轮从头下载
+	env.run(e)
+	wantLocalFile(t, root, "a.bin", content)
+}
@@ -0,0 +1,54 @@
+package sync
+
+import (
+	"crypto/md5"
+	"strings"
+
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+)
+
+// remotePlain 判断云端文件是否是以明文存储的旧文件 (开启加密之前上传的)
+// 密文没有可识别的标记 (头部只是随机的 IV)，只能依据同步记录判断: 云端文件自记录以来未变化，
+// 并且大小等于明文大小 (没有加密开销)。没有可靠 Hash 时以记录中的标记为准；
+// 云端被替换过的文件一律按加密文件处理
+func (e *Engine) remotePlain(r *fs.FileMeta, b *database.FileState) bool {
+	if !e.encrypted() || r == nil || b == nil || r.IsDir || b.IsDir {
+		return false
+	}
+	if r.Size != e.opts.RemoteFS.StoredSize(b.FileSize, false) {
+		return false
+	}
+	if e.opts.RemoteFS.HasContentHash() && r.RemoteHash != "" && b.RemoteHash != "" {
+		return r.RemoteHash == b.RemoteHash
+	}
+	return b.RemotePlain
+}
+
+// isPlainCopy 没有同步记录时判断云端文件是否是本地文件的明文副本
+// 云端的 MD5 与本地明文的 MD5 相同说明云端未加密 (加密后的内容不可能与明文一致)
+// 扫描结果中没有本地 Hash 时，只为大小吻合的文件计算一次，结果保存到 l.Hash
+func (e *Engine) isPlainCopy(l, r *fs.FileMeta) bool {
+	if !e.encrypted() || !e.opts.RemoteFS.HasContentHash() || fs.HashAlgorithmOf(e.opts.LocalFS) != fs.HashMD5 {
+		return false
+	}
+	if len(r.RemoteHash) != md5.Size*2 || r.Size != e.opts.RemoteFS.StoredSize(l.Size, false) {
+		return false
+	}
+	if l.Hash == "" {
+		stat, err := e.opts.LocalFS.Stat(l.RelPath)
+		if err != nil || stat.Size != l.Size {
+			return false
+		}
+		l.Hash = stat.Hash
+	}
+	return strings.EqualFold(l.Hash, r.RemoteHash)
+}
+
+// migratePlain 开启 MigratePlain 时把两侧一致、但云端仍是明文的文件重新加密上传
+func (e *Engine) migratePlain(path string, l, r *fs.FileMeta, b *database.FileState) (Task, bool) {
+	if !e.opts.MigratePlain || l == nil || l.IsDir || !e.remotePlain(r, b) {
+		return Task{}, false
+	}
+	return Task{Op: OpUpload, RelPath: path, Reason: "migrate_plain", Local: l, Remote: r}, true
+}
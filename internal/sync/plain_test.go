@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"baidusync/internal/crypto"
+	"baidusync/internal/database"
+)
+
+// decryptedRemote 读取云端文件并用 key 解密
+func decryptedRemote(t *testing.T, env *testEnv, relPath string, key []byte) string {
+	t.Helper()
+	data, ok := env.remote.ReadFile(relPath)
+	if !ok {
+		t.Fatalf("云端没有 %s", relPath)
+	}
+	r, err := crypto.NewDecryptReader(bytes.NewReader(data), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(plain)
+}
+
+// mixedRemote 先不加密同步 legacy.txt，再开启加密同步新文件 new.txt，得到明文与密文混合的云端
+func mixedRemote(t *testing.T, mods ...func(*EngineOptions)) (*testEnv, *Engine) {
+	t.Helper()
+	env := newTestEnv(t)
+	env.local.PutFile("legacy.txt", []byte("legacy plain"), t0)
+	env.run(env.engine())
+
+	env.local.PutFile("new.txt", []byte("new secret"), t0)
+	e := env.engine(append([]func(*EngineOptions){withKey(keyA)}, mods...)...)
+	env.run(e)
+	return env, e
+}
+
+func TestMixedRemoteKeepsLegacyPlainFiles(t *testing.T) {
+	env, e := mixedRemote(t)
+
+	// 旧文件保持明文，不会被当作密文解密后写回本地
+	wantFile(t, env.remote, "legacy.txt", "legacy plain")
+	wantFile(t, env.local, "legacy.txt", "legacy plain")
+	if state := wantState(t, env.db, "legacy.txt", true); !state.RemotePlain {
+		t.Fatal("legacy.txt 应记录为云端明文")
+	}
+	if got := decryptedRemote(t, env, "new.txt", keyA); got != "new secret" {
+		t.Fatalf("new.txt 解密后为 %q", got)
+	}
+	if state := wantState(t, env.db, "new.txt", true); state.RemotePlain {
+		t.Fatal("new.txt 不应记录为云端明文")
+	}
+	env.wantIdle(e)
+}
+
+func TestMixedRemoteRebuildsLostDatabase(t *testing.T) {
+	env, _ := mixedRemote(t)
+
+	// 数据库丢失后按内容重新识别明文副本
+	db, err := database.NewBoltDB(filepath.Join(t.TempDir(), "new.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	env.db = db
+	e := env.engine(withKey(keyA))
+	env.run(e)
+
+	if state := wantState(t, db, "legacy.txt", true); !state.RemotePlain {
+		t.Fatal("重建后 legacy.txt 应记录为云端明文")
+	}
+	wantFile(t, env.local, "legacy.txt", "legacy plain")
+	wantFile(t, env.local, "new.txt", "new secret")
+	env.wantIdle(e)
+}
+
+func TestMigratePlainReencryptsLegacyFiles(t *testing.T) {
+	env, e := mixedRemote(t, func(o *EngineOptions) { o.MigratePlain = true })
+
+	if got := decryptedRemote(t, env, "legacy.txt", keyA); got != "legacy plain" {
+		t.Fatalf("legacy.txt 解密后为 %q", got)
+	}
+	if state := wantState(t, env.db, "legacy.txt", true); state.RemotePlain {
+		t.Fatal("迁移后 legacy.txt 不应再记录为云端明文")
+	}
+	wantFile(t, env.local, "legacy.txt", "legacy plain")
+	env.wantIdle(e)
+}
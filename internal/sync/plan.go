@@ -0,0 +1,253 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+	"golang.org/x/sync/errgroup"
+)
+
+// Plan 一轮同步的执行计划
+// 生成计划只会读取本地、云端和数据库，不做任何修改，因此可以安全地用于预览 (status 命令)
+type Plan struct {
+	// Tasks 需要执行的同步任务
+	Tasks []Task
+	// Rebuilds 两边一致但数据库中缺少记录、需要静默重建索引的路径
+	Rebuilds []Task
+	// InSync 两边一致、无需处理的路径数量 (不含 Rebuilds 与 Orphans)
+	InSync int
+	// Orphans 两侧都已不存在、且超过 PruneOrphansAfter 未同步的数据库记录 (未开启清理时为空)
+	Orphans []*database.FileState
+	// Oversized 文件超过 MaxFileSize、本轮跳过的任务
+	Oversized []Task
+	// remote 扫描时云端的目录结构 (用于本轮结束后清理变空的云端目录)
+	remote *remoteTree
+	// keyRef 确认密钥用的参照文件 (见 checkKey)，没有合适的文件时为空
+	keyRef *keyRef
+	// Unreadable 扫描时无法读取的路径 (例如没有权限的目录)，连同下级本轮都不参与比对
+	// 只有一侧无法读取时另一侧的同名路径同样跳过，避免被当作已删除
+	Unreadable []string
+	// Collisions 开启路径规范化后，同一侧有多个路径映射到同一个 Key，本轮跳过不处理
+	Collisions []Collision
+	// HeldDeletes 扫描不完整 (Unreadable 不为空) 时本轮暂缓执行的删除任务 (开启 DeleteOnPartialScan 时为空)
+	HeldDeletes []Task
+	// TypeClashes 一侧是文件、另一侧是目录，按 TypeClash (skip) 本轮不处理的路径 (下级的任务同样跳过)
+	TypeClashes []Task
+	// Identities 开启 DetectMoves 后，两边一致但记录中缺少 (或是过时的) 文件标识的路径，本轮补记
+	Identities []Task
+	// Signatures 两侧内容与记录一致、但记录需要更新的路径: 开启 VerifyLocalChanges 后本地修改时间 (或文件标识) 变化，
+	// 或者云端大文件报告的 Hash 变化但分片 MD5 列表一致 (见 remoteUnchanged)，本轮更新记录中的签名与云端 Hash
+	Signatures []Task
+	// Quarantined 开启 QuarantineUndecryptable 后，云端文件无法解密、自隔离以来没有变化，本轮跳过的下载任务
+	Quarantined []Task
+	// GuardedUploads 按 ProtectNewerRemote (skip) 本轮跳过的上传任务: 云端文件比本地的新
+	GuardedUploads []Task
+}
+
+// Plan 扫描本地、云端与数据库，生成本轮同步的执行计划，但不执行
+func (e *Engine) Plan(ctx context.Context) (*Plan, error) {
+	runID := RunIDFromContext(ctx)
+	if runID == "" {
+		runID = NewRunID()
+	}
+	return e.plan(ctx, e.opts.Logger.With("run_id", runID))
+}
+
+// plan 生成执行计划的内部实现
+func (e *Engine) plan(ctx context.Context, log *slog.Logger) (*Plan, error) {
+	// 1. 获取本地与云端状态 (并发获取以加速)
+	// 数据库中的基准状态不整体加载，而是在第 2 步中流式遍历，以控制内存占用
+	// 个别路径无法读取 (*fs.ScanError) 时只跳过这些路径，不中止整轮同步
+	var (
+		localMap      map[string]*fs.FileMeta
+		remoteMap     map[string]*fs.FileMeta
+		localSkipped  []string
+		remoteSkipped []string
+	)
+
+	// 一侧扫描失败时取消另一侧，不必等它扫描完
+	g, gctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		var err error
+		localMap, err = fs.ListAll(gctx, e.opts.LocalFS)
+		if localSkipped, err = tolerateScan(log, "local", err); err != nil {
+			return fmt.Errorf("scan local failed: %w", err)
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		var err error
+		remoteMap, err = fs.ListAll(gctx, e.opts.RemoteFS)
+		if remoteSkipped, err = tolerateScan(log, "remote", err); err != nil {
+			// 云端根目录在两轮同步之间消失 (被移走或删除) 时不能继续比对，否则所有文件都会被当作已在云端删除
+			if errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("云端目录 %s 不存在，本轮不同步 (目录被移走或删除？): %w", e.opts.RemoteFS.Root(), err)
+			}
+			return fmt.Errorf("scan remote failed: %w", err)
+		}
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	e.dropExcluded(localMap)
+	e.dropExcluded(remoteMap)
+
+	// 2. 生成任务队列
+	plan := &Plan{Tasks: make([]Task, 0)}
+	if e.normalizing() {
+		// 两侧的 Key 统一为规范形式，与数据库中的 Key 保持一致
+		localMap, remoteMap, plan.Collisions = e.normalizeMaps(log, localMap, remoteMap)
+	}
+	plan.Unreadable = e.scopeUnreadable(append(localSkipped, remoteSkipped...))
+	unreadableKeys := make([]string, len(plan.Unreadable))
+	for i, path := range plan.Unreadable {
+		unreadableKeys[i] = e.canonical(path)
+	}
+	dropUnder(localMap, unreadableKeys)
+	dropUnder(remoteMap, unreadableKeys)
+	plan.remote = newRemoteTree(remoteMap)
+	collided := make(map[string]bool, len(plan.Collisions))
+	for _, c := range plan.Collisions {
+		collided[c.Key] = true
+	}
+	var orphanBefore time.Time
+	if e.opts.PruneOrphansAfter > 0 {
+		orphanBefore = e.now().Add(-e.opts.PruneOrphansAfter)
+	}
+	// vanished: 本地消失、将要删除云端的文件的记录，用于识别本地的移动 (见 detectMoves)
+	vanished := make(map[string]*database.FileState)
+	// sources: 两侧一致的文件，新文件与其内容相同时可以在云端复制 (后端支持时)
+	// clashes: 类型冲突的路径 (规范形式)，其下级的任务本轮跳过
+	var clashes []string
+	var sources copySources
+	if _, ok := e.opts.RemoteFS.(fs.Copier); ok {
+		sources = make(copySources)
+	}
+
+	visit := func(key string, l, r *fs.FileMeta, b *database.FileState) {
+		// 任务使用实际路径执行，未开启规范化时与 key 相同
+		path := actualPath(key, l, r)
+		// 调用 diff.go 中的 compare 逻辑
+		op := e.compare(ctx, log, path, l, r, b)
+		t := Task{Op: op, RelPath: path, Local: l, Remote: r}
+
+		if op == OpTypeClash {
+			clashes = append(clashes, key)
+		}
+		switch {
+		case op == OpTypeClash && e.opts.TypeClash == TypeClashSkip:
+			log.Warn("同一路径在一侧是文件、另一侧是目录，跳过 (可设置 type_clash 自动处理)",
+				"path", path, "local_dir", l.IsDir, "remote_dir", r.IsDir)
+			plan.TypeClashes = append(plan.TypeClashes, t)
+		case op != OpIgnore && e.oversized(&t):
+			log.Info("文件超过大小限制，跳过", "path", path, "op", op, "size", t.Size(), "max_file_size", e.opts.MaxFileSize)
+			plan.Oversized = append(plan.Oversized, t)
+		case op != OpIgnore:
+			plan.Tasks = append(plan.Tasks, t)
+			if e.opts.DetectMoves && op == OpDeleteRemote && b != nil && b.FileID != "" {
+				vanished[path] = b
+			}
+		case b == nil && l != nil && r != nil && l.IsDir == r.IsDir:
+			plan.Rebuilds = append(plan.Rebuilds, t)
+		default:
+			if m, ok := e.migratePlain(path, l, r, b); ok {
+				plan.Tasks = append(plan.Tasks, m)
+				return
+			}
+			plan.InSync++
+			e.pickKeyRef(plan, path, r, b)
+			// 明文副本不能作为复制来源 (复制得到的新文件也是明文)
+			if sources != nil && b != nil && l != nil && r != nil && !e.remotePlain(r, b) {
+				sources.add(path, b)
+			}
+			if e.opts.DetectMoves && b != nil && l != nil && l.FileID != "" && l.FileID != b.FileID {
+				plan.Identities = append(plan.Identities, t)
+			}
+			if signatureChanged(l, b) || remoteHashChanged(r, b) {
+				plan.Signatures = append(plan.Signatures, t)
+			}
+		}
+	}
+
+	// 2.1 先流式遍历数据库中的记录，处理过的路径从两侧的 map 中移除
+	// 重新扫描 (WithRescan) 时不读取记录，所有路径都按没有记录处理
+	scanDB := e.opts.StateDB.ForEach
+	if rescanning(ctx) {
+		scanDB = func(func(*database.FileState) error) error { return nil }
+	}
+	err := scanDB(func(b *database.FileState) error {
+		path := b.RelPath
+		if collided[path] || e.excluded(path) || underAny(path, unreadableKeys) {
+			return nil
+		}
+		l := localMap[path]
+		r := remoteMap[path]
+		delete(localMap, path)
+		delete(remoteMap, path)
+		if l == nil && r == nil && !orphanBefore.IsZero() && b.LastSyncAsTime().Before(orphanBefore) {
+			plan.Orphans = append(plan.Orphans, b)
+			return nil
+		}
+		visit(path, l, r, b)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan db failed: %w", err)
+	}
+
+	// 2.2 剩下的都是数据库中没有记录的路径 (新文件 / DB 丢失)
+	for path, l := range localMap {
+		r := remoteMap[path]
+		delete(remoteMap, path)
+		visit(path, l, r, nil)
+	}
+	for path, r := range remoteMap {
+		visit(path, nil, r, nil)
+	}
+	// 比对过程中 (计算 Hash 时) 被取消，部分路径的结论不可靠，整个计划作废
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	e.dropClashChildren(plan, clashes)
+	e.detectMoves(log, plan, vanished)
+	e.markCopies(plan, sources)
+	e.skipLeftoverDirs(log, plan)
+	e.holdDeletes(log, plan)
+	e.holdQuarantined(log, plan)
+	e.guardNewerRemote(log, plan)
+
+	return plan, nil
+}
+
+// holdDeletes 扫描不完整时暂缓本轮所有的删除任务
+// 跳过的路径已经不参与比对，但扫描出错说明列表本身可能不可信 (例如漏掉了部分文件)，
+// 此时“一侧没有”不能可靠地说明文件已被删除，只执行上传、下载等不会丢失数据的任务
+func (e *Engine) holdDeletes(log *slog.Logger, plan *Plan) {
+	if len(plan.Unreadable) == 0 || e.opts.DeleteOnPartialScan {
+		return
+	}
+	kept := plan.Tasks[:0]
+	for _, t := range plan.Tasks {
+		switch t.Op {
+		case OpDeleteLocal, OpDeleteRemote, OpRmdirLocal, OpRmdirRemote:
+			plan.HeldDeletes = append(plan.HeldDeletes, t)
+		default:
+			kept = append(kept, t)
+		}
+	}
+	plan.Tasks = kept
+	if len(plan.HeldDeletes) > 0 {
+		log.Warn("!!! 扫描不完整，本轮暂缓所有删除，只执行上传与下载 (确认可以接受风险时可开启 delete_on_partial_scan) !!!",
+			"held", len(plan.HeldDeletes), "unreadable", len(plan.Unreadable))
+	}
+}
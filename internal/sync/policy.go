@@ -0,0 +1,71 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"baidusync/internal/fs"
+)
+
+// ErrorPolicy 任务失败后的处理方式
+type ErrorPolicy int
+
+const (
+	// OnErrorContinue (默认)：记录错误并继续执行其他任务
+	// 认证失败、空间不足这类必然导致后续任务全部失败的错误仍会中止本轮同步
+	OnErrorContinue ErrorPolicy = iota
+	// OnErrorAbort：第一个不可重试的错误 (超时、限流、取消以外的错误) 就中止本轮同步
+	OnErrorAbort
+)
+
+// ErrAborted 本轮同步因为错误被提前中止，剩余任务未执行
+var ErrAborted = errors.New("同步已中止")
+
+// ParseErrorPolicy 解析配置中的 on_error，未知值按 continue 处理
+func ParseErrorPolicy(s string) ErrorPolicy {
+	if s == "abort" {
+		return OnErrorAbort
+	}
+	return OnErrorContinue
+}
+
+// String 返回配置中使用的名称 (用于日志)
+func (p ErrorPolicy) String() string {
+	if p == OnErrorAbort {
+		return "abort"
+	}
+	return "continue"
+}
+
+// isFatal 错误是否会让之后的所有任务都失败 (无论策略如何都应中止)
+func isFatal(err error) bool {
+	return errors.Is(err, fs.ErrAuth) || errors.Is(err, fs.ErrQuota)
+}
+
+// isRetryable 错误是否是暂时性的，下一轮同步重试即可恢复
+// 冲突处理中上传时云端又出现了同名文件 (ErrExist) 会在下一轮重新按冲突处理
+func isRetryable(err error) bool {
+	return errors.Is(err, ErrTaskTimeout) ||
+		errors.Is(err, fs.ErrThrottled) ||
+		errors.Is(err, ErrRecentlyModified) ||
+		errors.Is(err, fs.ErrExist) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// checkAbort 按 OnError 策略判断任务失败后是否中止本轮同步，需要中止时取消 ctx
+func (e *Engine) checkAbort(log *slog.Logger, abort context.CancelCauseFunc, t Task, err error) {
+	if !isFatal(err) && (e.opts.OnError != OnErrorAbort || isRetryable(err)) {
+		return
+	}
+	log.Error("遇到无法继续的错误，中止本轮同步",
+		"policy", e.opts.OnError,
+		"path", t.RelPath,
+		"op", t.Op,
+		"err", err,
+	)
+	// 具体的错误已经在 SyncError 中，这里只记录触发中止的任务
+	abort(fmt.Errorf("%w (%s %s)", ErrAborted, t.Op, t.RelPath))
+}
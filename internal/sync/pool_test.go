@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"baidusync/internal/fs/memfs"
+)
+
+func TestRunManyTasksCollectsAllErrors(t *testing.T) {
+	const files, failEvery = 5000, 7
+	env := newTestEnv(t)
+	boom := errors.New("写入失败")
+	var wantFailed []string
+	for i := range files {
+		p := fmt.Sprintf("dir%02d/file%04d.txt", i%50, i)
+		env.local.PutFile(p, []byte(p), t0)
+		if i%failEvery == 0 {
+			env.remote.InjectError(memfs.OpWrite, p, boom)
+			wantFailed = append(wantFailed, p)
+		}
+	}
+	slices.Sort(wantFailed)
+	e := env.engine(func(o *EngineOptions) { o.MaxWorkers = 8 })
+
+	result, err := env.runErr(e)
+	var syncErr *SyncError
+	if !errors.As(err, &syncErr) {
+		t.Fatalf("错误为 %v，应为 SyncError", err)
+	}
+	if result.Succeeded[OpUpload] != files-len(wantFailed) || result.Failed[OpUpload] != len(wantFailed) {
+		t.Fatalf("成功 %d 个、失败 %d 个上传，应为 %d 与 %d 个",
+			result.Succeeded[OpUpload], result.Failed[OpUpload], files-len(wantFailed), len(wantFailed))
+	}
+
+	// 每个失败的任务都有记录，且按路径排序
+	got := make([]string, len(syncErr.Errors))
+	for i, pe := range syncErr.Errors {
+		if pe.Op != OpUpload || !errors.Is(pe, boom) {
+			t.Fatalf("第 %d 个错误为 %v", i, pe)
+		}
+		got[i] = pe.RelPath
+	}
+	if !slices.Equal(got, wantFailed) {
+		t.Fatalf("失败 %d 个路径，应为 %d 个 (按路径排序)", len(got), len(wantFailed))
+	}
+	// 摘要只列出前几个
+	if want := fmt.Sprintf("另有 %d 个", len(wantFailed)-maxErrorSummary); !strings.Contains(err.Error(), want) {
+		t.Fatalf("错误摘要为 %q，应包含 %q", err, want)
+	}
+
+	env.remote.ClearErrors()
+	result = env.run(e)
+	if result.Succeeded[OpUpload] != len(wantFailed) {
+		t.Fatalf("重试时上传 %d 个，应为 %d 个", result.Succeeded[OpUpload], len(wantFailed))
+	}
+	env.wantIdle(e)
+}
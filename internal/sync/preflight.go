@@ -0,0 +1,57 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"baidusync/internal/fs"
+)
+
+// Preflight 在第一轮同步前检查两侧是否可用: 本地目录可读、云端认证有效、云端根目录存在
+// 云端根目录不存在时: 数据库中没有记录 (首次同步) 则创建它；
+// 已有记录说明云端目录被移走或 remote_dir 写错，继续同步会把所有文件当作已在云端删除，因此返回错误
+// 设置了 NoCreateRemoteRoot 时首次同步也不创建，直接返回错误
+// 不支持 fs.Checker 的文件系统跳过检查
+// 设置了 ClockSkewThreshold 时最后测量本机与云端的时钟偏差 (见 checkClockSkew)
+func (e *Engine) Preflight(ctx context.Context) error {
+	if c, ok := e.opts.LocalFS.(fs.Checker); ok {
+		if err := c.Check(ctx, false); err != nil {
+			return fmt.Errorf("本地目录不可用: %w", err)
+		}
+	}
+
+	created := false
+	if c, ok := e.opts.RemoteFS.(fs.Checker); ok {
+		err := c.Check(ctx, false)
+		if errors.Is(err, fs.ErrNotExist) {
+			empty, dbErr := e.opts.StateDB.Empty()
+			if dbErr != nil {
+				return fmt.Errorf("读取数据库失败: %w", dbErr)
+			}
+			if !empty {
+				return fmt.Errorf("云端目录 %s 不存在，但数据库中有同步记录 (目录被移走或 remote_dir 配置错误？): %w",
+					e.opts.RemoteFS.Root(), err)
+			}
+			if e.opts.NoCreateRemoteRoot {
+				return fmt.Errorf("云端目录 %s 不存在 (create_remote_root 已关闭，请先在网盘中创建该目录或检查 remote_dir): %w",
+					e.opts.RemoteFS.Root(), err)
+			}
+			if err = c.Check(ctx, true); err != nil {
+				return fmt.Errorf("无法创建云端目录 %s: %w", e.opts.RemoteFS.Root(), err)
+			}
+			created = true
+		}
+		if err != nil {
+			return fmt.Errorf("云端不可用: %w", err)
+		}
+	}
+
+	e.opts.Logger.Info("预检通过",
+		"local", e.opts.LocalFS.Root(),
+		"remote", e.opts.RemoteFS.Type()+":"+e.opts.RemoteFS.Root(),
+		"remote_created", created,
+	)
+	e.checkClockSkew(ctx)
+	return nil
+}
@@ -0,0 +1,110 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"baidusync/internal/fs"
+	"baidusync/internal/fs/memfs"
+)
+
+// rootFS 为内存文件系统加上 fs.Checker，可以模拟根目录不存在、无法创建
+type rootFS struct {
+	*memfs.FS
+	missing   bool  // 根目录不存在
+	createErr error // 创建根目录时返回的错误
+	created   int   // 创建根目录的次数
+}
+
+func (f *rootFS) Check(ctx context.Context, createRoot bool) error {
+	if !f.missing {
+		return nil
+	}
+	if !createRoot {
+		return fmt.Errorf("目录 %s: %w", f.Root(), fs.ErrNotExist)
+	}
+	if f.createErr != nil {
+		return f.createErr
+	}
+	f.missing = false
+	f.created++
+	return nil
+}
+
+func TestPreflightCreatesMissingRoot(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("a"), t0)
+	remote := &rootFS{FS: env.remote, missing: true}
+	e := env.engine(func(o *EngineOptions) { o.RemoteFS = remote })
+
+	if err := e.Preflight(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if remote.created != 1 {
+		t.Fatalf("创建了 %d 次根目录，应为 1 次", remote.created)
+	}
+	env.run(e)
+	wantFile(t, env.remote, "a.txt", "a")
+}
+
+func TestPreflightNoCreateRemoteRoot(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("a"), t0)
+	remote := &rootFS{FS: env.remote, missing: true}
+	e := env.engine(func(o *EngineOptions) {
+		o.RemoteFS = remote
+		o.NoCreateRemoteRoot = true
+	})
+
+	err := e.Preflight(context.Background())
+	if !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "create_remote_root") {
+		t.Fatalf("错误为 %v，应提示 create_remote_root 已关闭", err)
+	}
+	if remote.created != 0 || !remote.missing {
+		t.Fatal("关闭 create_remote_root 时不应创建根目录")
+	}
+}
+
+func TestPreflightMissingRootWithRecords(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("a"), t0)
+	env.local.PutFile("dir/b.txt", []byte("b"), t0)
+	remote := &rootFS{FS: env.remote}
+	e := env.engine(func(o *EngineOptions) { o.RemoteFS = remote })
+	env.run(e)
+
+	// 云端目录被移走: 继续同步会把本地文件全部当作已在云端删除
+	for _, p := range []string{"a.txt", "dir"} {
+		if err := env.remote.Delete(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remote.missing = true
+
+	err := e.Preflight(context.Background())
+	if !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "数据库中有同步记录") {
+		t.Fatalf("错误为 %v，应拒绝在已有同步记录时继续", err)
+	}
+	if remote.created != 0 {
+		t.Fatal("已有同步记录时不应重新创建根目录")
+	}
+	wantFile(t, env.local, "a.txt", "a")
+	wantFile(t, env.local, "dir/b.txt", "b")
+	wantState(t, env.db, "a.txt", true)
+	wantState(t, env.db, "dir/b.txt", true)
+}
+
+func TestPreflightRootCannotBeCreated(t *testing.T) {
+	env := newTestEnv(t)
+	denied := errors.New("没有权限")
+	remote := &rootFS{FS: env.remote, missing: true, createErr: denied}
+	e := env.engine(func(o *EngineOptions) { o.RemoteFS = remote })
+
+	err := e.Preflight(context.Background())
+	if !errors.Is(err, denied) || !strings.Contains(err.Error(), "无法创建云端目录") {
+		t.Fatalf("错误为 %v，应为无法创建云端目录", err)
+	}
+}
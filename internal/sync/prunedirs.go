@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"errors"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+
+	"baidusync/internal/fs"
+)
+
+// remoteTree 扫描时云端的目录结构，用于判断哪些目录在本轮删除后变空
+type remoteTree struct {
+	entries  map[string]bool // 云端的全部路径 (实际路径) -> 是否为目录
+	children map[string]int  // 目录中直接包含的条目数 (根目录为 "")
+}
+
+func newRemoteTree(remoteMap map[string]*fs.FileMeta) *remoteTree {
+	t := &remoteTree{entries: make(map[string]bool, len(remoteMap)), children: make(map[string]int)}
+	for _, r := range remoteMap {
+		t.entries[r.RelPath] = r.IsDir
+		t.children[parentDir(r.RelPath)]++
+	}
+	return t
+}
+
+// skipLeftoverDirs 去掉“本地已删除的目录”对应的 OpMkdirLocal 任务
+// 数据库中没有记录的云端目录会被当作云端新建的目录下载到本地，但如果其中的文件在本轮全部要从云端删除，
+// 说明这个目录是本地删除后残留在云端的，不应该在本地重新创建；本轮结束后由 pruneEmptyDirs 处理
+func (e *Engine) skipLeftoverDirs(log *slog.Logger, plan *Plan) {
+	deleting := make(map[string]bool)
+	for _, t := range plan.Tasks {
+		switch t.Op {
+		case OpDeleteRemote:
+			deleting[t.RelPath] = true
+		case OpMoveRemote:
+			deleting[t.From] = true
+		}
+	}
+	if len(deleting) == 0 {
+		return
+	}
+
+	// keep: 仍有文件保留在云端的目录；emptied: 有文件将被删除的目录
+	keep := make(map[string]bool)
+	emptied := make(map[string]bool)
+	for p, isDir := range plan.remote.entries {
+		if isDir {
+			continue
+		}
+		mark := keep
+		if deleting[p] {
+			mark = emptied
+		}
+		for dir := parentDir(p); dir != "" && !mark[dir]; dir = parentDir(dir) {
+			mark[dir] = true
+		}
+	}
+
+	tasks := plan.Tasks[:0]
+	for _, t := range plan.Tasks {
+		if t.Op == OpMkdirLocal && emptied[t.RelPath] && !keep[t.RelPath] {
+			log.Debug("云端目录中的文件将全部删除，不在本地创建该目录", "path", t.RelPath)
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	plan.Tasks = tasks
+}
+
+// parentDir 返回上级目录的相对路径，位于根目录下时返回 ""
+func parentDir(p string) string {
+	dir := path.Dir(p)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// pruneEmptyDirs 找出本轮删除云端文件后变空、且本地没有对应目录的云端目录
+// 开启 PruneEmptyDirs 时从里到外删除它们，否则只在日志中报告；同步根目录本身永远不会被删除
+// removed 为本轮在云端成功删除的路径
+func (e *Engine) pruneEmptyDirs(log *slog.Logger, tree *remoteTree, removed []string) {
+	if tree == nil || len(removed) == 0 {
+		return
+	}
+
+	gone := make(map[string]bool, len(removed))
+	candidates := make(map[string]bool)
+	for _, p := range removed {
+		gone[p] = true
+		tree.children[parentDir(p)]--
+		for dir := parentDir(p); dir != ""; dir = parentDir(dir) {
+			candidates[dir] = true
+		}
+	}
+
+	// 子目录在前，删除子目录后上级目录才可能变空
+	dirs := make([]string, 0, len(candidates))
+	for dir := range candidates {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		di, dj := strings.Count(dirs[i], "/"), strings.Count(dirs[j], "/")
+		if di != dj {
+			return di > dj
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	var empty []string
+	for _, dir := range dirs {
+		if gone[dir] || !tree.entries[dir] || tree.children[dir] > 0 {
+			continue
+		}
+		// 本地仍有这个目录时保留云端目录 (空目录同样需要同步)
+		if _, err := e.opts.LocalFS.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if !e.opts.PruneEmptyDirs {
+			// 只报告时同样视为已删除，上级目录因此变空时一并报告
+			empty = append(empty, dir)
+		} else if err := e.opts.RemoteFS.Rmdir(dir); err != nil {
+			// 目录中有扫描时跳过的文件 (例如被排除或隐藏的文件) 时云端会拒绝删除
+			if !errors.Is(err, fs.ErrNotEmpty) {
+				log.Warn("删除云端空目录失败", "path", dir, "err", err)
+			}
+			continue
+		} else {
+			log.Info("已删除云端空目录", "path", dir)
+			if err := e.forgetPath(log, dir); err != nil {
+				log.Warn("删除目录记录失败", "path", dir, "err", err)
+			}
+		}
+		gone[dir] = true
+		tree.children[parentDir(dir)]--
+	}
+	if len(empty) > 0 {
+		log.Info("云端有目录在删除文件后变空，开启 prune_empty_dirs 后会自动删除", "count", len(empty), "paths", empty)
+	}
+}
@@ -0,0 +1,79 @@
+package sync
+
+import (
+	"slices"
+	"testing"
+)
+
+// leftoverTree 同步一棵嵌套目录树，然后去掉目录的记录 (模拟早期版本不记录目录、或云端目录由另一台设备创建)
+// 再在本地删除 a/b 整个目录: 其中的文件会从云端删除，a/b 与 a/b/c 在云端变成没有记录的空目录
+func leftoverTree(t *testing.T, mods ...func(*EngineOptions)) (*testEnv, *Engine) {
+	t.Helper()
+	env := newTestEnv(t)
+	env.local.PutFile("a/b/c/x.txt", []byte("x"), t0)
+	env.local.PutFile("a/b/y.txt", []byte("y"), t0)
+	env.local.PutFile("a/keep.txt", []byte("keep"), t0)
+	e := env.engine(mods...)
+	env.run(e)
+	for _, dir := range []string{"a", "a/b", "a/b/c"} {
+		if err := env.db.Delete(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := env.local.Delete("a/b"); err != nil {
+		t.Fatal(err)
+	}
+	return env, e
+}
+
+func TestPruneEmptyDirsNested(t *testing.T) {
+	env, e := leftoverTree(t, func(o *EngineOptions) { o.PruneEmptyDirs = true })
+
+	result := env.run(e)
+	if result.Succeeded[OpDeleteRemote] != 2 || result.Succeeded[OpMkdirLocal] != 0 {
+		t.Fatalf("删除云端 %d 个、创建本地目录 %d 个", result.Succeeded[OpDeleteRemote], result.Succeeded[OpMkdirLocal])
+	}
+	// 从里到外删除变空的目录，仍有文件的上级目录保留
+	if got, want := env.remote.Paths(), []string{"a", "a/keep.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("云端为 %v，应为 %v", got, want)
+	}
+	if got, want := env.local.Paths(), []string{"a", "a/keep.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("本地为 %v，应为 %v", got, want)
+	}
+	env.wantIdle(e)
+
+	// 最后一个文件删除后上级目录同样变空，同步根目录本身保留
+	env.local.Delete("a/keep.txt")
+	env.db.Delete("a")
+	env.local.Delete("a")
+	env.run(e)
+	if got := env.remote.Paths(); len(got) != 0 {
+		t.Fatalf("云端仍有 %v", got)
+	}
+	env.wantIdle(e)
+}
+
+func TestPruneEmptyDirsOffOnlyReports(t *testing.T) {
+	env, e := leftoverTree(t)
+
+	env.run(e)
+	// 不删除云端目录，也不会在本地重新创建被删除的目录
+	if got, want := env.remote.Paths(), []string{"a", "a/b", "a/b/c", "a/keep.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("云端为 %v，应为 %v", got, want)
+	}
+	wantMissing(t, env.local, "a/b")
+}
+
+func TestPruneEmptyDirsKeepsDirWithSkippedFiles(t *testing.T) {
+	env, e := leftoverTree(t, func(o *EngineOptions) {
+		o.PruneEmptyDirs = true
+		o.Exclude = []string{"a/b/c/notes.tmp"}
+	})
+	// 扫描时排除的文件仍在云端目录中，云端拒绝删除该目录，其上级目录也因此保留
+	env.remote.PutFile("a/b/c/notes.tmp", []byte("tmp"), t0)
+
+	env.run(e)
+	if got, want := env.remote.Paths(), []string{"a", "a/b", "a/b/c", "a/b/c/notes.tmp", "a/keep.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("云端为 %v，应为 %v", got, want)
+	}
+}
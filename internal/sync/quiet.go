@@ -0,0 +1,30 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"baidusync/internal/fs"
+)
+
+// ErrRecentlyModified 目标文件在 QuietPeriod 内刚被修改 (可能有人正在编辑)，本轮不覆盖，推迟到下一轮
+// 这类任务既不算成功也不算失败，计入 RunResult.Deferred
+var ErrRecentlyModified = errors.New("目标文件刚被修改，推迟到下一轮")
+
+// checkQuiet 写入前检查目标一侧的同名文件，修改时间在 QuietPeriod 之内时返回 ErrRecentlyModified
+// 目标不存在或读取失败时不拦截，由之后的写入处理
+func (e *Engine) checkQuiet(target fs.FileSystem, side, path string) error {
+	quiet := e.opts.QuietPeriod
+	if quiet <= 0 {
+		return nil
+	}
+	meta, err := fs.StatQuick(target, path)
+	if err != nil || meta.IsDir {
+		return nil
+	}
+	if age := e.now().Sub(meta.ModTime); age < quiet {
+		return fmt.Errorf("%w: %s文件 %s 在 %s 前修改 (quiet_period %s)", ErrRecentlyModified, side, path, age.Round(time.Second), quiet)
+	}
+	return nil
+}
@@ -0,0 +1,469 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	"baidusync/internal/crypto"
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+)
+
+// ErrRekeyMismatch 用旧密钥解密得到的内容与同步记录中的明文 MD5 不一致
+// 通常是旧密码输入错误，或者该文件已经用新密钥加密过，此时不改写云端文件
+var ErrRekeyMismatch = errors.New("旧密钥解密的内容与同步记录不一致")
+
+// ErrRekeyUnverified 没有办法确认旧密钥是否正确，有文件没有改写
+// 内容加密 (AES-CTR) 没有校验码，用错误的旧密钥解密得到的乱码会被当作明文重新加密，覆盖云端文件后无法恢复
+var ErrRekeyUnverified = errors.New("无法确认旧密钥是否正确")
+
+// RekeyOptions 更换加密密钥的参数，新密钥为 EngineOptions.EncryptKey
+type RekeyOptions struct {
+	// OldKey 云端文件当前使用的旧密钥
+	OldKey []byte
+	// OldRemoteFS 用旧密钥解析文件名的云端后端 (开启文件名加密时必填)
+	// 为空表示文件名没有加密，新内容直接写回原来的路径
+	OldRemoteFS fs.RemoteProvider
+}
+
+// RekeyResult 一次更换密钥的结果
+type RekeyResult struct {
+	// Rekeyed 已用新密钥重新加密的文件
+	Rekeyed []string
+	// Copied 内容与已重新加密的文件相同、直接在云端复制的文件
+	Copied []string
+	// Skipped 之前中断时已经完成、本次跳过的文件
+	Skipped []string
+	// Unverified 没有确认旧密钥、同步记录中也没有明文 MD5 可以校验，因此没有改写的文件
+	Unverified []string
+	// Unreadable 旧密钥无法解析文件名、没有处理的路径数量 (已经换成新文件名的文件，或不属于同步目录的文件)
+	Unreadable int
+}
+
+// rekeyOutcome 单个文件的处理结果
+type rekeyOutcome int
+
+const (
+	rekeyDone rekeyOutcome = iota
+	rekeyCopied
+	rekeySkipped
+	rekeyUnverified
+)
+
+// rekeyCopy 本次已重新加密的文件，内容相同的文件可以在云端复制
+type rekeyCopy struct {
+	path string
+	hash string // 新的云端 Hash
+}
+
+// rekeyRun 一次更换密钥的执行状态
+type rekeyRun struct {
+	e       *Engine
+	log     *slog.Logger
+	old     fs.RemoteProvider // 按旧密钥解析文件名的后端 (文件名未加密时就是 RemoteFS)
+	renamed bool              // 新旧文件名不同: 写入新文件名后要删除旧文件名
+	oldKey  []byte
+	keyID   string // 新密钥的指纹
+	oldID   string // 旧密钥的指纹
+	// verified 已经确认旧密钥正确 (见 verifyOldKey)；否则只改写同步记录中有明文 MD5、可以逐个校验的文件
+	verified bool
+
+	mu     sync.Mutex
+	copies map[string]rekeyCopy // 明文 MD5 -> 已重新加密的文件
+}
+
+// Rekey 把云端用 OldKey 加密的文件全部改为用当前密钥加密，并更新同步记录中的云端 Hash
+// 逐个文件下载、用旧密钥解密后再用新密钥加密上传；开启文件名加密时写到新密钥加密的文件名下，
+// 再删除旧文件名，最后在新文件名下重建空目录并删除变空的旧目录。
+// 每个文件的进度记录在数据库中: 中断后再次执行会跳过已完成的文件，重复执行也不会把文件加密两次。
+// 改写任何文件之前先用参照文件确认旧密钥 (见 verifyOldKey)，旧密钥不正确时直接返回错误；
+// 无法确认时只改写同步记录中有明文 MD5 的文件，其余文件不改写并返回 ErrRekeyUnverified。
+// 同步记录中有明文 MD5 时校验解密的结果，不一致 (例如旧密码错误) 时不改写该文件。
+// 执行期间不能同时运行同步。
+func (e *Engine) Rekey(ctx context.Context, opts RekeyOptions) (*RekeyResult, error) {
+	runID := RunIDFromContext(ctx)
+	if runID == "" {
+		runID = NewRunID()
+	}
+	log := e.opts.Logger.With("run_id", runID)
+
+	if !e.encrypted() {
+		return nil, fmt.Errorf("未开启加密，无法更换密钥")
+	}
+	if len(opts.OldKey) == 0 || bytes.Equal(opts.OldKey, e.opts.EncryptKey) {
+		return nil, fmt.Errorf("旧密钥为空或与新密钥相同")
+	}
+
+	run := &rekeyRun{
+		e:       e,
+		log:     log,
+		old:     opts.OldRemoteFS,
+		renamed: opts.OldRemoteFS != nil,
+		oldKey:  opts.OldKey,
+		keyID:   crypto.KeyID(e.opts.EncryptKey),
+		oldID:   crypto.KeyID(opts.OldKey),
+		copies:  make(map[string]rekeyCopy),
+	}
+	if !run.renamed {
+		run.old = e.opts.RemoteFS
+	}
+
+	// 之前更换为其他密钥时留下的进度已经没有意义
+	if n, err := e.opts.StateDB.PruneRekeyMarks(run.keyID); err != nil {
+		return nil, fmt.Errorf("清理过期的换密钥进度失败: %w", err)
+	} else if n > 0 {
+		log.Info("已清理之前更换其他密钥时留下的进度", "count", n)
+	}
+
+	result := &RekeyResult{}
+	listing, err := fs.ListAll(ctx, run.old)
+	var scanErr *fs.ScanError
+	switch {
+	case errors.As(err, &scanErr):
+		result.Unreadable = len(scanErr.Skipped)
+	case err != nil:
+		return nil, fmt.Errorf("扫描云端失败: %w", err)
+	}
+	e.dropExcluded(listing)
+
+	var paths, dirs []string
+	for path, meta := range listing {
+		if meta.IsDir {
+			dirs = append(dirs, path)
+		} else {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	sort.Strings(dirs)
+	if run.verified, err = run.verifyOldKey(ctx, paths, listing); err != nil {
+		return nil, err
+	}
+	log.Info("开始更换密钥", "files", len(paths), "dirs", len(dirs), "rename", run.renamed,
+		"verified", run.verified, "unreadable", result.Unreadable)
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	pathChan := make(chan string, len(paths))
+	for _, p := range paths {
+		pathChan <- p
+	}
+	close(pathChan)
+
+	for i := 0; i < e.maxWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range pathChan {
+				if ctx.Err() != nil {
+					return
+				}
+				outcome, err := run.file(ctx, path, listing[path])
+				mu.Lock()
+				switch {
+				case err != nil:
+					log.Error("更换密钥失败", "path", path, "err", err)
+					errs = append(errs, fmt.Errorf("%s: %w", path, err))
+				case outcome == rekeySkipped:
+					result.Skipped = append(result.Skipped, path)
+				case outcome == rekeyCopied:
+					result.Copied = append(result.Copied, path)
+				case outcome == rekeyUnverified:
+					result.Unverified = append(result.Unverified, path)
+				default:
+					result.Rekeyed = append(result.Rekeyed, path)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(result.Rekeyed)
+	sort.Strings(result.Copied)
+	sort.Strings(result.Skipped)
+	sort.Strings(result.Unverified)
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%d path(s) failed to rekey: %w", len(errs), errors.Join(errs...))
+	}
+	if len(result.Unverified) > 0 {
+		return result, fmt.Errorf("%w: %d 个文件没有可以参照的明文 MD5，没有改写", ErrRekeyUnverified, len(result.Unverified))
+	}
+	if run.renamed {
+		run.moveDirs(dirs)
+	}
+	log.Info("更换密钥完成",
+		"rekeyed", len(result.Rekeyed),
+		"copied", len(result.Copied),
+		"skipped", len(result.Skipped),
+		"unreadable", result.Unreadable)
+	return result, nil
+}
+
+// file 更换单个文件的密钥
+func (r *rekeyRun) file(ctx context.Context, path string, meta *fs.FileMeta) (rekeyOutcome, error) {
+	e := r.e
+	key := e.dbKey(path)
+	mark, err := e.opts.StateDB.GetRekeyMark(key)
+	if err != nil {
+		return 0, err
+	}
+	base, err := e.opts.StateDB.Get(key)
+	if err != nil {
+		return 0, fmt.Errorf("读取同步记录失败: %w", err)
+	}
+
+	if mark != nil && mark.KeyID == r.keyID {
+		switch {
+		case mark.Done:
+			// 开启文件名加密时，上次可能只差删除旧文件名
+			return rekeySkipped, r.dropOld(path)
+		case !r.renamed && meta.RemoteHash != mark.OldHash:
+			// 原地改写: 云端 Hash 已经变化，说明上次中断前新内容已经写入，只差更新记录
+			r.log.Info("上次中断前已写入新密钥加密的内容，补记进度", "path", path)
+			return rekeyDone, r.finish(path, base, meta.RemoteHash)
+		}
+	}
+	if !r.renamed && meta.RemoteHash == "" {
+		return 0, fmt.Errorf("云端没有提供文件 Hash，中断后无法判断是否已经改写，不能原地更换密钥")
+	}
+	want := r.expectedMD5(meta, base)
+	if want == "" && !r.verified {
+		r.log.Warn("无法确认旧密钥，不改写", "path", path)
+		return rekeyUnverified, nil
+	}
+	// 先记录改写之前的云端 Hash，中断后据此判断新内容是否已经写入
+	if err := e.opts.StateDB.PutRekeyMark(key, r.mark(&database.RekeyMark{OldHash: meta.RemoteHash})); err != nil {
+		return 0, err
+	}
+
+	if hash, ok := r.tryCopy(path, want); ok {
+		return rekeyCopied, r.finish(path, base, hash)
+	}
+	hash, sum, err := r.transfer(ctx, path, meta, base, want)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	if _, ok := r.copies[sum]; !ok {
+		r.copies[sum] = rekeyCopy{path: path, hash: hash}
+	}
+	r.mu.Unlock()
+	return rekeyDone, r.finish(path, base, hash)
+}
+
+// verifyOldKey 改写任何文件之前确认旧密钥，旧密钥不正确时返回错误
+// 与同步时确认密钥一样 (见 pickKeyRef)，选一个云端没有变化、记录中有明文 Hash 的最小的加密文件作为参照，
+// 用旧密钥解密后与记录比较。已经改写过的文件不能作参照；之前中断的执行已经确认过同一个旧密钥时不再确认。
+// 没有可用的参照文件时返回 false
+func (r *rekeyRun) verifyOldKey(ctx context.Context, paths []string, listing map[string]*fs.FileMeta) (bool, error) {
+	e := r.e
+	var ref *keyRef
+	for _, path := range paths {
+		key := e.dbKey(path)
+		mark, err := e.opts.StateDB.GetRekeyMark(key)
+		if err != nil {
+			return false, err
+		}
+		if mark != nil && mark.KeyID == r.keyID {
+			if mark.OldKeyID == r.oldID {
+				r.log.Info("之前中断的执行已经确认过旧密钥", "path", path)
+				return true, nil
+			}
+			continue
+		}
+		base, err := e.opts.StateDB.Get(key)
+		if err != nil {
+			return false, fmt.Errorf("读取同步记录失败: %w", err)
+		}
+		meta := listing[path]
+		if base == nil || base.IsDir || base.LocalHash == "" || base.FileSize < keyRefMinSize || e.remotePlain(meta, base) ||
+			meta.RemoteHash == "" || meta.RemoteHash != base.RemoteHash || !e.verifiable(meta) {
+			continue
+		}
+		if ref == nil || base.FileSize < ref.base.FileSize {
+			ref = &keyRef{path: path, base: base}
+		}
+	}
+	if ref == nil {
+		r.log.Warn("没有可以确认旧密钥的参照文件，只改写同步记录中有明文 MD5 的文件")
+		return false, nil
+	}
+	err := e.probeKey(ctx, r.old, ref, r.oldKey)
+	switch {
+	case errors.Is(err, ErrWrongKey):
+		return false, fmt.Errorf("旧密码不正确 (参照文件 %s 解密后与同步记录不符): %w", ref.path, err)
+	case err != nil:
+		return false, fmt.Errorf("无法用参照文件 %s 确认旧密钥: %w", ref.path, err)
+	}
+	r.log.Info("已用参照文件确认旧密钥", "ref", ref.path)
+	return true, nil
+}
+
+// mark 填写进度中的密钥指纹；已经确认旧密钥时一并记录旧密钥的指纹
+func (r *rekeyRun) mark(m *database.RekeyMark) *database.RekeyMark {
+	m.KeyID = r.keyID
+	if r.verified {
+		m.OldKeyID = r.oldID
+	}
+	return m
+}
+
+// expectedMD5 同步记录中云端文件对应的明文 MD5，用于校验解密结果 (无法确定时为空)
+// 只有本地 Hash 是 MD5、且云端文件自记录以来没有变化时才可信
+func (r *rekeyRun) expectedMD5(meta *fs.FileMeta, base *database.FileState) string {
+	e := r.e
+	if base == nil || base.IsDir || fs.HashAlgorithmOf(e.opts.LocalFS) != fs.HashMD5 || len(base.LocalHash) != md5.Size*2 {
+		return ""
+	}
+	if !e.isRemoteSameAsBase(meta, base) {
+		return ""
+	}
+	return strings.ToLower(base.LocalHash)
+}
+
+// tryCopy 内容与本次已重新加密的某个文件相同时，直接在云端复制，返回复制得到的文件的云端 Hash
+// 只在新旧文件名不同时可用 (原地改写时目标路径上还是旧文件)
+func (r *rekeyRun) tryCopy(path, want string) (string, bool) {
+	copier, ok := r.e.opts.RemoteFS.(fs.Copier)
+	if !ok || !r.renamed || want == "" {
+		return "", false
+	}
+	r.mu.Lock()
+	src, ok := r.copies[want]
+	r.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	if err := copier.Copy(src.path, path); err != nil {
+		// 目标已存在: 上次中断前写入了一部分，改为重新上传覆盖
+		r.log.Debug("云端复制失败，改为重新加密上传", "from", src.path, "to", path, "err", err)
+		return "", false
+	}
+	r.log.Info("内容与已重新加密的文件相同，已在云端复制", "from", src.path, "to", path)
+	return src.hash, true
+}
+
+// transfer 用旧密钥解密云端文件，再用新密钥加密写回，返回新的云端 Hash 与明文 MD5
+func (r *rekeyRun) transfer(ctx context.Context, path string, meta *fs.FileMeta, base *database.FileState, want string) (hash, sum string, err error) {
+	e := r.e
+	rc, err := r.old.OpenStream(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer rc.Close()
+	// 超时或取消时关闭网络流，中断卡住的读取
+	stop := context.AfterFunc(ctx, func() { rc.Close() })
+	defer stop()
+
+	var src io.Reader = e.throttle(ctx, fs.NewContextReader(ctx, rc))
+	size := meta.Size
+	if e.remotePlain(meta, base) {
+		r.log.Info("云端文件是开启加密之前上传的明文文件，直接加密", "path", path)
+	} else {
+		if src, err = crypto.NewDecryptReader(src, r.oldKey); err != nil {
+			return "", "", fmt.Errorf("解密失败: %w", err)
+		}
+		size = e.plainSize(meta)
+	}
+
+	plain, err := newHashingReader(src, fs.HashMD5)
+	if err != nil {
+		return "", "", err
+	}
+	enc, err := crypto.NewEncryptReader(&checkedReader{hashingReader: plain, want: want}, e.opts.EncryptKey)
+	if err != nil {
+		return "", "", fmt.Errorf("crypto init failed: %w", err)
+	}
+	// 保留原来的修改时间，重新加密不是内容上的修改
+	hash, err = fs.WriteStreamWithOptions(e.opts.RemoteFS, path, enc, meta.ModTime, &fs.WriteOptions{
+		Progress: e.progressFunc(path, OpUpload),
+		Context:  ctx,
+		OnExist:  fs.ExistOverwrite,
+		Size:     e.opts.RemoteFS.StoredSize(size, true),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	r.log.Info("已用新密钥重新加密", "path", path, "size", size)
+	return hash, plain.Sum(), nil
+}
+
+// finish 更新同步记录中的云端 Hash，标记完成，并删除旧文件名
+func (r *rekeyRun) finish(path string, base *database.FileState, hash string) error {
+	e := r.e
+	if base != nil && !base.IsDir {
+		base.RemoteHash = hash
+		base.RemotePlain = false
+		// 重新加密后内容已经改变，旧的分片 MD5 列表不再适用
+		base.RemoteBlocks = nil
+		if err := e.putState(base); err != nil {
+			return err
+		}
+	}
+	if err := e.opts.StateDB.PutRekeyMark(e.dbKey(path), r.mark(&database.RekeyMark{Done: true})); err != nil {
+		return err
+	}
+	return r.dropOld(path)
+}
+
+// dropOld 开启文件名加密时删除旧密钥加密的文件名 (新文件名下的内容已经写好)
+func (r *rekeyRun) dropOld(path string) error {
+	if !r.renamed {
+		return nil
+	}
+	if err := r.old.Delete(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("删除旧文件名失败: %w", err)
+	}
+	return nil
+}
+
+// moveDirs 所有文件完成后，在新文件名下重建目录 (保留空目录)，并从最深处开始删除变空的旧目录
+func (r *rekeyRun) moveDirs(dirs []string) {
+	for _, dir := range dirs {
+		if err := r.e.opts.RemoteFS.Mkdir(dir); err != nil {
+			r.log.Warn("创建新目录失败", "path", dir, "err", err)
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err := r.old.Rmdir(dirs[i])
+		switch {
+		case errors.Is(err, fs.ErrNotEmpty):
+			r.log.Warn("旧目录中还有文件，保留", "path", dirs[i])
+		case err != nil && !errors.Is(err, fs.ErrNotExist):
+			r.log.Warn("删除旧目录失败", "path", dirs[i], "err", err)
+		}
+	}
+}
+
+// checkedReader 读到结尾时校验明文的 MD5，不一致时返回 ErrRekeyMismatch 而不是 io.EOF，
+// 让后端中止写入，云端文件保持原样
+type checkedReader struct {
+	*hashingReader
+	want string
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	n, err := c.hashingReader.Read(p)
+	if err == io.EOF && c.want != "" {
+		if got := c.Sum(); got != c.want {
+			return n, fmt.Errorf("%w: 记录的 MD5 %s，解密得到 %s", ErrRekeyMismatch, c.want, got)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,298 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+	"baidusync/internal/fs/local"
+	"baidusync/internal/fs/memfs"
+)
+
+var keyC = bytes.Repeat([]byte{0xC}, 32)
+
+// rekeyFiles 换密钥测试中的本地文件 (都不短于 keyRefMinSize，可以作为确认密钥的参照)
+var rekeyFiles = map[string]string{
+	"a.txt":     strings.Repeat("alpha ", 4),
+	"b.txt":     strings.Repeat("bravo ", 8),
+	"dir/c.txt": strings.Repeat("charlie ", 4),
+	"dir/d.txt": strings.Repeat("delta ", 16),
+}
+
+// rekeyEnv 用 keyA 同步 rekeyFiles，返回换成 keyB 的引擎
+func rekeyEnv(t *testing.T, mods ...func(*EngineOptions)) (*testEnv, *Engine) {
+	t.Helper()
+	env := newTestEnv(t)
+	for p, content := range rekeyFiles {
+		env.local.PutFile(p, []byte(content), t0)
+	}
+	if err := env.local.Mkdir("empty"); err != nil {
+		t.Fatal(err)
+	}
+	env.run(env.engine(withKey(keyA)))
+	return env, env.engine(append([]func(*EngineOptions){withKey(keyB)}, mods...)...)
+}
+
+// rekeyPaths rekeyFiles 中的路径 (已排序)
+func rekeyPaths() []string {
+	paths := make([]string, 0, len(rekeyFiles))
+	for p := range rekeyFiles {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// wantRekeyed 检查云端文件都能用 key 解密出原来的内容，并且用 key 同步时没有任务
+func wantRekeyed(t *testing.T, env *testEnv, key []byte) {
+	t.Helper()
+	for p, content := range rekeyFiles {
+		if got := decryptedRemote(t, env, p, key); got != content {
+			t.Fatalf("%s 解密后为 %q，应为 %q", p, got, content)
+		}
+	}
+	env.wantIdle(env.engine(withKey(key)))
+}
+
+// remoteSnapshot 云端全部文件的内容
+func remoteSnapshot(fsys *memfs.FS) map[string]string {
+	out := make(map[string]string)
+	for _, p := range fsys.Paths() {
+		if data, ok := fsys.ReadFile(p); ok {
+			out[p] = string(data)
+		}
+	}
+	return out
+}
+
+// cancelingFS 写入成功 n 个文件后取消 ctx，模拟执行到一半时被中断
+type cancelingFS struct {
+	*memfs.FS
+	n      int
+	cancel context.CancelFunc
+}
+
+func (f *cancelingFS) WriteStream(relPath string, stream io.Reader, modTime time.Time) (string, error) {
+	hash, err := f.FS.WriteStream(relPath, stream, modTime)
+	if f.n--; f.n == 0 {
+		f.cancel()
+	}
+	return hash, err
+}
+
+// lostWriteFS 写入 relPath 之后返回错误，模拟内容已经写入、但进程在记录进度之前退出
+type lostWriteFS struct {
+	*memfs.FS
+	relPath string
+}
+
+func (f *lostWriteFS) WriteStream(relPath string, stream io.Reader, modTime time.Time) (string, error) {
+	hash, err := f.FS.WriteStream(relPath, stream, modTime)
+	if err == nil && relPath == f.relPath {
+		return "", errors.New("连接断开")
+	}
+	return hash, err
+}
+
+func TestRekey(t *testing.T) {
+	env, e := rekeyEnv(t)
+
+	result, err := e.Rekey(context.Background(), RekeyOptions{OldKey: keyA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Rekeyed, rekeyPaths()) {
+		t.Fatalf("重新加密了 %v，应为 %v", result.Rekeyed, rekeyPaths())
+	}
+	wantRekeyed(t, env, keyB)
+}
+
+func TestRekeyTwiceDoesNotReencrypt(t *testing.T) {
+	env, e := rekeyEnv(t)
+	if _, err := e.Rekey(context.Background(), RekeyOptions{OldKey: keyA}); err != nil {
+		t.Fatal(err)
+	}
+	before := remoteSnapshot(env.remote)
+
+	// 再执行一次: 已经完成的文件全部跳过，不会把新密钥加密的内容当作旧密钥的再加密一次
+	result, err := e.Rekey(context.Background(), RekeyOptions{OldKey: keyA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rekeyed) != 0 || !slices.Equal(result.Skipped, rekeyPaths()) {
+		t.Fatalf("重新加密 %v、跳过 %v，应全部跳过", result.Rekeyed, result.Skipped)
+	}
+	if !maps.Equal(remoteSnapshot(env.remote), before) {
+		t.Fatal("第二次执行改写了云端文件")
+	}
+	wantRekeyed(t, env, keyB)
+}
+
+func TestRekeyResumesAfterInterrupt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env, e := rekeyEnv(t, func(o *EngineOptions) { o.MaxWorkers = 1 })
+	interrupted := env.engine(withKey(keyB), func(o *EngineOptions) {
+		o.MaxWorkers = 1
+		o.RemoteFS = &cancelingFS{FS: env.remote, n: 2, cancel: cancel}
+	})
+
+	result, err := interrupted.Rekey(ctx, RekeyOptions{OldKey: keyA})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("错误为 %v，应为 context.Canceled", err)
+	}
+	done := result.Rekeyed
+	if len(done) != 2 {
+		t.Fatalf("中断前重新加密了 %v，应为 2 个", done)
+	}
+
+	// 再次执行: 中断前完成的文件跳过，其余的重新加密
+	result, err = e.Rekey(context.Background(), RekeyOptions{OldKey: keyA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Skipped, done) {
+		t.Fatalf("跳过了 %v，应为中断前完成的 %v", result.Skipped, done)
+	}
+	all := slices.Sorted(slices.Values(append(slices.Clone(done), result.Rekeyed...)))
+	if !slices.Equal(all, rekeyPaths()) {
+		t.Fatalf("再次执行重新加密了 %v，应为中断前没有完成的文件", result.Rekeyed)
+	}
+	wantRekeyed(t, env, keyB)
+}
+
+func TestRekeyResumesAfterLostWrite(t *testing.T) {
+	env, e := rekeyEnv(t)
+	lost := env.engine(withKey(keyB), func(o *EngineOptions) {
+		o.RemoteFS = &lostWriteFS{FS: env.remote, relPath: "b.txt"}
+	})
+	if _, err := lost.Rekey(context.Background(), RekeyOptions{OldKey: keyA}); err == nil {
+		t.Fatal("写入 b.txt 失败时应返回错误")
+	}
+	// b.txt 已经是新密钥加密的内容，同步记录却还没有更新
+	if got := decryptedRemote(t, env, "b.txt", keyB); got != rekeyFiles["b.txt"] {
+		t.Fatalf("b.txt 解密后为 %q", got)
+	}
+
+	// 再次执行只补记进度，不会用旧密钥解密已经改写的内容
+	result, err := e.Rekey(context.Background(), RekeyOptions{OldKey: keyA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Rekeyed, []string{"b.txt"}) {
+		t.Fatalf("重新加密了 %v，应只补记 b.txt", result.Rekeyed)
+	}
+	wantRekeyed(t, env, keyB)
+}
+
+func TestRekeyRenamedFilenames(t *testing.T) {
+	env, _ := rekeyEnv(t)
+
+	// 开启文件名加密时新旧文件名不同: 旧文件名下的文件读出后写到新文件名下
+	old := env.remote
+	env.remote = memfs.New("remote-new")
+	env.remote.SetClock(env.clock)
+	e := env.engine(withKey(keyB))
+
+	result, err := e.Rekey(context.Background(), RekeyOptions{OldKey: keyA, OldRemoteFS: old})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Rekeyed, rekeyPaths()) {
+		t.Fatalf("重新加密了 %v，应为 %v", result.Rekeyed, rekeyPaths())
+	}
+	// 旧文件名全部删除，空目录在新文件名下重建
+	if paths := old.Paths(); len(paths) != 0 {
+		t.Fatalf("旧文件名下还有 %v", paths)
+	}
+	if !env.remote.Exists("empty") {
+		t.Fatal("空目录没有在新文件名下重建")
+	}
+	wantRekeyed(t, env, keyB)
+}
+
+func TestRekeyWrongOldKeyLeavesRemoteUnchanged(t *testing.T) {
+	env, _ := rekeyEnv(t)
+	before := remoteSnapshot(env.remote)
+	e := env.engine(withKey(keyC))
+
+	_, err := e.Rekey(context.Background(), RekeyOptions{OldKey: keyB})
+	if !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("错误为 %v，应为 ErrWrongKey", err)
+	}
+	if !maps.Equal(remoteSnapshot(env.remote), before) {
+		t.Fatal("旧密钥不正确时改写了云端文件")
+	}
+	wantRekeyed(t, env, keyA)
+}
+
+func TestRekeyWrongOldKeyWithSHA256LocalHash(t *testing.T) {
+	env := newTestEnv(t)
+	root := t.TempDir()
+	for p, content := range rekeyFiles {
+		writeLocal(t, root, p, content)
+	}
+	adapter, err := local.NewAdapterWithHash(root, fs.HashSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withLocal := func(o *EngineOptions) { o.LocalFS = adapter }
+	env.run(env.engine(withKey(keyA), withLocal))
+	before := remoteSnapshot(env.remote)
+
+	// 记录中的明文 Hash 不是 MD5，无法逐个校验解密结果，只能靠参照文件在改写之前确认旧密钥
+	e := env.engine(withKey(keyC), withLocal)
+	if _, err := e.Rekey(context.Background(), RekeyOptions{OldKey: keyB}); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("错误为 %v，应为 ErrWrongKey", err)
+	}
+	if !maps.Equal(remoteSnapshot(env.remote), before) {
+		t.Fatal("旧密钥不正确时改写了云端文件")
+	}
+
+	result, err := e.Rekey(context.Background(), RekeyOptions{OldKey: keyA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Rekeyed, rekeyPaths()) {
+		t.Fatalf("重新加密了 %v，应为 %v", result.Rekeyed, rekeyPaths())
+	}
+	for p, content := range rekeyFiles {
+		if got := decryptedRemote(t, env, p, keyC); got != content {
+			t.Fatalf("%s 解密后为 %q，应为 %q", p, got, content)
+		}
+	}
+}
+
+func TestRekeyUnverifiedLeavesRemoteUnchanged(t *testing.T) {
+	env, _ := rekeyEnv(t)
+	before := remoteSnapshot(env.remote)
+
+	// 数据库丢失: 没有参照文件，也没有可以逐个校验的明文 MD5
+	db, err := database.NewBoltDB(filepath.Join(t.TempDir(), "new.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	env.db = db
+	e := env.engine(withKey(keyC))
+
+	result, err := e.Rekey(context.Background(), RekeyOptions{OldKey: keyB})
+	if !errors.Is(err, ErrRekeyUnverified) {
+		t.Fatalf("错误为 %v，应为 ErrRekeyUnverified", err)
+	}
+	if !slices.Equal(result.Unverified, rekeyPaths()) || len(result.Rekeyed) != 0 {
+		t.Fatalf("未确认 %v、重新加密 %v，应全部不改写", result.Unverified, result.Rekeyed)
+	}
+	if !maps.Equal(remoteSnapshot(env.remote), before) {
+		t.Fatal("无法确认旧密钥时改写了云端文件")
+	}
+}
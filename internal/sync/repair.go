@@ -0,0 +1,148 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"baidusync/internal/fs"
+)
+
+// RepairSource 修复时以哪一侧为准
+type RepairSource int
+
+const (
+	// RepairFromLocal 以本地为准：重新上传本地文件覆盖云端
+	RepairFromLocal RepairSource = iota
+	// RepairFromRemote 以云端为准：重新下载云端文件覆盖本地
+	RepairFromRemote
+)
+
+// ParseRepairSource 将命令行参数 ("local" / "remote") 转换为 RepairSource
+func ParseRepairSource(s string) (RepairSource, error) {
+	switch s {
+	case "local":
+		return RepairFromLocal, nil
+	case "remote":
+		return RepairFromRemote, nil
+	default:
+		return 0, fmt.Errorf("未知的修复基准: %s (可选 local / remote)", s)
+	}
+}
+
+func (s RepairSource) String() string {
+	if s == RepairFromRemote {
+		return "remote"
+	}
+	return "local"
+}
+
+// RepairResult 一次修复的结果
+type RepairResult struct {
+	// Repaired 已按基准重新传输并更新数据库的路径
+	Repaired []string
+	// Skipped 基准一侧文件不存在、无法修复的路径 (不会反向删除另一侧)
+	Skipped []string
+}
+
+// Repair 按 source 指定的方向强制重新同步 paths，并在完成后更新数据库基准
+// paths 为空时先执行 Verify，修复所有校验不一致的路径。
+// 基准一侧缺失的文件只记录为跳过，避免误删另一侧的数据。
+func (e *Engine) Repair(ctx context.Context, source RepairSource, paths []string) (*RepairResult, error) {
+	runID := RunIDFromContext(ctx)
+	if runID == "" {
+		runID = NewRunID()
+		ctx = WithRunID(ctx, runID)
+	}
+	log := e.opts.Logger.With("run_id", runID)
+
+	if len(paths) == 0 {
+		verified, err := e.Verify(ctx)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, d := range verified.Drifts {
+			if !seen[d.RelPath] {
+				seen[d.RelPath] = true
+				paths = append(paths, d.RelPath)
+			}
+		}
+	}
+
+	log.Info("开始修复", "source", source, "count", len(paths))
+
+	var (
+		mu     sync.Mutex
+		result = &RepairResult{}
+		errs   []error
+		wg     sync.WaitGroup
+	)
+
+	pathChan := make(chan string, len(paths))
+	for _, p := range paths {
+		pathChan <- p
+	}
+	close(pathChan)
+
+	workers := e.maxWorkers()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range pathChan {
+				if ctx.Err() != nil {
+					return
+				}
+				skipped, err := e.repairPath(ctx, log, source, path)
+				mu.Lock()
+				switch {
+				case err != nil:
+					log.Error("修复失败", "path", path, "err", err)
+					errs = append(errs, fmt.Errorf("%s: %w", path, err))
+				case skipped:
+					result.Skipped = append(result.Skipped, path)
+				default:
+					result.Repaired = append(result.Repaired, path)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(result.Repaired)
+	sort.Strings(result.Skipped)
+	log.Info("修复完成", "repaired", len(result.Repaired), "skipped", len(result.Skipped), "failed", len(errs))
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%d path(s) failed to repair: %w", len(errs), errors.Join(errs...))
+	}
+	return result, nil
+}
+
+// repairPath 按基准方向重新传输单个文件；基准一侧不存在时返回 skipped=true
+func (e *Engine) repairPath(ctx context.Context, log *slog.Logger, source RepairSource, path string) (skipped bool, err error) {
+	src := e.opts.LocalFS
+	if source == RepairFromRemote {
+		src = e.opts.RemoteFS
+	}
+	if _, err := src.Stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Warn("基准一侧文件不存在，跳过修复", "path", path, "source", source)
+			return true, nil
+		}
+		return false, err
+	}
+
+	if source == RepairFromRemote {
+		return false, e.doDownload(ctx, log, path)
+	}
+	return false, e.doUpload(ctx, log, path, fs.ExistOverwrite)
+}
@@ -0,0 +1,109 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"baidusync/internal/crypto"
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+)
+
+type rescanKey struct{}
+
+// WithRescan 返回要求完全重新扫描的 ctx，用于怀疑同步记录已损坏时的恢复
+// Engine.Run / Engine.Plan 会忽略数据库中的全部记录，按首次同步的逻辑处理每个路径:
+//   - 没有记录就不会产生任何删除，只有一侧存在的文件会被补传或补下载
+//   - 两侧都存在的文件按内容比对 (见 sameContent)，一致时重建记录，不一致时按 FirstRunBias 处理
+//
+// Run 生成计划后会清空范围内的旧记录，由本轮的结果重新建立 (见 resetBase)
+func WithRescan(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rescanKey{}, true)
+}
+
+// rescanning ctx 是否要求完全重新扫描
+func rescanning(ctx context.Context) bool {
+	on, _ := ctx.Value(rescanKey{}).(bool)
+	return on
+}
+
+// resetBase 删除范围内 (Subpath 之内、未被排除) 的所有同步记录
+// 旧记录不可信，不能留给之后的同步使用: 例如本轮上传失败的文件如果还留着旧记录，
+// 下一轮可能被误判为“云端已删除”而删除本地文件。清空后未完成的路径在下一轮仍按首次同步处理
+func (e *Engine) resetBase(log *slog.Logger) error {
+	var keys []string
+	err := e.opts.StateDB.ForEach(func(b *database.FileState) error {
+		if !e.excluded(b.RelPath) {
+			keys = append(keys, b.RelPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("读取同步记录失败: %w", err)
+	}
+	for _, key := range keys {
+		if err := e.opts.StateDB.Delete(key); err != nil {
+			return fmt.Errorf("清空同步记录失败: %w", err)
+		}
+	}
+	log.Warn("重新扫描: 已清空旧的同步记录，将按两侧的实际内容重建", "records", len(keys))
+	return nil
+}
+
+// sameContent 重新扫描时代替只比较大小的 isSameFileFuzzy，按内容判断两侧是否一致
+// 云端提供的 MD5 与本地明文 MD5 相同时直接认定一致；否则大小吻合时读取云端文件 (必要时解密)
+// 计算明文 Hash 与本地比对。读取失败时视为不一致，交给 FirstRunBias 处理
+func (e *Engine) sameContent(ctx context.Context, log *slog.Logger, l, r *fs.FileMeta) bool {
+	encrypted := e.encrypted() && r.Size == e.opts.RemoteFS.StoredSize(l.Size, true)
+	if !encrypted && r.Size != e.opts.RemoteFS.StoredSize(l.Size, false) {
+		return false
+	}
+	if l.Hash == "" {
+		stat, err := fs.Stat(ctx, e.opts.LocalFS, l.RelPath)
+		if err != nil || stat.Size != l.Size {
+			log.Warn("重新扫描: 无法计算本地文件的 Hash，视为不一致", "path", l.RelPath, "err", err)
+			return false
+		}
+		l.Hash = stat.Hash
+	}
+	algorithm := fs.HashAlgorithmOf(e.opts.LocalFS)
+	if !encrypted && e.opts.RemoteFS.HasContentHash() && algorithm == fs.HashMD5 && strings.EqualFold(l.Hash, r.RemoteHash) {
+		return true
+	}
+
+	sum, err := e.remoteSum(ctx, r, encrypted, algorithm)
+	if err != nil {
+		log.Warn("重新扫描: 读取云端文件失败，视为不一致", "path", r.RelPath, "err", err)
+		return false
+	}
+	return strings.EqualFold(l.Hash, sum)
+}
+
+// remoteSum 读取云端文件，返回明文内容的 Hash
+func (e *Engine) remoteSum(ctx context.Context, r *fs.FileMeta, encrypted bool, algorithm string) (string, error) {
+	rc, err := e.opts.RemoteFS.OpenStream(r.RelPath)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	stop := context.AfterFunc(ctx, func() { rc.Close() })
+	defer stop()
+
+	var src io.Reader = e.throttle(ctx, fs.NewContextReader(ctx, rc))
+	if encrypted {
+		if src, err = crypto.NewDecryptReader(src, e.opts.EncryptKey); err != nil {
+			return "", fmt.Errorf("解密失败: %w", err)
+		}
+	}
+	h, err := newHashingReader(src, algorithm)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(io.Discard, h); err != nil {
+		return "", err
+	}
+	return h.Sum(), nil
+}
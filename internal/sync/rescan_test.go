@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"baidusync/internal/database"
+)
+
+// rescan 执行一轮忽略数据库记录的完全重新扫描
+func (env *testEnv) rescan(e *Engine) *RunResult {
+	env.t.Helper()
+	result, err := e.Run(WithRescan(context.Background()))
+	if err != nil {
+		env.t.Fatalf("重新扫描失败: %v", err)
+	}
+	return result
+}
+
+func TestRescanIgnoresCorruptDatabase(t *testing.T) {
+	env := newTestEnv(t)
+	for _, p := range []string{"a.txt", "b.txt", "c.txt"} {
+		env.local.PutFile(p, []byte("content of "+p), t0)
+	}
+	e := env.engine(func(o *EngineOptions) { o.FirstRunBias = BiasLocal })
+	env.run(e)
+
+	// 损坏的记录: b.txt 的 Hash 错误，gone.txt 在两侧都不存在
+	env.db.Put(&database.FileState{RelPath: "b.txt", FileSize: 1, LocalHash: "bogus", RemoteHash: "bogus"})
+	env.db.Put(&database.FileState{RelPath: "gone.txt", FileSize: 3})
+	// 云端丢失了 c.txt: 按旧记录会删除本地文件，重新扫描时应补传
+	env.remote.Delete("c.txt")
+	// 大小相同、内容不同: 只比较大小会误认为一致
+	env.advance(time.Minute)
+	env.local.PutFile("d.txt", []byte("local!"), env.now)
+	env.remote.PutFile("d.txt", []byte("remote"), env.now)
+
+	result := env.rescan(e)
+	if result.Succeeded[OpDeleteLocal] != 0 || result.Succeeded[OpDeleteRemote] != 0 {
+		t.Fatalf("重新扫描时删除了 %d 个本地、%d 个云端文件", result.Succeeded[OpDeleteLocal], result.Succeeded[OpDeleteRemote])
+	}
+	if result.Succeeded[OpUpload] != 2 {
+		t.Fatalf("上传 %d 个，应补传 c.txt 并按 first_run_bias 上传 d.txt", result.Succeeded[OpUpload])
+	}
+	wantFile(t, env.local, "c.txt", "content of c.txt")
+	wantFile(t, env.remote, "c.txt", "content of c.txt")
+	wantFile(t, env.remote, "d.txt", "local!")
+	wantState(t, env.db, "gone.txt", false)
+	if b := wantState(t, env.db, "b.txt", true); b.LocalHash != md5Hex("content of b.txt") {
+		t.Fatalf("b.txt 的记录未重建: %+v", b)
+	}
+	env.wantIdle(e)
+}
+
+func TestRescanEncryptedComparesContent(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("same.txt", []byte("same"), t0)
+	env.local.PutFile("diff.txt", []byte("local"), t0)
+	e := env.engine(withKey(keyA), func(o *EngineOptions) { o.FirstRunBias = BiasRemote })
+	env.run(e)
+
+	// 云端的 MD5 是密文的 MD5，只能解密后比对；两个版本的大小相同
+	env.advance(time.Minute)
+	env.remote.PutFile("diff.txt", encryptFor(t, "other", keyA), env.now)
+
+	result := env.rescan(e)
+	if result.Succeeded[OpDownload] != 1 || result.Succeeded[OpUpload] != 0 {
+		t.Fatalf("下载 %d 个、上传 %d 个，应只下载 diff.txt", result.Succeeded[OpDownload], result.Succeeded[OpUpload])
+	}
+	wantFile(t, env.local, "diff.txt", "other")
+	wantFile(t, env.local, "same.txt", "same")
+	wantState(t, env.db, "same.txt", true)
+	env.wantIdle(e)
+}
@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"sync"
+	"time"
+)
+
+// RunResult 一轮同步的统计结果
+// 任务执行过程中并发累加，Run 返回后不再修改，可以直接读取各字段
+type RunResult struct {
+	RunID    string
+	Started  time.Time
+	Duration time.Duration
+
+	// Succeeded / Failed 按操作类型统计的任务数
+	Succeeded map[OpType]int
+	Failed    map[OpType]int
+	// 成功的任务实际上传 / 下载的明文字节数 (在云端复制的文件不计入)
+	BytesUploaded   int64
+	BytesDownloaded int64
+	// 与云端之间实际传输的字节数 (加密时为密文)，包括失败、中断的任务已经传输的部分
+	WireBytesUploaded   int64
+	WireBytesDownloaded int64
+	// Deferred 推迟到下一轮的任务数: 目标文件刚被修改 (见 QuietPeriod)，
+	// 或收到停止请求、被取消、超时、中止后还没有开始执行的任务
+	// 成功、失败与推迟的任务数之和总是等于本轮计划执行的任务数
+	Deferred int
+	// Concurrency 文件传输阶段结束时的并发数 (没有文件任务时为 0)
+	Concurrency int
+
+	// removedRemote 本轮在云端成功删除的路径 (用于清理变空的云端目录)
+	removedRemote []string
+
+	mu sync.Mutex
+}
+
+func newRunResult(runID string) *RunResult {
+	return &RunResult{
+		RunID:     runID,
+		Started:   time.Now(),
+		Succeeded: make(map[OpType]int),
+		Failed:    make(map[OpType]int),
+	}
+}
+
+// record 记录一个任务的执行结果
+func (r *RunResult) record(t *Task, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s := t.stats; s != nil {
+		r.WireBytesUploaded += s.upWire.Load()
+		r.WireBytesDownloaded += s.downWire.Load()
+		if err == nil {
+			r.BytesUploaded += s.upPlain.Load()
+			r.BytesDownloaded += s.downPlain.Load()
+		}
+	}
+	if err != nil {
+		r.Failed[t.Op]++
+		return
+	}
+	r.Succeeded[t.Op]++
+	switch t.Op {
+	case OpDeleteRemote, OpRmdirRemote:
+		r.removedRemote = append(r.removedRemote, t.RelPath)
+	case OpMoveRemote:
+		// 移走文件后原目录可能变空
+		r.removedRemote = append(r.removedRemote, t.From)
+	}
+}
+
+// deferTasks 记录 n 个推迟到下一轮的任务
+func (r *RunResult) deferTasks(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Deferred += n
+}
+
+// Conflicts 本轮处理的冲突数 (包括处理失败的)
+func (r *RunResult) Conflicts() int {
+	return r.Succeeded[OpConflict] + r.Failed[OpConflict]
+}
+
+// Total 本轮执行的任务总数
+func (r *RunResult) Total() (succeeded, failed int) {
+	for _, n := range r.Succeeded {
+		succeeded += n
+	}
+	for _, n := range r.Failed {
+		failed += n
+	}
+	return succeeded, failed
+}
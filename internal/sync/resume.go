@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"baidusync/internal/fs"
+)
+
+// beginCycle 在数据库中记录本轮同步开始
+// 上一轮同步中途退出时返回它已经完成的任务，本轮跳过这些任务
+// 进度记录只是优化，读写失败时记录日志后照常同步
+func (e *Engine) beginCycle(log *slog.Logger, runID string) map[string]bool {
+	interrupted, done, err := e.opts.StateDB.BeginCycle(runID)
+	if err != nil {
+		log.Warn("记录同步进度失败", "err", err)
+		return nil
+	}
+	if interrupted != nil {
+		log.Warn("上一轮同步没有正常结束，将跳过其中已完成的任务",
+			"interrupted_run_id", interrupted.RunID,
+			"started", time.Unix(0, interrupted.Started).Format(time.DateTime),
+			"completed", len(done),
+		)
+	}
+	return done
+}
+
+// finishCycle 记录本轮同步结束
+// 被外部取消 (例如程序退出) 时保留进度，下次启动时跳过已完成的任务
+func (e *Engine) finishCycle(ctx context.Context, log *slog.Logger, err error) {
+	if ctx.Err() != nil {
+		log.Info("同步被中断，已完成的任务将在下一轮跳过")
+		return
+	}
+	if errors.Is(err, ErrStopped) {
+		// 剩余任务没有执行，本轮不算完成，保留进度供下一轮使用
+		return
+	}
+	if err := e.opts.StateDB.FinishCycle(err == nil); err != nil {
+		log.Warn("记录同步进度失败", "err", err)
+	}
+}
+
+// skipCompleted 去掉上一轮中途退出前已经完成的任务
+// 任务 Key 包含扫描到的两侧元数据，文件在此期间又被修改时 Key 不同，不会被跳过
+func (e *Engine) skipCompleted(log *slog.Logger, tasks []Task, done map[string]bool) []Task {
+	if len(done) == 0 {
+		return tasks
+	}
+	remaining := tasks[:0]
+	for _, t := range tasks {
+		if done[taskKey(&t)] {
+			log.Debug("跳过上一轮已完成的任务", "path", t.RelPath, "op", t.Op)
+			continue
+		}
+		remaining = append(remaining, t)
+	}
+	if skipped := len(tasks) - len(remaining); skipped > 0 {
+		log.Info("已跳过上一轮已完成的任务", "count", skipped)
+	}
+	return remaining
+}
+
+// markDone 记录任务已完成
+func (e *Engine) markDone(log *slog.Logger, t *Task) {
+	if err := e.opts.StateDB.MarkTaskDone(taskKey(t)); err != nil {
+		log.Warn("记录同步进度失败", "path", t.RelPath, "err", err)
+	}
+}
+
+// taskKey 任务的唯一标识: 操作类型、路径以及扫描到的两侧元数据
+func taskKey(t *Task) string {
+	return fmt.Sprintf("%s|%s|%s|%s", t.Op, t.RelPath, metaKey(t.Local), metaKey(t.Remote))
+}
+
+func metaKey(m *fs.FileMeta) string {
+	if m == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d:%s:%s", m.Size, m.ModTime.UnixNano(), m.Hash, m.RemoteHash)
+}
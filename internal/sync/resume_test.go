@@ -0,0 +1,150 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"baidusync/internal/fs/memfs"
+)
+
+// recordingFS 记录每次写入的路径
+type recordingFS struct {
+	*memfs.FS
+	writes []string
+}
+
+func (f *recordingFS) WriteStream(relPath string, stream io.Reader, modTime time.Time) (string, error) {
+	f.writes = append(f.writes, relPath)
+	return f.FS.WriteStream(relPath, stream, modTime)
+}
+
+func TestSkipCompleted(t *testing.T) {
+	env := newTestEnv(t)
+	for _, p := range []string{"a.txt", "b.txt", "c.txt"} {
+		env.local.PutFile(p, []byte(p), t0)
+	}
+	e := env.engine()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	plan, err := e.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.skipCompleted(log, slices.Clone(plan.Tasks), nil); len(got) != 3 {
+		t.Fatalf("没有已完成的任务时剩余 %d 个，应为 3 个", len(got))
+	}
+
+	// 上一轮完成了 a.txt 与 b.txt 的上传，之后 b.txt 又被修改
+	done := make(map[string]bool)
+	for i := range plan.Tasks {
+		if plan.Tasks[i].RelPath != "c.txt" {
+			done[taskKey(&plan.Tasks[i])] = true
+		}
+	}
+	env.advance(time.Minute)
+	env.local.PutFile("b.txt", []byte("b.txt v2"), env.now)
+
+	plan, err = e.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var remaining []string
+	for _, task := range e.skipCompleted(log, plan.Tasks, done) {
+		remaining = append(remaining, task.RelPath)
+	}
+	slices.Sort(remaining)
+	// b.txt 的元数据变了，Key 不同，不能当作已完成
+	if want := []string{"b.txt", "c.txt"}; !slices.Equal(remaining, want) {
+		t.Fatalf("剩余的任务为 %v，应为 %v", remaining, want)
+	}
+}
+
+func TestResumeAfterInterrupt(t *testing.T) {
+	const n = 6
+	env := newTestEnv(t)
+	var paths []string
+	for i := range n {
+		p := fmt.Sprintf("f%02d.txt", i)
+		env.local.PutFile(p, []byte(p), t0)
+		paths = append(paths, p)
+	}
+
+	// 上传 2 个文件后中断
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := env.engine(func(o *EngineOptions) {
+		o.MaxWorkers = 1
+		o.RemoteFS = &cancelingFS{FS: env.remote, n: 2, cancel: cancel}
+	})
+	result, err := e.Run(ctx)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	if result.Succeeded[OpUpload] != 2 || result.Deferred != n-2 {
+		t.Fatalf("上传 %d 个、推迟 %d 个，应为 2 与 %d 个", result.Succeeded[OpUpload], result.Deferred, n-2)
+	}
+	cursor, err := env.db.Cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cursor.InProgress() || !cursor.LastSuccessAsTime().IsZero() {
+		t.Fatalf("中断后的进度为 %+v，应仍在进行中且没有成功记录", cursor)
+	}
+	var uploaded []string
+	for _, p := range paths {
+		if env.remote.Exists(p) {
+			uploaded = append(uploaded, p)
+		}
+	}
+	if len(uploaded) != 2 {
+		t.Fatalf("中断前上传了 %v，应为 2 个", uploaded)
+	}
+
+	// 中断期间修改一个已经上传的文件
+	env.advance(time.Minute)
+	env.local.PutFile(uploaded[0], []byte("modified"), env.now)
+
+	// 再次同步: 中断前完成且没有变化的文件不再上传，修改过的与剩余的文件上传
+	remote := &recordingFS{FS: env.remote}
+	result = env.run(env.engine(func(o *EngineOptions) {
+		o.MaxWorkers = 1
+		o.RemoteFS = remote
+	}))
+	var want []string
+	for _, p := range paths {
+		if p == uploaded[0] || !slices.Contains(uploaded, p) {
+			want = append(want, p)
+		}
+	}
+	slices.Sort(remote.writes)
+	if !slices.Equal(remote.writes, want) {
+		t.Fatalf("再次同步上传了 %v，应为 %v", remote.writes, want)
+	}
+	if succeeded, failed := result.Total(); succeeded != len(want) || failed != 0 {
+		t.Fatalf("成功 %d 个、失败 %d 个，应成功 %d 个", succeeded, failed, len(want))
+	}
+	wantFile(t, env.remote, uploaded[0], "modified")
+	wantFile(t, env.remote, uploaded[1], uploaded[1])
+
+	// 正常结束: 清除进度并记录最近一次成功同步
+	if cursor, err = env.db.Cursor(); err != nil {
+		t.Fatal(err)
+	}
+	if cursor.InProgress() || cursor.LastSuccessRunID != result.RunID {
+		t.Fatalf("同步结束后的进度为 %+v，最近一次成功应为 %s", cursor, result.RunID)
+	}
+	interrupted, completed, err := env.db.BeginCycle("next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupted != nil || len(completed) != 0 {
+		t.Fatalf("正常结束后不应保留进度: %+v %v", interrupted, completed)
+	}
+	env.wantIdle(env.engine())
+}
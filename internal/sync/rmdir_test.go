@@ -0,0 +1,67 @@
+package sync
+
+import (
+	"testing"
+
+	"baidusync/internal/database"
+)
+
+// populatedDir 同步一个多层目录，并写入一条两侧都不存在的幽灵记录 (模拟列表分页出错时漏掉、随后被删除的文件)
+func populatedDir(t *testing.T) (*testEnv, *Engine) {
+	t.Helper()
+	env := newTestEnv(t)
+	env.local.PutFile("docs/a.txt", []byte("a"), t0)
+	env.local.PutFile("docs/sub/b.txt", []byte("b"), t0)
+	env.local.PutFile("docs/sub/deep/c.txt", []byte("c"), t0)
+	env.local.PutFile("docs-old/keep.txt", []byte("keep"), t0)
+	e := env.engine()
+	env.run(e)
+	if err := env.db.Put(&database.FileState{RelPath: "docs/sub/ghost.txt", FileSize: 5}); err != nil {
+		t.Fatal(err)
+	}
+	return env, e
+}
+
+// wantNoRecordsUnder 检查数据库中没有 prefix 及其下级的记录
+func wantNoRecordsUnder(t *testing.T, db *database.DB, prefix string) {
+	t.Helper()
+	left, err := db.ListByPrefix(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Fatalf("%s 下仍有 %d 条记录: %v", prefix, len(left), keysOf(left))
+	}
+}
+
+func keysOf(m map[string]*database.FileState) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+func TestDeleteLocalDirRemovesDescendantRecords(t *testing.T) {
+	env, e := populatedDir(t)
+
+	env.local.Delete("docs")
+	env.run(e)
+	wantMissing(t, env.remote, "docs")
+	wantNoRecordsUnder(t, env.db, "docs")
+	// 同名前缀的兄弟目录不受影响
+	wantFile(t, env.remote, "docs-old/keep.txt", "keep")
+	wantState(t, env.db, "docs-old/keep.txt", true)
+	env.wantIdle(e)
+}
+
+func TestDeleteRemoteDirRemovesDescendantRecords(t *testing.T) {
+	env, e := populatedDir(t)
+
+	env.remote.Delete("docs")
+	env.run(e)
+	wantMissing(t, env.local, "docs")
+	wantNoRecordsUnder(t, env.db, "docs")
+	wantState(t, env.db, "docs-old/keep.txt", true)
+	env.wantIdle(e)
+}
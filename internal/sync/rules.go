@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"path"
+	"strings"
+)
+
+// ConflictRule 按路径选择冲突策略
+// Pattern 是使用 "/" 分隔的 glob：支持 path.Match 的 * ? [...]，
+// 以及匹配任意层目录的 "**"；不含 "/" 的模式 (例如 "*.docx") 只匹配文件名
+type ConflictRule struct {
+	Pattern  string
+	Strategy ConflictStrategy
+}
+
+// Match 判断规则是否适用于 relPath
+func (r ConflictRule) Match(relPath string) bool {
+	if !strings.Contains(r.Pattern, "/") {
+		ok, _ := path.Match(r.Pattern, path.Base(relPath))
+		return ok
+	}
+	return matchSegments(strings.Split(r.Pattern, "/"), strings.Split(relPath, "/"))
+}
+
+// matchSegments 逐级匹配路径，"**" 可以匹配零个或多个目录
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// 依次尝试让 "**" 吞掉 0..n 级目录
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// conflictStrategyFor 按顺序匹配规则，第一条匹配的规则生效；都不匹配时使用全局策略
+func (e *Engine) conflictStrategyFor(relPath string) ConflictStrategy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, rule := range e.opts.ConflictRules {
+		if rule.Match(relPath) {
+			return rule.Strategy
+		}
+	}
+	return e.opts.ConflictStrategy
+}
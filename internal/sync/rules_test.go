@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConflictRuleMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		relPath string
+		want    bool
+	}{
+		{"*.docx", "report.docx", true},
+		{"*.docx", "docs/2024/report.docx", true}, // 不含 "/" 只匹配文件名
+		{"*.docx", "report.docx.bak", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/sub/a.md", false},
+		{"docs/**", "docs/sub/deeper/a.md", true},
+		{"docs/**", "docs", true},
+		{"docs/**", "documents/a.md", false},
+		{"**/build/*", "build/out.bin", true},
+		{"**/build/*", "src/app/build/out.bin", true},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/a/b/main.go", true},
+		{"src/**/*.go", "vendor/src/main.go", false},
+	}
+	for _, tt := range tests {
+		if got := (ConflictRule{Pattern: tt.pattern}).Match(tt.relPath); got != tt.want {
+			t.Errorf("%q 匹配 %q = %v，应为 %v", tt.pattern, tt.relPath, got, tt.want)
+		}
+	}
+}
+
+func TestConflictStrategyForFirstMatchWins(t *testing.T) {
+	env := newTestEnv(t)
+	e := env.engine(func(o *EngineOptions) {
+		o.ConflictStrategy = StrategyKeepNewest
+		o.ConflictRules = []ConflictRule{
+			{Pattern: "*.docx", Strategy: StrategyForceDownload},
+			{Pattern: "docs/**", Strategy: StrategyForceUpload},
+			{Pattern: "docs/*.docx", Strategy: StrategyRenameRemote}, // 被第一条遮住，永远不会生效
+		}
+	})
+
+	tests := map[string]ConflictStrategy{
+		"docs/report.docx": StrategyForceDownload,
+		"docs/notes.md":    StrategyForceUpload,
+		"report.docx":      StrategyForceDownload,
+		"src/main.go":      StrategyKeepNewest,
+	}
+	for relPath, want := range tests {
+		if got := e.conflictStrategyFor(relPath); got != want {
+			t.Errorf("%s 的冲突策略为 %d，应为 %d", relPath, got, want)
+		}
+	}
+
+	// 热更新后按新规则选择
+	e.Reload(StrategyRenameLocal, nil, 2)
+	if got := e.conflictStrategyFor("docs/report.docx"); got != StrategyRenameLocal {
+		t.Errorf("清空规则后冲突策略为 %d，应回落到全局策略", got)
+	}
+}
+
+func TestRunConflictRulesPerPath(t *testing.T) {
+	env := newTestEnv(t)
+	for _, p := range []string{"docs/a.docx", "docs/b.md", "c.md"} {
+		env.local.PutFile(p, []byte("v1"), t0)
+	}
+	e := env.engine(func(o *EngineOptions) {
+		o.ConflictRules = []ConflictRule{
+			{Pattern: "*.docx", Strategy: StrategyForceDownload},
+			{Pattern: "docs/**", Strategy: StrategyForceUpload},
+		}
+	})
+	env.run(e)
+
+	env.advance(time.Minute)
+	for _, p := range []string{"docs/a.docx", "docs/b.md", "c.md"} {
+		env.local.PutFile(p, []byte("local "+p), env.now)
+		env.remote.PutFile(p, []byte("remote "+p), env.now)
+	}
+	env.run(e)
+
+	// 第一条规则: 云端覆盖本地
+	wantFile(t, env.local, "docs/a.docx", "remote docs/a.docx")
+	wantFile(t, env.remote, "docs/a.docx", "remote docs/a.docx")
+	// 第二条规则: 本地覆盖云端
+	wantFile(t, env.local, "docs/b.md", "local docs/b.md")
+	wantFile(t, env.remote, "docs/b.md", "local docs/b.md")
+	// 都不匹配: 默认策略重命名本地
+	wantFile(t, env.local, "c.md", "remote c.md")
+	wantFile(t, env.local, "c.md.local", "local c.md")
+}
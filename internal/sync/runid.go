@@ -0,0 +1,29 @@
+package sync
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// runIDKey Run ID 在 context 中的 Key
+type runIDKey struct{}
+
+// NewRunID 生成一个简短的随机 Run ID (8 位十六进制)，用于关联同一轮同步的日志
+func NewRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRunID 将 Run ID 放入 context，Engine.Run 会沿用它而不是重新生成
+// 调用方 (如 main.go) 可以借此在自己的日志中使用同一个 Run ID
+func WithRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, id)
+}
+
+// RunIDFromContext 取出 context 中的 Run ID，没有时返回空字符串
+func RunIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
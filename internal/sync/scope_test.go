@@ -0,0 +1,57 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSubpathConfinesTasks(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("docs/synced.txt", []byte("synced"), t0)
+	env.local.PutFile("gone-local.txt", []byte("outside"), t0)
+	env.local.PutFile("gone-remote.txt", []byte("outside"), t0)
+	env.run(env.engine())
+
+	// 范围之外: 新文件、两个方向的删除；范围之内: 新文件与删除
+	env.local.PutFile("docs/new.txt", []byte("new"), t0)
+	env.local.PutFile("docs-old/x.txt", []byte("sibling"), t0)
+	env.local.PutFile("top.txt", []byte("top"), t0)
+	env.remote.PutFile("photos/c.jpg", []byte("photo"), t0)
+	env.remote.PutFile("docs/sub/remote.txt", []byte("remote"), t0)
+	env.local.Delete("gone-local.txt")
+	env.remote.Delete("gone-remote.txt")
+	env.remote.Delete("docs/synced.txt")
+	e := env.engine(func(o *EngineOptions) { o.Subpath = "docs" })
+
+	plan, err := e.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range plan.Tasks {
+		if task.RelPath != "docs" && !strings.HasPrefix(task.RelPath, "docs/") {
+			t.Errorf("范围之外的任务: %s %s", task.Op, task.RelPath)
+		}
+	}
+
+	env.run(e)
+	wantFile(t, env.remote, "docs/new.txt", "new")
+	wantFile(t, env.local, "docs/sub/remote.txt", "remote")
+	wantMissing(t, env.local, "docs/synced.txt")
+	// 范围之外的内容与记录保持原样
+	wantMissing(t, env.remote, "docs-old/x.txt")
+	wantMissing(t, env.remote, "top.txt")
+	wantMissing(t, env.local, "photos/c.jpg")
+	wantFile(t, env.remote, "gone-local.txt", "outside")
+	wantFile(t, env.local, "gone-remote.txt", "outside")
+	wantState(t, env.db, "gone-local.txt", true)
+	wantState(t, env.db, "gone-remote.txt", true)
+	env.wantIdle(e)
+
+	// 去掉范围后照常处理其余的变化
+	env.run(env.engine())
+	wantMissing(t, env.remote, "gone-local.txt")
+	wantMissing(t, env.local, "gone-remote.txt")
+	wantFile(t, env.remote, "top.txt", "top")
+	wantFile(t, env.local, "photos/c.jpg", "photo")
+}
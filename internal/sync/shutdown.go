@@ -0,0 +1,60 @@
+package sync
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStopped 收到停止请求后不再开始新的任务，正在执行的任务已经完成并写入数据库，剩余任务留到下一轮
+// 与 ctx 被取消 (正在传输的文件被中断) 不同，这种退出不会留下半途而废的任务
+var ErrStopped = errors.New("同步已停止")
+
+type stopKey struct{}
+
+// WithGracefulStop 返回可以分两步停止同步的 ctx
+// 第一步调用 stop: 不再开始新的任务，正在执行的任务继续完成并写入数据库；
+// 第二步取消 ctx (或其父 ctx): 立即中断正在传输的文件
+func WithGracefulStop(ctx context.Context) (context.Context, context.CancelFunc) {
+	stopCtx, stop := context.WithCancel(context.Background())
+	return context.WithValue(ctx, stopKey{}, stopCtx), stop
+}
+
+// Stopping 返回收到停止请求时关闭的 channel (ctx 不是由 WithGracefulStop 创建时返回 nil，永远不会关闭)
+func Stopping(ctx context.Context) <-chan struct{} {
+	if stopCtx, ok := ctx.Value(stopKey{}).(context.Context); ok {
+		return stopCtx.Done()
+	}
+	return nil
+}
+
+// StopRequested 是否已经收到停止请求
+func StopRequested(ctx context.Context) bool {
+	select {
+	case <-Stopping(ctx):
+		return true
+	default:
+		return false
+	}
+}
+
+// dispatchContext 返回决定是否开始新任务的 ctx: 收到停止请求或 ctx 本身结束时结束
+// 正在执行的任务仍然使用原来的 ctx，不会因为停止请求而中断
+func dispatchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	dispatch, cancel := context.WithCancel(ctx)
+	stopCtx, ok := ctx.Value(stopKey{}).(context.Context)
+	if !ok {
+		return dispatch, cancel
+	}
+	unregister := context.AfterFunc(stopCtx, cancel)
+	return dispatch, func() {
+		unregister()
+		cancel()
+	}
+}
+
+// dispatchStopped 是否应当停止派发新任务
+// dispatchContext 通过 AfterFunc 异步取消 dispatch，停止请求之后的短时间内 dispatch.Err() 可能仍为 nil，
+// 这里同时直接检查停止请求，保证调用 stop 之后不会再开始新的任务
+func dispatchStopped(dispatch context.Context) bool {
+	return dispatch.Err() != nil || StopRequested(dispatch)
+}
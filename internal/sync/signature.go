@@ -0,0 +1,67 @@
+package sync
+
+import (
+	"context"
+	"log/slog"
+
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+)
+
+// localUnchanged 判断本地文件相对基准是否未变化
+// 先比对廉价的签名 (大小、修改时间与文件标识，扫描时即可得到，见 isLocalSameAsBase)；
+// 签名变化、但大小与记录一致且开启了 VerifyLocalChanges 时，再计算完整的 Hash 与记录比对，
+// 只有内容确实变化才算作修改。开启内容加密时重新上传的代价很高 (每次上传的密文都不同，无法秒传)，
+// 只被 touch、或从备份恢复后修改时间改变的文件不会因此被重新上传
+// 计算出的 Hash 写回 l.Hash，同一轮中之后的比对直接使用，不会重复计算
+func (e *Engine) localUnchanged(ctx context.Context, log *slog.Logger, l *fs.FileMeta, b *database.FileState) bool {
+	if isLocalSameAsBase(l, b) {
+		return true
+	}
+	if !e.opts.VerifyLocalChanges || l.Hash != "" || b.LocalHash == "" || l.Size != b.FileSize {
+		return false
+	}
+	stat, err := fs.Stat(ctx, e.opts.LocalFS, l.RelPath)
+	if err != nil || stat.Size != l.Size || !fs.SameHashAlgorithm(stat.Hash, b.LocalHash) {
+		// 无法确认时按已修改处理，交给正常的同步流程
+		return false
+	}
+	l.Hash = stat.Hash
+	if l.Hash != b.LocalHash {
+		return false
+	}
+	log.Debug("本地文件只有修改时间 (或文件标识) 变化，内容与记录一致", "path", l.RelPath)
+	return true
+}
+
+// signatureChanged 本地文件内容与记录一致 (已按 Hash 确认)，但签名与记录不同，需要更新记录中的签名
+func signatureChanged(l *fs.FileMeta, b *database.FileState) bool {
+	return b != nil && l != nil && !l.IsDir && l.Hash != "" && l.Hash == b.LocalHash && !sameLocalSignature(l, b)
+}
+
+// recordSignatures 把内容未变化的文件的新签名 (本地修改时间、文件标识与云端 Hash) 写入记录
+// 不更新时这些文件每一轮都要重新计算 Hash (或重新读取云端文件)
+func (e *Engine) recordSignatures(log *slog.Logger, tasks []Task) {
+	for _, t := range tasks {
+		key := e.dbKey(t.RelPath)
+		state, err := e.opts.StateDB.Get(key)
+		if err != nil || state == nil {
+			continue
+		}
+		if signatureChanged(t.Local, state) {
+			state.ModTime = t.Local.ModTime.UnixNano()
+			if t.Local.FileID != "" {
+				state.FileID = t.Local.FileID
+			}
+		}
+		if remoteHashChanged(t.Remote, state) {
+			state.RemoteHash = t.Remote.RemoteHash
+		}
+		if err := e.putState(state); err != nil {
+			log.Error("更新本地文件签名失败", "path", t.RelPath, "err", err)
+		}
+	}
+	if len(tasks) > 0 {
+		log.Info("文件内容未变化，已更新记录中的签名", "count", len(tasks))
+	}
+}
@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"baidusync/internal/database"
+	"baidusync/internal/fs/local"
+	"baidusync/internal/fs/memfs"
+)
+
+// BenchmarkPlanUnchanged 加密同步一个没有变化的大目录后反复生成计划
+// unchanged: 签名 (大小、修改时间、文件标识) 与记录一致，不读取文件内容
+// touched: 修改时间全部改变，每个文件都要重新计算 Hash 才能确认内容未变
+func BenchmarkPlanUnchanged(b *testing.B) {
+	const files, size = 500, 64 << 10
+	for _, touched := range []bool{false, true} {
+		name := "unchanged"
+		if touched {
+			name = "touched"
+		}
+		b.Run(name, func(b *testing.B) {
+			root := b.TempDir()
+			data := strings.Repeat("x", size)
+			for i := range files {
+				p := filepath.Join(root, fmt.Sprintf("dir%02d", i%20), fmt.Sprintf("file%04d.bin", i))
+				os.MkdirAll(filepath.Dir(p), 0755)
+				if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+					b.Fatal(err)
+				}
+			}
+			db, err := database.NewBoltDB(filepath.Join(b.TempDir(), "state.db"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+			adapter := local.NewAdapter(root)
+			adapter.SetTrackIdentity(true)
+			e := NewEngine(&EngineOptions{
+				LocalFS:            adapter,
+				RemoteFS:           memfs.New("remote"),
+				StateDB:            db,
+				MaxWorkers:         8,
+				EncryptKey:         keyA,
+				VerifyLocalChanges: true,
+				Logger:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+			})
+			ctx := context.Background()
+			if _, err := e.Run(ctx); err != nil {
+				b.Fatal(err)
+			}
+			if touched {
+				later := time.Now().Add(time.Hour)
+				filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+					if err == nil && !d.IsDir() {
+						os.Chtimes(p, later, later)
+					}
+					return err
+				})
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for b.Loop() {
+				plan, err := e.Plan(ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(plan.Tasks) != 0 {
+					b.Fatalf("没有变化的目录产生了 %d 个任务", len(plan.Tasks))
+				}
+			}
+		})
+	}
+}
+
+func withVerifyLocal(o *EngineOptions) {
+	o.VerifyLocalChanges = true
+}
+
+func TestTouchDoesNotUpload(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("content"), t0)
+	env.local.PutFile("b.txt", []byte("content"), t0)
+	e := env.engine(withVerifyLocal)
+	env.run(e)
+
+	// a.txt 只改了修改时间；b.txt 大小不变但内容变了
+	env.advance(time.Hour)
+	env.local.PutFile("a.txt", []byte("content"), env.now)
+	env.local.PutFile("b.txt", []byte("CONTENT"), env.now)
+	result := env.run(e)
+	if result.Succeeded[OpUpload] != 1 {
+		t.Fatalf("上传 %d 个，应只上传内容变化的 b.txt", result.Succeeded[OpUpload])
+	}
+	wantFile(t, env.remote, "b.txt", "CONTENT")
+	// 记录中的修改时间更新为新的值，之后不必再计算 Hash
+	if state := wantState(t, env.db, "a.txt", true); state.ModTime != env.now.UnixNano() {
+		t.Fatalf("记录的修改时间为 %d，应更新为 %d", state.ModTime, env.now.UnixNano())
+	}
+	env.wantIdle(e)
+}
+
+func TestTouchLocalFileDoesNotUpload(t *testing.T) {
+	env, root, opts := localEnv(t)
+	writeLocal(t, root, "a.txt", "content")
+	e := env.engine(opts, withVerifyLocal)
+	env.run(e)
+
+	// 本地目录的扫描结果不含 Hash，修改时间变化后读取一次文件确认内容未变
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "a.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if result := env.run(e); result.Succeeded[OpUpload] != 0 {
+		t.Fatalf("touch 之后上传了 %d 个文件", result.Succeeded[OpUpload])
+	}
+	info, err := os.Stat(filepath.Join(root, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := wantState(t, env.db, "a.txt", true); state.ModTime != info.ModTime().UnixNano() {
+		t.Fatalf("记录的修改时间为 %d，应更新为 %d", state.ModTime, info.ModTime().UnixNano())
+	}
+	env.wantIdle(e)
+}
@@ -0,0 +1,26 @@
+package sync
+
+import "baidusync/internal/fs"
+
+// oversized 任务涉及的文件是否超过 MaxFileSize (按明文大小判断)
+// 只限制会传输文件内容的上传、下载与冲突处理，删除等操作不受影响
+func (e *Engine) oversized(t *Task) bool {
+	limit := e.opts.MaxFileSize
+	if limit <= 0 {
+		return false
+	}
+	switch t.Op {
+	case OpUpload, OpDownload, OpConflict:
+	default:
+		return false
+	}
+	if t.Local != nil && !t.Local.IsDir && t.Local.Size > limit {
+		return true
+	}
+	return t.Remote != nil && !t.Remote.IsDir && e.plainSize(t.Remote) > limit
+}
+
+// plainSize 返回云端文件的明文大小 (去掉加密带来的额外开销)
+func (e *Engine) plainSize(r *fs.FileMeta) int64 {
+	return r.Size - e.opts.RemoteFS.StoredSize(0, e.encrypted())
+}
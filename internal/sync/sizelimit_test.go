@@ -0,0 +1,96 @@
+package sync
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withMaxFileSize(n int64) func(*EngineOptions) {
+	return func(o *EngineOptions) { o.MaxFileSize = n }
+}
+
+// oversizedPaths 返回计划中因超过大小限制而跳过的路径 (已排序)
+func oversizedPaths(t *testing.T, e *Engine) []string {
+	t.Helper()
+	plan, err := e.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, task := range plan.Oversized {
+		paths = append(paths, task.RelPath)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestMaxFileSizeBoundary(t *testing.T) {
+	const limit = 10
+	env := newTestEnv(t)
+	env.local.PutFile("up-equal.bin", []byte(strings.Repeat("u", limit)), t0)
+	env.local.PutFile("up-over.bin", []byte(strings.Repeat("u", limit+1)), t0)
+	env.remote.PutFile("down-equal.bin", []byte(strings.Repeat("d", limit)), t0)
+	env.remote.PutFile("down-over.bin", []byte(strings.Repeat("d", limit+1)), t0)
+	env.local.PutFile("empty.txt", nil, t0)
+	e := env.engine(withMaxFileSize(limit))
+
+	if got, want := oversizedPaths(t, e), []string{"down-over.bin", "up-over.bin"}; !slices.Equal(got, want) {
+		t.Fatalf("跳过 %v，应为 %v", got, want)
+	}
+	result := env.run(e)
+	if result.Succeeded[OpUpload] != 2 || result.Succeeded[OpDownload] != 1 {
+		t.Fatalf("上传 %d 个、下载 %d 个，应为 2 个与 1 个", result.Succeeded[OpUpload], result.Succeeded[OpDownload])
+	}
+	// 等于限制的文件照常同步，超过 1 字节的文件两个方向都跳过
+	wantFile(t, env.remote, "up-equal.bin", strings.Repeat("u", limit))
+	wantFile(t, env.local, "down-equal.bin", strings.Repeat("d", limit))
+	wantMissing(t, env.remote, "up-over.bin")
+	wantMissing(t, env.local, "down-over.bin")
+	wantState(t, env.db, "up-over.bin", false)
+	wantState(t, env.db, "down-over.bin", false)
+
+	// 超过限制的文件不会每轮重试，也不影响删除
+	env.local.Delete("up-equal.bin")
+	result = env.run(e)
+	if result.Succeeded[OpDeleteRemote] != 1 || result.Succeeded[OpUpload] != 0 {
+		t.Fatalf("删除 %d 个、上传 %d 个", result.Succeeded[OpDeleteRemote], result.Succeeded[OpUpload])
+	}
+}
+
+func TestMaxFileSizeUsesPlainSize(t *testing.T) {
+	const limit = 10
+	env := newTestEnv(t)
+	// 密文比明文多出头部等开销，按明文大小判断
+	env.remote.PutFile("equal.bin", encryptFor(t, strings.Repeat("e", limit), keyA), t0)
+	env.remote.PutFile("over.bin", encryptFor(t, strings.Repeat("e", limit+1), keyA), t0)
+	e := env.engine(withKey(keyA), withMaxFileSize(limit))
+
+	if got, want := oversizedPaths(t, e), []string{"over.bin"}; !slices.Equal(got, want) {
+		t.Fatalf("跳过 %v，应为 %v", got, want)
+	}
+	env.run(e)
+	wantFile(t, env.local, "equal.bin", strings.Repeat("e", limit))
+	wantMissing(t, env.local, "over.bin")
+}
+
+func TestMaxFileSizeSkipsOversizedConflict(t *testing.T) {
+	const limit = 10
+	env := newTestEnv(t)
+	env.local.PutFile("a.txt", []byte("v1"), t0)
+	e := env.engine(withMaxFileSize(limit))
+	env.run(e)
+
+	// 冲突中任意一侧超过限制时整个冲突都不处理
+	env.advance(time.Minute)
+	env.local.PutFile("a.txt", []byte("local"), env.now)
+	env.remote.PutFile("a.txt", []byte(strings.Repeat("r", limit+1)), env.now)
+	if got, want := oversizedPaths(t, e), []string{"a.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("跳过 %v，应为 %v", got, want)
+	}
+	env.run(e)
+	wantFile(t, env.local, "a.txt", "local")
+	wantMissing(t, env.local, "a.txt.local")
+}
@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// BaseFileTimeout 按大小计算单个任务超时时间时的基础时长 (覆盖建立连接、秒传、合并分片等固定开销)
+	BaseFileTimeout = 5 * time.Minute
+	// MinTransferRate 按大小计算超时时间时假定的最低传输速度 (字节/秒)
+	MinTransferRate = 64 << 10
+)
+
+var (
+	// ErrTaskTimeout 单个任务超过了 fileTimeout
+	ErrTaskTimeout = errors.New("任务超时")
+	// ErrCycleTimeout 一轮同步超过了 CycleTimeout，剩余任务已取消
+	ErrCycleTimeout = errors.New("本轮同步超时")
+)
+
+// fileTimeout 返回单个任务允许的最长时间
+// 配置了 FileTimeout 时直接使用；否则按 BaseFileTimeout + 数据量 / MinTransferRate 计算，
+// 保证大文件有足够的时间，同时卡住的小文件也能较快释放 Worker
+func (e *Engine) fileTimeout(t *Task) time.Duration {
+	if e.opts.FileTimeout > 0 {
+		return e.opts.FileTimeout
+	}
+	return BaseFileTimeout + time.Duration(t.Size()/MinTransferRate)*time.Second
+}
+
+// runTask 在单个任务的超时时间内执行任务，实际传输的字节数记录在 t.stats 中
+// 超时导致的失败包装为 ErrTaskTimeout，与真正的传输错误区分开
+func (e *Engine) runTask(ctx context.Context, log *slog.Logger, t *Task) error {
+	timeout := e.fileTimeout(t)
+	taskCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	t.stats = &transferStats{}
+	err := e.processTask(withTransferStats(taskCtx, t.stats), log, *t)
+	if err != nil && ctx.Err() == nil && errors.Is(taskCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w (%s): %w", ErrTaskTimeout, timeout, err)
+	}
+	return err
+}
+
+// logTaskError 记录任务失败，超时与其他错误分开记录，便于在日志中区分卡住的传输
+func logTaskError(log *slog.Logger, t Task, err error, args ...any) {
+	args = append(args, "path", t.RelPath, "op", t.Op, "err", err)
+	switch {
+	case errors.Is(err, ErrTaskTimeout):
+		log.Warn("任务超时，已取消", args...)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// 整轮同步超时或程序退出时被中断的任务
+		log.Warn("任务被中断", args...)
+	default:
+		log.Error("任务失败", args...)
+	}
+}
@@ -0,0 +1,34 @@
+package sync
+
+import (
+	"context"
+
+	"baidusync/internal/fs"
+)
+
+// transferStats 单个任务实际传输的字节数
+// 与云端之间按网络上传输的内容统计 (加密时为密文，含密文头部)，与本地之间按明文统计；
+// 冲突等任务可能同时有上传和下载
+type transferStats struct {
+	upWire    fs.Counter // 发往云端的字节数
+	upPlain   fs.Counter // 从本地读取的字节数
+	downWire  fs.Counter // 从云端读取的字节数
+	downPlain fs.Counter // 写入本地的字节数
+}
+
+// transferStatsKey context 中保存 *transferStats 的 Key
+type transferStatsKey struct{}
+
+// withTransferStats 把任务的传输统计放入 context，上传与下载时据此计数
+func withTransferStats(ctx context.Context, s *transferStats) context.Context {
+	return context.WithValue(ctx, transferStatsKey{}, s)
+}
+
+// transferStatsFrom 取出任务的传输统计；不在同步任务中执行 (例如 repair) 时返回一个不会被汇总的空统计
+func transferStatsFrom(ctx context.Context) *transferStats {
+	s, _ := ctx.Value(transferStatsKey{}).(*transferStats)
+	if s == nil {
+		return &transferStats{}
+	}
+	return s
+}
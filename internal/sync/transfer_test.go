@@ -0,0 +1,65 @@
+package sync
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"baidusync/internal/crypto"
+	"baidusync/internal/fs/memfs"
+)
+
+func TestTransferByteAccounting(t *testing.T) {
+	const size = 1000
+	env := newTestEnv(t)
+	env.local.PutFile("up.bin", []byte(strings.Repeat("u", size)), t0)
+	env.remote.PutFile("down.bin", encryptFor(t, strings.Repeat("d", size), keyA), t0)
+
+	var mu sync.Mutex
+	progress := make(map[string][2]int64)
+	e := env.engine(withKey(keyA), func(o *EngineOptions) {
+		o.Progress = func(path string, op OpType, done, total int64) {
+			mu.Lock()
+			progress[path] = [2]int64{done, total}
+			mu.Unlock()
+		}
+	})
+
+	result := env.run(e)
+	// 明文字节数按本地文件统计，线路字节数包含密文头部
+	if result.BytesUploaded != size || result.BytesDownloaded != size {
+		t.Fatalf("明文上传 %d、下载 %d 字节，应各为 %d", result.BytesUploaded, result.BytesDownloaded, size)
+	}
+	if want := int64(size + crypto.HeaderSize); result.WireBytesUploaded != want || result.WireBytesDownloaded != want {
+		t.Fatalf("线路上传 %d、下载 %d 字节，应各为 %d", result.WireBytesUploaded, result.WireBytesDownloaded, want)
+	}
+	// 下载进度按线路字节报告，最后一次报告传输完成 (上传进度由后端报告，memfs 不报告)
+	if p, want := progress["down.bin"], int64(size+crypto.HeaderSize); p[0] != want || p[1] != want {
+		t.Errorf("down.bin 最后的进度为 %d/%d，应为 %d/%d", p[0], p[1], want, want)
+	}
+}
+
+func TestTransferBytesOfFailedTask(t *testing.T) {
+	env := newTestEnv(t)
+	env.local.PutFile("ok.txt", []byte("12345"), t0)
+	env.local.PutFile("bad.txt", []byte("1234567890"), t0)
+	env.remote.InjectError(memfs.OpWrite, "bad.txt", errors.New("写入失败"))
+	e := env.engine()
+
+	result, err := env.runErr(e)
+	if err == nil {
+		t.Fatal("应返回 bad.txt 的错误")
+	}
+	// 失败的任务不计入明文字节数；memfs 在读取数据之前就返回错误，没有线路字节
+	if result.BytesUploaded != 5 || result.WireBytesUploaded != 5 {
+		t.Fatalf("明文 %d、线路 %d 字节，应各为 5", result.BytesUploaded, result.WireBytesUploaded)
+	}
+
+	env.remote.ClearErrors()
+	env.advance(time.Minute)
+	if result := env.run(e); result.BytesUploaded != 10 {
+		t.Fatalf("重试上传 %d 字节，应为 10", result.BytesUploaded)
+	}
+}
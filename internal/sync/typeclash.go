@@ -0,0 +1,113 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"baidusync/internal/fs"
+)
+
+// TypeClashPolicy 同一路径在一侧是文件、另一侧是目录时的处理方式
+type TypeClashPolicy int
+
+const (
+	// TypeClashSkip (默认)：不处理，每轮在日志与 status 中报告，等待用户手动解决
+	TypeClashSkip TypeClashPolicy = iota
+	// TypeClashRenameLocal：本地一侧按 ConflictName 模板改名，原路径采用云端的文件或目录
+	TypeClashRenameLocal
+	// TypeClashRenameRemote：云端一侧按 ConflictName 模板改名，原路径采用本地的文件或目录
+	TypeClashRenameRemote
+)
+
+// ParseTypeClashPolicy 解析配置中的 type_clash，未知值按 skip 处理
+func ParseTypeClashPolicy(s string) TypeClashPolicy {
+	switch s {
+	case "rename_local":
+		return TypeClashRenameLocal
+	case "rename_remote":
+		return TypeClashRenameRemote
+	default:
+		return TypeClashSkip
+	}
+}
+
+// String 返回配置中使用的名称 (用于日志)
+func (p TypeClashPolicy) String() string {
+	switch p {
+	case TypeClashRenameLocal:
+		return "rename_local"
+	case TypeClashRenameRemote:
+		return "rename_remote"
+	default:
+		return "skip"
+	}
+}
+
+// isTypeClash 同一路径两侧都存在，但一侧是文件、另一侧是目录
+func isTypeClash(l, r *fs.FileMeta) bool {
+	return l != nil && r != nil && l.IsDir != r.IsDir
+}
+
+// dropClashChildren 去掉类型冲突路径下级的任务
+// 一侧是文件时另一侧目录中的内容无处可放 (上传、下载都会失败)，等冲突解决后的下一轮再处理
+func (e *Engine) dropClashChildren(plan *Plan, clashes []string) {
+	if len(clashes) == 0 {
+		return
+	}
+	under := func(path string) bool {
+		key := e.canonical(path)
+		for _, dir := range clashes {
+			if key != dir && underAny(key, []string{dir}) {
+				return true
+			}
+		}
+		return false
+	}
+	kept := plan.Tasks[:0]
+	for _, t := range plan.Tasks {
+		if !under(t.RelPath) {
+			kept = append(kept, t)
+		}
+	}
+	plan.Tasks = kept
+}
+
+// resolveTypeClash 按 TypeClash 把一侧改名让出原路径，再把另一侧的文件 (或空目录) 同步过来
+// 只改名、不删除，两侧的内容都会保留；目录中的文件由下一轮同步处理
+func (e *Engine) resolveTypeClash(ctx context.Context, log *slog.Logger, t Task) error {
+	path := t.RelPath
+	side, fsys, keep := "local", e.opts.LocalFS, t.Remote
+	if e.opts.TypeClash == TypeClashRenameRemote {
+		side, fsys, keep = "remote", fs.FileSystem(e.opts.RemoteFS), t.Local
+	}
+	newName, err := e.freeConflictName(renderConflictName(e.opts.ConflictName, path, side, e.now()))
+	if err != nil {
+		return err
+	}
+	log.Info("文件与目录冲突: 改名让出原路径", "path", path, "side", side, "new", newName, "keep_dir", keep.IsDir)
+	if err := fsys.Rename(path, newName); err != nil {
+		return fmt.Errorf("rename %s failed: %w", side, err)
+	}
+	// 旧记录 (及目录下级的记录) 描述的是改名前的内容
+	if err := e.forgetPath(log, path); err != nil {
+		return err
+	}
+
+	switch {
+	case side == "local" && keep.IsDir:
+		if err := e.opts.LocalFS.Mkdir(path); err != nil {
+			return err
+		}
+		return e.recordDir(path, keep)
+	case side == "local":
+		return e.doDownload(ctx, log, path)
+	case keep.IsDir:
+		if err := e.opts.RemoteFS.Mkdir(path); err != nil {
+			return err
+		}
+		return e.recordDir(path, keep)
+	default:
+		return e.doUpload(ctx, log, path, fs.ExistFail)
+	}
+}
@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// clashTree 本地 x 是文件、云端 x 是目录；本地 y 是目录、云端 y 是文件
+func clashTree(env *testEnv) {
+	env.local.PutFile("x", []byte("local file x"), t0)
+	env.remote.PutFile("x/inner.txt", []byte("remote inner"), t0)
+	env.local.PutFile("y/inner.txt", []byte("local inner"), t0)
+	env.remote.PutFile("y", []byte("remote file y"), t0)
+	env.local.PutFile("ok.txt", []byte("ok"), t0)
+}
+
+func TestTypeClashSkipReports(t *testing.T) {
+	env := newTestEnv(t)
+	clashTree(env)
+	e := env.engine()
+
+	plan, err := e.Plan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var clashes []string
+	for _, task := range plan.TypeClashes {
+		clashes = append(clashes, task.RelPath)
+	}
+	slices.Sort(clashes)
+	if !slices.Equal(clashes, []string{"x", "y"}) {
+		t.Fatalf("类型冲突为 %v，应为 [x y]", clashes)
+	}
+	// 冲突路径及其下级都没有任务，其他文件照常同步
+	for _, task := range plan.Tasks {
+		if task.RelPath != "ok.txt" {
+			t.Errorf("不应有任务 %s %s", task.Op, task.RelPath)
+		}
+	}
+
+	env.run(e)
+	wantFile(t, env.local, "x", "local file x")
+	wantFile(t, env.remote, "y", "remote file y")
+	wantMissing(t, env.local, "x/inner.txt")
+	wantMissing(t, env.remote, "y/inner.txt")
+	wantFile(t, env.remote, "ok.txt", "ok")
+}
+
+func TestTypeClashRenameLocal(t *testing.T) {
+	env := newTestEnv(t)
+	clashTree(env)
+	e := env.engine(func(o *EngineOptions) { o.TypeClash = TypeClashRenameLocal })
+
+	// 第一轮改名让出路径，第二轮同步改名后的副本与目录中的文件
+	env.run(e)
+	env.run(e)
+	// 文件对目录: 本地文件改名，原路径采用云端的目录
+	wantFile(t, env.local, "x.local", "local file x")
+	wantFile(t, env.remote, "x.local", "local file x")
+	wantFile(t, env.local, "x/inner.txt", "remote inner")
+	// 目录对文件: 本地目录改名，原路径采用云端的文件
+	wantFile(t, env.local, "y.local/inner.txt", "local inner")
+	wantFile(t, env.remote, "y.local/inner.txt", "local inner")
+	wantFile(t, env.local, "y", "remote file y")
+	env.wantIdle(e)
+}
+
+func TestTypeClashRenameRemote(t *testing.T) {
+	env := newTestEnv(t)
+	clashTree(env)
+	e := env.engine(func(o *EngineOptions) { o.TypeClash = TypeClashRenameRemote })
+
+	env.run(e)
+	env.run(e)
+	wantFile(t, env.remote, "x.remote/inner.txt", "remote inner")
+	wantFile(t, env.local, "x.remote/inner.txt", "remote inner")
+	wantFile(t, env.remote, "x", "local file x")
+	wantFile(t, env.remote, "y.remote", "remote file y")
+	wantFile(t, env.local, "y.remote", "remote file y")
+	wantFile(t, env.remote, "y/inner.txt", "local inner")
+	env.wantIdle(e)
+}
@@ -1,5 +1,7 @@
 package sync
 
+import "baidusync/internal/fs"
+
 // OpType 定义同步操作类型
 type OpType int
 
@@ -10,11 +12,91 @@ const (
 	OpDeleteRemote               // 删除网盘文件
 	OpDeleteLocal                // 删除本地文件
 	OpConflict                   // 冲突 (通常重命名本地文件后下载)
+	OpMkdirRemote                // 在网盘创建目录 (本地新建的目录)
+	OpMkdirLocal                 // 在本地创建目录 (网盘新建的目录)
+	OpRmdirRemote                // 删除网盘的空目录
+	OpRmdirLocal                 // 删除本地的空目录
+	OpMoveRemote                 // 在网盘移动文件 (本地文件被移动或改名，见 detectMoves)
+	OpTypeClash                  // 同一路径一侧是文件、另一侧是目录 (按 TypeClash 改名其中一侧)
 )
 
+// IsDirOp 是否为目录操作 (创建/删除空目录)
+func (op OpType) IsDirOp() bool {
+	return op >= OpMkdirRemote && op <= OpRmdirLocal
+}
+
+// String 返回操作类型的可读名称 (用于日志与命令行输出)
+func (op OpType) String() string {
+	switch op {
+	case OpIgnore:
+		return "ignore"
+	case OpUpload:
+		return "upload"
+	case OpDownload:
+		return "download"
+	case OpDeleteRemote:
+		return "delete_remote"
+	case OpDeleteLocal:
+		return "delete_local"
+	case OpConflict:
+		return "conflict"
+	case OpMkdirRemote:
+		return "mkdir_remote"
+	case OpMkdirLocal:
+		return "mkdir_local"
+	case OpRmdirRemote:
+		return "rmdir_remote"
+	case OpRmdirLocal:
+		return "rmdir_local"
+	case OpMoveRemote:
+		return "move_remote"
+	case OpTypeClash:
+		return "type_clash"
+	default:
+		return "unknown"
+	}
+}
+
 // Task 代表一个具体的同步任务
 type Task struct {
 	Op      OpType
 	RelPath string // 相对路径
 	Reason  string // 触发原因 (用于日志)
+
+	// 扫描阶段得到的两侧元数据 (不存在时为 nil)
+	Local  *fs.FileMeta
+	Remote *fs.FileMeta
+
+	// From OpMoveRemote 的原路径 (Remote 为原路径的云端元数据)，其他任务为空
+	From string
+
+	// copyFrom 上传任务的候选复制来源 (本地 Hash -> 云端已有的路径)，见 markCopies
+	copyFrom map[string]string
+	// stats 执行时实际传输的字节数 (执行前为 nil)
+	stats *transferStats
+}
+
+// Size 返回任务涉及的数据量 (字节)
+// 上传/删除本地取本地大小，下载/删除云端取云端大小，冲突取两者中较大的一侧，目录操作为 0
+func (t *Task) Size() int64 {
+	if t.Op.IsDirOp() {
+		return 0
+	}
+	var local, remote int64
+	if t.Local != nil {
+		local = t.Local.Size
+	}
+	if t.Remote != nil {
+		remote = t.Remote.Size
+	}
+	switch t.Op {
+	case OpMoveRemote:
+		return 0 // 云端移动不传输数据
+	case OpUpload, OpDeleteLocal:
+		return local
+	case OpDownload, OpDeleteRemote:
+		return remote
+	default:
+		return max(local, remote)
+	}
 }
@@ -0,0 +1,173 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+)
+
+// DriftSide 校验不一致发生在哪一侧
+type DriftSide string
+
+const (
+	DriftLocal  DriftSide = "local"
+	DriftRemote DriftSide = "remote"
+)
+
+// Drift 一条与数据库基准不一致的记录
+type Drift struct {
+	RelPath string    `json:"path"`
+	Side    DriftSide `json:"side"`
+	// Expected 数据库中记录的 Hash；Actual 实际的 Hash (文件不存在时为空)
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Missing  bool   `json:"missing"`
+	// Err 读取文件失败时的错误信息
+	Err string `json:"error,omitempty"`
+}
+
+// VerifyResult 一次完整性校验的结果
+type VerifyResult struct {
+	Checked int     `json:"checked"`
+	Drifts  []Drift `json:"drifts"`
+}
+
+// Count 统计某一侧不一致的记录数
+func (r *VerifyResult) Count(side DriftSide) int {
+	n := 0
+	for _, d := range r.Drifts {
+		if d.Side == side {
+			n++
+		}
+	}
+	return n
+}
+
+// Verify 逐条校验数据库中的快照是否与两侧实际文件一致，只报告不修复
+// 云端 Hash 取自一次完整的云端扫描 (与上传时记录的 RemoteHash 同源)；
+// 本地文件则按 hash_algorithm 重新计算 Hash 与 LocalHash 比对，按 MaxWorkers 并发执行。
+// 整个过程不写数据库，也不修改任何文件。
+func (e *Engine) Verify(ctx context.Context) (*VerifyResult, error) {
+	runID := RunIDFromContext(ctx)
+	if runID == "" {
+		runID = NewRunID()
+	}
+	log := e.opts.Logger.With("run_id", runID)
+
+	remoteMap, err := fs.ListAll(ctx, e.opts.RemoteFS)
+	if err != nil {
+		return nil, fmt.Errorf("scan remote failed: %w", err)
+	}
+	if e.normalizing() {
+		// 数据库中的 Key 是规范形式，云端按同样的规则查表 (碰撞的路径留给同步时报告)
+		remoteMap = e.canonicalMap(remoteMap, "remote", make(map[string][]string))
+	}
+
+	var (
+		mu     sync.Mutex
+		result = &VerifyResult{}
+		wg     sync.WaitGroup
+	)
+	report := func(d Drift) {
+		mu.Lock()
+		defer mu.Unlock()
+		result.Drifts = append(result.Drifts, d)
+	}
+
+	// 数据库记录流式分发给 Worker，避免整体加载到内存
+	recChan := make(chan *database.FileState)
+	workers := e.maxWorkers()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range recChan {
+				if d, ok := e.verifyLocal(ctx, b); !ok {
+					report(d)
+				}
+			}
+		}()
+	}
+
+	err = e.opts.StateDB.ForEach(func(b *database.FileState) error {
+		if b.IsDir || e.excluded(b.RelPath) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		result.Checked++
+
+		r := remoteMap[b.RelPath]
+		if r != nil && r.RelPath != b.RelPath {
+			// 规范化后的 Key 与实际路径不同，按云端的实际路径报告与修复
+			rec := *b
+			rec.RelPath = r.RelPath
+			b = &rec
+		}
+
+		// 云端只需查表，直接在当前 goroutine 中完成
+		if d, ok := e.verifyRemote(b, r); !ok {
+			report(d)
+		}
+
+		select {
+		case recChan <- b:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(recChan)
+	wg.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("verify failed: %w", err)
+	}
+
+	sort.Slice(result.Drifts, func(i, j int) bool {
+		a, b := result.Drifts[i], result.Drifts[j]
+		if a.RelPath != b.RelPath {
+			return a.RelPath < b.RelPath
+		}
+		return a.Side < b.Side
+	})
+
+	log.Info("完整性校验完成",
+		"checked", result.Checked,
+		"local_drift", result.Count(DriftLocal),
+		"remote_drift", result.Count(DriftRemote),
+	)
+	return result, nil
+}
+
+// verifyRemote 比对云端文件与数据库基准，一致时返回 ok=true
+func (e *Engine) verifyRemote(b *database.FileState, r *fs.FileMeta) (Drift, bool) {
+	d := Drift{RelPath: b.RelPath, Side: DriftRemote, Expected: b.RemoteHash}
+	if r == nil {
+		d.Missing = true
+		return d, false
+	}
+	d.Actual = r.RemoteHash
+	return d, e.isRemoteSameAsBase(r, b)
+}
+
+// verifyLocal 重新计算本地文件的 Hash 并与数据库基准比对，一致时返回 ok=true
+func (e *Engine) verifyLocal(ctx context.Context, b *database.FileState) (Drift, bool) {
+	d := Drift{RelPath: b.RelPath, Side: DriftLocal, Expected: b.LocalHash}
+	l, err := fs.Stat(ctx, e.opts.LocalFS, b.RelPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			d.Missing = true
+		} else {
+			d.Err = err.Error()
+		}
+		return d, false
+	}
+	d.Actual = l.Hash
+	return d, isLocalSameAsBase(l, b)
+}
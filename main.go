@@ -2,144 +2,245 @@ package main
 
 import (
 	"baidusync/internal/config"
-	"baidusync/internal/database"
-	"baidusync/internal/fs/baidu"
-	"baidusync/internal/fs/local"
-	syncer "baidusync/internal/sync"
+	"baidusync/pkg/baidusync"
 	"baidusync/pkg/logger"
 	"context"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
-	"sync"
-	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 func main() {
+	configPath := flag.String("config", "config/config.yaml", "配置文件路径")
+	flag.Usage = usage
+	flag.Parse()
 
 	// 1. 加载配置
-	configPath := "config/config.yaml"
-	cfg, err := config.LoadConfig(configPath)
+	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		panic("配置加载失败: " + err.Error())
 	}
 
-	// 2. 【关键】初始化日志系统
-	if err := logger.Setup(cfg.System.LogLevel, cfg.System.LogFile); err != nil {
+	// 2. 解析子命令
+	args := flag.Args()
+	cmd := "run"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	// 3. 【关键】初始化日志系统
+	// 子命令的结果输出到 stdout，日志改为输出到 stderr，避免混在一起 (例如 --json)
+	var console io.Writer = os.Stdout
+	if cmd != "run" {
+		console = os.Stderr
+	}
+	err = logger.Setup(logger.Options{
+		Level:      cfg.System.LogLevel,
+		Format:     cfg.System.LogFormat,
+		File:       cfg.System.LogFile,
+		MaxSizeMB:  cfg.System.LogMaxSizeMB,
+		MaxBackups: cfg.System.LogMaxBackups,
+		MaxAgeDays: cfg.System.LogMaxAgeDays,
+		Console:    console,
+	})
+	if err != nil {
 		panic("日志初始化失败: " + err.Error())
 	}
 
-	// 3. 开始使用
+	// 4. 分发子命令
+	switch cmd {
+	case "run":
+		runDaemon(*configPath, cfg)
+	case "sync":
+		if err := cmdSync(cfg, args); err != nil {
+			slog.Error("同步失败", "err", err)
+			os.Exit(1)
+		}
+	case "status":
+		if err := cmdStatus(cfg, args); err != nil {
+			slog.Error("查看同步状态失败", "err", err)
+			os.Exit(1)
+		}
+	case "verify":
+		if err := cmdVerify(cfg, args); err != nil {
+			slog.Error("完整性校验未通过", "err", err)
+			os.Exit(1)
+		}
+	case "repair":
+		if err := cmdRepair(cfg, args); err != nil {
+			slog.Error("修复失败", "err", err)
+			os.Exit(1)
+		}
+	case "share":
+		if err := cmdShare(cfg, args); err != nil {
+			slog.Error("分享失败", "err", err)
+			os.Exit(1)
+		}
+	case "find":
+		if err := cmdFind(cfg, args); err != nil {
+			slog.Error("查找失败", "err", err)
+			os.Exit(1)
+		}
+	case "conflicts":
+		if err := cmdConflicts(cfg, args); err != nil {
+			slog.Error("读取冲突历史失败", "err", err)
+			os.Exit(1)
+		}
+	case "recycle":
+		if err := cmdRecycle(cfg, args); err != nil {
+			slog.Error("回收站操作失败", "err", err)
+			os.Exit(1)
+		}
+	case "rekey":
+		if err := cmdRekey(cfg, args); err != nil {
+			slog.Error("更换密钥失败", "err", err)
+			os.Exit(1)
+		}
+	case "crypto-selftest":
+		if err := cmdCryptoSelfTest(cfg, args); err != nil {
+			slog.Error("加密自检未通过", "err", err)
+			os.Exit(1)
+		}
+	case "restore-db":
+		if err := cmdRestoreDB(cfg, args); err != nil {
+			slog.Error("恢复数据库失败", "err", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+}
+
+// usage 打印命令行帮助
+func usage() {
+	fmt.Fprintf(os.Stderr, `用法: baidusync [选项] [命令] [参数]
+
+命令:
+  run                    启动同步守护进程 (默认)
+  sync [-interactive] [-profile 名称] [-subpath 相对路径] [-rescan]
+                         立即同步一轮后退出；-interactive 时在终端中询问冲突的处理方式，-subpath 时只同步该目录；
+                         -rescan 时忽略同步记录，按两侧的实际内容重新比对并重建记录 (怀疑数据库损坏时的恢复手段)
+  status [--json] [-profile 名称]
+                         扫描两侧与数据库，列出待同步的差异 (不做任何修改)
+  verify [--json] [-profile 名称]
+                         校验数据库基准与两侧文件的 Hash 是否一致 (只报告，不修复)
+  repair -source local|remote [-profile 名称] [路径...]
+                         按指定基准重新上传/下载不一致的文件 (不指定路径时先执行 verify)
+  share [-profile 名称] [-password 提取码] [-expire 有效期] <路径>
+                         为已同步的文件创建百度网盘分享链接
+  find [--json] [-profile 名称] [-records] <关键字>
+                         按文件名查找同步目录中的文件 (开启文件名加密时搜索本地的同步记录)
+  conflicts [--json] [-profile 名称] [-n 条数] [路径]
+                         列出最近处理过的冲突 (时间、策略、保留的版本、两侧大小)，排查反复冲突的文件
+  recycle list [--json] [-profile 名称]
+                         列出网盘回收站中属于同步目录的文件
+  recycle restore [-profile 名称] <fs_id|路径>...
+                         将回收站中的文件还原到原来的位置
+  rekey [-profile 名称] [-old-password 旧密码]
+                         把云端文件从旧密码改为用配置中的新密码加密 (可中断后重新执行)
+  crypto-selftest [-profile 名称]
+                         用配置中的密钥对随机数据与示例文件名做一遍加密、解密，确认结果一致 (不访问网盘)
+  restore-db [备份|latest] 列出数据库备份，或用指定备份恢复状态数据库
+
+选项:
+`)
+	flag.PrintDefaults()
+}
+
+// runDaemon 启动定时同步，直到收到退出信号
+// configPath 用于收到 SIGHUP 时重新加载配置
+func runDaemon(configPath string, cfg *config.Config) {
 	slog.Info("BaiduSync 启动中",
 		"version", "1.0.0",
 		"log_level", cfg.System.LogLevel,
 		"log_file", cfg.System.LogFile,
 	)
-	slog.Info("配置已加载",
-		"local_dir", cfg.Sync.LocalDir,
-		"remote_dir", cfg.Sync.RemoteDir,
-		"interval", cfg.Sync.Interval,
-	)
-	// 3. 初始化数据库
-	db, err := database.NewBoltDB(cfg.System.DBPath)
+	app, err := baidusync.New(cfg)
 	if err != nil {
-		slog.Error("无法打开数据库", "err", err, "path", cfg.System.DBPath)
-		panic("数据库初始化失败: " + err.Error())
-	}
-	defer db.Close()
-
-	// 4. 初始化文件适配器
-	localFS := local.NewAdapter(cfg.Sync.LocalDir)
-
-	// 初始化百度客户端 (传入更多认证信息)
-	baiduClient := baidu.NewClient(&baidu.Options{
-		AppKey:       cfg.Baidu.AppKey,
-		SecretKey:    cfg.Baidu.SecretKey,
-		AccessToken:  cfg.Baidu.AccessToken,
-		RefreshToken: cfg.Baidu.RefreshToken,
-		UserAgent:    cfg.Baidu.UserAgent,
-	})
-
-	// 5. 准备加密密钥
-	var aesKey []byte
-	if cfg.Crypto.Enable {
-		aesKey = cfg.Crypto.GetAESKey() // 自动将密码转为32字节Key
-		slog.Info("加密模式: 已启用 (AES-256)", "encrypt_filenames", cfg.Crypto.EncryptFilenames)
-	} else {
-		slog.Info("加密模式: 未启用 (文件将原样上传)")
+		slog.Error("初始化失败", "err", err)
+		panic("初始化失败: " + err.Error())
 	}
+	defer app.Close()
 
-	// 传递加密参数到 Baidu Adapter
-	baiduFS := baidu.NewAdapter(baiduClient, cfg.Sync.RemoteDir, aesKey, cfg.Crypto.EncryptFilenames)
-
-	// 6. 初始化同步引擎
-	engine := syncer.NewEngine(&syncer.EngineOptions{
-		LocalFS:          localFS,
-		RemoteFS:         baiduFS,
-		StateDB:          db,
-		EncryptKey:       aesKey,
-		EncryptFilenames: cfg.Crypto.EncryptFilenames,
-		MaxWorkers:       cfg.Sync.MaxConcurrent,
-		ConflictStrategy: syncer.ParseConflictStrategy(cfg.Sync.ConflictStrategy),
-	})
-
-	// 7. 设置优雅退出
+	// 第一次收到信号时调用 app.Stop，不再开始新的任务；
+	// 等待超时或再次收到信号时 cancel，中断正在传输的文件
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// 启动前检查认证与两侧目录，有问题时直接退出，而不是让每个任务都失败
+	if err := app.Start(ctx); err != nil {
+		slog.Error("无法启动", "err", err)
+		os.Exit(1)
+	}
 
-	var wg sync.WaitGroup
-	var isSyncing atomic.Bool
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	runSync := func(appCtx context.Context) {
-		if !isSyncing.CompareAndSwap(false, true) {
-			slog.Info("上一轮同步尚未结束，跳过本次触发")
-			return
+	for sig := range sigChan {
+		if sig == syscall.SIGHUP {
+			// 热加载配置，不中断正在进行的同步，也不关闭数据库
+			reloadConfig(configPath, app)
+			continue
 		}
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			defer isSyncing.Store(false)
-
-			slog.Info(">>> 开始同步")
-			if err := engine.Run(appCtx); err != nil {
-				// 区分是外部取消还是真正的同步错误
-				if appCtx.Err() != nil {
-					slog.Warn("同步被中断")
-				} else {
-					slog.Error("同步错误", "error", err)
-				}
-			}
-			slog.Info("<<< 同步结束")
-		}()
+		slog.Info("接收到信号，准备优雅退出: 不再开始新的任务，等待正在传输的文件完成 (再次发送信号立即退出)",
+			"signal", sig, "timeout", cfg.System.ShutdownTimeoutDuration)
+		waitShutdown(app, sigChan, cancel, cfg.System.ShutdownTimeoutDuration)
+		return
 	}
+}
+
+// reloadConfig 重新读取配置文件，并把可以热更新的字段应用到正在运行的 Profile
+// 新配置解析或校验失败时保留旧配置继续运行
+func reloadConfig(path string, app *baidusync.App) {
+	slog.Info("收到 SIGHUP，重新加载配置", "path", path)
 
-	// 立即运行一次
-	runSync(ctx)
+	next, err := config.LoadConfig(path)
+	if err != nil {
+		slog.Error("新配置无效，继续使用旧配置", "err", err)
+		return
+	}
+	app.Reload(next)
+}
 
-	// 主循环
-	ticker := time.NewTicker(cfg.Sync.IntervalDuration)
-	defer ticker.Stop()
+// waitShutdown 等待所有 Profile 的同步任务结束
+// 超过 timeout (0 表示不限制) 或再次收到退出信号时调用 cancel，中断正在传输的文件后继续等待
+func waitShutdown(app *baidusync.App, sigChan <-chan os.Signal, cancel context.CancelFunc, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		app.Stop()
+		close(done)
+	}()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
 
 	for {
 		select {
-		case <-ticker.C:
-			runSync(ctx)
-		case sig := <-sigChan:
-			slog.Info("接收到信号，准备优雅退出...", "signal", sig)
-			cancel()    // 通知所有 goroutine 退出
-			wg.Wait()   // 等待所有同步任务完成
+		case <-done:
 			slog.Info("所有任务已完成，程序退出")
 			return
-		case <-ctx.Done():
-			// 如果是其他原因导致 ctx a被取消
-			slog.Info("主上下文被取消，程序退出")
-			return
+		case sig := <-sigChan:
+			if sig == syscall.SIGHUP {
+				continue
+			}
+			slog.Warn("再次接收到信号，中断正在传输的文件", "signal", sig)
+		case <-deadline:
+			slog.Warn("等待正在传输的文件超时，强制中断", "timeout", timeout)
 		}
+		cancel()
+		<-done
+		slog.Info("同步已强制中断，未完成的文件将在下次启动后重新传输，程序退出")
+		return
 	}
 }
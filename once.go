@@ -0,0 +1,123 @@
+package main
+
+import (
+	"baidusync/internal/config"
+	syncer "baidusync/internal/sync"
+	"baidusync/pkg/baidusync"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+)
+
+// cmdSync 立即执行一轮同步后退出 (不进入定时循环)
+// 加上 -interactive 且在终端中运行时，遇到冲突会提示用户选择保留哪一侧；
+// 守护进程 (run) 从不提示，始终使用配置中的冲突策略
+func cmdSync(cfg *config.Config, args []string) error {
+	fset := flag.NewFlagSet("sync", flag.ExitOnError)
+	only := fset.String("profile", "", "只同步指定的 Profile")
+	interactive := fset.Bool("interactive", false, "遇到冲突时在终端中询问处理方式")
+	timeout := fset.Duration("conflict-timeout", syncer.DefaultConflictTimeout, "等待冲突选择的最长时间，超时后使用配置的策略")
+	subpath := fset.String("subpath", "", "只同步该相对路径下的内容 (代替配置中的 subpath)")
+	rescan := fset.Bool("rescan", false, "忽略同步记录，按两侧的实际内容重新比对并重建记录 (恢复用)")
+	fset.Parse(args)
+
+	if *subpath != "" {
+		// 范围是相对于某个 Profile 的路径，避免误用到其他 Profile 的同名目录
+		if *only == "" && len(cfg.Profiles) > 1 {
+			return fmt.Errorf("配置了多个 Profile，指定 -subpath 时必须同时指定 -profile")
+		}
+		scope, err := config.CleanSubpath(*subpath)
+		if err != nil {
+			return fmt.Errorf("无效的 -subpath: %w", err)
+		}
+		for i := range cfg.Profiles {
+			cfg.Profiles[i].Subpath = scope
+		}
+	}
+
+	app, err := baidusync.NewWithOptions(cfg, baidusync.Options{Profile: *only})
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	if err := app.Lock(); err != nil {
+		return err
+	}
+
+	if err := app.Preflight(context.Background()); err != nil {
+		return err
+	}
+
+	if *interactive {
+		if isTerminal(os.Stdin) {
+			prompt := newConflictPrompt(os.Stdin, os.Stderr)
+			for _, r := range app.Profiles() {
+				r.Engine().SetConflictResolver(prompt.Resolve, *timeout)
+			}
+		} else {
+			slog.Warn("标准输入不是终端，忽略 -interactive，冲突将按配置的策略处理")
+		}
+	}
+
+	// 第一次 Ctrl+C 时不再开始新的任务，正在进行的任务完成后退出；再按一次则立即中断
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx, stop := syncer.WithGracefulStop(ctx)
+	if *rescan {
+		slog.Warn("重新扫描: 忽略现有的同步记录，两侧同名文件将按内容比对，可能需要下载云端文件计算 Hash")
+		ctx = syncer.WithRescan(ctx)
+	}
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	go func() {
+		<-sigChan
+		slog.Info("接收到信号，等待正在传输的文件完成后退出 (再次按 Ctrl+C 立即退出)")
+		stop()
+		<-sigChan
+		slog.Warn("再次接收到信号，中断正在传输的文件")
+		cancel()
+	}()
+
+	var errs []error
+	for _, r := range app.Profiles() {
+		if _, err := r.RunOnce(ctx); err != nil {
+			printFailures(os.Stderr, r.Name(), err)
+			errs = append(errs, fmt.Errorf("profile %s: %w", r.Name(), err))
+		}
+		if ctx.Err() != nil || syncer.StopRequested(ctx) {
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d 个 Profile 同步失败: %v", len(errs), errs)
+	}
+	if ctx.Err() == nil && syncer.StopRequested(ctx) {
+		// 剩余的 Profile 没有同步
+		return syncer.ErrStopped
+	}
+	return ctx.Err()
+}
+
+// printFailures 以表格形式列出本轮失败的任务 (err 不是 SyncError 时不输出)
+func printFailures(w io.Writer, profile string, err error) {
+	var syncErr *syncer.SyncError
+	if !errors.As(err, &syncErr) {
+		return
+	}
+	fmt.Fprintf(w, "[%s] %d 个任务失败:\n", profile, len(syncErr.Errors))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  操作\t路径\t原因")
+	for _, pe := range syncErr.Errors {
+		fmt.Fprintf(tw, "  %s\t%s\t%v\n", pe.Op, pe.RelPath, pe.Err)
+	}
+	tw.Flush()
+}
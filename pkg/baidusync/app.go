@@ -0,0 +1,211 @@
+package baidusync
+
+import (
+	"baidusync/internal/config"
+	"baidusync/internal/database"
+	"baidusync/internal/metrics"
+	syncer "baidusync/internal/sync"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// 内部包中的类型在这里导出别名，嵌入的程序不能直接导入 internal 下的包
+type (
+	// Config 完整的配置 (见 LoadConfig)
+	Config = config.Config
+	// ProfileConfig 单个 Profile 的配置
+	ProfileConfig = config.ProfileConfig
+	// Engine 单个 Profile 的同步引擎
+	Engine = syncer.Engine
+	// RunResult 一轮同步的结果
+	RunResult = syncer.RunResult
+)
+
+// LoadConfig 读取并校验配置文件
+func LoadConfig(path string) (*Config, error) {
+	return config.LoadConfig(path)
+}
+
+// Options App 的可选参数
+type Options struct {
+	// Profile 不为空时只初始化同名的 Profile (默认初始化配置中的全部 Profile)
+	Profile string
+}
+
+// App 按配置组装好的同步程序: 状态数据库、百度网盘客户端，以及每个 Profile 的适配器与同步引擎
+// 守护进程与各个子命令都通过它初始化，其他程序也可以直接嵌入:
+// Start 按配置的时间安排定时同步，RunOnce 立即同步一轮，用完后调用 Close
+type App struct {
+	cfg      *Config
+	db       *database.DB
+	profiles []*Profile
+
+	mu sync.Mutex
+	// release 释放本地目录锁 (未加锁时为空)
+	release func()
+	// prepared 已通过预检 (只需要检查一次)
+	prepared bool
+	// stop 请求 Start 启动的调度循环优雅退出 (未启动时为空)
+	stop context.CancelFunc
+	// wg 跟踪调度循环及其正在执行的同步任务
+	wg sync.WaitGroup
+	// stopMetrics 关闭指标服务 (未开启时为空)
+	stopMetrics func()
+	closed      bool
+}
+
+// New 按配置初始化全部 Profile
+func New(cfg *Config) (*App, error) {
+	return NewWithOptions(cfg, Options{})
+}
+
+// NewWithOptions 按配置与 opts 初始化 App
+// 只打开数据库并创建适配器与引擎，不访问网络，也不锁定本地目录
+func NewWithOptions(cfg *Config, opts Options) (*App, error) {
+	db, profiles, err := openProfiles(cfg, opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+	return &App{cfg: cfg, db: db, profiles: profiles}, nil
+}
+
+// Profiles 返回已初始化的 Profile (按配置中的顺序)
+func (a *App) Profiles() []*Profile {
+	return a.profiles
+}
+
+// DB 返回所有 Profile 共享的状态数据库 (由 Close 关闭)
+func (a *App) DB() *database.DB {
+	return a.db
+}
+
+// Lock 锁定各个 Profile 的本地目录，防止另一个实例同时修改同一个目录 (已加锁时什么也不做)
+// 只读取的子命令 (status、verify 等) 不需要加锁；锁由 Close 释放
+func (a *App) Lock() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.release != nil {
+		return nil
+	}
+	release, err := lockLocalDirs(a.profiles)
+	if err != nil {
+		return err
+	}
+	a.release = release
+	return nil
+}
+
+// Preflight 检查认证与两侧目录，有问题时返回错误，而不是让每个任务都失败 (已通过时不再检查)
+func (a *App) Preflight(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.prepared {
+		return nil
+	}
+	if err := preflight(ctx, a.profiles); err != nil {
+		return err
+	}
+	a.prepared = true
+	return nil
+}
+
+// prepare 同步之前锁定本地目录并完成预检
+func (a *App) prepare(ctx context.Context) error {
+	if err := a.Lock(); err != nil {
+		return err
+	}
+	if err := a.Preflight(ctx); err != nil {
+		return fmt.Errorf("预检失败: %w", err)
+	}
+	return nil
+}
+
+// Start 锁定本地目录、完成预检后，在后台按各个 Profile 的时间安排定时同步，立即返回
+// 配置了 system.metrics_addr 时同时启动指标服务
+// 调用 Stop 优雅退出；取消 ctx 会中断正在传输的文件
+func (a *App) Start(ctx context.Context) error {
+	if err := a.prepare(ctx); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return errors.New("已经关闭")
+	}
+	if a.stop != nil {
+		return errors.New("已经启动")
+	}
+
+	// 可选的指标服务，每轮同步结束后由各 Profile 累加统计结果
+	if a.cfg.System.MetricsAddr != "" {
+		reg := metrics.NewRegistry()
+		for _, r := range a.profiles {
+			r.metrics = reg
+		}
+		a.stopMetrics = startMetricsServer(a.cfg.System.MetricsAddr, reg)
+	}
+
+	ctx, a.stop = syncer.WithGracefulStop(ctx)
+	for _, runner := range a.profiles {
+		a.wg.Add(1)
+		go func(r *Profile) {
+			defer a.wg.Done()
+			r.loop(ctx, &a.wg)
+		}(runner)
+	}
+	return nil
+}
+
+// Stop 不再开始新的同步与任务，等待正在传输的文件完成后返回 (未启动时立即返回)
+// 等待的时长不受限制，需要中断时取消传给 Start 的 ctx
+func (a *App) Stop() {
+	a.mu.Lock()
+	stop := a.stop
+	a.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	stop()
+	a.wg.Wait()
+}
+
+// RunOnce 锁定本地目录、完成预检后依次把每个 Profile 同步一轮
+// 任一 Profile 失败时继续同步其余的 Profile，最后汇总返回；ctx 被取消时不再同步剩余的 Profile
+func (a *App) RunOnce(ctx context.Context) error {
+	if err := a.prepare(ctx); err != nil {
+		return err
+	}
+	var errs []error
+	for _, r := range a.profiles {
+		if _, err := r.RunOnce(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", r.name, err))
+		}
+		if ctx.Err() != nil || syncer.StopRequested(ctx) {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close 停止调度循环 (见 Stop)，关闭各个 Profile 的文件系统与指标服务，释放目录锁并关闭数据库
+func (a *App) Close() error {
+	a.Stop()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	if a.stopMetrics != nil {
+		a.stopMetrics()
+	}
+	closeProfiles(a.profiles)
+	if a.release != nil {
+		a.release()
+	}
+	return a.db.Close()
+}
@@ -0,0 +1,27 @@
+// Package baidusync 把百度网盘同步嵌入到其他 Go 程序中
+//
+// 命令行程序的守护进程与各个子命令都通过这里初始化，嵌入时的用法与之相同:
+//
+//	cfg, err := baidusync.LoadConfig("config/config.yaml")
+//	if err != nil {
+//		return err
+//	}
+//	app, err := baidusync.New(cfg)
+//	if err != nil {
+//		return err
+//	}
+//	defer app.Close()
+//
+//	// 立即同步一轮
+//	if err := app.RunOnce(ctx); err != nil {
+//		return err
+//	}
+//
+//	// 或者在后台按配置的时间安排定时同步，直到调用 Stop
+//	if err := app.Start(ctx); err != nil {
+//		return err
+//	}
+//	defer app.Stop()
+//
+// 日志通过 slog.Default() 输出，需要时由调用方事先设置
+package baidusync
@@ -0,0 +1,69 @@
+package baidusync_test
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"baidusync/pkg/baidusync"
+)
+
+// 把本地目录同步到另一个目录 (remote.type: local)，不需要百度网盘账号即可运行
+func ExampleApp_RunOnce() {
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+
+	dir, err := os.MkdirTemp("", "baidusync-example")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "local")
+	remote := filepath.Join(dir, "remote")
+	os.MkdirAll(filepath.Join(local, "docs"), 0755)
+	os.MkdirAll(remote, 0755)
+	os.WriteFile(filepath.Join(local, "docs", "readme.txt"), []byte("hello"), 0644)
+
+	configPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(configPath, fmt.Appendf(nil, `
+remote:
+  type: local
+sync:
+  local_dir: %q
+  remote_dir: %q
+  interval: 1h
+  max_concurrent: 2
+system:
+  db_path: %q
+  temp_dir: %q
+`, local, remote, filepath.Join(dir, "state.db"), filepath.Join(dir, "tmp")), 0644)
+
+	cfg, err := baidusync.LoadConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app, err := baidusync.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	if err := app.RunOnce(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	filepath.WalkDir(remote, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(remote, path)
+			data, _ := os.ReadFile(path)
+			fmt.Printf("%s: %s\n", filepath.ToSlash(rel), data)
+		}
+		return err
+	})
+	// Output:
+	// docs/readme.txt: hello
+}
@@ -0,0 +1,41 @@
+package baidusync
+
+import (
+	"baidusync/internal/metrics"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// metricsShutdownTimeout 退出时等待指标请求处理完毕的最长时间
+const metricsShutdownTimeout = 5 * time.Second
+
+// startMetricsServer 在 addr 上提供 /metrics (Prometheus 文本格式)
+// 返回的函数用于在退出时关闭服务
+func startMetricsServer(addr string, reg *metrics.Registry) (shutdown func()) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", reg)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		slog.Info("指标服务已启动", "addr", addr, "path", "/metrics")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			// 指标服务是可选的，启动失败不影响同步
+			slog.Error("指标服务异常退出", "addr", addr, "err", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Warn("关闭指标服务失败", "err", err)
+		}
+	}
+}
@@ -0,0 +1,523 @@
+package baidusync
+
+import (
+	"baidusync/internal/config"
+	"baidusync/internal/database"
+	"baidusync/internal/fs"
+	"baidusync/internal/fs/baidu"
+	"baidusync/internal/fs/folder"
+	"baidusync/internal/fs/local"
+	"baidusync/internal/fs/webdav"
+	"baidusync/internal/metrics"
+	syncer "baidusync/internal/sync"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Profile 负责单个 Profile 的同步
+// 每个 Profile 拥有独立的适配器、同步引擎和定时器
+type Profile struct {
+	name      string
+	engine    *syncer.Engine
+	local     fs.FileSystem
+	remote    fs.RemoteProvider
+	client    *baidu.Client // 所有 Profile 共享 (rekey 用它创建按旧密钥解析文件名的后端)
+	schedule  syncSchedule
+	log       *slog.Logger
+	isSyncing atomic.Bool
+
+	// profile 当前生效的配置 (热加载时用于比对哪些字段发生了变化)
+	profile config.ProfileConfig
+	// scheduleCh 热加载时通知调度循环按新的时间安排重置定时器
+	scheduleCh chan syncSchedule
+	// metrics 开启指标服务时累加每轮同步的结果 (可为空)
+	metrics *metrics.Registry
+}
+
+// openProfiles 打开数据库、创建百度客户端并初始化 Profile
+// only 不为空时只初始化同名 Profile。调用方负责关闭返回的数据库。
+func openProfiles(cfg *config.Config, only string) (*database.DB, []*Profile, error) {
+	// 初始化数据库 (所有 Profile 共享，按 Profile 分 Bucket 存放快照)
+	db, err := database.NewBoltDB(cfg.System.DBPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("无法打开数据库 %s: %w", cfg.System.DBPath, err)
+	}
+
+	// 初始化百度客户端 (所有 Profile 共享，传入更多认证信息)
+	client := baidu.NewClient(&baidu.Options{
+		AppKey:                cfg.Baidu.AppKey,
+		SecretKey:             cfg.Baidu.SecretKey,
+		AccessToken:           cfg.Baidu.AccessToken,
+		RefreshToken:          cfg.Baidu.RefreshToken,
+		UserAgent:             cfg.Baidu.UserAgent,
+		UserAgents:            cfg.Baidu.UserAgents,
+		MetadataTimeout:       cfg.Baidu.MetadataTimeoutDuration,
+		StreamUploadThreshold: cfg.Baidu.StreamUploadThresholdBytes,
+		ListWorkers:           cfg.Baidu.ListWorkers,
+		CopyBuffer:            cfg.System.CopyBufferBytes,
+	})
+
+	// 为每个 Profile 初始化适配器与同步引擎
+	runners := make([]*Profile, 0, len(cfg.Profiles))
+	for i := range cfg.Profiles {
+		p := &cfg.Profiles[i]
+		if only != "" && p.Name != only {
+			continue
+		}
+		runner, err := newProfile(cfg, p, db, client)
+		if err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("初始化 Profile %s 失败: %w", p.Name, err)
+		}
+		runners = append(runners, runner)
+	}
+
+	if len(runners) == 0 {
+		db.Close()
+		return nil, nil, fmt.Errorf("没有找到 Profile: %s", only)
+	}
+	return db, runners, nil
+}
+
+// newProfile 根据 Profile 配置初始化适配器与同步引擎
+// db 与 client 在所有 Profile 间共享，快照按 Profile 名称隔离
+func newProfile(cfg *config.Config, p *config.ProfileConfig, db *database.DB, client *baidu.Client) (*Profile, error) {
+	log := slog.With("profile", p.Name)
+	log.Info("配置已加载",
+		"local_dir", p.LocalDir,
+		"remote_dir", p.RemoteDir,
+		"interval", p.Interval,
+		"schedule", p.Schedule,
+		"on_error", p.OnError,
+		"hash_algorithm", p.HashAlgorithm,
+	)
+
+	stateDB, err := db.Profile(p.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 初始化文件适配器
+	localFS, err := newLocalFS(cfg, p)
+	if err != nil {
+		return nil, err
+	}
+	if setter, ok := localFS.(fs.CopyBufferSetter); ok {
+		setter.SetCopyBuffer(cfg.System.CopyBufferBytes)
+	}
+	if cfg.Local.Type == config.LocalTypeWebDAV {
+		log.Info("本地一侧: WebDAV", "root", localFS.Root())
+	}
+
+	// 准备加密密钥
+	var aesKey []byte
+	if p.Crypto.Enable {
+		aesKey = p.Crypto.GetAESKey() // 自动将密码转为32字节Key
+		log.Info("加密模式: 已启用 (AES-256)", "encrypt_filenames", p.Crypto.EncryptFilenames)
+	} else {
+		log.Info("加密模式: 未启用 (文件将原样上传)")
+	}
+
+	remoteFS := NewRemoteProvider(cfg, p, client, aesKey)
+	// 百度网盘的缓冲区在创建客户端时设置，这里只对写入本地目录的后端 (remote.type: local) 生效
+	if setter, ok := remoteFS.(fs.CopyBufferSetter); ok {
+		setter.SetCopyBuffer(cfg.System.CopyBufferBytes)
+	}
+	log.Info("云端后端", "type", remoteFS.Type(), "root", remoteFS.Root())
+
+	if p.SkipHidden {
+		// 两侧必须同时跳过隐藏文件，否则只在一侧被跳过的文件会被当作已删除
+		skipper, ok := remoteFS.(fs.HiddenSkipper)
+		if !ok {
+			return nil, fmt.Errorf("云端后端 %s 不支持 include_hidden: false", remoteFS.Type())
+		}
+		localSkipper, ok := localFS.(fs.HiddenSkipper)
+		if !ok {
+			return nil, fmt.Errorf("本地存储 %s 不支持 include_hidden: false", cfg.Local.Type)
+		}
+		skipper.SetSkipHidden(true)
+		localSkipper.SetSkipHidden(true)
+		log.Info("隐藏文件: 不同步")
+	}
+	if p.DetectMoves {
+		if tracker, ok := localFS.(fs.IdentityTracker); ok {
+			tracker.SetTrackIdentity(true)
+			log.Info("移动检测: 开启")
+		} else {
+			log.Warn("本地存储不提供文件标识，detect_moves 不生效", "type", cfg.Local.Type)
+		}
+	}
+
+	// 初始化同步引擎
+	engine := syncer.NewEngine(&syncer.EngineOptions{
+		LocalFS:          localFS,
+		RemoteFS:         remoteFS,
+		StateDB:          stateDB,
+		EncryptKey:       aesKey,
+		MaxWorkers:       p.MaxConcurrent,
+		OpLimits:         opLimits(p),
+		ConflictStrategy: syncer.ParseConflictStrategy(p.ConflictStrategy),
+		ConflictRules:    conflictRules(p),
+		ConflictName:     p.ConflictName,
+		BackupDir:        cfg.System.BackupDir,
+		BackupKeep:       cfg.System.BackupKeep,
+		// 孤立记录清理为可选功能，避免与正常的删除传播冲突
+		PruneOrphansAfter:       p.PruneOrphansDuration,
+		OnError:                 syncer.ParseErrorPolicy(p.OnError),
+		Adaptive:                adaptiveOptions(p),
+		FileTimeout:             p.FileTimeoutDuration,
+		DownloadRetries:         p.DownloadRetries,
+		PreserveMode:            p.PreserveMode,
+		MaxFileSize:             p.MaxFileSizeBytes,
+		Bandwidth:               bandwidthOptions(p),
+		PruneEmptyDirs:          p.PruneEmptyDirs,
+		CycleTimeout:            p.CycleTimeoutDuration,
+		Exclude:                 selfExcludes(cfg, p, log),
+		Subpath:                 p.Subpath,
+		NormalizeCase:           p.NormalizeCase,
+		DeleteOnPartialScan:     p.DeleteOnPartialScan,
+		VerifyLocalChanges:      p.VerifyLocal,
+		QuarantineUndecryptable: p.QuarantineUndecryptable,
+		ProtectNewerRemote:      syncer.ParseNewerRemoteGuard(p.ProtectNewerRemote),
+		FirstRunBias:            syncer.ParseFirstRunBias(p.FirstRunBias),
+		TypeClash:               syncer.ParseTypeClashPolicy(p.TypeClash),
+		MigratePlain:            p.Crypto.Enable && p.Crypto.MigratePlain,
+		QuietPeriod:             p.QuietPeriodDuration,
+		DetectMoves:             p.DetectMoves,
+		NoCreateRemoteRoot:      !p.CreateRoot,
+		ClockSkewThreshold:      p.ClockSkewDuration,
+		ClockSkewHashOnly:       p.ClockSkewHashOnly,
+		NormalizeUnicode:        p.NormalizeUnicode,
+		Logger:                  log,
+		Progress: func(relPath string, op syncer.OpType, done, total int64) {
+			log.Debug("传输进度", "path", relPath, "op", op, "done", done, "total", total)
+		},
+	})
+
+	return &Profile{
+		name:       p.Name,
+		engine:     engine,
+		local:      localFS,
+		remote:     remoteFS,
+		client:     client,
+		schedule:   scheduleOf(p),
+		log:        log,
+		profile:    *p,
+		scheduleCh: make(chan syncSchedule, 1),
+	}, nil
+}
+
+// newLocalFS 按 local.type 创建本地一侧的文件系统
+func newLocalFS(cfg *config.Config, p *config.ProfileConfig) (fs.FileSystem, error) {
+	switch cfg.Local.Type {
+	case config.LocalTypeWebDAV:
+		return webdav.New(p.LocalDir, &webdav.Options{
+			URL:           cfg.Local.WebDAV.URL,
+			Username:      cfg.Local.WebDAV.Username,
+			Password:      cfg.Local.WebDAV.Password,
+			HashAlgorithm: p.HashAlgorithm,
+		})
+	default:
+		return local.NewAdapterWithHash(p.LocalDir, p.HashAlgorithm)
+	}
+}
+
+// dirLocker 可以锁定根目录的本地文件系统 (见 local.Adapter.Lock)
+type dirLocker interface {
+	Lock() (unlock func() error, err error)
+}
+
+// lockLocalDirs 锁定各个 Profile 的本地目录，防止另一个实例 (例如使用了不同 db_path 的配置) 同时修改同一个目录
+// 任一目录已被占用时释放已经加上的锁并返回错误；release 在退出前调用
+func lockLocalDirs(runners []*Profile) (release func(), err error) {
+	var unlocks []func() error
+	release = func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}
+	for _, r := range runners {
+		// WebDAV 等远程存储没有可用的锁，跳过
+		locker, ok := r.local.(dirLocker)
+		if !ok {
+			continue
+		}
+		unlock, err := locker.Lock()
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("profile %s: %w", r.name, err)
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return release, nil
+}
+
+// closeProfiles 关闭各个 Profile 的本地与云端文件系统 (释放目录锁、空闲连接等)
+// 必须在所有同步任务结束之后调用
+func closeProfiles(runners []*Profile) {
+	for _, r := range runners {
+		if err := r.local.Close(); err != nil {
+			r.log.Warn("关闭本地文件系统失败", "err", err)
+		}
+		if err := r.remote.Close(); err != nil {
+			r.log.Warn("关闭云端文件系统失败", "err", err)
+		}
+	}
+}
+
+// preflight 依次检查各个 Profile 是否可以开始同步，全部通过后输出汇总
+func preflight(ctx context.Context, runners []*Profile) error {
+	names := make([]string, 0, len(runners))
+	for _, r := range runners {
+		if err := r.engine.Preflight(ctx); err != nil {
+			return fmt.Errorf("profile %s: %w", r.name, err)
+		}
+		names = append(names, r.name)
+	}
+	slog.Info("准备就绪", "profiles", names)
+	return nil
+}
+
+// selfExcludes 找出位于 local_dir 中的数据库、日志、临时目录与备份目录，返回它们相对于 local_dir 的路径
+// 这些文件在同步过程中不断变化 (数据库还被当前进程锁定)，同步它们只会每轮报错，因此自动排除并提示移走
+func selfExcludes(cfg *config.Config, p *config.ProfileConfig, log *slog.Logger) []string {
+	// WebDAV 服务器上的目录不会包含本机的这些文件
+	if cfg.Local.Type != config.LocalTypeFolder {
+		return nil
+	}
+	root, err := filepath.Abs(p.LocalDir)
+	if err != nil {
+		return nil
+	}
+	type selfPath struct{ key, path string }
+	candidates := []selfPath{
+		{"db_path", cfg.System.DBPath},
+		{"log_file", cfg.System.LogFile},
+		{"temp_dir", cfg.System.TempDir},
+	}
+	if cfg.System.BackupKeep > 0 {
+		candidates = append(candidates, selfPath{"backup_dir", cfg.System.BackupDir})
+	}
+
+	var excludes []string
+	for _, c := range candidates {
+		if c.path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(c.path)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if rel == "." {
+			log.Warn(c.key+" 与同步目录相同，请修改配置", "path", abs)
+			continue
+		}
+		log.Warn(c.key+" 位于同步目录中，已自动排除，建议移到同步目录之外", "path", abs)
+		excludes = append(excludes, filepath.ToSlash(rel))
+	}
+	return excludes
+}
+
+// conflictRules 将配置中的路径规则转换为引擎使用的规则
+func conflictRules(p *config.ProfileConfig) []syncer.ConflictRule {
+	rules := make([]syncer.ConflictRule, 0, len(p.ConflictRules))
+	for _, r := range p.ConflictRules {
+		rules = append(rules, syncer.ConflictRule{
+			Pattern:  r.Pattern,
+			Strategy: syncer.ParseConflictStrategy(r.Strategy),
+		})
+	}
+	return rules
+}
+
+// adaptiveOptions 未开启自适应并发时返回 nil (固定使用 max_concurrent)
+func adaptiveOptions(p *config.ProfileConfig) *syncer.AdaptiveOptions {
+	if !p.AdaptiveConcurrency.Enable {
+		return nil
+	}
+	return &syncer.AdaptiveOptions{
+		Min: p.AdaptiveConcurrency.Min,
+		Max: p.AdaptiveConcurrency.Max,
+	}
+}
+
+// opLimits 按操作类型的并发上限 (0 表示只受 max_concurrent 限制)
+func opLimits(p *config.ProfileConfig) syncer.OpLimits {
+	return syncer.OpLimits{
+		Uploads:   p.MaxUploads,
+		Downloads: p.MaxDownloads,
+		Deletes:   p.MaxDeletes,
+	}
+}
+
+// bandwidthOptions 未配置限速时返回 nil
+func bandwidthOptions(p *config.ProfileConfig) *syncer.BandwidthOptions {
+	if p.BandwidthLimitBytes <= 0 && len(p.BandwidthSchedule) == 0 {
+		return nil
+	}
+	opts := &syncer.BandwidthOptions{Limit: p.BandwidthLimitBytes}
+	for _, w := range p.BandwidthSchedule {
+		opts.Schedule = append(opts.Schedule, syncer.BandwidthWindow{
+			From:  w.FromOffset,
+			To:    w.ToOffset,
+			Limit: w.LimitBytes,
+		})
+	}
+	return opts
+}
+
+// NewRemoteProvider 根据 remote.type 创建云端存储后端
+// 文件名加密等后端相关的细节在这里交给具体的后端处理
+func NewRemoteProvider(cfg *config.Config, p *config.ProfileConfig, client *baidu.Client, aesKey []byte) fs.RemoteProvider {
+	switch cfg.Remote.Type {
+	case config.RemoteTypeLocal:
+		return folder.New(p.RemoteDir)
+	default:
+		// 传递加密参数到 Baidu Adapter
+		return baidu.NewAdapter(client, p.RemoteDir, aesKey, p.Crypto.EncryptFilenames)
+	}
+}
+
+// Name 返回 Profile 的名称
+func (r *Profile) Name() string {
+	return r.name
+}
+
+// Engine 返回 Profile 的同步引擎
+func (r *Profile) Engine() *Engine {
+	return r.engine
+}
+
+// Local 返回 Profile 的本地文件系统 (按 local.type 为 *local.Adapter 或 *webdav.Adapter)
+func (r *Profile) Local() fs.FileSystem {
+	return r.local
+}
+
+// Remote 返回 Profile 的云端存储后端
+func (r *Profile) Remote() fs.RemoteProvider {
+	return r.remote
+}
+
+// Client 返回所有 Profile 共享的百度网盘客户端
+func (r *Profile) Client() *baidu.Client {
+	return r.client
+}
+
+// Logger 返回带有 Profile 名称的 Logger
+func (r *Profile) Logger() *slog.Logger {
+	return r.log
+}
+
+// Config 返回 Profile 当前生效的配置 (热加载后只有可热更新的字段是新值)
+func (r *Profile) Config() *ProfileConfig {
+	return &r.profile
+}
+
+// RunOnce 立即同步一轮，返回本轮的结果
+// 结果总是不为 nil，出错时也包含已经完成的任务；不与调度循环触发的同步互斥，由调用方避免同时执行
+func (r *Profile) RunOnce(ctx context.Context) (*RunResult, error) {
+	// 由这里生成 Run ID 并交给引擎沿用，保证开始/结束日志与任务日志使用同一个 ID
+	runID := syncer.NewRunID()
+	log := r.log.With("run_id", runID)
+
+	log.Info(">>> 开始同步")
+	result, err := r.engine.Run(syncer.WithRunID(ctx, runID))
+	if r.metrics != nil {
+		r.metrics.Observe(r.name, result, err)
+	}
+	if err != nil {
+		// 区分是外部取消还是真正的同步错误
+		switch {
+		case ctx.Err() != nil:
+			log.Warn("同步被强制中断，正在传输的文件已放弃，将在下一轮重新传输")
+		case errors.Is(err, syncer.ErrStopped):
+			log.Info("同步已停止，已完成的任务均已写入数据库", "error", err)
+		case errors.Is(err, syncer.ErrAborted):
+			log.Error("同步已中止，剩余任务将在下一轮继续", "on_error", r.profile.OnError, "error", err)
+		case errors.Is(err, syncer.ErrCycleTimeout):
+			log.Warn("同步超时，剩余任务将在下一轮继续", "error", err)
+		default:
+			log.Error("同步错误", "error", err)
+		}
+	}
+	succeeded, failed := result.Total()
+	log.Info("<<< 同步结束",
+		"duration", result.Duration.Round(time.Millisecond),
+		"succeeded", succeeded,
+		"failed", failed,
+		"deferred", result.Deferred,
+		"bytes_up", result.BytesUploaded,
+		"bytes_down", result.BytesDownloaded,
+		"wire_up", result.WireBytesUploaded,
+		"wire_down", result.WireBytesDownloaded,
+	)
+	return result, err
+}
+
+// runSync 在后台触发一轮同步；上一轮尚未结束时跳过
+func (r *Profile) runSync(ctx context.Context, wg *sync.WaitGroup) {
+	if !r.isSyncing.CompareAndSwap(false, true) {
+		r.log.Info("上一轮同步尚未结束，跳过本次触发")
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer r.isSyncing.Store(false)
+		r.RunOnce(ctx)
+	}()
+}
+
+// loop 按时间安排定时同步，直到 ctx 被取消
+// 固定间隔模式下启动后立即同步一次；cron 模式严格按表达式的时间执行
+// 正在同步时到点的触发由 runSync 跳过，不会叠加执行
+func (r *Profile) loop(ctx context.Context, wg *sync.WaitGroup) {
+	schedule := r.schedule
+	if schedule.cron == nil && schedule.runOnStart {
+		r.runSync(ctx, wg)
+	}
+
+	wait := r.untilNext(schedule)
+	if schedule.cron == nil && !schedule.runOnStart {
+		r.log.Info("启动时不同步，等待第一次定时同步", "at", time.Now().Add(wait).Format(time.DateTime))
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			r.runSync(ctx, wg)
+			timer.Reset(r.untilNext(schedule))
+		case schedule = <-r.scheduleCh:
+			timer.Reset(r.untilNext(schedule))
+		case <-ctx.Done():
+			return
+		case <-syncer.Stopping(ctx):
+			// 收到停止请求后不再触发新的同步，正在进行的同步由 runSync 等待结束
+			return
+		}
+	}
+}
+
+// untilNext 计算距离下一次同步的等待时间，cron 模式下记录下次同步时间
+func (r *Profile) untilNext(s syncSchedule) time.Duration {
+	now := time.Now()
+	next := s.next(now)
+	if s.cron != nil {
+		r.log.Info("下次同步时间", "at", next.Format(time.DateTime))
+	}
+	return next.Sub(now)
+}
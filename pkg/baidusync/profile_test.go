@@ -0,0 +1,105 @@
+package baidusync
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"baidusync/internal/config"
+)
+
+func TestSelfExcludes(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Local.Type = config.LocalTypeFolder
+	cfg.System.DBPath = filepath.Join(root, "state.db")
+	cfg.System.LogFile = filepath.Join(root, "logs", "sync.log")
+	cfg.System.TempDir = filepath.Join(outside, "tmp")
+	cfg.System.BackupDir = filepath.Join(root, "backup")
+	p := &config.ProfileConfig{SyncConfig: config.SyncConfig{LocalDir: root}}
+
+	// 备份目录只在开启备份时排除
+	got := selfExcludes(cfg, p, slog.New(slog.DiscardHandler))
+	if want := []string{"state.db", "logs/sync.log"}; !slices.Equal(got, want) {
+		t.Fatalf("排除 %v，应为 %v", got, want)
+	}
+	cfg.System.BackupKeep = 3
+	got = selfExcludes(cfg, p, slog.New(slog.DiscardHandler))
+	if want := []string{"state.db", "logs/sync.log", "backup"}; !slices.Equal(got, want) {
+		t.Fatalf("排除 %v，应为 %v", got, want)
+	}
+
+	// 与同步目录同名前缀的兄弟目录不在同步目录中
+	cfg.System.DBPath = root + "-state/state.db"
+	cfg.System.LogFile = ""
+	cfg.System.BackupKeep = 0
+	if got := selfExcludes(cfg, p, slog.New(slog.DiscardHandler)); len(got) != 0 {
+		t.Fatalf("排除 %v，同步目录之外的路径不应排除", got)
+	}
+
+	// WebDAV 本地端不检查
+	cfg.Local.Type = config.LocalTypeWebDAV
+	cfg.System.DBPath = filepath.Join(root, "state.db")
+	if got := selfExcludes(cfg, p, slog.New(slog.DiscardHandler)); len(got) != 0 {
+		t.Fatalf("WebDAV 本地端排除了 %v", got)
+	}
+}
+
+func TestDBInsideSyncRootIsNotUploaded(t *testing.T) {
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	dir := t.TempDir()
+	local := filepath.Join(dir, "local")
+	remote := filepath.Join(dir, "remote")
+	os.MkdirAll(filepath.Join(local, "logs"), 0755)
+	os.MkdirAll(remote, 0755)
+	os.WriteFile(filepath.Join(local, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(local, "logs", "sync.log"), []byte("log"), 0644)
+
+	configPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(configPath, fmt.Appendf(nil, `
+remote:
+  type: local
+sync:
+  local_dir: %q
+  remote_dir: %q
+  interval: 1h
+system:
+  db_path: %q
+  log_file: %q
+  temp_dir: %q
+`, local, remote, filepath.Join(local, "state.db"), filepath.Join(local, "logs", "sync.log"), filepath.Join(local, "tmp")), 0644)
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	// 数据库在同步过程中一直被锁定并不断变化，第二轮也不能报错
+	for range 2 {
+		if err := app.RunOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var uploaded []string
+	filepath.WalkDir(remote, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(remote, path)
+			uploaded = append(uploaded, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if want := []string{"a.txt"}; !slices.Equal(uploaded, want) {
+		t.Fatalf("云端的文件为 %v，应为 %v", uploaded, want)
+	}
+}
@@ -0,0 +1,202 @@
+package baidusync
+
+import (
+	"baidusync/internal/config"
+	syncer "baidusync/internal/sync"
+	"log/slog"
+	"reflect"
+)
+
+// Reload 把新配置中可以热更新的字段应用到正在运行的 Profile，其余字段的修改只输出需要重启的警告
+// 可热更新: interval、schedule、conflict_strategy、conflict_rules、max_concurrent
+// 需要重启: db_path、metrics_addr、local、remote.type、user_agent、local_dir、remote_dir、crypto、Profile 的增删
+func (a *App) Reload(next *Config) {
+	current, runners := a.cfg, a.profiles
+
+	if next.System.DBPath != current.System.DBPath {
+		slog.Warn("system.db_path 已修改，需要重启才能生效",
+			"old", current.System.DBPath, "new", next.System.DBPath)
+	}
+
+	if next.System.MetricsAddr != current.System.MetricsAddr {
+		slog.Warn("system.metrics_addr 已修改，需要重启才能生效",
+			"old", current.System.MetricsAddr, "new", next.System.MetricsAddr)
+	}
+
+	if next.Baidu.UserAgent != current.Baidu.UserAgent || !reflect.DeepEqual(next.Baidu.UserAgents, current.Baidu.UserAgents) {
+		slog.Warn("baidu.user_agent / baidu.user_agents 已修改，需要重启才能生效")
+	}
+
+	if next.Baidu.MetadataTimeoutDuration != current.Baidu.MetadataTimeoutDuration {
+		slog.Warn("baidu.metadata_timeout 已修改，需要重启才能生效",
+			"old", current.Baidu.MetadataTimeout, "new", next.Baidu.MetadataTimeout)
+	}
+
+	if next.Baidu.ListWorkers != current.Baidu.ListWorkers {
+		slog.Warn("baidu.list_workers 已修改，需要重启才能生效",
+			"old", current.Baidu.ListWorkers, "new", next.Baidu.ListWorkers)
+	}
+
+	if next.System.CopyBufferBytes != current.System.CopyBufferBytes {
+		slog.Warn("system.copy_buffer 已修改，需要重启才能生效",
+			"old", current.System.CopyBuffer, "new", next.System.CopyBuffer)
+	}
+
+	if next.Baidu.StreamUploadThresholdBytes != current.Baidu.StreamUploadThresholdBytes {
+		slog.Warn("baidu.stream_upload_threshold 已修改，需要重启才能生效",
+			"old", current.Baidu.StreamUploadThreshold, "new", next.Baidu.StreamUploadThreshold)
+	}
+
+	if next.Local.Type != current.Local.Type || next.Local.WebDAV != current.Local.WebDAV {
+		slog.Warn("local.type / local.webdav 已修改，需要重启才能生效",
+			"old", current.Local.Type, "new", next.Local.Type)
+	}
+
+	if next.Remote.Type != current.Remote.Type {
+		slog.Warn("remote.type 已修改，需要重启才能生效",
+			"old", current.Remote.Type, "new", next.Remote.Type)
+	}
+
+	nextProfiles := make(map[string]*config.ProfileConfig, len(next.Profiles))
+	for i := range next.Profiles {
+		nextProfiles[next.Profiles[i].Name] = &next.Profiles[i]
+	}
+
+	running := make(map[string]bool, len(runners))
+	for _, r := range runners {
+		running[r.name] = true
+		p, ok := nextProfiles[r.name]
+		if !ok {
+			r.log.Warn("Profile 已从配置中移除，需要重启才能停止")
+			continue
+		}
+		r.reload(p)
+	}
+	for name := range nextProfiles {
+		if !running[name] {
+			slog.Warn("新增了 Profile，需要重启才能启动", "profile", name)
+		}
+	}
+}
+
+// reload 将 Profile 中可热更新的字段应用到引擎和定时器
+func (r *Profile) reload(p *config.ProfileConfig) {
+	old := r.profile
+
+	if p.LocalDir != old.LocalDir {
+		r.log.Warn("local_dir 已修改，需要重启才能生效", "old", old.LocalDir, "new", p.LocalDir)
+	}
+	if p.RemoteDir != old.RemoteDir {
+		r.log.Warn("remote_dir 已修改，需要重启才能生效", "old", old.RemoteDir, "new", p.RemoteDir)
+	}
+	if !reflect.DeepEqual(p.Crypto, old.Crypto) {
+		r.log.Warn("crypto 配置已修改，需要重启才能生效")
+	}
+	if p.OnError != old.OnError {
+		r.log.Warn("on_error 已修改，需要重启才能生效", "old", old.OnError, "new", p.OnError)
+	}
+	if p.ConflictName != old.ConflictName {
+		r.log.Warn("conflict_name 已修改，需要重启才能生效", "old", old.ConflictName, "new", p.ConflictName)
+	}
+	if p.AdaptiveConcurrency != old.AdaptiveConcurrency {
+		r.log.Warn("adaptive_concurrency 已修改，需要重启才能生效")
+	}
+	if p.FileTimeoutDuration != old.FileTimeoutDuration || p.CycleTimeoutDuration != old.CycleTimeoutDuration {
+		r.log.Warn("file_timeout / cycle_timeout 已修改，需要重启才能生效")
+	}
+	if p.NormalizeCase != old.NormalizeCase || p.NormalizeUnicode != old.NormalizeUnicode {
+		r.log.Warn("normalize_case / normalize_unicode 已修改，需要重启才能生效")
+	}
+	if p.SkipHidden != old.SkipHidden {
+		r.log.Warn("include_hidden 已修改，需要重启才能生效", "skip_hidden", p.SkipHidden)
+	}
+	if p.BandwidthLimitBytes != old.BandwidthLimitBytes || !reflect.DeepEqual(p.BandwidthSchedule, old.BandwidthSchedule) {
+		r.log.Warn("bandwidth_limit / bandwidth_schedule 已修改，需要重启才能生效")
+	}
+	if p.PruneEmptyDirs != old.PruneEmptyDirs {
+		r.log.Warn("prune_empty_dirs 已修改，需要重启才能生效", "old", old.PruneEmptyDirs, "new", p.PruneEmptyDirs)
+	}
+	if p.DeleteOnPartialScan != old.DeleteOnPartialScan {
+		r.log.Warn("delete_on_partial_scan 已修改，需要重启才能生效", "old", old.DeleteOnPartialScan, "new", p.DeleteOnPartialScan)
+	}
+	if p.QuarantineUndecryptable != old.QuarantineUndecryptable {
+		r.log.Warn("quarantine_undecryptable 已修改，需要重启才能生效", "old", old.QuarantineUndecryptable, "new", p.QuarantineUndecryptable)
+	}
+	if p.ProtectNewerRemote != old.ProtectNewerRemote {
+		r.log.Warn("protect_newer_remote 已修改，需要重启才能生效", "old", old.ProtectNewerRemote, "new", p.ProtectNewerRemote)
+	}
+	if p.MaxUploads != old.MaxUploads || p.MaxDownloads != old.MaxDownloads || p.MaxDeletes != old.MaxDeletes {
+		r.log.Warn("max_uploads / max_downloads / max_deletes 已修改，需要重启才能生效")
+	}
+	if p.Subpath != old.Subpath {
+		r.log.Warn("subpath 已修改，需要重启才能生效", "old", old.Subpath, "new", p.Subpath)
+	}
+	if p.QuietPeriodDuration != old.QuietPeriodDuration {
+		r.log.Warn("quiet_period 已修改，需要重启才能生效", "old", old.QuietPeriodDuration, "new", p.QuietPeriodDuration)
+	}
+	if p.FirstRunBias != old.FirstRunBias {
+		r.log.Warn("first_run_bias 已修改，需要重启才能生效", "old", old.FirstRunBias, "new", p.FirstRunBias)
+	}
+	if p.TypeClash != old.TypeClash {
+		r.log.Warn("type_clash 已修改，需要重启才能生效", "old", old.TypeClash, "new", p.TypeClash)
+	}
+	if p.VerifyLocal != old.VerifyLocal {
+		r.log.Warn("verify_local_changes 已修改，需要重启才能生效", "old", old.VerifyLocal, "new", p.VerifyLocal)
+	}
+	if p.CreateRoot != old.CreateRoot {
+		r.log.Warn("create_remote_root 已修改，需要重启才能生效", "old", old.CreateRoot, "new", p.CreateRoot)
+	}
+	if p.RunAtStart != old.RunAtStart {
+		r.log.Warn("run_on_start 已修改，需要重启才能生效", "old", old.RunAtStart, "new", p.RunAtStart)
+	}
+	if p.DetectMoves != old.DetectMoves {
+		r.log.Warn("detect_moves 已修改，需要重启才能生效", "old", old.DetectMoves, "new", p.DetectMoves)
+	}
+	if p.ClockSkewDuration != old.ClockSkewDuration || p.ClockSkewHashOnly != old.ClockSkewHashOnly {
+		r.log.Warn("clock_skew_threshold / clock_skew_hash_only 已修改，需要重启才能生效")
+	}
+	if p.MaxFileSizeBytes != old.MaxFileSizeBytes {
+		r.log.Warn("max_file_size 已修改，需要重启才能生效", "old", old.MaxFileSize, "new", p.MaxFileSize)
+	}
+	if p.PreserveMode != old.PreserveMode {
+		r.log.Warn("preserve_mode 已修改，需要重启才能生效", "old", old.PreserveMode, "new", p.PreserveMode)
+	}
+	if p.DownloadRetries != old.DownloadRetries {
+		r.log.Warn("download_retries 已修改，需要重启才能生效", "old", old.DownloadRetries, "new", p.DownloadRetries)
+	}
+	if p.HashAlgorithm != old.HashAlgorithm {
+		r.log.Warn("hash_algorithm 已修改，需要重启才能生效", "old", old.HashAlgorithm, "new", p.HashAlgorithm)
+	}
+
+	r.engine.Reload(syncer.ParseConflictStrategy(p.ConflictStrategy), conflictRules(p), p.MaxConcurrent)
+
+	if p.IntervalDuration != old.IntervalDuration || p.Schedule != old.Schedule || p.IntervalJitterDuration != old.IntervalJitterDuration {
+		// 丢弃尚未被消费的旧值，保证调度循环拿到的是最新的时间安排
+		select {
+		case <-r.scheduleCh:
+		default:
+		}
+		r.scheduleCh <- scheduleOf(p)
+	}
+
+	// 只记录已生效的字段，不可热更新的字段保持旧值，以便下次继续提示
+	r.profile.Interval = p.Interval
+	r.profile.IntervalDuration = p.IntervalDuration
+	r.profile.Schedule = p.Schedule
+	r.profile.CronSchedule = p.CronSchedule
+	r.profile.IntervalJitter = p.IntervalJitter
+	r.profile.IntervalJitterDuration = p.IntervalJitterDuration
+	r.profile.ConflictStrategy = p.ConflictStrategy
+	r.profile.ConflictRules = p.ConflictRules
+	r.profile.MaxConcurrent = p.MaxConcurrent
+	r.schedule = scheduleOf(p)
+
+	r.log.Info("配置已热更新",
+		"interval", p.Interval,
+		"schedule", p.Schedule,
+		"interval_jitter", p.IntervalJitter,
+		"conflict_strategy", p.ConflictStrategy,
+		"conflict_rules", len(p.ConflictRules),
+		"max_concurrent", p.MaxConcurrent,
+	)
+}
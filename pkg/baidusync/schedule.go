@@ -0,0 +1,45 @@
+package baidusync
+
+import (
+	"baidusync/internal/config"
+	"math/rand/v2"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// syncSchedule 一个 Profile 的同步时间安排
+// 配置了 cron 表达式时按表达式执行，否则按固定间隔执行
+type syncSchedule struct {
+	interval time.Duration
+	cron     cron.Schedule
+	// jitter 每次同步时间额外推迟 [0, jitter) 的随机时长，
+	// 避免多个 Profile 或多个实例在同一时刻集中请求百度网盘
+	jitter time.Duration
+	// runOnStart 调度循环启动时立即同步一轮 (只对 interval 生效，cron 模式总是等到下一个计划时间)
+	runOnStart bool
+}
+
+// scheduleOf 从 Profile 配置中取出同步时间安排
+func scheduleOf(p *config.ProfileConfig) syncSchedule {
+	return syncSchedule{
+		interval:   p.IntervalDuration,
+		cron:       p.CronSchedule,
+		jitter:     p.IntervalJitterDuration,
+		runOnStart: p.RunAtStart,
+	}
+}
+
+// next 返回 now 之后下一次同步的时间 (已加上随机延迟)
+func (s syncSchedule) next(now time.Time) time.Time {
+	var next time.Time
+	if s.cron != nil {
+		next = s.cron.Next(now)
+	} else {
+		next = now.Add(s.interval)
+	}
+	if s.jitter > 0 {
+		next = next.Add(rand.N(s.jitter))
+	}
+	return next
+}
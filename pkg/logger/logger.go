@@ -8,13 +8,30 @@ import (
 	"strings"
 )
 
+// Options 日志配置
+type Options struct {
+	// Level 日志等级: "debug", "info", "warn", "error"
+	Level string
+	// Format 输出格式: "text" (默认，方便人类阅读) 或 "json" (方便 Loki/ELK 等系统采集)
+	Format string
+	// File 日志文件路径 (如果为空则只输出到控制台)
+	File string
+	// MaxSizeMB 单个日志文件的最大体积，超过后切割 (0 表示不切割)
+	MaxSizeMB int
+	// MaxBackups 最多保留的历史日志文件数量 (0 表示不限制)
+	MaxBackups int
+	// MaxAgeDays 历史日志文件的最长保留天数 (0 表示不限制)
+	MaxAgeDays int
+	// Console 控制台输出目标 (为空时使用 os.Stdout)
+	// 命令行子命令把结果打印到 stdout 时，可以将日志改为输出到 os.Stderr
+	Console io.Writer
+}
+
 // Setup 初始化全局日志配置
-// levelStr: "debug", "info", "warn", "error"
-// logPath: 日志文件路径 (如果为空则只输出到控制台)
-func Setup(levelStr string, logPath string) error {
+func Setup(o Options) error {
 	// 1. 解析日志等级
 	var level slog.Level
-	switch strings.ToLower(levelStr) {
+	switch strings.ToLower(o.Level) {
 	case "debug":
 		level = slog.LevelDebug
 	case "warn", "warning":
@@ -26,33 +43,45 @@ func Setup(levelStr string, logPath string) error {
 	}
 
 	// 2. 配置输出目标 (Writer)
-	var writer io.Writer = os.Stdout
+	var console io.Writer = os.Stdout
+	if o.Console != nil {
+		console = o.Console
+	}
+	writer := console
 
-	if logPath != "" {
+	if o.File != "" {
 		// 确保日志目录存在
-		if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		if err := os.MkdirAll(filepath.Dir(o.File), 0755); err != nil {
 			return err
 		}
 
-		// 打开日志文件 (追加模式)
-		file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		// 打开日志文件 (追加模式，按大小切割)
+		file, err := NewRotatingFile(o.File, o.MaxSizeMB, o.MaxBackups, o.MaxAgeDays)
 		if err != nil {
 			return err
 		}
 
 		// 使用 MultiWriter 同时输出到控制台和文件
-		writer = io.MultiWriter(os.Stdout, file)
+		writer = io.MultiWriter(console, file)
 	}
 
 	// 3. 配置 Handler 选项
 	opts := &slog.HandlerOptions{
 		Level:     level,                    // 设置最低日志等级
 		AddSource: level == slog.LevelDebug, // 仅在 Debug 模式下显示文件名和行号
-		// 自定义时间格式等可以在这里通过 ReplaceAttr 处理
+		// 对 access_token、password 等敏感字段脱敏，避免用户分享日志时泄露
+		ReplaceAttr: redactAttr,
 	}
 
-	// 4. 创建 Logger (使用 TextHandler 方便人类阅读，也可以选 JSONHandler)
-	logger := slog.New(slog.NewTextHandler(writer, opts))
+	// 4. 创建 Logger (默认使用 TextHandler 方便人类阅读，也可以选 JSONHandler)
+	var handler slog.Handler
+	switch strings.ToLower(o.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(writer, opts)
+	default:
+		handler = slog.NewTextHandler(writer, opts)
+	}
+	logger := slog.New(handler)
 
 	// 5. 设置为全局默认 Logger
 	slog.SetDefault(logger)
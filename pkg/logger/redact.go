@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// Redacted 敏感信息在日志中的替代文本
+const Redacted = "***"
+
+// secretKeys 日志中需要脱敏的属性名 (不区分大小写)
+var secretKeys = map[string]bool{
+	"access_token":  true,
+	"refresh_token": true,
+	"secret_key":    true,
+	"password":      true,
+}
+
+// IsSecretKey 判断属性名是否属于敏感字段
+// 同时兼容 "access_token"、"AccessToken"、"accessToken" 等写法
+func IsSecretKey(key string) bool {
+	normalized := strings.ToLower(key)
+	if secretKeys[normalized] {
+		return true
+	}
+	return secretKeys[strings.ToLower(toSnake(key))]
+}
+
+// toSnake 将驼峰命名转换为下划线命名: "AccessToken" -> "Access_Token"
+func toSnake(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			b.WriteByte('_')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// redactAttr 作为 slog.HandlerOptions.ReplaceAttr 使用，替换敏感字段的值
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if IsSecretKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
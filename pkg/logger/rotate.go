@@ -0,0 +1,136 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotateTimeFormat 归档文件名中的时间格式 (字典序即时间序)
+const rotateTimeFormat = "20060102-150405.000"
+
+// RotatingFile 按大小切割的日志文件，并按数量和时间清理旧的归档
+// 所有写入都由互斥锁保护，可以安全地被多个 goroutine 并发调用
+type RotatingFile struct {
+	path       string
+	maxSize    int64         // 单个文件的最大字节数 (0 表示不切割)
+	maxBackups int           // 最多保留的归档数量 (0 表示不限制)
+	maxAge     time.Duration // 归档的最长保留时间 (0 表示不限制)
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile 打开 (追加模式) 或创建日志文件
+func NewRotatingFile(path string, maxSizeMB, maxBackups, maxAgeDays int) (*RotatingFile, error) {
+	r := &RotatingFile{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+		maxAge:     time.Duration(maxAgeDays) * 24 * time.Hour,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	// 启动时顺便清理一次过期归档
+	r.cleanup()
+	return r, nil
+}
+
+// open 打开当前日志文件并记录已有大小
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// Write 实现 io.Writer，写入前检查是否需要切割
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			// 切割失败时继续写入旧文件，不丢日志
+			fmt.Fprintf(os.Stderr, "日志切割失败: %v\n", err)
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close 关闭当前日志文件
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// rotate 将当前文件重命名为带时间戳的归档，并打开新文件 (调用方需持有锁)
+// "logs/app.log" -> "logs/app-20240101-120000.000.log"
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(r.path)
+	archive := strings.TrimSuffix(r.path, ext) + "-" + time.Now().Format(rotateTimeFormat) + ext
+	if err := os.Rename(r.path, archive); err != nil {
+		// 重命名失败时重新打开原文件，保证后续写入不受影响
+		if openErr := r.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.cleanup()
+	return nil
+}
+
+// cleanup 删除超出数量或超过保留时间的归档
+func (r *RotatingFile) cleanup() {
+	if r.maxBackups <= 0 && r.maxAge <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(r.path)
+	pattern := strings.TrimSuffix(r.path, ext) + "-*" + ext
+	archives, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+	sort.Strings(archives) // 从旧到新
+
+	now := time.Now()
+	for i, archive := range archives {
+		tooMany := r.maxBackups > 0 && len(archives)-i > r.maxBackups
+		tooOld := false
+		if r.maxAge > 0 {
+			if info, err := os.Stat(archive); err == nil && now.Sub(info.ModTime()) > r.maxAge {
+				tooOld = true
+			}
+		}
+		if tooMany || tooOld {
+			os.Remove(archive)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"baidusync/internal/fs"
+	syncer "baidusync/internal/sync"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// conflictPrompt 在终端中逐个询问冲突文件的处理方式
+// 多个 Worker 可能同时遇到冲突，mu 保证一次只显示一个提示
+type conflictPrompt struct {
+	mu    sync.Mutex
+	out   io.Writer
+	lines chan string
+}
+
+// newConflictPrompt 创建终端提示，并在后台持续读取输入
+// 读取放在独立的 goroutine 中，这样等待输入时也能响应超时
+func newConflictPrompt(in io.Reader, out io.Writer) *conflictPrompt {
+	p := &conflictPrompt{out: out, lines: make(chan string)}
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			p.lines <- strings.TrimSpace(scanner.Text())
+		}
+		close(p.lines)
+	}()
+	return p
+}
+
+// isTerminal 判断标准输入是否连接到终端 (通过管道或重定向运行时不提示)
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Resolve 实现 syncer.ConflictResolver
+func (p *conflictPrompt) Resolve(ctx context.Context, relPath string, local, remote *fs.FileMeta) (syncer.ConflictStrategy, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 丢弃上一个提示超时后才输入的内容，避免被当成本次的选择
+	for drained := false; !drained; {
+		select {
+		case <-p.lines:
+		default:
+			drained = true
+		}
+	}
+
+	fmt.Fprintf(p.out, "\n冲突: %s\n", relPath)
+	fmt.Fprintf(p.out, "  本地: %s\n", describeMeta(local))
+	fmt.Fprintf(p.out, "  云端: %s\n", describeMeta(remote))
+
+	for {
+		fmt.Fprint(p.out, "保留哪一侧？[l]本地 [r]云端 [b]两者都保留 [s]跳过: ")
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				return 0, fmt.Errorf("标准输入已关闭")
+			}
+			switch strings.ToLower(line) {
+			case "l", "local":
+				return syncer.StrategyForceUpload, nil
+			case "r", "remote":
+				return syncer.StrategyForceDownload, nil
+			case "b", "both":
+				return syncer.StrategyKeepBoth, nil
+			case "s", "skip":
+				return syncer.StrategySkip, nil
+			}
+			fmt.Fprintln(p.out, "无效的选择，请重新输入")
+		case <-ctx.Done():
+			fmt.Fprintln(p.out, "\n等待超时，使用默认策略")
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// describeMeta 生成一行文件描述 (大小与修改时间)
+func describeMeta(m *fs.FileMeta) string {
+	if m == nil {
+		return "(不存在)"
+	}
+	return fmt.Sprintf("%s, 修改于 %s", formatSize(m.Size), m.ModTime.Format(time.DateTime))
+}
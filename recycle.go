@@ -0,0 +1,167 @@
+package main
+
+import (
+	"baidusync/internal/config"
+	"baidusync/internal/fs/baidu"
+	"baidusync/pkg/baidusync"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// cmdRecycle 查看或还原百度网盘回收站中属于同步目录的文件
+// 同步删除云端文件 (包括冲突策略覆盖的文件) 后，网盘会在回收站中保留一段时间
+func cmdRecycle(cfg *config.Config, args []string) error {
+	const usage = "用法: baidusync recycle list [--json] [-profile 名称] | recycle restore [-profile 名称] <fs_id|路径>..."
+	if len(args) == 0 {
+		return fmt.Errorf(usage)
+	}
+	if cfg.Remote.Type != config.RemoteTypeBaidu {
+		return fmt.Errorf("remote.type=%s 没有回收站", cfg.Remote.Type)
+	}
+
+	switch args[0] {
+	case "list":
+		return recycleList(cfg, args[1:])
+	case "restore":
+		return recycleRestore(cfg, args[1:])
+	default:
+		return fmt.Errorf("未知的子命令 %s\n%s", args[0], usage)
+	}
+}
+
+// recycleList 按 Profile 列出回收站中的文件，路径为解密后的相对路径
+func recycleList(cfg *config.Config, args []string) error {
+	fset := flag.NewFlagSet("recycle list", flag.ExitOnError)
+	asJSON := fset.Bool("json", false, "以 JSON 格式输出")
+	only := fset.String("profile", "", "只查看指定的 Profile")
+	fset.Parse(args)
+
+	app, err := baidusync.NewWithOptions(cfg, baidusync.Options{Profile: *only})
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	type profileRecycle struct {
+		Profile string               `json:"profile"`
+		Entries []baidu.RecycleEntry `json:"entries"`
+	}
+	var reports []profileRecycle
+	for _, r := range app.Profiles() {
+		adapter, err := recycleAdapter(r)
+		if err != nil {
+			return err
+		}
+		entries, err := adapter.ListRecycleBin()
+		if err != nil {
+			return fmt.Errorf("profile %s: 读取回收站失败: %w", r.Name(), err)
+		}
+		reports = append(reports, profileRecycle{Profile: r.Name(), Entries: entries})
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+
+	for _, report := range reports {
+		fmt.Printf("[%s] 回收站中共 %d 项\n", report.Profile, len(report.Entries))
+		if len(report.Entries) == 0 {
+			continue
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "  FS_ID\t删除时间\t剩余天数\t大小\t路径")
+		for _, e := range report.Entries {
+			path := e.RelPath
+			if e.IsDir {
+				path += "/"
+			}
+			fmt.Fprintf(tw, "  %d\t%s\t%d\t%d\t%s\n", e.FsID, e.DeletedAt.Format(time.DateTime), e.LeftDays, e.Size, path)
+		}
+		tw.Flush()
+	}
+	return nil
+}
+
+// recycleRestore 还原回收站中的文件，参数可以是 fs_id 或 list 中显示的相对路径
+// 同一路径被删除过多次时还原最近删除的那一份
+func recycleRestore(cfg *config.Config, args []string) error {
+	fset := flag.NewFlagSet("recycle restore", flag.ExitOnError)
+	only := fset.String("profile", "", "文件所属的 Profile (配置了多个 Profile 时必填)")
+	fset.Parse(args)
+
+	if fset.NArg() == 0 {
+		return fmt.Errorf("用法: baidusync recycle restore [-profile 名称] <fs_id|路径>...")
+	}
+	if *only == "" && len(cfg.Profiles) > 1 {
+		return fmt.Errorf("配置了多个 Profile，必须通过 -profile 指定文件所属的 Profile")
+	}
+
+	app, err := baidusync.NewWithOptions(cfg, baidusync.Options{Profile: *only})
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	r := app.Profiles()[0]
+	adapter, err := recycleAdapter(r)
+	if err != nil {
+		return err
+	}
+	entries, err := adapter.ListRecycleBin()
+	if err != nil {
+		return fmt.Errorf("读取回收站失败: %w", err)
+	}
+
+	// entries 已按删除时间从新到旧排列，同一路径只保留第一次出现的
+	byID := make(map[uint64]baidu.RecycleEntry, len(entries))
+	byPath := make(map[string]baidu.RecycleEntry, len(entries))
+	for _, e := range entries {
+		byID[e.FsID] = e
+		if _, ok := byPath[e.RelPath]; !ok {
+			byPath[e.RelPath] = e
+		}
+	}
+
+	var selected []baidu.RecycleEntry
+	for _, arg := range fset.Args() {
+		e, ok := byPath[arg]
+		if !ok {
+			if id, err := strconv.ParseUint(arg, 10, 64); err == nil {
+				e, ok = byID[id]
+			}
+		}
+		if !ok {
+			return fmt.Errorf("回收站中没有找到 %s (可通过 recycle list 查看)", arg)
+		}
+		selected = append(selected, e)
+	}
+
+	ids := make([]uint64, len(selected))
+	for i, e := range selected {
+		ids[i] = e.FsID
+	}
+	if err := adapter.RestoreFromRecycle(ids); err != nil {
+		return fmt.Errorf("还原失败: %w", err)
+	}
+	for _, e := range selected {
+		fmt.Printf("已还原: %s\n", e.RelPath)
+	}
+	fmt.Println("下一轮同步会把还原的文件当作云端新增的文件处理")
+	return nil
+}
+
+// recycleAdapter 回收站只有百度网盘后端支持
+func recycleAdapter(r *baidusync.Profile) (*baidu.Adapter, error) {
+	adapter, ok := r.Remote().(*baidu.Adapter)
+	if !ok {
+		return nil, fmt.Errorf("profile %s: 云端后端 %s 没有回收站", r.Name(), r.Remote().Type())
+	}
+	return adapter, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"baidusync/internal/config"
+	"baidusync/internal/fs"
+	syncer "baidusync/internal/sync"
+	"baidusync/pkg/baidusync"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// cmdRekey 更换加密密码: 把云端用旧密码加密的文件改为用配置中的 (新) 密码加密
+// 旧密码通过 -old-password 或环境变量 BAIDUSYNC_OLD_PASSWORD 提供
+func cmdRekey(cfg *config.Config, args []string) error {
+	fset := flag.NewFlagSet("rekey", flag.ExitOnError)
+	only := fset.String("profile", "", "只处理指定的 Profile")
+	oldPassword := fset.String("old-password", "", "云端文件当前使用的旧密码 (为空时读取环境变量 BAIDUSYNC_OLD_PASSWORD)")
+	fset.Parse(args)
+
+	if *oldPassword == "" {
+		*oldPassword = os.Getenv("BAIDUSYNC_OLD_PASSWORD")
+	}
+	if *oldPassword == "" {
+		return fmt.Errorf("用法: baidusync rekey [-profile 名称] -old-password 旧密码 (新密码写在配置文件的 crypto.password 中)")
+	}
+
+	app, err := baidusync.NewWithOptions(cfg, baidusync.Options{Profile: *only})
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	// 与同步一样锁定本地目录，保证更换期间没有同时运行的同步
+	if err := app.Lock(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, r := range app.Profiles() {
+		if !r.Config().Crypto.Enable {
+			fmt.Printf("[%s] 未开启加密，跳过\n", r.Name())
+			continue
+		}
+		old := config.CryptoConfig{Password: *oldPassword}
+		opts := syncer.RekeyOptions{OldKey: old.GetAESKey()}
+		if r.Config().Crypto.EncryptFilenames {
+			// 文件名同样用旧密钥加密，需要一个按旧密钥解析文件名的后端
+			oldFS := baidusync.NewRemoteProvider(cfg, r.Config(), r.Client(), opts.OldKey)
+			if skipper, ok := oldFS.(fs.HiddenSkipper); ok && r.Config().SkipHidden {
+				skipper.SetSkipHidden(true)
+			}
+			opts.OldRemoteFS = oldFS
+		}
+
+		result, err := r.Engine().Rekey(context.Background(), opts)
+		if opts.OldRemoteFS != nil {
+			if cerr := opts.OldRemoteFS.Close(); cerr != nil {
+				r.Logger().Warn("关闭云端文件系统失败", "err", cerr)
+			}
+		}
+		if result != nil {
+			fmt.Printf("[%s] 重新加密 %d 个，云端复制 %d 个，之前已完成 %d 个\n",
+				r.Name(), len(result.Rekeyed), len(result.Copied), len(result.Skipped))
+			if len(result.Unverified) > 0 {
+				fmt.Printf("  无法确认旧密码、没有改写的文件 %d 个\n", len(result.Unverified))
+			}
+			if result.Unreadable > 0 {
+				fmt.Printf("  旧密码无法解析文件名的路径 %d 个 (已更换过的文件，或不属于同步目录的文件)\n", result.Unreadable)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", r.Name(), err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d 个 Profile 更换密钥失败 (可以重新执行，已完成的文件会跳过): %v", len(errs), errs)
+	}
+	return nil
+}
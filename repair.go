@@ -0,0 +1,60 @@
+package main
+
+import (
+	"baidusync/internal/config"
+	syncer "baidusync/internal/sync"
+	"baidusync/pkg/baidusync"
+	"context"
+	"flag"
+	"fmt"
+)
+
+// cmdRepair 按指定基准重新同步校验不一致 (或手动指定) 的文件，并更新数据库基准
+func cmdRepair(cfg *config.Config, args []string) error {
+	fset := flag.NewFlagSet("repair", flag.ExitOnError)
+	sourceFlag := fset.String("source", "", "以哪一侧为准: local (重新上传) 或 remote (重新下载)，必填")
+	only := fset.String("profile", "", "只修复指定的 Profile")
+	fset.Parse(args)
+
+	source, err := syncer.ParseRepairSource(*sourceFlag)
+	if err != nil {
+		return err
+	}
+
+	// 手动指定路径时，路径只对应一个 Profile，避免误操作其他 Profile 的同名文件
+	paths := fset.Args()
+	if len(paths) > 0 && *only == "" && len(cfg.Profiles) > 1 {
+		return fmt.Errorf("配置了多个 Profile，指定路径时必须同时指定 -profile")
+	}
+
+	app, err := baidusync.NewWithOptions(cfg, baidusync.Options{Profile: *only})
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	if err := app.Lock(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, r := range app.Profiles() {
+		result, err := r.Engine().Repair(context.Background(), source, paths)
+		if result != nil {
+			fmt.Printf("[%s] 已修复 %d 个，跳过 %d 个\n", r.Name(), len(result.Repaired), len(result.Skipped))
+			for _, p := range result.Repaired {
+				fmt.Println("  已修复: " + p)
+			}
+			for _, p := range result.Skipped {
+				fmt.Println("  已跳过 (基准一侧不存在): " + p)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", r.Name(), err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d 个 Profile 修复失败: %v", len(errs), errs)
+	}
+	return nil
+}
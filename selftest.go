@@ -0,0 +1,74 @@
+package main
+
+import (
+	"baidusync/internal/config"
+	"baidusync/internal/crypto"
+	"crypto/rand"
+	"flag"
+	"fmt"
+)
+
+// selfTest 执行自检，测试中替换为返回失败结果的函数
+var selfTest = crypto.SelfTest
+
+// cmdCryptoSelfTest 用配置中的密钥 (没有开启加密时用随机密钥) 对随机数据与示例文件名做一遍加密、解密，
+// 在把真实数据交给加密之前确认密钥与密文格式没有问题；任何一项不一致时返回错误
+// 只在本机计算，不访问网盘，也不打开数据库
+func cmdCryptoSelfTest(cfg *config.Config, args []string) error {
+	fset := flag.NewFlagSet("crypto-selftest", flag.ExitOnError)
+	only := fset.String("profile", "", "只检查指定 Profile 的密钥")
+	fset.Parse(args)
+
+	// 按密钥去重: 多个 Profile 共用全局 crypto 配置时只检查一次
+	type target struct {
+		label string
+		key   []byte
+	}
+	var targets []target
+	seen := make(map[string]bool)
+	found := false
+	for _, p := range cfg.Profiles {
+		if *only != "" && p.Name != *only {
+			continue
+		}
+		found = true
+		if !p.Crypto.Enable {
+			continue
+		}
+		key := p.Crypto.GetAESKey()
+		if id := crypto.KeyID(key); !seen[id] {
+			seen[id] = true
+			targets = append(targets, target{label: fmt.Sprintf("[%s] 密钥 %s", p.Name, id), key: key})
+		}
+	}
+	if !found {
+		return fmt.Errorf("没有找到 Profile: %s", *only)
+	}
+	if len(targets) == 0 {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("生成随机密钥失败: %w", err)
+		}
+		targets = append(targets, target{label: "未开启加密，使用随机密钥", key: key})
+	}
+
+	total, failed := 0, 0
+	for _, t := range targets {
+		fmt.Println(t.label)
+		for _, r := range selfTest(t.key) {
+			total++
+			if r.Err != nil {
+				failed++
+				fmt.Printf("  FAIL  %s: %v\n", r.Name, r.Err)
+				continue
+			}
+			fmt.Printf("  PASS  %s\n", r.Name)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d / %d 项未通过，请不要在这个版本上开启加密", failed, total)
+	}
+	fmt.Printf("全部 %d 项通过\n", total)
+	return nil
+}
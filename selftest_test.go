@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"baidusync/internal/config"
+	"baidusync/internal/crypto"
+)
+
+// selfTestConfig 两个开启加密的 Profile 使用同一个密码，另一个没有开启加密
+func selfTestConfig() *config.Config {
+	enabled := &config.CryptoConfig{Enable: true, Password: "secret"}
+	return &config.Config{Profiles: []config.ProfileConfig{
+		{Name: "docs", Crypto: enabled},
+		{Name: "photos", Crypto: enabled},
+		{Name: "plain", Crypto: &config.CryptoConfig{}},
+	}}
+}
+
+// stubSelfTest 在测试期间替换自检，记录每次检查的密钥
+func stubSelfTest(t *testing.T, fn func(key []byte) []crypto.SelfTestResult) *[][]byte {
+	t.Helper()
+	var keys [][]byte
+	saved := selfTest
+	selfTest = func(key []byte) []crypto.SelfTestResult {
+		keys = append(keys, key)
+		return fn(key)
+	}
+	t.Cleanup(func() { selfTest = saved })
+	return &keys
+}
+
+func TestCryptoSelfTestPasses(t *testing.T) {
+	keys := stubSelfTest(t, crypto.SelfTest)
+	if err := cmdCryptoSelfTest(selfTestConfig(), nil); err != nil {
+		t.Fatal(err)
+	}
+	// 共用同一个密钥的 Profile 只检查一次
+	if len(*keys) != 1 {
+		t.Fatalf("检查了 %d 个密钥，应为 1 个", len(*keys))
+	}
+}
+
+func TestCryptoSelfTestFailure(t *testing.T) {
+	stubSelfTest(t, func(key []byte) []crypto.SelfTestResult {
+		return []crypto.SelfTestResult{
+			{Name: "内容 0 字节"},
+			{Name: "内容 17 字节", Err: errors.New("解密结果与原文不一致")},
+		}
+	})
+	err := cmdCryptoSelfTest(selfTestConfig(), nil)
+	if err == nil || !strings.Contains(err.Error(), "1 / 2 项未通过") {
+		t.Fatalf("错误为 %v，应报告 1 / 2 项未通过", err)
+	}
+}
+
+func TestCryptoSelfTestWithoutEncryption(t *testing.T) {
+	keys := stubSelfTest(t, crypto.SelfTest)
+	if err := cmdCryptoSelfTest(selfTestConfig(), []string{"-profile", "plain"}); err != nil {
+		t.Fatal(err)
+	}
+	// 没有开启加密时用随机密钥检查
+	if len(*keys) != 1 || len((*keys)[0]) != 32 {
+		t.Fatalf("检查的密钥为 %x，应为一个随机的 32 字节密钥", *keys)
+	}
+
+	if err := cmdCryptoSelfTest(selfTestConfig(), []string{"-profile", "missing"}); err == nil {
+		t.Fatal("不存在的 Profile 应返回错误")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"baidusync/internal/config"
+	"baidusync/internal/fs/baidu"
+	"baidusync/pkg/baidusync"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// cmdShare 为已同步的文件创建百度网盘分享链接
+// 参数为相对于同步目录的路径，开启文件名加密时自动换算为网盘中的加密路径
+func cmdShare(cfg *config.Config, args []string) error {
+	fset := flag.NewFlagSet("share", flag.ExitOnError)
+	only := fset.String("profile", "", "文件所属的 Profile (配置了多个 Profile 时必填)")
+	password := fset.String("password", "", "4 位提取码 (小写字母或数字)，为空时随机生成")
+	expire := fset.Duration("expire", 7*24*time.Hour, "有效期，向上取整到 1/7/30 天；0 或超过 30 天表示永久有效")
+	fset.Parse(args)
+
+	if fset.NArg() != 1 {
+		return fmt.Errorf("用法: baidusync share [-profile 名称] [-password 提取码] [-expire 有效期] <相对路径>")
+	}
+	if cfg.Remote.Type != config.RemoteTypeBaidu {
+		return fmt.Errorf("remote.type=%s 不支持分享", cfg.Remote.Type)
+	}
+	if *only == "" && len(cfg.Profiles) > 1 {
+		return fmt.Errorf("配置了多个 Profile，必须通过 -profile 指定文件所属的 Profile")
+	}
+
+	app, err := baidusync.NewWithOptions(cfg, baidusync.Options{Profile: *only})
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	r := app.Profiles()[0]
+	adapter, ok := r.Remote().(*baidu.Adapter)
+	if !ok {
+		return fmt.Errorf("profile %s: 云端后端 %s 不支持分享", r.Name(), r.Remote().Type())
+	}
+
+	relPath := fset.Arg(0)
+	link, err := adapter.Share(relPath, *password, *expire)
+	if errors.Is(err, baidu.ErrShareDisabled) {
+		return fmt.Errorf("无法分享 %s: 该文件被限制分享，或账号的分享功能已关闭", relPath)
+	}
+	if err != nil {
+		return fmt.Errorf("创建分享链接失败: %w", err)
+	}
+
+	validity := "永久有效"
+	if link.PeriodDays > 0 {
+		validity = fmt.Sprintf("%d 天", link.PeriodDays)
+	}
+	fmt.Printf("链接:   %s\n提取码: %s\n有效期: %s\n", link.URL, link.Password, validity)
+	if r.Config().Crypto.Enable {
+		fmt.Println("注意: 该 Profile 开启了加密，分享出去的是密文，对方需要同样的密码才能解密")
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"baidusync/internal/config"
+	syncer "baidusync/internal/sync"
+	"baidusync/pkg/baidusync"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// statusOrder 文本输出时各类任务的显示顺序与名称
+var statusOrder = []struct {
+	op    syncer.OpType
+	title string
+}{
+	{syncer.OpUpload, "待上传"},
+	{syncer.OpDownload, "待下载"},
+	{syncer.OpDeleteRemote, "待删除 (云端)"},
+	{syncer.OpDeleteLocal, "待删除 (本地)"},
+	{syncer.OpMoveRemote, "待移动 (云端)"},
+	{syncer.OpConflict, "冲突"},
+	{syncer.OpTypeClash, "文件/目录冲突"},
+	{syncer.OpMkdirRemote, "待建目录 (云端)"},
+	{syncer.OpMkdirLocal, "待建目录 (本地)"},
+	{syncer.OpRmdirRemote, "待删目录 (云端)"},
+	{syncer.OpRmdirLocal, "待删目录 (本地)"},
+}
+
+// statusGroup 同一类任务的汇总
+type statusGroup struct {
+	Count int      `json:"count"`
+	Bytes int64    `json:"bytes"`
+	Paths []string `json:"paths"`
+}
+
+// profileStatus 单个 Profile 的差异报告 (同时用于 --json 输出)
+type profileStatus struct {
+	Profile   string                  `json:"profile"`
+	LocalDir  string                  `json:"local_dir"`
+	RemoteDir string                  `json:"remote_dir"`
+	InSync    int                     `json:"in_sync"`
+	Rebuild   int                     `json:"rebuild_index"`
+	Orphans   int                     `json:"orphans"`
+	Pending   map[string]*statusGroup `json:"pending"`
+	// Oversized 超过 max_file_size、不会同步的路径
+	Oversized []string `json:"oversized,omitempty"`
+	// Unreadable 无法读取、本次未参与比对的路径
+	Unreadable []string `json:"unreadable,omitempty"`
+	// HeldDeletes 扫描不完整、本轮暂缓执行的删除 (按操作类型分组)
+	HeldDeletes map[string]*statusGroup `json:"held_deletes,omitempty"`
+	// TypeClashes 一侧是文件、另一侧是目录，按 type_clash: skip 不处理的路径
+	TypeClashes []string `json:"type_clashes,omitempty"`
+	// Quarantined 无法解密、按 quarantine_undecryptable 暂停下载的路径
+	Quarantined []string `json:"quarantined,omitempty"`
+	// GuardedUploads 云端文件比本地的新、按 protect_newer_remote: skip 不上传的路径
+	GuardedUploads []string `json:"guarded_uploads,omitempty"`
+	// Collisions 路径规范化后发生碰撞、需要手动重命名的路径
+	Collisions []syncer.Collision `json:"collisions,omitempty"`
+	// LastSuccess 最近一次完整且没有失败的同步的结束时间 (从未成功时为空)
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	// InterruptedRun 中途退出、尚未结束的同步的 Run ID (正在同步时也会显示)
+	InterruptedRun string `json:"interrupted_run_id,omitempty"`
+	// ClockSkew / ClockSkewAt 最近一次测量的时钟偏差 (云端时间 - 本机时间) 与测量时间 (未开启 clock_skew_threshold 时为空)
+	ClockSkew   string     `json:"clock_skew,omitempty"`
+	ClockSkewAt *time.Time `json:"clock_skew_at,omitempty"`
+}
+
+// cmdStatus 扫描两侧与数据库，按操作类型列出差异后退出
+// 只调用 Engine.Plan，不传输文件，也不写数据库
+func cmdStatus(cfg *config.Config, args []string) error {
+	fset := flag.NewFlagSet("status", flag.ExitOnError)
+	asJSON := fset.Bool("json", false, "以 JSON 格式输出")
+	only := fset.String("profile", "", "只查看指定的 Profile")
+	fset.Parse(args)
+
+	app, err := baidusync.NewWithOptions(cfg, baidusync.Options{Profile: *only})
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	var reports []*profileStatus
+	for _, r := range app.Profiles() {
+		plan, err := r.Engine().Plan(context.Background())
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", r.Name(), err)
+		}
+
+		report := &profileStatus{
+			Profile:   r.Name(),
+			LocalDir:  r.Config().LocalDir,
+			RemoteDir: r.Config().RemoteDir,
+			InSync:    plan.InSync,
+			Rebuild:   len(plan.Rebuilds),
+			Orphans:   len(plan.Orphans),
+			Pending:   make(map[string]*statusGroup),
+
+			Unreadable: plan.Unreadable,
+			Collisions: plan.Collisions,
+		}
+		stateDB, err := app.DB().Profile(r.Name())
+		if err != nil {
+			return err
+		}
+		cursor, err := stateDB.Cursor()
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", r.Name(), err)
+		}
+		if t := cursor.LastSuccessAsTime(); !t.IsZero() {
+			report.LastSuccess = &t
+		}
+		report.InterruptedRun = cursor.RunID
+		if skew, ok := cursor.ClockSkewAsDuration(); ok {
+			at := time.Unix(0, cursor.ClockSkewAt)
+			report.ClockSkew, report.ClockSkewAt = skew.String(), &at
+		}
+		groupTasks(report.Pending, plan.Tasks)
+		if len(plan.HeldDeletes) > 0 {
+			report.HeldDeletes = make(map[string]*statusGroup)
+			groupTasks(report.HeldDeletes, plan.HeldDeletes)
+		}
+		for _, t := range plan.Oversized {
+			report.Oversized = append(report.Oversized, t.RelPath)
+		}
+		sort.Strings(report.Oversized)
+		for _, t := range plan.TypeClashes {
+			report.TypeClashes = append(report.TypeClashes, t.RelPath)
+		}
+		sort.Strings(report.TypeClashes)
+		for _, t := range plan.Quarantined {
+			report.Quarantined = append(report.Quarantined, t.RelPath)
+		}
+		sort.Strings(report.Quarantined)
+		for _, t := range plan.GuardedUploads {
+			report.GuardedUploads = append(report.GuardedUploads, t.RelPath)
+		}
+		sort.Strings(report.GuardedUploads)
+		reports = append(reports, report)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+
+	for _, report := range reports {
+		printStatus(report)
+	}
+	return nil
+}
+
+// groupTasks 按操作类型汇总任务，每组的路径按字典序排列
+func groupTasks(groups map[string]*statusGroup, tasks []syncer.Task) {
+	for i := range tasks {
+		t := &tasks[i]
+		group, ok := groups[t.Op.String()]
+		if !ok {
+			group = &statusGroup{}
+			groups[t.Op.String()] = group
+		}
+		group.Count++
+		group.Bytes += t.Size()
+		group.Paths = append(group.Paths, t.RelPath)
+	}
+	for _, group := range groups {
+		sort.Strings(group.Paths)
+	}
+}
+
+// printStatus 以人类可读的格式输出差异报告
+func printStatus(report *profileStatus) {
+	fmt.Printf("[%s] 本地: %s  云端: %s\n", report.Profile, report.LocalDir, report.RemoteDir)
+	if report.LastSuccess != nil {
+		fmt.Printf("  最近一次成功同步: %s\n", report.LastSuccess.Format(time.DateTime))
+	} else {
+		fmt.Println("  最近一次成功同步: 无")
+	}
+	if report.InterruptedRun != "" {
+		fmt.Printf("  同步 %s 尚未结束 (正在进行或中途退出)，下一轮将跳过其中已完成的任务\n", report.InterruptedRun)
+	}
+	if report.ClockSkewAt != nil {
+		fmt.Printf("  时钟偏差: %s (云端 - 本机，测量于 %s)\n", report.ClockSkew, report.ClockSkewAt.Format(time.DateTime))
+	}
+
+	total := 0
+	for _, item := range statusOrder {
+		group, ok := report.Pending[item.op.String()]
+		if !ok {
+			continue
+		}
+		total += group.Count
+		fmt.Printf("  %-12s %6d 个  %s\n", item.title, group.Count, formatSize(group.Bytes))
+		for _, p := range group.Paths {
+			fmt.Printf("      %s\n", p)
+		}
+	}
+
+	fmt.Printf("  %-12s %6d 个\n", "已同步", report.InSync)
+	if report.Rebuild > 0 {
+		fmt.Printf("  %-12s %6d 个\n", "待重建索引", report.Rebuild)
+	}
+	if report.Orphans > 0 {
+		fmt.Printf("  %-12s %6d 个\n", "待清理记录", report.Orphans)
+	}
+	if len(report.Oversized) > 0 {
+		fmt.Printf("  %-12s %6d 个  (超过 max_file_size，不会同步)\n", "超过大小限制", len(report.Oversized))
+		for _, p := range report.Oversized {
+			fmt.Printf("      %s\n", p)
+		}
+	}
+	if len(report.Unreadable) > 0 {
+		fmt.Printf("  %-12s %6d 个  (没有权限等原因，跳过)\n", "无法读取", len(report.Unreadable))
+		for _, p := range report.Unreadable {
+			fmt.Printf("      %s\n", p)
+		}
+	}
+	for _, item := range statusOrder {
+		group, ok := report.HeldDeletes[item.op.String()]
+		if !ok {
+			continue
+		}
+		fmt.Printf("  %-12s %6d 个  (扫描不完整，本轮暂缓)\n", item.title, group.Count)
+		for _, p := range group.Paths {
+			fmt.Printf("      %s\n", p)
+		}
+	}
+	if len(report.TypeClashes) > 0 {
+		fmt.Printf("  %-12s %6d 个  (一侧是文件、另一侧是目录，需要手动处理或设置 type_clash)\n", "文件/目录冲突", len(report.TypeClashes))
+		for _, p := range report.TypeClashes {
+			fmt.Printf("      %s\n", p)
+		}
+	}
+	if len(report.Quarantined) > 0 {
+		fmt.Printf("  %-12s %6d 个  (无法解密，云端文件变化前不再下载)\n", "已隔离", len(report.Quarantined))
+		for _, p := range report.Quarantined {
+			fmt.Printf("      %s\n", p)
+		}
+	}
+	if len(report.GuardedUploads) > 0 {
+		fmt.Printf("  %-12s %6d 个  (云端比本地新，按 protect_newer_remote 不上传)\n", "云端较新", len(report.GuardedUploads))
+		for _, p := range report.GuardedUploads {
+			fmt.Printf("      %s\n", p)
+		}
+	}
+	if len(report.Collisions) > 0 {
+		fmt.Printf("  %-12s %6d 个  (需要手动重命名)\n", "路径碰撞", len(report.Collisions))
+		for _, c := range report.Collisions {
+			fmt.Printf("      %s\n", strings.Join(c.Paths, "  "))
+		}
+	}
+	if total == 0 {
+		fmt.Println("  两边已一致，没有待同步的文件")
+	}
+	fmt.Println()
+}
+
+// formatSize 将字节数格式化为 KB/MB/GB
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"baidusync/internal/config"
+	syncer "baidusync/internal/sync"
+	"baidusync/pkg/baidusync"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// profileVerify 单个 Profile 的校验报告 (同时用于 --json 输出)
+type profileVerify struct {
+	Profile string `json:"profile"`
+	*syncer.VerifyResult
+}
+
+// cmdVerify 校验数据库基准与两侧实际文件是否一致，只报告不修复
+// 发现不一致时返回错误，便于脚本通过退出码判断
+func cmdVerify(cfg *config.Config, args []string) error {
+	fset := flag.NewFlagSet("verify", flag.ExitOnError)
+	asJSON := fset.Bool("json", false, "以 JSON 格式输出")
+	only := fset.String("profile", "", "只校验指定的 Profile")
+	fset.Parse(args)
+
+	app, err := baidusync.NewWithOptions(cfg, baidusync.Options{Profile: *only})
+	if err != nil {
+		return err
+	}
+	defer app.Close()
+
+	var (
+		reports []profileVerify
+		drifted int
+	)
+	for _, r := range app.Profiles() {
+		result, err := r.Engine().Verify(context.Background())
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", r.Name(), err)
+		}
+		drifted += len(result.Drifts)
+		reports = append(reports, profileVerify{Profile: r.Name(), VerifyResult: result})
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	} else {
+		for _, report := range reports {
+			printVerify(report)
+		}
+	}
+
+	if drifted > 0 {
+		return fmt.Errorf("发现 %d 处不一致", drifted)
+	}
+	return nil
+}
+
+// printVerify 以人类可读的格式输出校验报告
+func printVerify(report profileVerify) {
+	fmt.Printf("[%s] 已校验 %d 个文件，本地不一致 %d 个，云端不一致 %d 个\n",
+		report.Profile, report.Checked,
+		report.Count(syncer.DriftLocal), report.Count(syncer.DriftRemote))
+
+	for _, d := range report.Drifts {
+		side := "本地"
+		if d.Side == syncer.DriftRemote {
+			side = "云端"
+		}
+		switch {
+		case d.Err != "":
+			fmt.Printf("  [%s] %s  读取失败: %s\n", side, d.RelPath, d.Err)
+		case d.Missing:
+			fmt.Printf("  [%s] %s  文件不存在\n", side, d.RelPath)
+		default:
+			fmt.Printf("  [%s] %s  期望 %s，实际 %s\n", side, d.RelPath, d.Expected, d.Actual)
+		}
+	}
+	fmt.Println()
+}